@@ -0,0 +1,199 @@
+package peggysue
+
+import "strings"
+
+// BacktrackRisks statically analyzes the rules reachable from root for
+// patterns that make the parser backtrack more than it needs to, or that
+// can't match at all, and suggests how to rewrite them. It reports:
+//
+//   - Ordered choices whose alternatives begin with the same rules, such as
+//     Or(Seq(args, S(";")), Seq(args, S("{"))), when the shared rules match
+//     an unbounded amount of input or more than one rule. The shared rules
+//     are matched again for each alternative, unless they are memoized.
+//   - A repetition followed by a rule that it would match, such as
+//     Seq(Star(Any()), S(";")). The repetition consumes the input the rule
+//     needs, so the sequence can never match.
+//
+// Unlike Lint, the first kind of report is not a mistake, only a cost,
+// which a grammar may choose to pay for readability.
+func BacktrackRisks(root Rule) []Warning {
+	l := &linter{
+		seen:     make(map[Rule]bool),
+		visiting: make(map[Rule]bool),
+	}
+
+	l.walkRisks(root, "")
+
+	return l.warnings
+}
+
+// BacktrackRisks validates the grammar and then runs BacktrackRisks on its
+// root rule.
+func (g *Grammar) BacktrackRisks() ([]Warning, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	return BacktrackRisks(g.labels.refs[g.root]), nil
+}
+
+func (l *linter) walkRisks(r Rule, def string) {
+	r = unchain(r)
+
+	if r == nil || l.seen[r] {
+		return
+	}
+
+	l.seen[r] = true
+
+	if name := r.Name(); name != "" {
+		def = name
+	}
+
+	l.checkSharedPrefix(def, alternatives(r))
+
+	switch r.(type) {
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		l.checkGreedy(def, subRules(r))
+	}
+
+	for _, sub := range subRules(r) {
+		l.walkRisks(sub, def)
+	}
+}
+
+// checkSharedPrefix reports each pair of alternatives that begin with the
+// same costly rules.
+func (l *linter) checkSharedPrefix(def string, alts []Rule) {
+	for i, a := range alts {
+		pa := seqParts(a)
+
+		for _, b := range alts[i+1:] {
+			pb := seqParts(b)
+
+			n := 0
+			for n < len(pa) && n < len(pb) && sameRule(pa[n], pb[n]) {
+				n++
+			}
+
+			if n == 0 || !costlyPrefix(pa[:n]) {
+				continue
+			}
+
+			shared := printParts(pa[:n])
+
+			l.warnings = append(l.warnings, Warning{
+				Rule:    def,
+				Message: "alternatives " + Print(a) + " and " + Print(b) + " both match " + shared + " before they differ",
+				Suggestion: "factor out the shared rules, as Seq(" + shared + ", Or(...)), " +
+					"or memoize them with Memo or a Ref",
+			})
+		}
+	}
+}
+
+// costlyPrefix reports whether matching the rules again is costly: they
+// aren't all memoized, and they match more than one rule or an unbounded
+// amount of input.
+func costlyPrefix(parts []Rule) bool {
+	memoized := true
+
+	for _, p := range parts {
+		if _, ok := unchain(p).(*matchRef); !ok {
+			memoized = false
+		}
+	}
+
+	if memoized {
+		return false
+	}
+
+	if len(parts) > 1 {
+		return true
+	}
+
+	return unbounded(parts[0], make(map[Rule]bool))
+}
+
+// checkGreedy reports a repetition followed by a rule that the repeated
+// rule matches first.
+func (l *linter) checkGreedy(def string, parts []Rule) {
+	for i := 0; i+1 < len(parts); i++ {
+		rep := repeated(parts[i])
+		if rep == nil {
+			continue
+		}
+
+		next := parts[i+1]
+
+		if !l.shadows(rep, next) {
+			continue
+		}
+
+		l.warnings = append(l.warnings, Warning{
+			Rule:    def,
+			Message: Print(next) + " never matches after " + Print(parts[i]) + ", which consumes the input it would match",
+			Suggestion: "stop the repetition before it, as (" +
+				Print(Not(next)) + " " + Print(rep) + ")* " + Print(next),
+		})
+	}
+}
+
+// repeated returns the rule that r repeats without a limit, or nil if r is
+// not such a repetition.
+func repeated(r Rule) Rule {
+	switch m := unchain(r).(type) {
+	case *matchZeroOrMore:
+		return m.rule
+	case *matchOneOrMore:
+		return m.rule
+	case *matchMany:
+		if m.max < 0 {
+			return m.rule
+		}
+	}
+
+	return nil
+}
+
+// seqParts returns the rules that r matches in order, looking through
+// rules such as Action that don't change what is matched. Refs are not
+// looked through, since they are memoized.
+func seqParts(r Rule) []Rule {
+	r = unchain(r)
+
+	for {
+		if _, ok := r.(*matchRef); ok {
+			break
+		}
+
+		sub := inner(r)
+		if sub == nil {
+			break
+		}
+
+		r = unchain(sub)
+	}
+
+	switch r.(type) {
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		return subRules(r)
+	default:
+		return []Rule{r}
+	}
+}
+
+// sameRule reports whether a and b match the same input, either because
+// they are the same rule or were built the same way.
+func sameRule(a, b Rule) bool {
+	return unchain(a) == unchain(b) || Print(a) == Print(b)
+}
+
+func printParts(parts []Rule) string {
+	strs := make([]string, len(parts))
+	for i, p := range parts {
+		strs[i] = Print(p)
+	}
+
+	return strings.Join(strs, " ")
+}
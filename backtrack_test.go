@@ -0,0 +1,72 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBacktrackRisks(t *testing.T) {
+	t.Run("reports alternatives with a costly shared prefix", func(t *testing.T) {
+		r := require.New(t)
+
+		args := SepBy(Range('a', 'z'), S(","))
+		call := N("call", Or(
+			Seq(args, S(";")),
+			Seq(args, S("{")),
+		))
+
+		warnings := BacktrackRisks(call)
+		r.Len(warnings, 1)
+		r.Equal("call", warnings[0].Rule)
+		r.Equal(`alternatives `+Print(Seq(args, S(";")))+` and `+Print(Seq(args, S("{")))+` both match `+Print(args)+` before they differ`, warnings[0].Message)
+		r.Contains(warnings[0].Suggestion, "factor out the shared rules")
+		r.Contains(warnings[0].String(), "; factor out")
+	})
+
+	t.Run("compares rules built the same way", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := Or(
+			Seq(S("let"), Plus(Range('a', 'z')), S("=")),
+			Seq(S("let"), Plus(Range('a', 'z')), S(":")),
+		)
+
+		warnings := BacktrackRisks(rule)
+		r.Len(warnings, 1)
+		r.Contains(warnings[0].Message, `both match "let" [a-z]+ before they differ`)
+	})
+
+	t.Run("accepts memoized or short shared prefixes", func(t *testing.T) {
+		r := require.New(t)
+
+		args := R("args")
+		args.Set(SepBy(Range('a', 'z'), S(",")))
+
+		r.Empty(BacktrackRisks(Or(Seq(args, S(";")), Seq(args, S("{")))))
+		r.Empty(BacktrackRisks(Or(Seq(S("a"), S("b")), Seq(S("a"), S("c")))))
+	})
+
+	t.Run("reports a repetition that consumes what follows", func(t *testing.T) {
+		r := require.New(t)
+
+		stmt := N("stmt", Seq(Star(Any()), S(";")))
+
+		warnings := BacktrackRisks(stmt)
+		r.Len(warnings, 1)
+		r.Equal("stmt", warnings[0].Rule)
+		r.Equal(`";" never matches after .*, which consumes the input it would match`, warnings[0].Message)
+		r.Equal(`stop the repetition before it, as (!";" .)* ";"`, warnings[0].Suggestion)
+
+		_, ok, err := New().Parse(Seq(Star(Seq(Not(S(";")), Any())), S(";")), "ab;")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("accepts a repetition that stops before what follows", func(t *testing.T) {
+		r := require.New(t)
+
+		r.Empty(BacktrackRisks(Seq(Star(Range('a', 'z')), S(";"))))
+		r.Empty(BacktrackRisks(Seq(Many(S("a"), 0, 2, nil), S("a"))))
+	})
+}
@@ -0,0 +1,63 @@
+package peggysue
+
+import "sort"
+
+// Binding is a value bound by Named, or captured by Capture, while parsing
+// with WithBindings. Captures have an empty Name.
+type Binding struct {
+	Name  string
+	Span  Span
+	Value interface{}
+}
+
+// WithBindings records every value bound by Named or captured by Capture in
+// the input that the rule matched, and returns them as the Bindings of the
+// ParseResult returned by Run. This gives tools such as highlighters and
+// extractors structured data from a grammar, without threading Actions
+// through it. Values bound within alternatives that were later abandoned are
+// not included.
+func WithBindings(on bool) Option {
+	return func(p *Parser) {
+		p.bindings = on
+	}
+}
+
+// recordBinding records the value bound to name from the input from start to
+// the current position.
+func (s *state) recordBinding(name string, start int, val interface{}) {
+	s.spans = &spanList{start: start, end: s.pos, rule: name, node: val, binding: true, prev: s.spans}
+}
+
+// sortedBindings returns the recorded bindings in the order they appear in
+// the input, with bindings before the bindings they contain.
+func (s *state) sortedBindings() []Binding {
+	var spans []*spanList
+
+	for sl := s.spans; sl != nil; sl = sl.prev {
+		if sl.binding {
+			spans = append(spans, sl)
+		}
+	}
+
+	// As in sortedSpans, the list is in reverse order of the bindings
+	// finishing, which puts a Named before the Capture it binds.
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+
+		return spans[i].end > spans[j].end
+	})
+
+	bindings := make([]Binding, len(spans))
+
+	for i, sl := range spans {
+		bindings[i] = Binding{
+			Name:  sl.rule,
+			Span:  Span{Start: s.position(sl.start), End: s.position(sl.end)},
+			Value: sl.node,
+		}
+	}
+
+	return bindings
+}
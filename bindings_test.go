@@ -0,0 +1,82 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindings(t *testing.T) {
+	type binding struct {
+		name       string
+		start, end int
+		value      interface{}
+	}
+
+	simplify := func(bs []Binding) []binding {
+		var out []binding
+		for _, b := range bs {
+			out = append(out, binding{b.Name, b.Span.Start.Offset, b.Span.End.Offset, b.Value})
+		}
+		return out
+	}
+
+	ident := Capture(Plus(Range('a', 'z')))
+
+	t.Run("records named values and captures", func(t *testing.T) {
+		r := require.New(t)
+
+		assign := Seq(Named("lhs", ident), S("="), Named("rhs", Plus(Range('0', '9'))))
+
+		res := New(WithBindings(true)).Run(assign, "x=42")
+		r.NoError(res.Err())
+
+		r.Equal([]binding{
+			{"lhs", 0, 1, "x"},
+			{"", 0, 1, "x"},
+			{"rhs", 2, 4, nil},
+		}, simplify(res.Bindings))
+	})
+
+	t.Run("skips abandoned alternatives", func(t *testing.T) {
+		r := require.New(t)
+
+		call := Seq(Named("fn", ident), S("()"))
+		field := Seq(Named("obj", ident), S("."), Named("field", ident))
+
+		res := New(WithBindings(true)).Run(Or(call, field), "a.b")
+		r.NoError(res.Err())
+
+		var names []string
+		for _, b := range res.Bindings {
+			if b.Name != "" {
+				names = append(names, b.Name)
+			}
+		}
+
+		r.Equal([]string{"obj", "field"}, names)
+	})
+
+	t.Run("records bindings within memoized refs", func(t *testing.T) {
+		r := require.New(t)
+
+		word := R("word")
+		word.Set(Named("w", ident))
+
+		rule := Or(Seq(word, S("!")), Seq(word, S("?")))
+
+		res := New(WithBindings(true)).Run(rule, "hi?")
+		r.NoError(res.Err())
+
+		r.Equal([]binding{
+			{"w", 0, 2, "hi"},
+			{"", 0, 2, "hi"},
+		}, simplify(res.Bindings))
+	})
+
+	t.Run("is off by default", func(t *testing.T) {
+		res := New().Run(Named("x", ident), "abc")
+		require.NoError(t, res.Err())
+		require.Nil(t, res.Bindings)
+	})
+}
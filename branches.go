@@ -0,0 +1,149 @@
+package peggysue
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// BranchSet edits the branches of a rule created by Branches, so that a
+// grammar defined in one package can be extended by another, such as by
+// adding a new form of statement, without rebuilding the whole list of
+// alternatives. It is obtained with BranchesOf.
+//
+// The branches must be edited before the rule is first used to parse, since
+// the left recursion of the grammar is analyzed then and depends on them.
+type BranchSet struct {
+	mb *matchBranch
+}
+
+// BranchesOf returns the branches of r, which must be the rule returned by
+// Branches.
+func BranchesOf(r Rule) (*BranchSet, error) {
+	ref, ok := unchain(r).(*matchRef)
+	if !ok {
+		return nil, fmt.Errorf("%s was not created by Branches", Print(r))
+	}
+
+	mb := findBranches(ref)
+	if mb == nil {
+		return nil, fmt.Errorf("%s was not created by Branches", ref.name)
+	}
+
+	return &BranchSet{mb: mb}, nil
+}
+
+// findBranches returns the matchBranch that ref was created for. It is the
+// ref's rule, or when the Branches has precedence levels, the operand of the
+// highest level.
+func findBranches(ref *matchRef) *matchBranch {
+	seen := map[Rule]bool{}
+
+	var visit func(r Rule) *matchBranch
+
+	visit = func(r Rule) *matchBranch {
+		r = unchain(r)
+
+		if r == nil || seen[r] {
+			return nil
+		}
+
+		seen[r] = true
+
+		if mb, ok := r.(*matchBranch); ok {
+			if mb.ref == Ref(ref) {
+				return mb
+			}
+
+			return nil
+		}
+
+		for _, sub := range subRules(r) {
+			if mb := visit(sub); mb != nil {
+				return mb
+			}
+		}
+
+		return nil
+	}
+
+	return visit(ref.rule)
+}
+
+// Names returns the names of the branches, in the order they are tried.
+func (b *BranchSet) Names() []string {
+	names := make([]string, len(b.mb.rules))
+	for i, br := range b.mb.rules {
+		names[i] = strings.TrimPrefix(br.name, "+")
+	}
+
+	return names
+}
+
+// Get returns the rule of the named branch, or nil if there is none.
+func (b *BranchSet) Get(name string) Rule {
+	if i := b.index(name); i >= 0 {
+		return b.mb.rules[i].r
+	}
+
+	return nil
+}
+
+// Replace replaces the rule of the named branch, keeping its position and
+// associativity.
+func (b *BranchSet) Replace(name string, r Rule) error {
+	if err := b.editable(); err != nil {
+		return err
+	}
+
+	i := b.index(name)
+	if i < 0 {
+		return fmt.Errorf("no branch named %s in %s", name, b.mb.ref.Name())
+	}
+
+	b.mb.rules[i].r = r
+
+	return nil
+}
+
+// InsertBefore adds a branch named name before the branch named before, so
+// that it is tried first.
+func (b *BranchSet) InsertBefore(before, name string, r Rule) error {
+	if err := b.editable(); err != nil {
+		return err
+	}
+
+	if b.index(name) >= 0 {
+		return fmt.Errorf("branch %s already exists in %s", name, b.mb.ref.Name())
+	}
+
+	i := b.index(before)
+	if i < 0 {
+		return fmt.Errorf("no branch named %s in %s", before, b.mb.ref.Name())
+	}
+
+	rules := append([]branch(nil), b.mb.rules[:i]...)
+	rules = append(rules, branch{name: "+" + name, r: r})
+	b.mb.rules = append(rules, b.mb.rules[i:]...)
+
+	return nil
+}
+
+func (b *BranchSet) index(name string) int {
+	for i, br := range b.mb.rules {
+		if br.name == "+"+name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// editable returns an error if the branches have already been used to parse.
+func (b *BranchSet) editable() error {
+	if ref, ok := b.mb.ref.(*matchRef); ok && atomic.LoadUint32(&ref.analyzed) == 1 {
+		return fmt.Errorf("can not edit the branches of %s after it has been used to parse", ref.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranchesOf(t *testing.T) {
+	stmt := func() Rule {
+		return Branches("stmt", func(bb BranchesBuilder, r Rule) {
+			bb.Add("if", Seq(S("if "), Capture(Re("[a-z]+"))))
+			bb.Add("expr", Capture(Re("[a-z]+")))
+		})
+	}
+
+	t.Run("lists and gets branches", func(t *testing.T) {
+		r := require.New(t)
+
+		bs, err := BranchesOf(stmt())
+		r.NoError(err)
+
+		r.Equal([]string{"if", "expr"}, bs.Names())
+		r.NotNil(bs.Get("if"))
+		r.Nil(bs.Get("while"))
+	})
+
+	t.Run("inserts a branch before another", func(t *testing.T) {
+		r := require.New(t)
+
+		s := stmt()
+
+		bs, err := BranchesOf(s)
+		r.NoError(err)
+
+		r.NoError(bs.InsertBefore("expr", "while", Seq(S("while "), Capture(Re("[a-z]+")))))
+		r.Equal([]string{"if", "while", "expr"}, bs.Names())
+
+		v, ok, err := New().Parse(s, "while x")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("x", v)
+
+		r.Error(bs.InsertBefore("expr", "if", S("if")))
+		r.Error(bs.InsertBefore("for", "loop", S("loop")))
+	})
+
+	t.Run("replaces a branch", func(t *testing.T) {
+		r := require.New(t)
+
+		s := stmt()
+
+		bs, err := BranchesOf(s)
+		r.NoError(err)
+
+		r.NoError(bs.Replace("expr", Capture(Re("[0-9]+"))))
+		r.Error(bs.Replace("while", S("while")))
+
+		v, ok, err := New().Parse(s, "42")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("42", v)
+
+		r.Error(bs.Replace("expr", Capture(Re("[a-z]+"))))
+	})
+
+	t.Run("with precedence levels", func(t *testing.T) {
+		r := require.New(t)
+
+		e := Branches("e", func(bb BranchesBuilder, e Rule) {
+			bb.AddLevel(1, AssocLeft, Capture(S("+")))
+			bb.Add("n", Capture(Re("[0-9]+")))
+		})
+
+		bs, err := BranchesOf(e)
+		r.NoError(err)
+
+		r.NoError(bs.InsertBefore("n", "ident", Capture(Re("[a-z]+"))))
+
+		v, ok, err := New().Parse(e, "x+1")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(BinaryOp{LHS: "x", Op: "+", RHS: "1"}, v)
+	})
+
+	t.Run("rejects other rules", func(t *testing.T) {
+		_, err := BranchesOf(R("x"))
+		require.Error(t, err)
+
+		_, err = BranchesOf(S("x"))
+		require.Error(t, err)
+	})
+}
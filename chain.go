@@ -0,0 +1,90 @@
+package peggysue
+
+// Chain wraps a Rule to provide methods for building rules fluently, as an
+// alternative to nesting function calls. For example:
+//
+//	C(ident).Named("name").Then(S("="), value).Action(fn)
+//
+// is the same as:
+//
+//	Action(Seq(Named("name", ident), S("="), value), fn)
+//
+// A Chain is itself a Rule, so it can be used anywhere a Rule can.
+type Chain struct {
+	Rule
+}
+
+// C returns a Chain for the given rule.
+func C(r Rule) Chain {
+	return Chain{unchain(r)}
+}
+
+// unchain returns the rule wrapped by a Chain, so that rules can inspect
+// the rule itself.
+func unchain(r Rule) Rule {
+	if c, ok := r.(Chain); ok {
+		return c.Rule
+	}
+
+	return r
+}
+
+func (c Chain) detectLeftRec(r Rule, rs ruleSet) bool {
+	return c.Rule == r || c.Rule.detectLeftRec(r, rs)
+}
+
+func unchainAll(rules []Rule) []Rule {
+	out := make([]Rule, len(rules))
+
+	for i, r := range rules {
+		out[i] = unchain(r)
+	}
+
+	return out
+}
+
+// Then matches the rule followed by the given rules, like Seq.
+func (c Chain) Then(rules ...Rule) Chain {
+	return C(Seq(append([]Rule{c.Rule}, unchainAll(rules)...)...))
+}
+
+// Or matches the rule or, if it does not match, the given rules in order,
+// like Or.
+func (c Chain) Or(rules ...Rule) Chain {
+	return C(Or(append([]Rule{c.Rule}, unchainAll(rules)...)...))
+}
+
+// Star matches the rule zero or more times, like Star.
+func (c Chain) Star() Chain {
+	return C(Star(c.Rule))
+}
+
+// Plus matches the rule one or more times, like Plus.
+func (c Chain) Plus() Chain {
+	return C(Plus(c.Rule))
+}
+
+// Maybe matches the rule zero or one times, like Maybe.
+func (c Chain) Maybe() Chain {
+	return C(Maybe(c.Rule))
+}
+
+// Named names the value of the rule, like Named.
+func (c Chain) Named(name string) Chain {
+	return C(Named(name, c.Rule))
+}
+
+// Capture uses the matched input as the value of the rule, like Capture.
+func (c Chain) Capture() Chain {
+	return C(Capture(c.Rule))
+}
+
+// Action calls fn when the rule matches, like Action.
+func (c Chain) Action(fn func(Values) interface{}) Chain {
+	return C(Action(c.Rule, fn))
+}
+
+// Transform calls fn with the matched input, like Transform.
+func (c Chain) Transform(fn func(string) interface{}) Chain {
+	return C(Transform(c.Rule, fn))
+}
@@ -0,0 +1,56 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	t.Run("builds rules fluently", func(t *testing.T) {
+		r := require.New(t)
+
+		ident := C(Range('a', 'z')).Plus().Capture()
+		num := C(Range('0', '9')).Plus().Transform(func(s string) interface{} {
+			return len(s)
+		})
+
+		assign := ident.Named("name").
+			Then(S("="), C(num).Or(ident).Named("value"), C(S(";")).Maybe()).
+			Action(func(v Values) interface{} {
+				return []interface{}{v.Get("name"), v.Get("value")}
+			})
+
+		r.Equal(Print(Seq(Named("name", Capture(Plus(Range('a', 'z')))), S("="))), Print(ident.Named("name").Then(S("="))))
+
+		val, ok, err := New().Parse(assign, "abc=123;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"abc", 3}, val)
+
+		val, ok, err = New().Parse(assign, "abc=def")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"abc", "def"}, val)
+
+		list := Collect(C(assign).Star())
+
+		val, ok, err = New().Parse(list, "a=1b=22")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{[]interface{}{"a", 1}, []interface{}{"b", 2}}, val)
+	})
+
+	t.Run("detects left recursion through a chain", func(t *testing.T) {
+		r := require.New(t)
+
+		e := R("e")
+		e.Set(C(e).Then(S("+"), S("1")).Or(S("1")))
+
+		r.True(e.LeftRecursive())
+
+		_, ok, err := New().Parse(e, "1+1+1")
+		r.NoError(err)
+		r.True(ok)
+	})
+}
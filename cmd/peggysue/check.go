@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lab47/peggysue/dsl"
+)
+
+func checkCmd(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the diagnostics as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: peggysue check [-json] grammar.peg")
+	}
+
+	path := fs.Arg(0)
+
+	f, err := dsl.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	diags := dsl.Check(f)
+
+	if *asJSON {
+		if diags == nil {
+			diags = []dsl.Diagnostic{}
+		}
+
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(diags); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Fprintf(stdout, "%s:%s\n", path, d)
+		}
+	}
+
+	var errs int
+
+	for _, d := range diags {
+		if d.Severity == dsl.SeverityError {
+			errs++
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%d errors", errs)
+	}
+
+	return nil
+}
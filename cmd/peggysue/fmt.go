@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lab47/peggysue/dsl"
+)
+
+func fmtCmd(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := fs.Bool("w", false, "write the result to the file instead of stdout")
+	list := fs.Bool("l", false, "list files whose formatting differs")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		if *write || *list {
+			return errors.New("-w and -l require file arguments")
+		}
+
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+
+		out, err := formatGrammar("<stdin>", string(data))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(stdout, out)
+		return err
+	}
+
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		out, err := formatGrammar(path, string(data))
+		if err != nil {
+			return err
+		}
+
+		if *list && out != string(data) {
+			fmt.Fprintln(stdout, path)
+		}
+
+		if *write {
+			if out != string(data) {
+				if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+					return err
+				}
+			}
+		} else if !*list {
+			if _, err := io.WriteString(stdout, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatGrammar(filename, src string) (string, error) {
+	f, err := dsl.Parse(filename, src)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := dsl.FormatFile(f)
+	if err != nil {
+		return "", fmt.Errorf("%s:%w", filename, err)
+	}
+
+	return out, nil
+}
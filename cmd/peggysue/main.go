@@ -0,0 +1,82 @@
+// Command peggysue works with grammars written in the textual format of the
+// dsl package, so grammars can be developed without writing a Go harness.
+//
+// Usage:
+//
+//	peggysue run [-format sexp|json] [-partial] grammar.peg [input]
+//	peggysue check [-json] grammar.peg
+//	peggysue fmt [-w] [-l] [grammar.peg ...]
+//	peggysue trace [-o report.html] [-partial] grammar.peg [input]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"check": {
+		usage: "report problems with a grammar",
+		run:   checkCmd,
+	},
+	"fmt": {
+		usage: "format grammars canonically",
+		run:   fmtCmd,
+	},
+	"run": {
+		usage: "parse input with a grammar and print the syntax tree",
+		run:   runCmd,
+	},
+	"trace": {
+		usage: "write an HTML report tracing a parse",
+		run:   traceCmd,
+	},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "peggysue: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	if err := cmd.run(args[1:], stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "peggysue %s: %s\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: peggysue <command> [arguments]\n\ncommands:\n")
+
+	var names []string
+
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
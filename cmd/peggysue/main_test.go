@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeGrammar(t *testing.T, src string) string {
+	path := filepath.Join(t.TempDir(), "test.peg")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	grammar := writeGrammar(t, `
+sum <- num ('+' num)*
+num <- [0-9]+
+`)
+
+	t.Run("prints the tree as an s-expression", func(t *testing.T) {
+		r := require.New(t)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"run", grammar}, strings.NewReader("1+23"), &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+		r.Equal("(sum\n  (num \"1\")\n  ('+' \"+\")\n  (num \"23\"))\n", stdout.String())
+	})
+
+	t.Run("prints the tree as JSON", func(t *testing.T) {
+		r := require.New(t)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"run", "-format", "json", grammar}, strings.NewReader("7"), &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+		r.JSONEq(`{"rule": "sum", "start": 0, "end": 1, "line": 1, "children": [
+			{"rule": "num", "start": 0, "end": 1, "line": 1, "text": "7"}
+		]}`, stdout.String())
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		r := require.New(t)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"run", grammar}, strings.NewReader("1+x"), &stdout, &stderr)
+		r.Equal(1, code)
+		r.Contains(stderr.String(), "<stdin>:1:3: full input not consumed")
+
+		code = run([]string{"nope"}, nil, &stdout, &stderr)
+		r.Equal(2, code)
+	})
+}
+
+func TestCheck(t *testing.T) {
+	grammar := writeGrammar(t, `
+list <- item* !.
+item <- 'a'? / 'b'
+`)
+
+	t.Run("prints diagnostics", func(t *testing.T) {
+		r := require.New(t)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"check", grammar}, nil, &stdout, &stderr)
+		r.Equal(1, code)
+		r.Equal(
+			grammar+":2: error: list: item* repeats an expression that can match without consuming input\n"+
+				grammar+":3: warning: item: alternatives after 'a'? are unreachable because it always matches\n",
+			stdout.String())
+		r.Contains(stderr.String(), "1 errors")
+	})
+
+	t.Run("prints diagnostics as JSON", func(t *testing.T) {
+		r := require.New(t)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"check", "-json", grammar}, nil, &stdout, &stderr)
+		r.Equal(1, code)
+		r.JSONEq(`[
+			{"severity": "error", "rule": "list", "line": 2, "message": "item* repeats an expression that can match without consuming input"},
+			{"severity": "warning", "rule": "item", "line": 3, "message": "alternatives after 'a'? are unreachable because it always matches"}
+		]`, stdout.String())
+
+		clean := writeGrammar(t, "a <- 'a'\n")
+
+		stdout.Reset()
+		code = run([]string{"check", "-json", clean}, nil, &stdout, &stderr)
+		r.Equal(0, code)
+		r.JSONEq(`[]`, stdout.String())
+	})
+}
+
+func TestFmt(t *testing.T) {
+	t.Run("formats grammars", func(t *testing.T) {
+		r := require.New(t)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"fmt"}, strings.NewReader("a<-b  / 'c'\nb<-'x'"), &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+		r.Equal("a <- b / 'c'\n\nb <- 'x'\n", stdout.String())
+
+		grammar := writeGrammar(t, "a<-'a'\n")
+
+		stdout.Reset()
+		code = run([]string{"fmt", "-l", "-w", grammar}, nil, &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+		r.Equal(grammar+"\n", stdout.String())
+
+		data, err := os.ReadFile(grammar)
+		r.NoError(err)
+		r.Equal("a <- 'a'\n", string(data))
+
+		stdout.Reset()
+		code = run([]string{"fmt", "-l", grammar}, nil, &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+		r.Empty(stdout.String())
+	})
+
+	t.Run("keeps the comments within definitions", func(t *testing.T) {
+		r := require.New(t)
+
+		grammar := writeGrammar(t, "a <- 'x' # trailing\n  # inner\n  / 'y'\n")
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"fmt", "-w", grammar}, nil, &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+
+		data, err := os.ReadFile(grammar)
+		r.NoError(err)
+		r.Equal("a <- 'x' # trailing\n     # inner\n   / 'y'\n", string(data))
+	})
+}
+
+func TestTrace(t *testing.T) {
+	t.Run("writes an HTML report", func(t *testing.T) {
+		r := require.New(t)
+
+		grammar := writeGrammar(t, `
+sum <- num '+' num / num
+num <- [0-9]+
+`)
+
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"trace", grammar}, strings.NewReader("12"), &stdout, &stderr)
+		r.Equal(0, code, stderr.String())
+
+		out := stdout.String()
+		r.Contains(out, "The input matched.")
+		r.Contains(out, `<td>num</td><td>2</td><td>2</td><td>1</td>`)
+		r.Contains(out, `<summary class="match">num 1:1 matched &#34;12&#34;</summary>`)
+		r.Contains(out, `<summary class="memo">num 1:1 matched &#34;12&#34; (memoized)</summary>`)
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/dsl"
+)
+
+func runCmd(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	format := fs.String("format", "sexp", "output format, sexp or json")
+	partial := fs.Bool("partial", false, "allow the grammar to match a prefix of the input")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: peggysue run [-format sexp|json] [-partial] grammar.peg [input]")
+	}
+
+	if *format != "sexp" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	filename, input, err := readInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+
+	f, err := dsl.ParseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	g, err := dsl.Compile(f, peggysue.WithFilename(filename), peggysue.WithPartial(*partial))
+	if err != nil {
+		return err
+	}
+
+	val, ok, err := g.Parse(input)
+	if err != nil {
+		var nc *peggysue.ErrInputNotConsumed
+		if errors.As(err, &nc) {
+			return fmt.Errorf("%s: %w", nc.Pos, err)
+		}
+
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("%s: input does not match %s", filename, f.Defs[0].Name)
+	}
+
+	n := val.(*dsl.Node)
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(toJSON(n, input))
+	}
+
+	var sb strings.Builder
+	writeSexp(&sb, n, input, 0)
+	sb.WriteByte('\n')
+
+	_, err = io.WriteString(stdout, sb.String())
+	return err
+}
+
+// readInput returns the name and contents of the input file given as the
+// second argument, or stdin if there is none.
+func readInput(fs *flag.FlagSet, stdin io.Reader) (string, string, error) {
+	if fs.NArg() == 2 {
+		data, err := os.ReadFile(fs.Arg(1))
+		return fs.Arg(1), string(data), err
+	}
+
+	data, err := io.ReadAll(stdin)
+	return "<stdin>", string(data), err
+}
+
+type jsonNode struct {
+	Rule     string      `json:"rule"`
+	Start    int         `json:"start"`
+	End      int         `json:"end"`
+	Line     int         `json:"line"`
+	Text     string      `json:"text,omitempty"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+func toJSON(n *dsl.Node, input string) *jsonNode {
+	jn := &jsonNode{
+		Rule:  n.Rule,
+		Start: n.Start,
+		End:   n.End,
+		Line:  n.Line,
+	}
+
+	if len(n.Children) == 0 {
+		jn.Text = n.Text(input)
+	}
+
+	for _, c := range n.Children {
+		jn.Children = append(jn.Children, toJSON(c, input))
+	}
+
+	return jn
+}
+
+// writeSexp writes n as an s-expression, with nodes that have no children
+// showing the text they matched.
+func writeSexp(sb *strings.Builder, n *dsl.Node, input string, depth int) {
+	sb.WriteString("(" + n.Rule)
+
+	if len(n.Children) == 0 {
+		sb.WriteString(" " + strconv.Quote(n.Text(input)) + ")")
+		return
+	}
+
+	for _, c := range n.Children {
+		sb.WriteString("\n" + strings.Repeat("  ", depth+1))
+		writeSexp(sb, c, input, depth+1)
+	}
+
+	sb.WriteString(")")
+}
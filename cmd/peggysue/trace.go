@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/dsl"
+)
+
+// maxTraceCalls limits how many calls are shown in the trace tree, since
+// the report for a large input would otherwise be unusably big. The
+// profile always includes every call.
+const maxTraceCalls = 20000
+
+type traceCall struct {
+	Rule       string
+	Start, End peggysue.Pos
+	Matched    bool
+	Memoized   bool
+	Text       string
+	Calls      []*traceCall
+
+	began time.Time
+}
+
+type ruleProfile struct {
+	Rule     string
+	Calls    int
+	Matches  int
+	Memoized int
+	Time     time.Duration
+}
+
+// recorder is a peggysue.Tracer that builds a tree of calls and a profile
+// of each rule.
+type recorder struct {
+	input string
+
+	root    traceCall
+	stack   []*traceCall
+	calls   int
+	profile map[string]*ruleProfile
+}
+
+func newRecorder(input string) *recorder {
+	r := &recorder{
+		input:   input,
+		profile: map[string]*ruleProfile{},
+	}
+
+	r.stack = []*traceCall{&r.root}
+
+	return r
+}
+
+func (r *recorder) Enter(rule string, pos peggysue.Pos) {
+	c := &traceCall{Rule: rule, Start: pos, began: time.Now()}
+
+	r.calls++
+
+	if r.calls <= maxTraceCalls {
+		parent := r.stack[len(r.stack)-1]
+		parent.Calls = append(parent.Calls, c)
+	}
+
+	r.stack = append(r.stack, c)
+}
+
+func (r *recorder) Exit(rule string, start, end peggysue.Pos, matched, memoized bool) {
+	c := r.stack[len(r.stack)-1]
+	r.stack = r.stack[:len(r.stack)-1]
+
+	c.End = end
+	c.Matched = matched
+	c.Memoized = memoized
+
+	if matched {
+		c.Text = r.input[start.Offset:end.Offset]
+	}
+
+	p, ok := r.profile[rule]
+	if !ok {
+		p = &ruleProfile{Rule: rule}
+		r.profile[rule] = p
+	}
+
+	p.Calls++
+	p.Time += time.Since(c.began)
+
+	if matched {
+		p.Matches++
+	}
+
+	if memoized {
+		p.Memoized++
+	}
+}
+
+type traceReport struct {
+	Grammar   string
+	Input     string
+	Matched   bool
+	Error     string
+	Calls     []*traceCall
+	Truncated bool
+	Profile   []*ruleProfile
+}
+
+func traceCmd(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	output := fs.String("o", "", "write the report to this file instead of stdout")
+	partial := fs.Bool("partial", false, "allow the grammar to match a prefix of the input")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: peggysue trace [-o report.html] [-partial] grammar.peg [input]")
+	}
+
+	filename, input, err := readInput(fs, stdin)
+	if err != nil {
+		return err
+	}
+
+	f, err := dsl.ParseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	rec := newRecorder(input)
+
+	g, err := dsl.Compile(f,
+		peggysue.WithFilename(filename),
+		peggysue.WithPartial(*partial),
+		peggysue.WithTracer(rec),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, ok, err := g.Parse(input)
+
+	report := traceReport{
+		Grammar:   fs.Arg(0),
+		Input:     filename,
+		Matched:   ok,
+		Calls:     rec.root.Calls,
+		Truncated: rec.calls > maxTraceCalls,
+	}
+
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	for _, p := range rec.profile {
+		report.Profile = append(report.Profile, p)
+	}
+
+	sort.Slice(report.Profile, func(i, j int) bool {
+		if report.Profile[i].Time != report.Profile[j].Time {
+			return report.Profile[i].Time > report.Profile[j].Time
+		}
+
+		return report.Profile[i].Rule < report.Profile[j].Rule
+	})
+
+	w := stdout
+
+	if *output != "" {
+		out, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+
+		defer out.Close()
+
+		w = out
+	}
+
+	return traceTemplate.Execute(w, report)
+}
+
+var traceTemplate = template.Must(template.New("trace").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>peggysue trace: {{.Grammar}}</title>
+<style>
+body { font-family: sans-serif; }
+details { margin-left: 1.5em; }
+summary { font-family: monospace; white-space: pre; }
+.match { color: #070; }
+.fail { color: #a00; }
+.memo { color: #888; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 0.8em; text-align: right; }
+td:first-child, th:first-child { text-align: left; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Trace of {{.Input}} with {{.Grammar}}</h1>
+<p>{{if .Matched}}The input matched.{{else}}The input did not match.{{end}}{{with .Error}} {{.}}{{end}}</p>
+
+<h2>Profile</h2>
+<table>
+<tr><th>Rule</th><th>Calls</th><th>Matches</th><th>Memoized</th><th>Time</th></tr>
+{{range .Profile}}<tr><td>{{.Rule}}</td><td>{{.Calls}}</td><td>{{.Matches}}</td><td>{{.Memoized}}</td><td>{{.Time}}</td></tr>
+{{end}}</table>
+
+<h2>Calls</h2>
+{{if .Truncated}}<p>Only the first calls are shown.</p>{{end}}
+{{template "calls" .Calls}}
+</body>
+</html>
+{{define "calls"}}{{range .}}<details>
+<summary class="{{if .Memoized}}memo{{else if .Matched}}match{{else}}fail{{end}}">{{.Rule}} {{.Start.Line}}:{{.Start.Column}}{{if .Matched}} matched {{printf "%q" .Text}}{{else}} failed{{end}}{{if .Memoized}} (memoized){{end}}</summary>
+{{template "calls" .Calls}}</details>
+{{end}}{{end}}
+`))
@@ -0,0 +1,69 @@
+package peggysue
+
+import "unicode"
+
+// ColumnMode controls how columns are counted when reporting positions.
+// Editors and compilers disagree on what a column is, so the mode should be
+// chosen to match whatever consumes the positions.
+type ColumnMode int
+
+const (
+	// ColumnBytes counts each byte as a column. This is the default.
+	ColumnBytes ColumnMode = iota
+
+	// ColumnRunes counts each rune as a column.
+	ColumnRunes
+
+	// ColumnDisplay counts columns as they would be displayed: a tab advances
+	// to the next tab stop (see WithTabWidth) and combining marks take up no
+	// space.
+	ColumnDisplay
+)
+
+// DefaultTabWidth is the tab width used by ColumnDisplay when WithTabWidth
+// has not been used.
+const DefaultTabWidth = 8
+
+// WithColumnMode sets how columns are counted when reporting positions.
+func WithColumnMode(mode ColumnMode) Option {
+	return func(p *Parser) {
+		p.columnMode = mode
+	}
+}
+
+// WithTabWidth sets the distance between tab stops used when columns are
+// counted with ColumnDisplay.
+func WithTabWidth(n int) Option {
+	return func(p *Parser) {
+		p.tabWidth = n
+	}
+}
+
+// displayColumn returns how many columns str takes up when displayed.
+func displayColumn(str string, tabWidth int) int {
+	if tabWidth <= 0 {
+		tabWidth = DefaultTabWidth
+	}
+
+	col := 0
+
+	for _, r := range str {
+		col = nextDisplayColumn(col, r, tabWidth)
+	}
+
+	return col
+}
+
+// nextDisplayColumn returns the column that follows r when r is displayed
+// at col.
+func nextDisplayColumn(col int, r rune, tabWidth int) int {
+	switch {
+	case r == '\t':
+		return col + tabWidth - (col % tabWidth)
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		// combining marks are drawn over the previous rune
+		return col
+	default:
+		return col + 1
+	}
+}
@@ -0,0 +1,260 @@
+package peggysue
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// CustomRule is a matcher implemented outside of this package, for input
+// that is awkward or slow to describe with the built in rules, such as a
+// heredoc whose terminator is chosen by the input, or a hand written scanner
+// for a hot token. It is turned into a Rule with Custom.
+type CustomRule interface {
+	// Match matches the input at the current position of c. If it
+	// matches, it advances c past the input it matched and returns the
+	// value of the match. If it doesn't, the position is reset by the
+	// parser, so it need not restore it.
+	Match(c *CustomContext) (value interface{}, ok bool)
+}
+
+// CustomRules may be implemented by a CustomRule that matches other rules
+// with CustomContext.Match, so that they are included in the analysis of
+// the grammar, such as left recursion and Lint.
+type CustomRules interface {
+	// Rules returns the rules that the custom rule may match.
+	Rules() []Rule
+
+	// LeftRules returns the rules that the custom rule may match at the
+	// position it begins at, before consuming any input.
+	LeftRules() []Rule
+}
+
+// Custom returns a Rule that matches with cr. The name is used to identify
+// the rule in Print, debug output, and errors.
+//
+// The value of the match is the value returned by cr.
+func Custom(name string, cr CustomRule) Rule {
+	return &matchCustom{basicRule: basicRule{name: name}, cr: cr}
+}
+
+type matchCustom struct {
+	basicRule
+	cr CustomRule
+}
+
+func (m *matchCustom) match(s *state) result {
+	save := s.mark()
+
+	val, ok := m.cr.Match(&CustomContext{s: s, start: s.pos})
+	if !ok {
+		s.restore(save)
+		s.bad(m)
+		return result{}
+	}
+
+	s.good(m)
+	return result{matched: true, value: val}
+}
+
+func (m *matchCustom) detectLeftRec(r Rule, rs ruleSet) bool {
+	cr, ok := m.cr.(CustomRules)
+	if !ok {
+		return false
+	}
+
+	for _, sub := range cr.LeftRules() {
+		if !rs.Add(sub) {
+			continue
+		}
+
+		if sub == r || sub.detectLeftRec(r, rs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *matchCustom) print() string {
+	if _, ct := customType(m.cr); ct != nil && ct.Print != nil {
+		rules := customRules(m.cr)
+
+		strs := make([]string, len(rules))
+		for i, r := range rules {
+			strs[i] = Print(r)
+		}
+
+		return ct.Print(m.cr, strs)
+	}
+
+	return "<custom " + m.name + ">"
+}
+
+// CustomContext gives a CustomRule access to the parser while it matches.
+// Unlike the MatchContext passed to CheckActionCtx, it can consume input and
+// match other rules.
+type CustomContext struct {
+	s     *state
+	start int
+}
+
+// Input returns the whole input being parsed.
+func (c *CustomContext) Input() string {
+	return c.s.input
+}
+
+// Rest returns the input from the current position on.
+func (c *CustomContext) Rest() string {
+	return c.s.cur()
+}
+
+// Pos returns the current position, as a byte offset into Input.
+func (c *CustomContext) Pos() int {
+	return c.s.pos
+}
+
+// Start returns the position that the custom rule began matching at.
+func (c *CustomContext) Start() int {
+	return c.start
+}
+
+// Position returns the line and column of the byte offset bp in Input.
+func (c *CustomContext) Position(bp int) Pos {
+	return c.s.position(bp)
+}
+
+// Advance moves the current position forward by n bytes, past input that the
+// custom rule has matched. It panics if that is past the end of the input.
+func (c *CustomContext) Advance(n int) {
+	if n < 0 || c.s.pos+n > c.s.inputSize {
+		panic("peggysue: advanced past the end of the input")
+	}
+
+	c.s.advance(n, nil)
+}
+
+// Mark is a point in the parse that can be returned to with
+// CustomContext.Restore.
+type Mark struct {
+	sp savepoint
+}
+
+// Mark returns the current point in the parse, including the position and
+// the state store.
+func (c *CustomContext) Mark() Mark {
+	return Mark{sp: c.s.mark()}
+}
+
+// Restore returns to a point returned by Mark, undoing everything matched
+// since.
+func (c *CustomContext) Restore(m Mark) {
+	c.s.restore(m.sp)
+}
+
+// Match matches r at the current position, as if it were part of the
+// grammar, returning its value. If r doesn't match, the position is left
+// where it was.
+func (c *CustomContext) Match(r Rule) (interface{}, bool) {
+	save := c.s.mark()
+
+	res := c.s.match(r)
+	if !res.matched {
+		c.s.restore(save)
+	}
+
+	return res.value, res.matched
+}
+
+// Values returns the values of the named rules matched so far in the
+// enclosing scope, as passed to an Action.
+func (c *CustomContext) Values() Values {
+	return c.s.values
+}
+
+// State returns the state store, as set by StateSet and StatePush.
+func (c *CustomContext) State() State {
+	return c.s.store
+}
+
+// CustomType describes a type of CustomRule, so that grammars using it can be
+// printed by Print and PrintGrammar, and serialized by Marshal and Unmarshal.
+// It is registered with RegisterCustom.
+//
+// The rules returned by CustomRules.Rules are printed and serialized along
+// with the custom rule, and are passed to its functions in the same order.
+type CustomType struct {
+	// Print returns the rule in the syntax of PrintGrammar, given the
+	// printed form of its rules. If nil, the rule is printed as
+	// <custom name>.
+	Print func(cr CustomRule, rules []string) string
+
+	// Marshal returns the configuration of the rule, as JSON. If nil, the
+	// rule has no configuration.
+	Marshal func(cr CustomRule) (json.RawMessage, error)
+
+	// Unmarshal creates the rule from the configuration returned by
+	// Marshal and its rules.
+	Unmarshal func(data json.RawMessage, rules []Rule) (CustomRule, error)
+}
+
+var customTypes = struct {
+	sync.RWMutex
+	byType map[reflect.Type]string
+	byKind map[string]*CustomType
+}{
+	byType: map[reflect.Type]string{},
+	byKind: map[string]*CustomType{},
+}
+
+// RegisterCustom registers the type of the CustomRule example under the name
+// kind, which identifies it in serialized grammars. It panics if either has
+// already been registered, which is almost always two packages choosing the
+// same kind.
+func RegisterCustom(kind string, example CustomRule, ct CustomType) {
+	customTypes.Lock()
+	defer customTypes.Unlock()
+
+	typ := reflect.TypeOf(example)
+
+	if _, ok := customTypes.byKind[kind]; ok {
+		panic(fmt.Sprintf("custom rule kind already registered: %s", kind))
+	}
+
+	if other, ok := customTypes.byType[typ]; ok {
+		panic(fmt.Sprintf("custom rule type %s already registered as %s", typ, other))
+	}
+
+	customTypes.byType[typ] = kind
+	customTypes.byKind[kind] = &ct
+}
+
+// customType returns the kind and CustomType that cr's type is registered as.
+func customType(cr CustomRule) (string, *CustomType) {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+
+	kind, ok := customTypes.byType[reflect.TypeOf(cr)]
+	if !ok {
+		return "", nil
+	}
+
+	return kind, customTypes.byKind[kind]
+}
+
+func customKind(kind string) *CustomType {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+
+	return customTypes.byKind[kind]
+}
+
+// customRules returns the rules of cr.
+func customRules(cr CustomRule) []Rule {
+	if crs, ok := cr.(CustomRules); ok {
+		return crs.Rules()
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package peggysue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// heredoc matches "<<TAG\n", then everything up to a line that is TAG.
+type heredoc struct{}
+
+func (heredoc) Match(c *CustomContext) (interface{}, bool) {
+	rest := c.Rest()
+	if !strings.HasPrefix(rest, "<<") {
+		return nil, false
+	}
+
+	nl := strings.IndexByte(rest, '\n')
+	if nl < 0 {
+		return nil, false
+	}
+
+	tag := rest[2:nl]
+
+	end := strings.Index(rest[nl:], "\n"+tag)
+	if end < 0 {
+		return nil, false
+	}
+
+	body := rest[nl+1 : nl+end]
+
+	c.Advance(nl + end + 1 + len(tag))
+
+	return body, true
+}
+
+// list matches items separated by commas, using other rules.
+type list struct {
+	item Rule
+}
+
+func (l *list) Match(c *CustomContext) (interface{}, bool) {
+	var items []interface{}
+
+	for {
+		v, ok := c.Match(l.item)
+		if !ok {
+			return nil, false
+		}
+
+		items = append(items, v)
+
+		m := c.Mark()
+		if _, ok := c.Match(S(",")); !ok {
+			c.Restore(m)
+			return items, true
+		}
+	}
+}
+
+func (l *list) Rules() []Rule     { return []Rule{l.item} }
+func (l *list) LeftRules() []Rule { return []Rule{l.item} }
+
+func init() {
+	RegisterCustom("list", &list{}, CustomType{
+		Print: func(cr CustomRule, rules []string) string {
+			return "list(" + rules[0] + ")"
+		},
+		Unmarshal: func(data json.RawMessage, rules []Rule) (CustomRule, error) {
+			return &list{item: rules[0]}, nil
+		},
+	})
+}
+
+func TestCustom(t *testing.T) {
+	t.Run("matches with a custom rule", func(t *testing.T) {
+		r := require.New(t)
+
+		doc := Custom("heredoc", heredoc{})
+
+		v, ok, err := New().Parse(Seq(S("x = "), Named("doc", doc), Action(S(";"), func(v Values) interface{} {
+			return v.Get("doc")
+		})), "x = <<END\none\ntwo\nEND;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("one\ntwo", v)
+
+		_, ok, err = New().Parse(doc, "<<END\none")
+		r.NoError(err)
+		r.False(ok)
+
+		r.Equal("heredoc", Print(doc))
+		r.Equal("<custom heredoc>", Repr(doc))
+	})
+
+	t.Run("matches other rules", func(t *testing.T) {
+		r := require.New(t)
+
+		items := Custom("list", &list{item: Capture(Re("[0-9]+"))})
+
+		v, ok, err := New().Parse(items, "1,2,3")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"1", "2", "3"}, v)
+
+		_, ok, err = New().Parse(items, "1,")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("takes part in grammar analysis", func(t *testing.T) {
+		r := require.New(t)
+
+		l := Refs()
+
+		items := l.Set("items", Custom("list", &list{item: l.Ref("item")}))
+		l.Set("item", Or(Seq(items, S(";")), S("x")))
+
+		r.True(items.LeftRecursive())
+		r.Contains(subRules(Custom("list", &list{item: S("x")})), S("x"))
+	})
+
+	t.Run("prints registered types", func(t *testing.T) {
+		r := require.New(t)
+
+		items := &list{item: Capture(Re("[0-9]+"))}
+
+		r.Equal("list(< /[0-9]+/ >)", Repr(Custom("items", items)))
+		r.Equal("<custom doc>", Repr(Custom("doc", heredoc{})))
+
+		l := Refs()
+		l.Set("num", Capture(Re("[0-9]+")))
+		root := l.Set("items", Custom("", &list{item: l.Ref("num")}))
+
+		r.Equal("items <- list(num)\nnum <- < /[0-9]+/ >\n", PrintGrammar(root))
+	})
+
+	t.Run("serializes registered types", func(t *testing.T) {
+		r := require.New(t)
+
+		num := R("num")
+		num.Set(Capture(Re("[0-9]+")))
+
+		data, err := Marshal(Custom("items", &list{item: num}), nil)
+		r.NoError(err)
+
+		rule, err := Unmarshal(data, nil)
+		r.NoError(err)
+		r.Equal("items", rule.Name())
+
+		v, ok, err := New().Parse(rule, "1,2")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"1", "2"}, v)
+
+		_, err = Marshal(Custom("doc", heredoc{}), nil)
+		r.Error(err)
+
+		_, err = Unmarshal([]byte(`{"version":1,"rule":{"type":"custom","value":"nope"}}`), nil)
+		r.Error(err)
+	})
+
+	t.Run("registers each kind and type once", func(t *testing.T) {
+		r := require.New(t)
+
+		r.Panics(func() {
+			RegisterCustom("list", heredoc{}, CustomType{})
+		})
+
+		r.Panics(func() {
+			RegisterCustom("other-list", &list{}, CustomType{})
+		})
+	})
+
+	t.Run("can not advance past the end of the input", func(t *testing.T) {
+		r := require.New(t)
+
+		r.Panics(func() {
+			New().Parse(Custom("bad", customFunc(func(c *CustomContext) (interface{}, bool) {
+				c.Advance(10)
+				return nil, true
+			})), "short")
+		})
+	})
+}
+
+type customFunc func(c *CustomContext) (interface{}, bool)
+
+func (f customFunc) Match(c *CustomContext) (interface{}, bool) {
+	return f(c)
+}
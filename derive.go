@@ -0,0 +1,461 @@
+package peggysue
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Derive builds a rule from the `peg:` tags of the fields of v, which must
+// be a struct or a pointer to one, so that simple languages can be parsed
+// without writing the rules by hand. The value of the rule is a pointer to a
+// new struct of the same type, with its fields filled in.
+//
+// The struct matches the tags of its fields in order. Fields without a tag,
+// or tagged `peg:"-"`, are ignored. A tag that begins with | is an
+// alternative to the fields before it, so that a struct can hold one of
+// several kinds of value. A tag is a sequence of terms:
+//
+//	'text'      matches the literal text
+//	@class      matches a token and stores it in the field
+//	@'text'     matches the literal text and stores it in the field
+//	@@          matches the struct type of the field and stores it
+//	( ... )     groups terms
+//	a | b       matches a, or b if a does not match
+//	x* x+ x?    matches x zero or more times, one or more times, or
+//	            optionally
+//
+// The token classes are ident, a letter or underscore followed by letters,
+// digits, and underscores; int, an optionally signed integer; float, a
+// decimal number with an optional fraction and exponent; and string, a
+// double quoted string with Go escapes, which is stored unquoted.
+//
+// Stored values are converted to the type of the field as Unmarshal does.
+// A slice field gets every value stored in it, and a bool field is set to
+// true if anything is stored in it. Any other field gets the last value
+// stored.
+//
+// Whitespace is skipped before the struct and after each literal and token.
+// Literals that end in a letter, digit, or underscore don't match if they
+// are followed by one, so 'if' does not match the start of "iffy".
+//
+// For example:
+//
+//	type Assign struct {
+//		Name  string `peg:"@ident '='"`
+//		Value int    `peg:"@int ';'"`
+//	}
+//
+//	type Program struct {
+//		Assigns []*Assign `peg:"@@*"`
+//	}
+func Derive(v interface{}) (Rule, error) {
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can not derive a rule from %T: not a struct", v)
+	}
+
+	d := &deriver{
+		refs: make(map[reflect.Type]Ref),
+		ws:   Star(Set(' ', '\t', '\r', '\n')),
+	}
+
+	ref, err := d.structRule(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	return Seq(d.ws, ref), nil
+}
+
+type deriver struct {
+	refs map[reflect.Type]Ref
+	ws   Rule
+}
+
+var identChar = Or(Range('a', 'z'), Range('A', 'Z'), Range('0', '9'), S("_"))
+
+// deriveTokens are the token classes that can be captured with @.
+var deriveTokens = map[string]Rule{
+	"ident": Seq(Or(Range('a', 'z'), Range('A', 'Z'), S("_")), Star(identChar)),
+	"int":   Seq(Maybe(Set('+', '-')), Plus(Range('0', '9'))),
+	"float": Seq(
+		Maybe(Set('+', '-')), Plus(Range('0', '9')),
+		Maybe(Seq(S("."), Star(Range('0', '9')))),
+		Maybe(Seq(Set('e', 'E'), Maybe(Set('+', '-')), Plus(Range('0', '9')))),
+	),
+	"string": Seq(S(`"`), Star(Or(Seq(S(`\`), Any()), Seq(Not(Set('"', '\\', '\n')), Any()))), S(`"`)),
+}
+
+// structRule returns the Ref that matches typ, creating it if needed. The
+// Ref is created before the fields are derived so that types can refer to
+// themselves.
+func (d *deriver) structRule(typ reflect.Type) (Ref, error) {
+	if ref, ok := d.refs[typ]; ok {
+		return ref, nil
+	}
+
+	ref := R(typ.Name())
+	d.refs[typ] = ref
+
+	var (
+		// parts holds the rules of the fields, grouped with the fields
+		// that are alternatives to them.
+		parts  [][]Rule
+		fields []int
+	)
+
+	for i := 0; i < typ.NumField(); i++ {
+		ft := typ.Field(i)
+
+		tag, ok := ft.Tag.Lookup("peg")
+		if !ok || tag == "-" || !ft.IsExported() {
+			continue
+		}
+
+		alt := strings.HasPrefix(strings.TrimLeft(tag, " "), "|")
+		if alt {
+			if len(parts) == 0 {
+				return nil, fmt.Errorf("%s.%s: tag %q is not an alternative to a previous field", typ.Name(), ft.Name, tag)
+			}
+
+			tag = strings.Replace(tag, "|", " ", 1)
+		}
+
+		tp := &tagParser{d: d, field: ft, tag: tag}
+
+		rule, err := tp.parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", typ.Name(), ft.Name, err)
+		}
+
+		if alt {
+			last := len(parts) - 1
+			parts[last] = append(parts[last], Named(ft.Name, rule))
+		} else {
+			parts = append(parts, []Rule{Named(ft.Name, rule)})
+		}
+
+		fields = append(fields, i)
+	}
+
+	seq := make([]Rule, len(parts))
+	for i, alts := range parts {
+		seq[i] = Or(alts...)
+	}
+
+	ref.Set(ActionErr(Seq(seq...), func(v Values) (interface{}, error) {
+		ptr := reflect.New(typ)
+
+		for _, i := range fields {
+			ft := typ.Field(i)
+
+			vals, _ := v.Get(ft.Name).([]interface{})
+			if len(vals) == 0 {
+				continue
+			}
+
+			fv := ptr.Elem().Field(i)
+
+			var err error
+
+			switch {
+			case fv.Kind() == reflect.Bool:
+				fv.SetBool(true)
+			case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+				err = unmarshalValue(fv, vals, ft.Name)
+			default:
+				err = unmarshalValue(fv, vals[len(vals)-1], ft.Name)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return ptr.Interface(), nil
+	}))
+
+	return ref, nil
+}
+
+// tagParser parses the `peg:` tag of a field into a rule. The value of the
+// rule is a []interface{} of the values it stores in the field, or nil.
+type tagParser struct {
+	d     *deriver
+	field reflect.StructField
+	tag   string
+	pos   int
+}
+
+func (tp *tagParser) parse() (Rule, error) {
+	rule, err := tp.alternatives()
+	if err != nil {
+		return nil, err
+	}
+
+	tp.skipSpace()
+
+	if tp.pos < len(tp.tag) {
+		return nil, tp.errorf("unexpected %q", tp.tag[tp.pos])
+	}
+
+	return rule, nil
+}
+
+func (tp *tagParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid tag %q at offset %d: %s", tp.tag, tp.pos, fmt.Sprintf(format, args...))
+}
+
+func (tp *tagParser) skipSpace() {
+	for tp.pos < len(tp.tag) && tp.tag[tp.pos] == ' ' {
+		tp.pos++
+	}
+}
+
+func (tp *tagParser) peek() byte {
+	tp.skipSpace()
+
+	if tp.pos == len(tp.tag) {
+		return 0
+	}
+
+	return tp.tag[tp.pos]
+}
+
+func (tp *tagParser) alternatives() (Rule, error) {
+	var alts []Rule
+
+	for {
+		seq, err := tp.sequence()
+		if err != nil {
+			return nil, err
+		}
+
+		alts = append(alts, seq)
+
+		if tp.peek() != '|' {
+			break
+		}
+
+		tp.pos++
+	}
+
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+
+	return Or(alts...), nil
+}
+
+func (tp *tagParser) sequence() (Rule, error) {
+	var terms []Rule
+
+	for {
+		switch tp.peek() {
+		case 0, '|', ')':
+			if len(terms) == 0 {
+				return nil, tp.errorf("expected a term")
+			}
+
+			if len(terms) == 1 {
+				return terms[0], nil
+			}
+
+			parts := make([]Rule, len(terms))
+			for i, t := range terms {
+				parts[i] = Named(strconv.Itoa(i), t)
+			}
+
+			return Action(Seq(parts...), func(v Values) interface{} {
+				var vals []interface{}
+
+				for i := range terms {
+					if tv, ok := v.Get(strconv.Itoa(i)).([]interface{}); ok {
+						vals = append(vals, tv...)
+					}
+				}
+
+				return vals
+			}), nil
+		}
+
+		term, err := tp.term()
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, term)
+	}
+}
+
+func (tp *tagParser) term() (Rule, error) {
+	atom, err := tp.atom()
+	if err != nil {
+		return nil, err
+	}
+
+	if tp.pos == len(tp.tag) {
+		return atom, nil
+	}
+
+	switch tp.tag[tp.pos] {
+	case '*':
+		tp.pos++
+		return Many(atom, 0, -1, flattenValues), nil
+	case '+':
+		tp.pos++
+		return Many(atom, 1, -1, flattenValues), nil
+	case '?':
+		tp.pos++
+		return Many(atom, 0, 1, flattenValues), nil
+	default:
+		return atom, nil
+	}
+}
+
+func flattenValues(values []interface{}) interface{} {
+	var vals []interface{}
+
+	for _, v := range values {
+		if tv, ok := v.([]interface{}); ok {
+			vals = append(vals, tv...)
+		}
+	}
+
+	return vals
+}
+
+func (tp *tagParser) atom() (Rule, error) {
+	switch tp.peek() {
+	case '(':
+		tp.pos++
+
+		rule, err := tp.alternatives()
+		if err != nil {
+			return nil, err
+		}
+
+		if tp.peek() != ')' {
+			return nil, tp.errorf("expected )")
+		}
+
+		tp.pos++
+
+		return rule, nil
+	case '\'':
+		lit, err := tp.literal()
+		if err != nil {
+			return nil, err
+		}
+
+		return Seq(tp.d.keyword(lit), tp.d.ws), nil
+	case '@':
+		tp.pos++
+		return tp.capture()
+	default:
+		return nil, tp.errorf("expected a term")
+	}
+}
+
+func (tp *tagParser) literal() (string, error) {
+	start := tp.pos + 1
+
+	end := strings.IndexByte(tp.tag[start:], '\'')
+	if end <= 0 {
+		return "", tp.errorf("unterminated or empty literal")
+	}
+
+	tp.pos = start + end + 1
+
+	return tp.tag[start : start+end], nil
+}
+
+// keyword matches lit, but not the start of a longer identifier if lit ends
+// with an identifier character.
+func (d *deriver) keyword(lit string) Rule {
+	last := lit[len(lit)-1]
+
+	if last == '_' || (last >= '0' && last <= '9') || (last >= 'a' && last <= 'z') || (last >= 'A' && last <= 'Z') {
+		return Seq(S(lit), Not(identChar))
+	}
+
+	return S(lit)
+}
+
+func (tp *tagParser) capture() (Rule, error) {
+	if tp.pos < len(tp.tag) && tp.tag[tp.pos] == '@' {
+		tp.pos++
+
+		typ := tp.field.Type
+		for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+		}
+
+		if typ.Kind() != reflect.Struct {
+			return nil, tp.errorf("@@ requires a struct field, not %s", tp.field.Type)
+		}
+
+		ref, err := tp.d.structRule(typ)
+		if err != nil {
+			return nil, err
+		}
+
+		return Many(ref, 1, 1, copyGroup), nil
+	}
+
+	var (
+		token Rule
+		conv  func(string) (interface{}, error)
+	)
+
+	if tp.pos < len(tp.tag) && tp.tag[tp.pos] == '\'' {
+		lit, err := tp.literal()
+		if err != nil {
+			return nil, err
+		}
+
+		token = tp.d.keyword(lit)
+	} else {
+		start := tp.pos
+		for tp.pos < len(tp.tag) && tp.tag[tp.pos] >= 'a' && tp.tag[tp.pos] <= 'z' {
+			tp.pos++
+		}
+
+		class := tp.tag[start:tp.pos]
+
+		var ok bool
+
+		token, ok = deriveTokens[class]
+		if !ok {
+			tp.pos = start
+			return nil, tp.errorf("unknown token class %q", class)
+		}
+
+		if class == "string" {
+			conv = func(s string) (interface{}, error) {
+				return strconv.Unquote(s)
+			}
+		}
+	}
+
+	return ActionErr(Seq(Named("v", Capture(token)), tp.d.ws), func(v Values) (interface{}, error) {
+		str := v.Get("v").(string)
+
+		if conv == nil {
+			return []interface{}{str}, nil
+		}
+
+		val, err := conv(str)
+		if err != nil {
+			return nil, err
+		}
+
+		return []interface{}{val}, nil
+	}), nil
+}
@@ -0,0 +1,122 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type deriveValue struct {
+	Str   string        `peg:"@string"`
+	Num   float64       `peg:"| @float"`
+	Bool  bool          `peg:"| @'true'"`
+	List  []deriveValue `peg:"| '[' (@@ (',' @@)*)? ']'"`
+	Ident string        `peg:"| @ident"`
+}
+
+type deriveAssign struct {
+	Const bool         `peg:"@'const'?"`
+	Name  string       `peg:"@ident '='"`
+	Value *deriveValue `peg:"@@ ';'"`
+}
+
+type deriveProgram struct {
+	Assigns []*deriveAssign `peg:"@@*"`
+	ignored int
+}
+
+func TestDerive(t *testing.T) {
+	t.Run("parses into structs", func(t *testing.T) {
+		r := require.New(t)
+
+		rule, err := Derive(&deriveProgram{})
+		r.NoError(err)
+
+		val, ok, err := New().Parse(rule, `
+			x = 1.5;
+			const name = "a\tb";
+			list = [1, [true], y];
+		`)
+		r.NoError(err)
+		r.True(ok)
+
+		prog := val.(*deriveProgram)
+		r.Len(prog.Assigns, 3)
+
+		r.Equal(&deriveAssign{Name: "x", Value: &deriveValue{Num: 1.5}}, prog.Assigns[0])
+		r.Equal(&deriveAssign{Const: true, Name: "name", Value: &deriveValue{Str: "a\tb"}}, prog.Assigns[1])
+		r.Equal(&deriveValue{List: []deriveValue{
+			{Num: 1},
+			{List: []deriveValue{{Bool: true}}},
+			{Ident: "y"},
+		}}, prog.Assigns[2].Value)
+	})
+
+	t.Run("does not match keywords within identifiers", func(t *testing.T) {
+		r := require.New(t)
+
+		rule, err := Derive(deriveAssign{})
+		r.NoError(err)
+
+		val, ok, err := New().Parse(rule, "constant = true;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(&deriveAssign{Name: "constant", Value: &deriveValue{Bool: true}}, val)
+
+		_, ok, err = New().Parse(rule, "x = ;")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("converts values to the field type", func(t *testing.T) {
+		r := require.New(t)
+
+		type point struct {
+			X int8 `peg:"'(' @int ','"`
+			Y int8 `peg:"@int ')'"`
+		}
+
+		rule, err := Derive(point{})
+		r.NoError(err)
+
+		val, ok, err := New().Parse(rule, "(1, -2)")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(&point{X: 1, Y: -2}, val)
+
+		_, _, err = New().Parse(rule, "(1, 300)")
+		r.ErrorContains(err, "field Y of type int8")
+	})
+
+	t.Run("reports invalid tags", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Derive(1)
+		r.ErrorContains(err, "not a struct")
+
+		_, err = Derive(struct {
+			A string `peg:"@number"`
+		}{})
+		r.ErrorContains(err, `unknown token class "number"`)
+
+		_, err = Derive(struct {
+			A string `peg:"@@"`
+		}{})
+		r.ErrorContains(err, "@@ requires a struct field")
+
+		_, err = Derive(struct {
+			A string `peg:"('a'"`
+		}{})
+		r.ErrorContains(err, "expected )")
+
+		_, err = Derive(struct {
+			A string `peg:"'a' )"`
+		}{})
+		r.ErrorContains(err, `unexpected ')'`)
+
+		_, err = Derive(struct {
+			A string `peg:"| @ident"`
+		}{})
+		r.ErrorContains(err, "not an alternative to a previous field")
+	})
+}
@@ -0,0 +1,119 @@
+// Package dsl implements a textual format for peggysue grammars, using the
+// conventional PEG syntax:
+//
+//	# A comment
+//	list  <- item (',' item)*
+//	item  <- [a-z]+ / '(' list ')'
+//
+// The first definition is the root of the grammar. Expressions are made of
+// references to other definitions, literals quoted with ' or ", character
+// classes such as [a-z0-9_] or [^"], the any character ".", grouping with
+// parentheses, the suffixes ?, *, and +, the lookahead prefixes & and !, and
+// sequences of these separated by / to form ordered choices.
+package dsl
+
+// File is a parsed grammar.
+type File struct {
+	Defs []*Def
+
+	// Trailing are the comments after the last definition.
+	Trailing []string
+}
+
+// Def is the definition of a named rule.
+type Def struct {
+	Name string
+	Expr Expr
+
+	// Line is the line the definition begins on.
+	Line int
+
+	// Comments are the comments on the lines preceding the definition,
+	// without the leading '#'.
+	Comments []string
+
+	// LineComment is the comment at the end of the last line of the
+	// definition, if any, without the leading '#'. The other comments
+	// within the definition are held by Commented expressions.
+	LineComment string
+}
+
+// Expr is one of the expression types below.
+type Expr interface {
+	expr()
+}
+
+// Choice is an ordered choice between alternatives, "a / b".
+type Choice struct {
+	Alts []Expr
+}
+
+// Sequence is a sequence of expressions, "a b". An empty Sequence always
+// matches without consuming input.
+type Sequence struct {
+	Items []Expr
+}
+
+// Lookahead is a predicate, "&a" or "!a", that does not consume input.
+type Lookahead struct {
+	Not  bool
+	Expr Expr
+}
+
+// Repeat is an expression followed by one of the suffixes '?', '*', or '+'.
+type Repeat struct {
+	Op   byte
+	Expr Expr
+}
+
+// RuleRef is a reference to a definition.
+type RuleRef struct {
+	Name string
+}
+
+// Literal matches a string.
+type Literal struct {
+	Value string
+}
+
+// CharRange is an inclusive range of runes in a Class. A single rune has
+// equal Lo and Hi.
+type CharRange struct {
+	Lo, Hi rune
+}
+
+// Class matches a single rune in, or if Negated not in, any of its Ranges.
+type Class struct {
+	Negated bool
+	Ranges  []CharRange
+}
+
+// AnyChar matches any single rune, ".".
+type AnyChar struct{}
+
+// Commented is an expression along with the comments around it within a
+// definition, such as those between alternatives, which are kept so that
+// FormatFile can print them back. It matches the same input as Expr.
+type Commented struct {
+	Expr Expr
+
+	// Before are the comments that precede the expression when it begins
+	// an alternative or follows a prefix. After are the comments that
+	// follow it. They are without the leading '#'.
+	Before []string
+	After  []string
+
+	// Inline is true if the first of After is on the line that the
+	// expression ends on.
+	Inline bool
+}
+
+func (*Choice) expr()    {}
+func (*Sequence) expr()  {}
+func (*Lookahead) expr() {}
+func (*Repeat) expr()    {}
+func (*RuleRef) expr()   {}
+func (*Literal) expr()   {}
+func (*Class) expr()     {}
+func (*AnyChar) expr()   {}
+func (*Commented) expr() {}
@@ -0,0 +1,312 @@
+package dsl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity classifies a Diagnostic.
+type Severity string
+
+const (
+	// SeverityError is a problem that prevents the grammar from working,
+	// such as a reference to an undefined rule or a loop that never ends.
+	SeverityError Severity = "error"
+
+	// SeverityWarning is likely to be a mistake, such as an alternative
+	// that can never be reached.
+	SeverityWarning Severity = "warning"
+
+	// SeverityInfo describes the structure of the grammar, such as which
+	// rules are left recursive.
+	SeverityInfo Severity = "info"
+)
+
+// Diagnostic is a problem or observation about a grammar reported by Check.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+
+	// Rule and Line identify the definition the diagnostic is about.
+	Rule string `json:"rule"`
+	Line int    `json:"line"`
+
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d: %s: %s: %s", d.Line, d.Severity, d.Rule, d.Message)
+}
+
+// Check statically analyzes the grammar, reporting references to undefined
+// rules, repetitions of expressions that can match without consuming input,
+// alternatives that can never be reached, rules that are not reachable from
+// the root, and which rules are left recursive. The diagnostics are sorted by
+// line.
+func Check(f *File) []Diagnostic {
+	c := &checker{
+		defs:     map[string]*Def{},
+		nullable: map[string]bool{},
+	}
+
+	for _, d := range f.Defs {
+		if prev, ok := c.defs[d.Name]; ok {
+			c.report(SeverityError, d, "redefinition of rule defined on line %d", prev.Line)
+			continue
+		}
+
+		c.defs[d.Name] = d
+	}
+
+	c.computeNullable(f)
+
+	for _, d := range f.Defs {
+		c.def = d
+		c.walk(d.Expr)
+	}
+
+	c.checkReachable(f)
+	c.checkLeftRecursion(f)
+
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		return c.diags[i].Line < c.diags[j].Line
+	})
+
+	return c.diags
+}
+
+type checker struct {
+	defs     map[string]*Def
+	nullable map[string]bool
+
+	def   *Def
+	diags []Diagnostic
+}
+
+func (c *checker) report(sev Severity, d *Def, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{
+		Severity: sev,
+		Rule:     d.Name,
+		Line:     d.Line,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// computeNullable determines which definitions can match without consuming
+// input, iterating until no more are found since definitions refer to
+// each other.
+func (c *checker) computeNullable(f *File) {
+	for changed := true; changed; {
+		changed = false
+
+		for _, d := range f.Defs {
+			if !c.nullable[d.Name] && c.isNullable(d.Expr) {
+				c.nullable[d.Name] = true
+				changed = true
+			}
+		}
+	}
+}
+
+func (c *checker) isNullable(e Expr) bool {
+	switch e := e.(type) {
+	case *Choice:
+		for _, a := range e.Alts {
+			if c.isNullable(a) {
+				return true
+			}
+		}
+
+		return false
+	case *Sequence:
+		for _, i := range e.Items {
+			if !c.isNullable(i) {
+				return false
+			}
+		}
+
+		return true
+	case *Lookahead:
+		return true
+	case *Repeat:
+		return e.Op != '+' || c.isNullable(e.Expr)
+	case *Commented:
+		return c.isNullable(e.Expr)
+	case *RuleRef:
+		return c.nullable[e.Name]
+	case *Literal:
+		return e.Value == ""
+	default:
+		return false
+	}
+}
+
+func (c *checker) walk(e Expr) {
+	switch e := e.(type) {
+	case *Choice:
+		for i, a := range e.Alts {
+			c.walk(a)
+
+			if i == len(e.Alts)-1 {
+				break
+			}
+
+			if c.isNullable(a) {
+				c.report(SeverityWarning, c.def, "alternatives after %s are unreachable because it always matches", Format(a))
+				break
+			}
+
+			for _, later := range e.Alts[i+1:] {
+				if shadows(a, later) {
+					c.report(SeverityWarning, c.def, "alternative %s is unreachable because %s matches first", Format(later), Format(a))
+				}
+			}
+		}
+	case *Sequence:
+		for _, i := range e.Items {
+			c.walk(i)
+		}
+	case *Lookahead:
+		c.walk(e.Expr)
+	case *Repeat:
+		c.walk(e.Expr)
+
+		if e.Op != '?' && c.isNullable(e.Expr) {
+			c.report(SeverityError, c.def, "%s repeats an expression that can match without consuming input", Format(e))
+		}
+	case *Commented:
+		c.walk(e.Expr)
+	case *RuleRef:
+		if _, ok := c.defs[e.Name]; !ok {
+			c.report(SeverityError, c.def, "reference to undefined rule %s", e.Name)
+		}
+	}
+}
+
+// shadows reports whether a always matches when b would, when a is tried
+// first. Only literals are considered, where a is a prefix of b.
+func shadows(a, b Expr) bool {
+	if c, ok := a.(*Commented); ok {
+		return shadows(c.Expr, b)
+	}
+
+	if c, ok := b.(*Commented); ok {
+		return shadows(a, c.Expr)
+	}
+
+	la, ok := a.(*Literal)
+	if !ok {
+		return false
+	}
+
+	lb, ok := b.(*Literal)
+	if !ok {
+		return false
+	}
+
+	return strings.HasPrefix(lb.Value, la.Value)
+}
+
+func (c *checker) checkReachable(f *File) {
+	if len(f.Defs) == 0 {
+		return
+	}
+
+	seen := map[string]bool{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		d, ok := c.defs[name]
+		if !ok || seen[name] {
+			return
+		}
+
+		seen[name] = true
+
+		refs(d.Expr, false, c.isNullable, func(ref string) {
+			visit(ref)
+		})
+	}
+
+	visit(f.Defs[0].Name)
+
+	for _, d := range f.Defs {
+		if !seen[d.Name] {
+			c.report(SeverityWarning, d, "rule is not reachable from %s", f.Defs[0].Name)
+		}
+	}
+}
+
+func (c *checker) checkLeftRecursion(f *File) {
+	left := map[string][]string{}
+
+	for _, d := range f.Defs {
+		refs(d.Expr, true, c.isNullable, func(ref string) {
+			left[d.Name] = append(left[d.Name], ref)
+		})
+	}
+
+	for _, d := range f.Defs {
+		if path := findCycle(d.Name, left); path != nil {
+			c.report(SeverityInfo, d, "rule is left recursive: %s", strings.Join(path, " -> "))
+		}
+	}
+}
+
+// findCycle returns the path of rules called without consuming input that
+// leads from start back to itself, if there is one.
+func findCycle(start string, left map[string][]string) []string {
+	seen := map[string]bool{}
+
+	var visit func(name string, path []string) []string
+	visit = func(name string, path []string) []string {
+		path = append(path, name)
+
+		for _, next := range left[name] {
+			if next == start {
+				return append(path, next)
+			}
+
+			if seen[next] {
+				continue
+			}
+
+			seen[next] = true
+
+			if p := visit(next, path); p != nil {
+				return p
+			}
+		}
+
+		return nil
+	}
+
+	return visit(start, nil)
+}
+
+// refs calls fn with each rule referenced by e. If leftOnly is true, only
+// rules that can be called before e has consumed any input are included.
+func refs(e Expr, leftOnly bool, nullable func(Expr) bool, fn func(string)) {
+	switch e := e.(type) {
+	case *Choice:
+		for _, a := range e.Alts {
+			refs(a, leftOnly, nullable, fn)
+		}
+	case *Sequence:
+		for _, i := range e.Items {
+			refs(i, leftOnly, nullable, fn)
+
+			if leftOnly && !nullable(i) {
+				break
+			}
+		}
+	case *Lookahead:
+		refs(e.Expr, leftOnly, nullable, fn)
+	case *Repeat:
+		refs(e.Expr, leftOnly, nullable, fn)
+	case *Commented:
+		refs(e.Expr, leftOnly, nullable, fn)
+	case *RuleRef:
+		fn(e.Name)
+	}
+}
@@ -0,0 +1,184 @@
+package dsl
+
+import (
+	"fmt"
+
+	p "github.com/lab47/peggysue"
+)
+
+// Node is the value produced by each definition of a compiled grammar,
+// forming a concrete syntax tree of the input.
+type Node struct {
+	// Rule is the name of the definition that matched or, for a leaf
+	// node produced by a literal such as '+', the literal as it is
+	// written in the grammar.
+	Rule string
+
+	// Start and End are the byte offsets of the input matched.
+	Start, End int
+
+	// Line is the line that the match begins on.
+	Line int
+
+	// Children are the nodes of the definitions referenced and literals
+	// matched while matching, in the order they matched.
+	Children []*Node
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (n *Node) SetPosition(start, end, line int, filename string) {
+	n.Start = start
+	n.End = end
+	n.Line = line
+}
+
+// Text returns the portion of input that the node matched.
+func (n *Node) Text(input string) string {
+	return input[n.Start:n.End]
+}
+
+// Compile converts the definitions in f into a Grammar, rooted at the first
+// definition, that parses with the given options. The value of each
+// definition is a *Node.
+func Compile(f *File, opts ...p.Option) (*p.Grammar, error) {
+	g := p.NewGrammar(opts...)
+
+	for _, d := range f.Defs {
+		if d.Expr == nil {
+			return nil, fmt.Errorf("%d: %s has no expression", d.Line, d.Name)
+		}
+
+		name := d.Name
+
+		g.Define(name, p.Action(p.Named("v", compileExpr(g, d.Expr)), func(v p.Values) interface{} {
+			return &Node{Rule: name, Children: flatten(nil, v.Get("v"))}
+		}))
+	}
+
+	if len(f.Defs) > 0 {
+		g.Root(f.Defs[0].Name)
+	}
+
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Load parses and compiles the grammar in src.
+func Load(filename, src string, opts ...p.Option) (*p.Grammar, error) {
+	f, err := Parse(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compile(f, opts...)
+}
+
+func compileExpr(g *p.Grammar, e Expr) p.Rule {
+	switch e := e.(type) {
+	case *Choice:
+		var alts []p.Rule
+
+		for _, a := range e.Alts {
+			alts = append(alts, compileExpr(g, a))
+		}
+
+		return p.Or(alts...)
+	case *Sequence:
+		switch len(e.Items) {
+		case 0:
+			return p.S("")
+		case 1:
+			return compileExpr(g, e.Items[0])
+		}
+
+		var items []p.Rule
+
+		for _, i := range e.Items {
+			items = append(items, compileExpr(g, i))
+		}
+
+		return p.SeqAll(items...)
+	case *Lookahead:
+		r := compileExpr(g, e.Expr)
+		if e.Not {
+			r = not(r)
+		} else {
+			r = p.Check(r)
+		}
+
+		return p.Action(r, func(p.Values) interface{} { return nil })
+	case *Repeat:
+		r := compileExpr(g, e.Expr)
+
+		switch e.Op {
+		case '?':
+			return p.Maybe(r)
+		case '*':
+			return p.Collect(p.Star(r))
+		default:
+			return p.Collect(p.Plus(r))
+		}
+	case *Commented:
+		return compileExpr(g, e.Expr)
+	case *RuleRef:
+		return g.Ref(e.Name)
+	case *Literal:
+		// Literals produce leaf nodes so that the tree keeps the tokens,
+		// such as operators, that distinguish otherwise similar inputs.
+		name := Format(e)
+
+		return p.Transform(p.S(e.Value), func(string) interface{} {
+			return &Node{Rule: name}
+		})
+	case *Class:
+		ranges := e.Ranges
+		negated := e.Negated
+
+		return p.Rune(func(r rune) bool {
+			for _, cr := range ranges {
+				if r >= cr.Lo && r <= cr.Hi {
+					return !negated
+				}
+			}
+
+			return negated
+		})
+	case *AnyChar:
+		return p.Any()
+	default:
+		panic(fmt.Sprintf("unknown expression type: %T", e))
+	}
+}
+
+// not returns !r, with the meaning it has in standard PEG. Unlike
+// peggysue.Not, it matches at the end of the input when r does not, so that
+// the common !. matches the end of the input.
+func not(r p.Rule) p.Rule {
+	atEnd := p.Scope(p.Seq(
+		p.EOS(),
+		p.Named("r", p.MaybeValue(p.Check(r))),
+		p.CheckAction(func(v p.Values) bool {
+			return !v.Get("r").(p.Optional).Matched
+		}),
+	))
+
+	return p.Or(p.Not(r), atEnd)
+}
+
+// flatten appends the nodes within v, which is a *Node or a nesting of
+// []interface{} as produced by sequences and repetitions, to nodes.
+func flatten(nodes []*Node, v interface{}) []*Node {
+	switch v := v.(type) {
+	case *Node:
+		return append(nodes, v)
+	case []interface{}:
+		for _, sub := range v {
+			nodes = flatten(nodes, sub)
+		}
+	}
+
+	return nodes
+}
@@ -0,0 +1,336 @@
+package dsl
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("parses definitions", func(t *testing.T) {
+		r := require.New(t)
+
+		f, err := Parse("test.peg", `
+# A list of items
+list <- item (',' item)* !.
+
+item <- [a-z_]+ / "(" list ")" / [^\]]? &'x' .
+# trailing
+`)
+		r.NoError(err)
+		r.Len(f.Defs, 2)
+
+		r.Equal("list", f.Defs[0].Name)
+		r.Equal(3, f.Defs[0].Line)
+		r.Equal([]string{" A list of items"}, f.Defs[0].Comments)
+		r.Equal([]string{" trailing"}, f.Trailing)
+
+		r.Equal(&Sequence{Items: []Expr{
+			&RuleRef{Name: "item"},
+			&Repeat{Op: '*', Expr: &Sequence{Items: []Expr{&Literal{Value: ","}, &RuleRef{Name: "item"}}}},
+			&Lookahead{Not: true, Expr: &AnyChar{}},
+		}}, f.Defs[0].Expr)
+
+		r.Equal(&Choice{Alts: []Expr{
+			&Repeat{Op: '+', Expr: &Class{Ranges: []CharRange{{'a', 'z'}, {'_', '_'}}}},
+			&Sequence{Items: []Expr{&Literal{Value: "("}, &RuleRef{Name: "list"}, &Literal{Value: ")"}}},
+			&Sequence{Items: []Expr{
+				&Repeat{Op: '?', Expr: &Class{Negated: true, Ranges: []CharRange{{']', ']'}}}},
+				&Lookahead{Expr: &Literal{Value: "x"}},
+				&AnyChar{},
+			}},
+		}}, f.Defs[1].Expr)
+	})
+
+	t.Run("reports syntax errors", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Parse("test.peg", "a <- 'x'\nb <- (c d] e\n")
+
+		var se *SyntaxError
+		r.ErrorAs(err, &se)
+		r.Equal(2, se.Pos.Line)
+	})
+}
+
+func TestCompile(t *testing.T) {
+	t.Run("produces a tree of nodes", func(t *testing.T) {
+		r := require.New(t)
+
+		g, err := Load("test.peg", `
+sum   <- num ('+' num)*
+num   <- [0-9]+
+`)
+		r.NoError(err)
+
+		input := "1+23"
+
+		val, ok, err := g.Parse(input)
+		r.NoError(err)
+		r.True(ok)
+
+		n := val.(*Node)
+		r.Equal("sum", n.Rule)
+		r.Len(n.Children, 3)
+		r.Equal("'+'", n.Children[1].Rule)
+		r.Equal("+", n.Children[1].Text(input))
+		r.Equal("num", n.Children[2].Rule)
+		r.Equal("23", n.Children[2].Text(input))
+	})
+
+	t.Run("keeps the literals matched in the tree", func(t *testing.T) {
+		r := require.New(t)
+
+		g, err := Load("test.peg", `
+expr <- num (('+' / '-') num)*
+num  <- [0-9]
+`)
+		r.NoError(err)
+
+		rules := func(input string) []string {
+			val, ok, err := g.Parse(input)
+			r.NoError(err)
+			r.True(ok)
+
+			var rules []string
+			for _, c := range val.(*Node).Children {
+				rules = append(rules, c.Rule)
+			}
+
+			return rules
+		}
+
+		r.Equal([]string{"num", "'+'", "num", "'-'", "num"}, rules("1+2-3"))
+		r.Equal([]string{"num", "'-'", "num", "'+'", "num"}, rules("1-2+3"))
+	})
+
+	t.Run("matches !. at the end of the input", func(t *testing.T) {
+		r := require.New(t)
+
+		g, err := Load("test.peg", "a <- 'x' !. / 'x' 'y'?\n")
+		r.NoError(err)
+
+		_, ok, err := g.Parse("x")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = g.Parse("xy")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("reports undefined rules", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Load("test.peg", "a <- b c")
+
+		var ue *p.UndefinedRulesError
+		r.ErrorAs(err, &ue)
+		r.Equal([]string{"b", "c"}, ue.Names)
+	})
+}
+
+func TestFormat(t *testing.T) {
+	t.Run("round trips expressions", func(t *testing.T) {
+		r := require.New(t)
+
+		for _, src := range []string{
+			`a b / c`,
+			`(a / b) c`,
+			`!(a b)* &c+ .?`,
+			`'it\'s\n' [^\]\-a-z\\] [\^x]`,
+			`(a b)?`,
+			`''`,
+		} {
+			f, err := Parse("test.peg", "x <- "+src)
+			r.NoError(err, src)
+			r.Equal(src, Format(f.Defs[0].Expr))
+		}
+	})
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("reports problems with the grammar", func(t *testing.T) {
+		r := require.New(t)
+
+		f, err := Parse("test.peg", `
+expr   <- expr '+' term / term
+term   <- 'a' / 'ab' / num
+num    <- digit* / 'x'
+digit  <- [0-9]?
+spaces <- (' '?)* undefined
+a <- b
+b <- 'x' / a
+`)
+		r.NoError(err)
+
+		var msgs []string
+
+		for _, d := range Check(f) {
+			msgs = append(msgs, d.String())
+		}
+
+		r.Equal([]string{
+			"2: info: expr: rule is left recursive: expr -> expr",
+			"3: warning: term: alternative 'ab' is unreachable because 'a' matches first",
+			"4: error: num: digit* repeats an expression that can match without consuming input",
+			"4: warning: num: alternatives after digit* are unreachable because it always matches",
+			"6: error: spaces: (' '?)* repeats an expression that can match without consuming input",
+			"6: error: spaces: reference to undefined rule undefined",
+			"6: warning: spaces: rule is not reachable from expr",
+			"7: warning: a: rule is not reachable from expr",
+			"7: info: a: rule is left recursive: a -> b -> a",
+			"8: warning: b: rule is not reachable from expr",
+			"8: info: b: rule is left recursive: b -> a -> b",
+		}, msgs)
+	})
+}
+
+func TestFormatFile(t *testing.T) {
+	t.Run("formats a grammar canonically", func(t *testing.T) {
+		r := require.New(t)
+
+		f, err := Parse("test.peg", `# The root
+expr<-   term(('+'/'-')  term)*   # inline comments are kept
+term <- factor ( '*' factor )*
+
+# A factor.
+#
+factor <- [0-9]+ / '(' expr ')' / 'sin' '(' expr ')' / 'cos' '(' expr ')' / 'tan' '(' expr ')'
+# end
+`)
+		r.NoError(err)
+
+		expected := `# The root
+expr   <- term (('+' / '-') term)* # inline comments are kept
+
+term   <- factor ('*' factor)*
+
+# A factor.
+#
+factor <- [0-9]+
+        / '(' expr ')'
+        / 'sin' '(' expr ')'
+        / 'cos' '(' expr ')'
+        / 'tan' '(' expr ')'
+
+# end
+`
+
+		out, err := FormatFile(f)
+		r.NoError(err)
+		r.Equal(expected, out)
+
+		f, err = Parse("test.peg", expected)
+		r.NoError(err)
+
+		out, err = FormatFile(f)
+		r.NoError(err)
+		r.Equal(expected, out)
+	})
+
+	t.Run("keeps every comment", func(t *testing.T) {
+		r := require.New(t)
+
+		src := `# the root
+a <- 'x#' / [#] / b # end of a
+
+# c1
+b <- 'a-long-literal-to-split-the-line' / 'another-long-literal' / 'and-one-more' # end of b
+# trailing
+`
+
+		f, err := Parse("test.peg", src)
+		r.NoError(err)
+		r.Equal(" end of a", f.Defs[0].LineComment)
+		r.False(hasComments(f.Defs[0].Expr))
+
+		out, err := FormatFile(f)
+		r.NoError(err)
+
+		expected := `# the root
+a <- 'x#' / [#] / b # end of a
+
+# c1
+b <- 'a-long-literal-to-split-the-line'
+   / 'another-long-literal'
+   / 'and-one-more' # end of b
+
+# trailing
+`
+		r.Equal(expected, out)
+
+		f, err = Parse("test.peg", out)
+		r.NoError(err)
+
+		out, err = FormatFile(f)
+		r.NoError(err)
+		r.Equal(expected, out)
+	})
+
+	t.Run("keeps comments within a definition", func(t *testing.T) {
+		r := require.New(t)
+
+		f, err := Parse("test.peg", "a <- 'x' # trailing\n  # inner\n  / 'y'\n")
+		r.NoError(err)
+
+		r.Equal(&Choice{Alts: []Expr{
+			&Commented{Expr: &Literal{Value: "x"}, After: []string{" trailing", " inner"}, Inline: true},
+			&Literal{Value: "y"},
+		}}, f.Defs[0].Expr)
+
+		out, err := FormatFile(f)
+		r.NoError(err)
+		r.Equal("a <- 'x' # trailing\n     # inner\n   / 'y'\n", out)
+	})
+
+	t.Run("prints comments within a definition back", func(t *testing.T) {
+		r := require.New(t)
+
+		src := `a <- # first
+  b # after b
+  c
+  ( # in the group
+    'x' 'y'
+    # before the end
+  ) # after the group
+  / ! # checked
+    d +
+b <- 'b' # the end
+c <- 'c'
+d <- 'd'
+`
+
+		f, err := Parse("test.peg", src)
+		r.NoError(err)
+
+		out, err := FormatFile(f)
+		r.NoError(err)
+
+		expected := `a <- # first
+     b # after b
+     c ( # in the group
+     'x' 'y'
+     # before the end
+     ) # after the group
+   / ! # checked
+     d+
+
+b <- 'b' # the end
+
+c <- 'c'
+
+d <- 'd'
+`
+		r.Equal(expected, out)
+
+		f2, err := Parse("test.peg", out)
+		r.NoError(err)
+		r.Equal(f.Defs[0].Expr, f2.Defs[0].Expr)
+
+		out, err = FormatFile(f2)
+		r.NoError(err)
+		r.Equal(expected, out)
+	})
+}
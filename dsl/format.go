@@ -0,0 +1,328 @@
+package dsl
+
+import (
+	"strings"
+)
+
+// Precedence of each kind of expression, used to decide where parentheses
+// are needed.
+const (
+	precChoice = iota
+	precSequence
+	precPrefix
+	precSuffix
+	precPrimary
+)
+
+func precedence(e Expr) int {
+	switch e := e.(type) {
+	case *Choice:
+		return precChoice
+	case *Sequence:
+		if len(e.Items) == 1 {
+			return precedence(e.Items[0])
+		}
+
+		return precSequence
+	case *Lookahead:
+		return precPrefix
+	case *Repeat:
+		return precSuffix
+	case *Commented:
+		return precedence(e.Expr)
+	default:
+		return precPrimary
+	}
+}
+
+// Format returns e in the textual grammar syntax, without the comments
+// within it.
+func Format(e Expr) string {
+	var pr printer
+	pr.expr(e)
+	return pr.sb.String()
+}
+
+// printer writes expressions in the textual grammar syntax.
+type printer struct {
+	sb strings.Builder
+
+	// comments is true if the comments of Commented expressions are
+	// written. A comment ends the line, so the text after it begins a new
+	// line at indent.
+	comments bool
+	indent   string
+
+	// eol is true if the line has been ended by a comment.
+	eol bool
+}
+
+// write writes s, beginning a new line first if the last one was ended by
+// a comment.
+func (pr *printer) write(s string) {
+	if pr.eol {
+		pr.sb.WriteString("\n" + pr.indent)
+		s = strings.TrimLeft(s, " ")
+		pr.eol = false
+	}
+
+	pr.sb.WriteString(s)
+}
+
+func (pr *printer) operand(e Expr, min int) {
+	if c, ok := e.(*Commented); ok {
+		pr.commented(c, min)
+		return
+	}
+
+	if precedence(e) < min {
+		pr.write("(")
+		pr.expr(e)
+		pr.write(")")
+	} else {
+		pr.expr(e)
+	}
+}
+
+func (pr *printer) commented(c *Commented, min int) {
+	if !pr.comments {
+		pr.operand(c.Expr, min)
+		return
+	}
+
+	for _, t := range c.Before {
+		pr.comment(t)
+	}
+
+	pr.operand(c.Expr, min)
+
+	for i, t := range c.After {
+		if i > 0 || !c.Inline {
+			pr.eol = true
+		}
+
+		pr.comment(t)
+	}
+}
+
+// comment writes the comment t, which ends the line.
+func (pr *printer) comment(t string) {
+	if !pr.eol && !strings.HasSuffix(pr.sb.String(), " ") {
+		pr.sb.WriteString(" ")
+	}
+
+	pr.write("#" + strings.TrimRight(t, " \t\r"))
+	pr.eol = true
+}
+
+func (pr *printer) expr(e Expr) {
+	switch e := e.(type) {
+	case *Choice:
+		for i, a := range e.Alts {
+			if i > 0 {
+				pr.write(" / ")
+			}
+
+			pr.operand(a, precSequence)
+		}
+	case *Sequence:
+		if len(e.Items) == 0 {
+			pr.write("''")
+		}
+
+		for i, item := range e.Items {
+			if i > 0 {
+				pr.write(" ")
+			}
+
+			pr.operand(item, precPrefix)
+		}
+	case *Lookahead:
+		if e.Not {
+			pr.write("!")
+		} else {
+			pr.write("&")
+		}
+
+		pr.operand(e.Expr, precSuffix)
+	case *Repeat:
+		pr.operand(e.Expr, precPrimary)
+		pr.write(string(e.Op))
+	case *Commented:
+		pr.commented(e, precChoice)
+	case *RuleRef:
+		pr.write(e.Name)
+	case *Literal:
+		var sb strings.Builder
+
+		sb.WriteString("'")
+
+		for _, r := range e.Value {
+			switch r {
+			case '\'':
+				sb.WriteString(`\'`)
+			default:
+				writeChar(&sb, r)
+			}
+		}
+
+		sb.WriteString("'")
+		pr.write(sb.String())
+	case *Class:
+		var sb strings.Builder
+
+		sb.WriteString("[")
+
+		if e.Negated {
+			sb.WriteString("^")
+		}
+
+		for i, cr := range e.Ranges {
+			writeClassChar(&sb, cr.Lo, i == 0 && !e.Negated)
+
+			if cr.Hi != cr.Lo {
+				sb.WriteString("-")
+				writeClassChar(&sb, cr.Hi, false)
+			}
+		}
+
+		sb.WriteString("]")
+		pr.write(sb.String())
+	case *AnyChar:
+		pr.write(".")
+	}
+}
+
+func writeChar(sb *strings.Builder, r rune) {
+	switch r {
+	case '\n':
+		sb.WriteString(`\n`)
+	case '\r':
+		sb.WriteString(`\r`)
+	case '\t':
+		sb.WriteString(`\t`)
+	case '\\':
+		sb.WriteString(`\\`)
+	default:
+		sb.WriteRune(r)
+	}
+}
+
+func writeClassChar(sb *strings.Builder, r rune, first bool) {
+	switch {
+	case r == ']' || r == '-':
+		sb.WriteString(`\` + string(r))
+	case r == '^' && first:
+		sb.WriteString(`\^`)
+	default:
+		writeChar(sb, r)
+	}
+}
+
+// maxLineLength is the length beyond which FormatFile places each
+// alternative of a choice on its own line.
+const maxLineLength = 80
+
+// FormatFile returns the grammar in canonical form. Each definition is
+// preceded by its comments and separated from the next by a blank line,
+// the arrows of all definitions are aligned, and choices that do not fit
+// on one line, or that have comments within them, have an alternative per
+// line. The comments within a definition are kept with the terms they
+// follow, and the comment at the end of a definition stays at the end of
+// it.
+func FormatFile(f *File) (string, error) {
+	var (
+		sb    strings.Builder
+		width int
+	)
+
+	for _, d := range f.Defs {
+		if len(d.Name) > width {
+			width = len(d.Name)
+		}
+	}
+
+	for i, d := range f.Defs {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		writeComments(&sb, d.Comments)
+
+		prefix := d.Name + strings.Repeat(" ", width-len(d.Name)) + " <- "
+
+		pr := printer{comments: true, indent: strings.Repeat(" ", len(prefix))}
+		pr.sb.WriteString(prefix)
+
+		c, ok := d.Expr.(*Choice)
+		if !ok || (len(prefix+Format(d.Expr)) <= maxLineLength && !hasComments(d.Expr)) {
+			pr.expr(d.Expr)
+		} else {
+			indent := strings.Repeat(" ", width+2) + "/ "
+
+			for j, a := range c.Alts {
+				if j > 0 {
+					pr.sb.WriteString("\n" + indent)
+					pr.eol = false
+				}
+
+				pr.operand(a, precSequence)
+			}
+		}
+
+		pr.write("")
+		sb.WriteString(pr.sb.String())
+		writeLineComment(&sb, d.LineComment)
+	}
+
+	if len(f.Trailing) > 0 {
+		if len(f.Defs) > 0 {
+			sb.WriteString("\n")
+		}
+
+		writeComments(&sb, f.Trailing)
+	}
+
+	return sb.String(), nil
+}
+
+// writeLineComment ends the line, with the comment c if there is one.
+func writeLineComment(sb *strings.Builder, c string) {
+	if c = strings.TrimRight(c, " \t\r"); c != "" {
+		sb.WriteString(" #" + c)
+	}
+
+	sb.WriteString("\n")
+}
+
+func writeComments(sb *strings.Builder, comments []string) {
+	for _, c := range comments {
+		sb.WriteString("#" + strings.TrimRight(c, " \t\r") + "\n")
+	}
+}
+
+// hasComments reports whether there are comments within e.
+func hasComments(e Expr) bool {
+	switch e := e.(type) {
+	case *Choice:
+		for _, a := range e.Alts {
+			if hasComments(a) {
+				return true
+			}
+		}
+	case *Sequence:
+		for _, i := range e.Items {
+			if hasComments(i) {
+				return true
+			}
+		}
+	case *Lookahead:
+		return hasComments(e.Expr)
+	case *Repeat:
+		return hasComments(e.Expr)
+	case *Commented:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,489 @@
+package dsl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+// SyntaxError is returned when a grammar can not be parsed.
+type SyntaxError struct {
+	Pos p.Pos
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: syntax error", e.Pos)
+}
+
+var escapes = map[string]string{
+	"n": "\n", "r": "\r", "t": "\t", "\\": "\\", "'": "'", "\"": "\"", "[": "[", "]": "]", "-": "-", "^": "^",
+}
+
+type defPos struct {
+	line int
+}
+
+func (d *defPos) SetPosition(start, end, line int, filename string) {
+	d.line = line
+}
+
+var file p.Rule
+
+func init() {
+	ws := p.Set(' ', '\t', '\r', '\n')
+	comment := p.Seq(p.S("#"), p.Capture(p.Star(p.Seq(p.Not(p.S("\n")), p.Any()))))
+
+	sp := p.Star(p.Or(ws, comment))
+
+	// comments matches the same input as sp and returns the comments in it.
+	comments := p.Transform(sp, func(text string) interface{} {
+		return commentsIn(text)
+	})
+
+	alpha := p.Or(p.Range('a', 'z'), p.Range('A', 'Z'), p.S("_"))
+	ident := p.Capture(p.Seq(alpha, p.Star(p.Or(alpha, p.Range('0', '9'), p.S("-")))))
+
+	escape := p.Action(p.Seq(p.S("\\"), p.Named("c", p.Capture(p.Any()))), func(v p.Values) interface{} {
+		c := v.Get("c").(string)
+		if e, ok := escapes[c]; ok {
+			return e
+		}
+
+		return "\\" + c
+	})
+
+	char := p.Or(escape, p.Seq(p.Not(p.S("\\")), p.Capture(p.Any())))
+
+	literal := func(q string) p.Rule {
+		return p.Action(
+			p.Seq(p.S(q), p.Named("chars", p.Collect(p.Star(p.Seq(p.Not(p.S(q)), char)))), p.S(q)),
+			func(v p.Values) interface{} {
+				var sb strings.Builder
+
+				for _, c := range v.Get("chars").([]interface{}) {
+					sb.WriteString(c.(string))
+				}
+
+				return &Literal{Value: sb.String()}
+			},
+		)
+	}
+
+	classChar := p.Action(p.Seq(p.Not(p.S("]")), p.Named("c", char)), func(v p.Values) interface{} {
+		return []rune(v.Get("c").(string))[0]
+	})
+
+	classItem := p.Or(
+		p.Action(p.Seq(p.Named("lo", classChar), p.S("-"), p.Named("hi", classChar)), func(v p.Values) interface{} {
+			return CharRange{Lo: v.Get("lo").(rune), Hi: v.Get("hi").(rune)}
+		}),
+		p.Action(p.Named("c", classChar), func(v p.Values) interface{} {
+			c := v.Get("c").(rune)
+			return CharRange{Lo: c, Hi: c}
+		}),
+	)
+
+	class := p.Action(
+		p.Seq(p.S("["), p.Named("neg", p.MaybeValue(p.S("^"))), p.Named("items", p.Collect(p.Star(classItem))), p.S("]")),
+		func(v p.Values) interface{} {
+			c := &Class{Negated: v.Get("neg").(p.Optional).Matched}
+
+			for _, r := range v.Get("items").([]interface{}) {
+				c.Ranges = append(c.Ranges, r.(CharRange))
+			}
+
+			return c
+		},
+	)
+
+	expr := p.R("expr")
+
+	// Terms don't consume the white space that follows them. It is
+	// matched, along with any comments in it, by whatever comes next, so
+	// that the comments can be kept with the term they follow or precede.
+	primary := p.Or(
+		p.Action(p.Seq(p.Named("name", ident), not(p.Seq(sp, p.S("<-")))), func(v p.Values) interface{} {
+			return &RuleRef{Name: v.Get("name").(string)}
+		}),
+		p.Action(p.Seq(p.S("("), p.Named("e", expr), p.S(")")), func(v p.Values) interface{} {
+			return v.Get("e")
+		}),
+		literal("'"),
+		literal("\""),
+		class,
+		p.Action(p.S("."), func(p.Values) interface{} {
+			return &AnyChar{}
+		}),
+	)
+
+	suffixOp := p.Action(
+		p.Seq(p.Named("c", comments), p.Named("op", p.Capture(p.Set('?', '*', '+')))),
+		func(v p.Values) interface{} {
+			return &suffixed{op: v.Get("op").(string)[0], comments: v.Get("c").(commentRun)}
+		},
+	)
+
+	suffix := p.Action(
+		p.Seq(p.Named("e", primary), p.Named("op", p.MaybeValue(suffixOp))),
+		func(v p.Values) interface{} {
+			e := v.Get("e").(Expr)
+
+			if op := v.Get("op").(p.Optional); op.Matched {
+				so := op.Value.(*suffixed)
+				return addAfter(&Repeat{Op: so.op, Expr: e}, so.comments)
+			}
+
+			return e
+		},
+	)
+
+	prefix := p.Action(
+		p.Seq(p.Named("op", p.MaybeValue(p.Capture(p.Set('&', '!')))), p.Named("c", comments), p.Named("e", suffix)),
+		func(v p.Values) interface{} {
+			e := addBefore(v.Get("e").(Expr), v.Get("c").(commentRun))
+
+			if op := v.Get("op").(p.Optional); op.Matched {
+				return &Lookahead{Not: op.Value == "!", Expr: e}
+			}
+
+			return e
+		},
+	)
+
+	item := p.Action(p.Seq(p.Named("c", comments), p.Named("e", prefix)), func(v p.Values) interface{} {
+		return &commented{e: v.Get("e").(Expr), comments: v.Get("c").(commentRun)}
+	})
+
+	// The comments before the first item of a sequence precede it, and
+	// those before each other item follow the item before it.
+	seq := p.Action(p.Named("items", p.Collect(p.Star(item))), func(v p.Values) interface{} {
+		s := &Sequence{}
+
+		for _, i := range v.Get("items").([]interface{}) {
+			ci := i.(*commented)
+
+			if len(s.Items) == 0 {
+				s.Items = append(s.Items, addBefore(ci.e, ci.comments))
+				continue
+			}
+
+			s.Items[len(s.Items)-1] = addAfter(s.Items[len(s.Items)-1], ci.comments)
+			s.Items = append(s.Items, ci.e)
+		}
+
+		return s
+	})
+
+	alt := p.Action(p.Seq(p.Named("c", comments), p.S("/"), p.Named("s", seq)), func(v p.Values) interface{} {
+		return &commented{e: v.Get("s").(Expr), comments: v.Get("c").(commentRun)}
+	})
+
+	// choice matches alternatives followed by tail, which matches the
+	// comments after the last of them. The comments before each / follow
+	// the alternative before it.
+	choice := func(tail p.Rule) p.Rule {
+		return p.Action(
+			p.Seq(p.Named("first", seq), p.Named("rest", p.Collect(p.Star(alt))), p.Named("tail", tail)),
+			func(v p.Values) interface{} {
+				alts := []*Sequence{v.Get("first").(*Sequence)}
+				after := []commentRun{}
+
+				for _, a := range v.Get("rest").([]interface{}) {
+					ca := a.(*commented)
+
+					after = append(after, ca.comments)
+					alts = append(alts, ca.e.(*Sequence))
+				}
+
+				after = append(after, v.Get("tail").(commentRun))
+
+				var exprs []Expr
+
+				for i, s := range alts {
+					var e Expr = s
+
+					if len(s.Items) > 0 {
+						s.Items[len(s.Items)-1] = addAfter(s.Items[len(s.Items)-1], after[i])
+
+						if len(s.Items) == 1 {
+							e = s.Items[0]
+						}
+					} else {
+						e = addAfter(s, after[i])
+					}
+
+					exprs = append(exprs, e)
+				}
+
+				if len(exprs) == 1 {
+					return exprs[0]
+				}
+
+				return &Choice{Alts: exprs}
+			},
+		)
+	}
+
+	expr.Set(choice(comments))
+
+	// The comments at the end of a definition are assigned to it by
+	// attachComments instead.
+	noComments := p.Transform(p.S(""), func(string) interface{} { return commentRun{} })
+
+	def := p.Action(
+		p.Seq(
+			p.Named("pos", p.Transform(p.S(""), func(string) interface{} { return &defPos{} })),
+			p.Named("name", ident),
+			sp,
+			p.S("<-"),
+			p.Named("expr", choice(noComments)),
+			sp,
+		),
+		func(v p.Values) interface{} {
+			return &Def{
+				Name: v.Get("name").(string),
+				Expr: v.Get("expr").(Expr),
+				Line: v.Get("pos").(*defPos).line,
+			}
+		},
+	)
+
+	file = p.Action(
+		p.Seq(sp, p.Named("defs", p.Collect(p.Star(def)))),
+		func(v p.Values) interface{} {
+			f := &File{}
+
+			for _, d := range v.Get("defs").([]interface{}) {
+				f.Defs = append(f.Defs, d.(*Def))
+			}
+
+			return f
+		},
+	)
+}
+
+// Parse parses the text of a grammar. The filename is used in errors.
+func Parse(filename, src string) (*File, error) {
+	val, ok, err := p.New(p.WithFilename(filename)).Parse(file, src)
+	if err != nil {
+		var nc *p.ErrInputNotConsumed
+		if errors.As(err, &nc) {
+			return nil, &SyntaxError{Pos: nc.Pos}
+		}
+
+		return nil, err
+	}
+
+	if !ok {
+		return nil, &SyntaxError{Pos: p.Pos{Line: 1, Column: 1, Filename: filename}}
+	}
+
+	f := val.(*File)
+	attachComments(f, src)
+
+	return f, nil
+}
+
+// attachComments assigns the comments on the lines preceding each definition
+// to it, the comment at the end of its last line to its LineComment, and those
+// at the end of src to f.Trailing. The other comments within definitions are
+// already held by Commented expressions.
+func attachComments(f *File, src string) {
+	lines := strings.Split(src, "\n")
+
+	// blank returns true if line n, counting from 0, has nothing but
+	// whitespace or a comment.
+	blank := func(n int) bool {
+		l := strings.TrimSpace(lines[n])
+		return l == "" || strings.HasPrefix(l, "#")
+	}
+
+	// above returns the comments in the run of comment and blank lines
+	// that ends just before line n.
+	above := func(n int) []string {
+		start := n
+
+		for start > 0 && blank(start-1) {
+			start--
+		}
+
+		var comments []string
+
+		for _, l := range lines[start:n] {
+			if l = strings.TrimSpace(l); l != "" {
+				comments = append(comments, l[1:])
+			}
+		}
+
+		return comments
+	}
+
+	comments := scanComments(src)
+
+	for i, d := range f.Defs {
+		d.Comments = above(d.Line - 1)
+
+		end := len(lines) + 1
+		if i+1 < len(f.Defs) {
+			end = f.Defs[i+1].Line
+		}
+
+		// The definition ends on the last line before end that has more
+		// than a comment on it. The comments after it belong to the next
+		// definition, or are trailing.
+		last := end - 1
+		for last > d.Line && blank(last-1) {
+			last--
+		}
+
+		for _, c := range comments {
+			switch {
+			case c.line < d.Line || c.line > last:
+				continue
+			case c.line == last && !c.own:
+				d.LineComment = c.text
+			}
+		}
+	}
+
+	f.Trailing = above(len(lines))
+}
+
+// commentRun is the comments in a run of white space.
+type commentRun struct {
+	texts []string
+
+	// inline is true if the first comment is on the line the run begins on.
+	inline bool
+}
+
+// commentsIn returns the comments in text, which is white space and
+// comments.
+func commentsIn(text string) commentRun {
+	var run commentRun
+
+	for i, l := range strings.Split(text, "\n") {
+		if j := strings.IndexByte(l, '#'); j >= 0 {
+			if i == 0 {
+				run.inline = true
+			}
+
+			run.texts = append(run.texts, strings.TrimRight(l[j+1:], " \t\r"))
+		}
+	}
+
+	return run
+}
+
+// commented is an expression along with the comments that precede it.
+type commented struct {
+	e        Expr
+	comments commentRun
+}
+
+type suffixed struct {
+	op       byte
+	comments commentRun
+}
+
+// addBefore returns e with the comments c before it.
+func addBefore(e Expr, c commentRun) Expr {
+	if len(c.texts) == 0 {
+		return e
+	}
+
+	if ce, ok := e.(*Commented); ok {
+		ce.Before = append(c.texts, ce.Before...)
+		return ce
+	}
+
+	return &Commented{Expr: e, Before: c.texts}
+}
+
+// addAfter returns e with the comments c after it.
+func addAfter(e Expr, c commentRun) Expr {
+	if len(c.texts) == 0 {
+		return e
+	}
+
+	if ce, ok := e.(*Commented); ok {
+		if len(ce.After) == 0 {
+			ce.Inline = c.inline
+		}
+
+		ce.After = append(ce.After, c.texts...)
+		return ce
+	}
+
+	return &Commented{Expr: e, After: c.texts, Inline: c.inline}
+}
+
+type comment struct {
+	line int
+	text string
+
+	// own is true if the comment is the only thing on its line.
+	own bool
+}
+
+// scanComments returns the comments in src, skipping over the '#' characters
+// in literals and classes.
+func scanComments(src string) []comment {
+	var (
+		comments []comment
+		line     = 1
+		code     bool
+	)
+
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '\n':
+			line++
+			code = false
+		case ' ', '\t', '\r':
+		case '#':
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+
+			comments = append(comments, comment{line: line, text: src[i+1 : i+end], own: !code})
+			i += end - 1
+		case '\'', '"', '[':
+			code = true
+
+			term := c
+			if c == '[' {
+				term = ']'
+			}
+
+			for i++; i < len(src) && src[i] != term; i++ {
+				switch src[i] {
+				case '\\':
+					if i++; i < len(src) && src[i] == '\n' {
+						line++
+					}
+				case '\n':
+					line++
+				}
+			}
+		default:
+			code = true
+		}
+	}
+
+	return comments
+}
+
+// ParseFile reads and parses the grammar in the file at path.
+func ParseFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(path, string(data))
+}
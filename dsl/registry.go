@@ -0,0 +1,207 @@
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	p "github.com/lab47/peggysue"
+)
+
+// GrammarRegistry holds grammars compiled from files, recompiling them when
+// the files change. Code using a grammar calls Get each time it needs it,
+// so that it sees the latest version. It is safe for concurrent use.
+type GrammarRegistry struct {
+	opts []p.Option
+
+	// mu guards entries and the grammar of each entry.
+	mu      sync.RWMutex
+	entries map[string]*registryEntry
+
+	// reloadMu serializes reloading, which updates the file versions and
+	// failures of the entries.
+	reloadMu sync.Mutex
+}
+
+type registryEntry struct {
+	path    string
+	modTime time.Time
+	size    int64
+
+	// failure is the message of the last error reported for the entry,
+	// so that an error that persists, such as the file having been
+	// removed, is reported only when it changes.
+	failure string
+
+	grammar *p.Grammar
+}
+
+// NewGrammarRegistry returns an empty registry whose grammars parse with
+// the given options.
+func NewGrammarRegistry(opts ...p.Option) *GrammarRegistry {
+	return &GrammarRegistry{
+		opts:    opts,
+		entries: map[string]*registryEntry{},
+	}
+}
+
+// Load compiles the grammar in the file at path and registers it as name,
+// replacing any grammar previously registered as name.
+func (r *GrammarRegistry) Load(name, path string) error {
+	e := &registryEntry{path: path}
+
+	g, err := r.compile(e)
+	if err != nil {
+		return err
+	}
+
+	e.grammar = g
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[name] = e
+
+	return nil
+}
+
+// compile compiles the grammar for e, recording the version of the file
+// that was compiled even if it fails so that it is not retried until the
+// file changes again.
+func (r *GrammarRegistry) compile(e *registryEntry) (*p.Grammar, error) {
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	e.modTime = fi.ModTime()
+	e.size = fi.Size()
+
+	f, err := ParseFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compile(f, r.opts...)
+}
+
+// Get returns the current version of the grammar registered as name, or nil
+// if there is none.
+func (r *GrammarRegistry) Get(name string) *p.Grammar {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.entries[name]
+	if !ok {
+		return nil
+	}
+
+	return e.grammar
+}
+
+// ReloadError is returned by Reload when grammars could not be recompiled.
+// The previous versions of those grammars remain in use.
+type ReloadError struct {
+	// Errors are the errors for each grammar, by name.
+	Errors map[string]error
+}
+
+func (e *ReloadError) Error() string {
+	var names []string
+
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	msg := "unable to reload grammars:"
+
+	for _, name := range names {
+		msg += fmt.Sprintf(" %s: %s;", name, e.Errors[name])
+	}
+
+	return msg[:len(msg)-1]
+}
+
+// Reload recompiles the grammars whose files have changed since they were
+// last compiled. Grammars that fail to compile keep their previous version
+// and are reported in a ReloadError, once for each change to the file. An
+// error reading a file is reported once, until it changes.
+//
+// Grammars are compiled without holding the lock that Get uses, so that
+// Get is not blocked while they compile.
+func (r *GrammarRegistry) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	r.mu.RLock()
+	entries := make(map[string]*registryEntry, len(r.entries))
+	for name, e := range r.entries {
+		entries[name] = e
+	}
+	r.mu.RUnlock()
+
+	var errs map[string]error
+
+	for name, e := range entries {
+		fi, err := os.Stat(e.path)
+
+		switch {
+		case err != nil:
+			if err.Error() == e.failure {
+				continue
+			}
+		case fi.ModTime().Equal(e.modTime) && fi.Size() == e.size:
+			e.failure = ""
+			continue
+		default:
+			var g *p.Grammar
+
+			g, err = r.compile(e)
+			if err == nil {
+				r.mu.Lock()
+				e.grammar = g
+				r.mu.Unlock()
+
+				e.failure = ""
+				continue
+			}
+		}
+
+		e.failure = err.Error()
+
+		if errs == nil {
+			errs = map[string]error{}
+		}
+
+		errs[name] = err
+	}
+
+	if errs != nil {
+		return &ReloadError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Watch calls Reload every interval until ctx is done. If onError is not nil,
+// it is called with the errors from Reload.
+func (r *GrammarRegistry) Watch(ctx context.Context, interval time.Duration, onError func(err error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package dsl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrammarRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.peg")
+
+	write := func(src string, mod time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+		require.NoError(t, os.Chtimes(path, mod, mod))
+	}
+
+	now := time.Now()
+
+	t.Run("reloads grammars when their file changes", func(t *testing.T) {
+		r := require.New(t)
+
+		write("a <- 'a'", now)
+
+		reg := NewGrammarRegistry()
+		r.NoError(reg.Load("test", path))
+		r.Nil(reg.Get("other"))
+
+		_, ok, err := reg.Get("test").Parse("a")
+		r.NoError(err)
+		r.True(ok)
+
+		r.NoError(reg.Reload())
+
+		write("a <- 'b'", now.Add(time.Second))
+		r.NoError(reg.Reload())
+
+		_, ok, err = reg.Get("test").Parse("b")
+		r.NoError(err)
+		r.True(ok)
+
+		write("a <- (", now.Add(2*time.Second))
+
+		err = reg.Reload()
+
+		var re *ReloadError
+		r.ErrorAs(err, &re)
+		r.Contains(re.Errors, "test")
+
+		r.NoError(reg.Reload())
+
+		_, ok, err = reg.Get("test").Parse("b")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("reports an error reading a file once", func(t *testing.T) {
+		r := require.New(t)
+
+		write("a <- 'a'", now)
+
+		reg := NewGrammarRegistry()
+		r.NoError(reg.Load("test", path))
+
+		r.NoError(os.Remove(path))
+
+		var re *ReloadError
+		r.ErrorAs(reg.Reload(), &re)
+		r.Contains(re.Errors, "test")
+
+		r.NoError(reg.Reload())
+		r.NoError(reg.Reload())
+
+		_, ok, err := reg.Get("test").Parse("a")
+		r.NoError(err)
+		r.True(ok)
+
+		write("a <- 'd'", now.Add(time.Second))
+		r.NoError(reg.Reload())
+
+		_, ok, err = reg.Get("test").Parse("d")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("watches for changes", func(t *testing.T) {
+		r := require.New(t)
+
+		write("a <- 'a'", now)
+
+		reg := NewGrammarRegistry()
+		r.NoError(reg.Load("test", path))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go reg.Watch(ctx, time.Millisecond, nil)
+
+		write("a <- 'c'", now.Add(time.Second))
+
+		r.Eventually(func() bool {
+			_, ok, _ := reg.Get("test").Parse("c")
+			return ok
+		}, time.Second, time.Millisecond)
+	})
+}
@@ -0,0 +1,315 @@
+package peggysue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Positioner is implemented by values that can report the position they
+// were given by SetPositioner. It is used by EncodeAST.
+type Positioner interface {
+	Position() (start, end, line int, filename string)
+}
+
+// EncodeAST encodes v, an AST built by a parse, as JSON. It gives AST values
+// a standard form for downstream tools and golden tests, without needing
+// MarshalJSON methods.
+//
+// Each struct is encoded as an object with a "$type" member holding the name
+// of its type, followed by its exported fields, named by their `json:` tag
+// if they have one. Fields tagged `json:"-"` are skipped. Embedded structs
+// have their fields included in the object, as with encoding/json.
+//
+// If a struct has a position, it is encoded as a "$span" member with the
+// start and end offsets, line, and filename. The position is taken from the
+// Position method if the struct implements Positioner, otherwise from int
+// fields named Start and End, and optionally Line and a string Filename,
+// in the struct or a struct embedded in it, such as a Pos type that
+// implements SetPositioner. An embedded struct that implements
+// SetPositioner is not otherwise encoded.
+//
+// Pointers and interfaces are encoded as the value they refer to, or null.
+// Maps are encoded as objects with sorted keys. Other values are encoded as
+// they are by encoding/json.
+func EncodeAST(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := encodeAST(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+var (
+	setPositionerType = reflect.TypeOf((*SetPositioner)(nil)).Elem()
+	positionerType    = reflect.TypeOf((*Positioner)(nil)).Elem()
+)
+
+func encodeAST(buf *bytes.Buffer, rv reflect.Value) error {
+	if !rv.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Struct {
+			return encodeStruct(buf, rv.Elem(), rv)
+		}
+
+		return encodeAST(buf, rv.Elem())
+	case reflect.Struct:
+		return encodeStruct(buf, rv, reflect.Value{})
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		// Encode []byte as encoding/json does.
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		buf.WriteByte('[')
+
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeAST(buf, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte(']')
+
+		return nil
+	case reflect.Map:
+		if rv.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		keys := make([]string, 0, rv.Len())
+		vals := make(map[string]reflect.Value, rv.Len())
+
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			keys = append(keys, key)
+			vals[key] = iter.Value()
+		}
+
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			writeJSON(buf, key)
+			buf.WriteByte(':')
+
+			if err := encodeAST(buf, vals[key]); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte('}')
+
+		return nil
+	}
+
+	data, err := json.Marshal(rv.Interface())
+	if err != nil {
+		return err
+	}
+
+	buf.Write(data)
+
+	return nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	// Strings and ints can always be marshaled.
+	data, _ := json.Marshal(v)
+	buf.Write(data)
+}
+
+// encodeStruct encodes the struct rv. ptr is the pointer to it, if it was
+// reached through one, which is needed to call pointer methods.
+func encodeStruct(buf *bytes.Buffer, rv, ptr reflect.Value) error {
+	buf.WriteString(`{"$type":`)
+	writeJSON(buf, rv.Type().Name())
+
+	if start, end, line, filename, ok := structPosition(rv, ptr); ok {
+		fmt.Fprintf(buf, `,"$span":{"start":%d,"end":%d,"line":%d`, start, end, line)
+
+		if filename != "" {
+			buf.WriteString(`,"filename":`)
+			writeJSON(buf, filename)
+		}
+
+		buf.WriteByte('}')
+	}
+
+	if err := encodeFields(buf, rv); err != nil {
+		return err
+	}
+
+	buf.WriteByte('}')
+
+	return nil
+}
+
+func encodeFields(buf *bytes.Buffer, rv reflect.Value) error {
+	typ := rv.Type()
+
+	for i := 0; i < rv.NumField(); i++ {
+		ft := typ.Field(i)
+		fv := rv.Field(i)
+
+		if ft.Anonymous {
+			et := ft.Type
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+
+			if et.Kind() == reflect.Struct {
+				if reflect.PointerTo(et).Implements(setPositionerType) {
+					continue
+				}
+
+				if fv.Kind() == reflect.Pointer {
+					if fv.IsNil() {
+						continue
+					}
+
+					fv = fv.Elem()
+				}
+
+				if err := encodeFields(buf, fv); err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		if !ft.IsExported() {
+			continue
+		}
+
+		name := ft.Name
+
+		if tag := ft.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+
+		buf.WriteByte(',')
+		writeJSON(buf, name)
+		buf.WriteByte(':')
+
+		if err := encodeAST(buf, fv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// structPosition returns the position of the struct rv, see EncodeAST.
+func structPosition(rv, ptr reflect.Value) (start, end, line int, filename string, ok bool) {
+	if ptr.IsValid() && ptr.Type().Implements(positionerType) {
+		start, end, line, filename = ptr.Interface().(Positioner).Position()
+		return start, end, line, filename, true
+	}
+
+	if rv.Type().Implements(positionerType) {
+		start, end, line, filename = rv.Interface().(Positioner).Position()
+		return start, end, line, filename, true
+	}
+
+	if start, end, line, filename, ok = positionFields(rv); ok {
+		return start, end, line, filename, true
+	}
+
+	typ := rv.Type()
+
+	for i := 0; i < rv.NumField(); i++ {
+		fv := rv.Field(i)
+
+		if !typ.Field(i).Anonymous {
+			continue
+		}
+
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() != reflect.Struct {
+			continue
+		}
+
+		if start, end, line, filename, ok = positionFields(fv); ok {
+			return start, end, line, filename, true
+		}
+	}
+
+	return 0, 0, 0, "", false
+}
+
+// positionFields returns the position held in the Start, End, Line, and
+// Filename fields of rv.
+func positionFields(rv reflect.Value) (start, end, line int, filename string, ok bool) {
+	intField := func(name string) (int, bool) {
+		fv := rv.FieldByName(name)
+		if !fv.IsValid() || !fv.CanInt() {
+			return 0, false
+		}
+
+		return int(fv.Int()), true
+	}
+
+	start, ok = intField("Start")
+	if !ok {
+		return 0, 0, 0, "", false
+	}
+
+	end, ok = intField("End")
+	if !ok {
+		return 0, 0, 0, "", false
+	}
+
+	line, _ = intField("Line")
+
+	if fv := rv.FieldByName("Filename"); fv.IsValid() && fv.Kind() == reflect.String {
+		filename = fv.String()
+	}
+
+	return start, end, line, filename, true
+}
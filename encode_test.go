@@ -0,0 +1,96 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type encPos struct {
+	Start, End, Line int
+}
+
+func (p *encPos) SetPosition(start, end, line int, filename string) {
+	p.Start, p.End, p.Line = start, end, line
+}
+
+type encIdent struct {
+	encPos
+	Name string
+}
+
+type encCall struct {
+	encPos
+	Func *encIdent
+	Args []interface{} `json:"args"`
+	memo int
+}
+
+type encLit struct {
+	Value  int
+	Hidden string `json:"-"`
+	pos    [2]int
+}
+
+func (l *encLit) Position() (start, end, line int, filename string) {
+	return l.pos[0], l.pos[1], 1, "x.go"
+}
+
+func TestEncodeAST(t *testing.T) {
+	t.Run("includes types, fields, and spans", func(t *testing.T) {
+		call := &encCall{
+			encPos: encPos{Start: 0, End: 8, Line: 1},
+			Func:   &encIdent{encPos: encPos{Start: 0, End: 1, Line: 1}, Name: "f"},
+			Args: []interface{}{
+				&encLit{Value: 1, Hidden: "no", pos: [2]int{2, 3}},
+				nil,
+			},
+		}
+
+		data, err := EncodeAST(call)
+		require.NoError(t, err)
+
+		require.JSONEq(t, `{
+			"$type": "encCall",
+			"$span": {"start": 0, "end": 8, "line": 1},
+			"Func": {
+				"$type": "encIdent",
+				"$span": {"start": 0, "end": 1, "line": 1},
+				"Name": "f"
+			},
+			"args": [
+				{
+					"$type": "encLit",
+					"$span": {"start": 2, "end": 3, "line": 1, "filename": "x.go"},
+					"Value": 1
+				},
+				null
+			]
+		}`, string(data))
+	})
+
+	t.Run("is deterministic for maps", func(t *testing.T) {
+		data, err := EncodeAST(map[string]interface{}{
+			"b": 2,
+			"a": []string{"x"},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, `{"a":["x"],"b":2}`, string(data))
+	})
+
+	t.Run("encodes values from a parse", func(t *testing.T) {
+		ident := Action(Named("name", Capture(Plus(Range('a', 'z')))), func(v Values) interface{} {
+			return &encIdent{Name: v.Get("name").(string)}
+		})
+
+		val, ok, err := New().Parse(Seq(S(" "), ident), " abc")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		data, err := EncodeAST(val)
+		require.NoError(t, err)
+
+		require.Equal(t, `{"$type":"encIdent","$span":{"start":1,"end":4,"line":1},"Name":"abc"}`, string(data))
+	})
+}
@@ -0,0 +1,213 @@
+package peggysue
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding identifies how the input passed to the parser is encoded. Rules
+// always match against UTF-8, so other encodings are decoded before parsing.
+type Encoding int
+
+const (
+	// EncodingUTF8 indicates the input is UTF-8. This is the default.
+	EncodingUTF8 Encoding = iota
+
+	// EncodingUTF16LE indicates the input is little endian UTF-16.
+	EncodingUTF16LE
+
+	// EncodingUTF16BE indicates the input is big endian UTF-16.
+	EncodingUTF16BE
+
+	// EncodingLatin1 indicates the input is ISO-8859-1, where each byte
+	// is a single rune.
+	EncodingLatin1
+
+	// EncodingDetect uses a byte order mark at the start of the input to
+	// detect UTF-8, UTF-16LE, or UTF-16BE, falling back to UTF-8 if there is
+	// no byte order mark. The byte order mark is always skipped.
+	EncodingDetect
+)
+
+const utf8BOM = "\xef\xbb\xbf"
+
+// WithEncoding sets the encoding of the input. Positions reported to
+// SetPositioner values and in errors are byte offsets into the original
+// input, not the decoded UTF-8 that the rules match against.
+func WithEncoding(enc Encoding) Option {
+	return func(p *Parser) {
+		p.encoding = enc
+	}
+}
+
+// WithSkipBOM causes a byte order mark at the start of the input to be
+// skipped rather than passed to the rules.
+func WithSkipBOM(on bool) Option {
+	return func(p *Parser) {
+		p.skipBOM = on
+	}
+}
+
+// sourceMap translates byte offsets in the decoded input back to byte
+// offsets in the original input. A nil sourceMap is the identity mapping.
+type sourceMap struct {
+	shift   int
+	offsets []int
+}
+
+func (m *sourceMap) original(pos int) int {
+	if m == nil {
+		return pos
+	}
+
+	if m.offsets == nil {
+		return pos + m.shift
+	}
+
+	if pos >= len(m.offsets) {
+		pos = len(m.offsets) - 1
+	}
+
+	return m.offsets[pos]
+}
+
+func decodeInput(input string, enc Encoding, skipBOM bool) (string, *sourceMap) {
+	if enc == EncodingDetect {
+		switch {
+		case strings.HasPrefix(input, utf8BOM):
+			enc = EncodingUTF8
+		case strings.HasPrefix(input, "\xff\xfe"):
+			enc = EncodingUTF16LE
+		case strings.HasPrefix(input, "\xfe\xff"):
+			enc = EncodingUTF16BE
+		default:
+			enc = EncodingUTF8
+		}
+
+		skipBOM = true
+	}
+
+	switch enc {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		return decodeUTF16(input, enc == EncodingUTF16BE, skipBOM)
+	case EncodingLatin1:
+		return decodeLatin1(input)
+	default:
+		if skipBOM && strings.HasPrefix(input, utf8BOM) {
+			return input[len(utf8BOM):], &sourceMap{shift: len(utf8BOM)}
+		}
+
+		return input, nil
+	}
+}
+
+func decodeLatin1(input string) (string, *sourceMap) {
+	ascii := true
+
+	for i := 0; i < len(input); i++ {
+		if input[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+
+	// ASCII is the same in Latin-1 and UTF-8, so there is nothing to do.
+	if ascii {
+		return input, nil
+	}
+
+	var (
+		sb      strings.Builder
+		offsets = make([]int, 0, len(input)+1)
+	)
+
+	for i := 0; i < len(input); i++ {
+		n, _ := sb.WriteRune(rune(input[i]))
+
+		for j := 0; j < n; j++ {
+			offsets = append(offsets, i)
+		}
+	}
+
+	offsets = append(offsets, len(input))
+
+	return sb.String(), &sourceMap{offsets: offsets}
+}
+
+func decodeUTF16(input string, bigEndian, skipBOM bool) (string, *sourceMap) {
+	unit := func(i int) rune {
+		if bigEndian {
+			return rune(input[i])<<8 | rune(input[i+1])
+		}
+
+		return rune(input[i+1])<<8 | rune(input[i])
+	}
+
+	var (
+		sb      strings.Builder
+		offsets = make([]int, 0, len(input)/2+1)
+	)
+
+	i := 0
+
+	if skipBOM && len(input) >= 2 && unit(0) == 0xfeff {
+		i = 2
+	}
+
+	for i < len(input) {
+		start := i
+
+		var rn rune
+
+		switch {
+		case i+1 >= len(input):
+			// A trailing odd byte can not be decoded.
+			rn = utf8.RuneError
+			i++
+		default:
+			rn = unit(i)
+			i += 2
+
+			if utf16.IsSurrogate(rn) {
+				if i+1 < len(input) {
+					rn = utf16.DecodeRune(rn, unit(i))
+					if rn != utf8.RuneError {
+						i += 2
+					}
+				} else {
+					rn = utf8.RuneError
+				}
+			}
+		}
+
+		n, _ := sb.WriteRune(rn)
+
+		for j := 0; j < n; j++ {
+			offsets = append(offsets, start)
+		}
+	}
+
+	offsets = append(offsets, len(input))
+
+	return sb.String(), &sourceMap{offsets: offsets}
+}
+
+// decoded translates a byte offset in the original input to the offset of the
+// corresponding byte in the decoded input.
+func (m *sourceMap) decoded(pos int) int {
+	if m == nil {
+		return pos
+	}
+
+	if m.offsets == nil {
+		if pos < m.shift {
+			return 0
+		}
+
+		return pos - m.shift
+	}
+
+	return sort.SearchInts(m.offsets, pos)
+}
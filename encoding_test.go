@@ -0,0 +1,107 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPosNode struct {
+	start, end int
+}
+
+func (t *testPosNode) SetPosition(start, end, line int, filename string) {
+	t.start = start
+	t.end = end
+}
+
+func TestEncoding(t *testing.T) {
+	word := Transform(Plus(Rune(func(r rune) bool { return r != ' ' })), func(s string) interface{} {
+		return s
+	})
+
+	t.Run("fails on a BOM by default", func(t *testing.T) {
+		r := require.New(t)
+
+		_, ok, err := New().Parse(Plus(Range('a', 'z')), "\xef\xbb\xbfabc")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("skips a UTF-8 BOM", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithSkipBOM(true))
+
+		rule := Seq(S("ab"), Transform(S("c"), func(string) interface{} {
+			return &testPosNode{}
+		}))
+
+		val, ok, err := p.Parse(rule, "\xef\xbb\xbfabc")
+		r.NoError(err)
+		r.True(ok)
+
+		n := val.(*testPosNode)
+		r.Equal(5, n.start)
+		r.Equal(6, n.end)
+
+		_, ok, err = p.Parse(rule, "abc")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("decodes UTF-16", func(t *testing.T) {
+		r := require.New(t)
+
+		le := "\xff\xfeh\x00\xe9\x00=\xd8\x00\xde"
+		be := "\xfe\xff\x00h\x00\xe9\xd8=\xde\x00"
+
+		val, ok, err := New(WithEncoding(EncodingUTF16LE), WithSkipBOM(true)).Parse(word, le)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("hé😀", val)
+
+		val, ok, err = New(WithEncoding(EncodingUTF16BE), WithSkipBOM(true)).Parse(word, be)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("hé😀", val)
+
+		val, ok, err = New(WithEncoding(EncodingDetect)).Parse(word, le)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("hé😀", val)
+	})
+
+	t.Run("decodes Latin-1", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithEncoding(EncodingLatin1))
+
+		val, ok, err := p.Parse(word, "caf\xe9")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("café", val)
+	})
+
+	t.Run("reports positions in the original input", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithEncoding(EncodingUTF16LE))
+
+		rule := Seq(S("é"), Transform(S("x"), func(string) interface{} {
+			return &testPosNode{}
+		}))
+
+		val, ok, err := p.Parse(rule, "\xe9\x00x\x00")
+		r.NoError(err)
+		r.True(ok)
+
+		n := val.(*testPosNode)
+		r.Equal(2, n.start)
+		r.Equal(4, n.end)
+
+		_, _, err = p.Parse(S("é"), "\xe9\x00x\x00")
+		r.Error(err)
+		r.Equal(2, err.(*ErrInputNotConsumed).MaxPos)
+	})
+}
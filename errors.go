@@ -0,0 +1,220 @@
+package peggysue
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	// ErrNoMatch indicates that the rule did not match the input. Errors
+	// of type *NoMatchError match it with errors.Is.
+	ErrNoMatch = errors.New("rule did not match input")
+
+	// ErrPartialInput indicates that the rule matched but did not consume
+	// the entire input. Errors of type *ErrInputNotConsumed match it with
+	// errors.Is.
+	ErrPartialInput = errors.New("full input not consumed")
+)
+
+// NoMatchError is returned when the rule did not match the input.
+type NoMatchError struct {
+	// Pos is the furthest position in the input that was reached.
+	Pos Pos
+
+	// Rule is the Ref that was being matched when Pos was reached.
+	Rule Rule
+}
+
+func (e *NoMatchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, ErrNoMatch)
+}
+
+// Is allows errors.Is(err, ErrNoMatch) to detect NoMatchError.
+func (e *NoMatchError) Is(target error) bool {
+	return target == ErrNoMatch
+}
+
+// ErrInputNotConsumed is returned when the rule matched, but did not consume
+// the entire input.
+type ErrInputNotConsumed struct {
+	MaxPos  int
+	MaxRule Rule
+
+	// Pos is the position of MaxPos, including the filename.
+	Pos Pos
+}
+
+func (*ErrInputNotConsumed) Error() string {
+	return ErrPartialInput.Error()
+}
+
+// Is allows errors.Is(err, ErrPartialInput) to detect ErrInputNotConsumed.
+func (e *ErrInputNotConsumed) Is(target error) bool {
+	return target == ErrPartialInput
+}
+
+// SemanticError is returned when an action created with ActionErr reports an
+// error, such as a reference to an undeclared variable. The error returned by
+// the action is available with errors.Unwrap, errors.Is, and errors.As.
+type SemanticError struct {
+	// Pos is the position where the action's rule began matching.
+	Pos Pos
+
+	// Rule is the name of the Ref that contains the action, if any.
+	Rule string
+
+	Err error
+}
+
+func (e *SemanticError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", e.Pos, e.Rule, e.Err)
+}
+
+func (e *SemanticError) Unwrap() error {
+	return e.Err
+}
+
+// RecursionLimitError is returned when Refs are nested deeper than the limit
+// set with WithRecursionLimit.
+type RecursionLimitError struct {
+	Limit int
+
+	// Pos is the position where the limit was exceeded.
+	Pos Pos
+
+	// Rule is the name of the Ref that exceeded the limit.
+	Rule string
+}
+
+func (e *RecursionLimitError) Error() string {
+	return fmt.Sprintf("%s: recursion limit of %d exceeded in %s", e.Pos, e.Limit, e.Rule)
+}
+
+// WithRecursionLimit sets the maximum depth that Refs may be nested while
+// matching. When exceeded, parsing stops and a RecursionLimitError is returned.
+// This protects against deeply nested input exhausting the stack. A limit of 0,
+// the default, means there is no limit.
+func WithRecursionLimit(n int) Option {
+	return func(p *Parser) {
+		p.recursionLimit = n
+	}
+}
+
+// ParseError is returned when a function passed to Action, ActionErr,
+// Transform, CheckAction, or CheckActionCtx panics. The panic is recovered so
+// that it does not unwind through the caller of the parser.
+type ParseError struct {
+	// Pos is the position where the rule invoking the function began matching.
+	Pos Pos
+
+	// Rule is the name of the rule invoking the function, or the name of the
+	// Ref that contains it if the rule is unnamed.
+	Rule string
+
+	// Value is the value that was passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (e *ParseError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s: panic: %v", e.Pos, e.Value)
+	}
+
+	return fmt.Sprintf("%s: %s: panic: %v", e.Pos, e.Rule, e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e *ParseError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// parseAbort is used to unwind the parser when an error stops parsing.
+type parseAbort struct {
+	err error
+}
+
+// abort stops parsing, causing the given error to be returned to the caller.
+func (s *state) abort(err error) {
+	panic(&parseAbort{err: err})
+}
+
+// enterAction records that user code is about to be called on behalf of
+// rule m, which began matching at bp, so that a panic can be attributed to it.
+func (s *state) enterAction(m Rule, bp int) {
+	s.action = m
+	s.actionRef = s.curRef
+	s.actionPos = bp
+}
+
+func (s *state) leaveAction() {
+	s.action = nil
+}
+
+// run matches r, converting an abort or a panic in user code into s.err.
+func (s *state) run(r Rule) (res result) {
+	defer func() {
+		if v := recover(); v != nil {
+			switch {
+			case isAbort(v):
+				s.err = v.(*parseAbort).err
+			case s.action != nil:
+				name := s.action.Name()
+				if name == "" && s.actionRef != nil {
+					name = s.actionRef.Name()
+				}
+
+				s.err = &ParseError{
+					Pos:   s.position(s.actionPos),
+					Rule:  name,
+					Value: v,
+					Stack: debug.Stack(),
+				}
+
+				s.action = nil
+			default:
+				panic(v)
+			}
+
+			res = result{}
+		}
+	}()
+
+	return s.match(r)
+}
+
+func isAbort(v interface{}) bool {
+	_, ok := v.(*parseAbort)
+	return ok
+}
+
+func (s *state) notConsumed() error {
+	return &ErrInputNotConsumed{
+		MaxPos:  s.endOffset(s.maxPos),
+		MaxRule: s.maxRule,
+		Pos:     s.position(s.maxPos),
+	}
+}
+
+func (s *state) noMatch() error {
+	return &NoMatchError{
+		Pos:  s.position(s.maxPos),
+		Rule: s.maxRule,
+	}
+}
+
+func (s *state) refName() string {
+	if s.curRef == nil {
+		return ""
+	}
+
+	return s.curRef.Name()
+}
@@ -0,0 +1,137 @@
+package peggysue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("classifies input that was not consumed", func(t *testing.T) {
+		r := require.New(t)
+
+		_, _, err := New().Parse(S("a"), "ab")
+		r.ErrorIs(err, ErrPartialInput)
+		r.False(errors.Is(err, ErrNoMatch))
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(err, &nc)
+		r.Equal(1, nc.MaxPos)
+	})
+
+	t.Run("classifies a failed match", func(t *testing.T) {
+		r := require.New(t)
+
+		res := New().Run(S("a"), "b")
+
+		var nm *NoMatchError
+		r.ErrorAs(res.Err(), &nm)
+		r.ErrorIs(res.Err(), ErrNoMatch)
+		r.Equal(Pos{Offset: 0, Line: 1, Column: 1}, nm.Pos)
+	})
+
+	t.Run("stops parsing when an action returns an error", func(t *testing.T) {
+		r := require.New(t)
+
+		errUndeclared := errors.New("undeclared variable")
+
+		ident := R("ident")
+		ident.Set(ActionErr(Named("id", Capture(Plus(Range('a', 'z')))), func(v Values) (interface{}, error) {
+			if v.Get("id").(string) != "x" {
+				return nil, errUndeclared
+			}
+
+			return "x", nil
+		}))
+
+		rule := Or(Seq(S("("), ident, S(")")), S("(y)"))
+
+		_, ok, err := New().Parse(rule, "(x)")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = New().Parse(rule, "(y)")
+		r.False(ok)
+		r.ErrorIs(err, errUndeclared)
+
+		var se *SemanticError
+		r.ErrorAs(err, &se)
+		r.Equal("ident", se.Rule)
+		r.Equal(1, se.Pos.Offset)
+		r.Equal("1:2: ident: undeclared variable", se.Error())
+
+		res := New().Run(rule, "(y)")
+		r.False(res.Matched)
+		r.ErrorIs(res.Err(), errUndeclared)
+	})
+
+	t.Run("limits recursion depth", func(t *testing.T) {
+		r := require.New(t)
+
+		parens := R("parens")
+		parens.Set(Or(Seq(S("("), parens, S(")")), S("x")))
+
+		p := New(WithRecursionLimit(3))
+
+		_, ok, err := p.Parse(parens, "((x))")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(parens, "(((x)))")
+		r.False(ok)
+
+		var rl *RecursionLimitError
+		r.ErrorAs(err, &rl)
+		r.Equal(3, rl.Limit)
+		r.Equal("parens", rl.Rule)
+		r.Equal(3, rl.Pos.Offset)
+
+		_, ok, err = New().Parse(parens, "(((x)))")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("recovers panics in actions", func(t *testing.T) {
+		r := require.New(t)
+
+		boom := errors.New("boom")
+
+		num := R("num")
+		num.Set(Seq(S("1"), Action(S("2"), func(Values) interface{} {
+			panic(boom)
+		})))
+
+		_, ok, err := New().Parse(Seq(S(" "), num), " 12")
+		r.False(ok)
+		r.ErrorIs(err, boom)
+
+		var pe *ParseError
+		r.ErrorAs(err, &pe)
+		r.Equal("num", pe.Rule)
+		r.Equal(2, pe.Pos.Offset)
+		r.Equal("1:3: num: panic: boom", pe.Error())
+		r.Contains(string(pe.Stack), "TestErrors")
+
+		check := CheckAction(func(Values) bool {
+			panic("bad check")
+		})
+		check.SetName("check")
+
+		res := New().Run(Seq(S("a"), check), "a")
+		r.False(res.Matched)
+		r.ErrorAs(res.Err(), &pe)
+		r.Equal("check", pe.Rule)
+		r.Equal("bad check", pe.Value)
+
+		tr := Transform(S("a"), func(string) interface{} {
+			var m map[string]int
+			m["x"] = 1
+			return m
+		})
+
+		_, _, err = New().Parse(tr, "a")
+		r.ErrorAs(err, &pe)
+		r.Equal("", pe.Rule)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	p "github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/toolkit"
+)
+
+// The grammar, from loosest to tightest binding:
+//
+//	expr    <- expr ('+' / '-') term / term
+//	term    <- term ('*' / '/' / '%') unary / unary
+//	unary   <- '-' unary / power
+//	power   <- primary '^' unary / primary
+//	primary <- number / '(' expr ')'
+//
+// expr and term are left recursive, which makes + - * / and % left
+// associative. power recurses on the right instead, so ^ is right
+// associative: 2^3^2 is 2^(3^2). Because power's right operand is a unary,
+// 2^-1 is allowed, and because unary is looser than power, -2^2 is -(2^2).
+var (
+	expr    = p.R("expr")
+	term    = p.R("term")
+	unary   = p.R("unary")
+	power   = p.R("power")
+	primary = p.R("primary")
+
+	tk = toolkit.Tokens(toolkit.HorizontalWS)
+
+	// The sign is left to unary so that -2^2 groups correctly.
+	number = tk.T(p.ActionErr(
+		p.Named("num", toolkit.NewNumberSpec().Bases(10).Sign(false).Rule()),
+		func(v p.Values) (interface{}, error) {
+			return v.Get("num").(*toolkit.NumberValue).AsFloat64()
+		}))
+
+	calc = p.Seq(p.Maybe(toolkit.HorizontalWS), expr)
+)
+
+// ErrDivisionByZero is reported when the right side of / or % is 0.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// binary returns a rule for the left associative operator op, applying fn
+// to the values of the operands.
+func binary(lhs p.Rule, op string, rhs p.Rule, fn func(a, b float64) (float64, error)) p.Rule {
+	return p.ActionErr(
+		p.Seq(p.Named("a", lhs), tk.Tok(op), p.Named("b", rhs)),
+		func(v p.Values) (interface{}, error) {
+			return fn(v.Get("a").(float64), v.Get("b").(float64))
+		})
+}
+
+func init() {
+	expr.Set(p.Or(
+		binary(expr, "+", term, func(a, b float64) (float64, error) { return a + b, nil }),
+		binary(expr, "-", term, func(a, b float64) (float64, error) { return a - b, nil }),
+		term,
+	))
+
+	term.Set(p.Or(
+		binary(term, "*", unary, func(a, b float64) (float64, error) { return a * b, nil }),
+		binary(term, "/", unary, func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, ErrDivisionByZero
+			}
+			return a / b, nil
+		}),
+		binary(term, "%", unary, func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, ErrDivisionByZero
+			}
+			return math.Mod(a, b), nil
+		}),
+		unary,
+	))
+
+	unary.Set(p.Or(
+		p.Action(p.Seq(tk.Tok("-"), p.Named("x", unary)), func(v p.Values) interface{} {
+			return -v.Get("x").(float64)
+		}),
+		power,
+	))
+
+	power.Set(p.Or(
+		binary(primary, "^", unary, func(a, b float64) (float64, error) { return math.Pow(a, b), nil }),
+		primary,
+	))
+
+	primary.Set(p.Or(
+		number,
+		toolkit.Around(tk.Tok("("), tk.Tok(")"))(expr),
+	))
+}
+
+// Eval parses and evaluates the expression in src. Errors name the column
+// where the problem was found.
+func Eval(src string) (float64, error) {
+	res := p.New().Run(calc, src)
+
+	var (
+		se *p.SemanticError
+		nm *p.NoMatchError
+		nc *p.ErrInputNotConsumed
+	)
+
+	err := res.Err()
+
+	switch {
+	case err == nil:
+		return res.Value.(float64), nil
+	case errors.As(err, &se):
+		return 0, fmt.Errorf("column %d: %s", se.Pos.Column, se.Err)
+	case errors.As(err, &nm):
+		return 0, unexpected(src, nm.Pos)
+	case errors.As(err, &nc):
+		return 0, unexpected(src, nc.Pos)
+	default:
+		return 0, err
+	}
+}
+
+// unexpected describes the input at pos, the furthest point the parser
+// reached and so the most likely place for the mistake.
+func unexpected(src string, pos p.Pos) error {
+	if pos.Offset >= len(src) {
+		return fmt.Errorf("column %d: unexpected end of expression", pos.Column)
+	}
+
+	return fmt.Errorf("column %d: unexpected %q", pos.Column, src[pos.Offset:pos.Offset+1])
+}
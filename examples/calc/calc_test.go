@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	t.Run("respects precedence and associativity", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, expected := range map[string]float64{
+			"3*1+2*2":        7,
+			"10 - 4 - 3":     3,
+			"2 * (3 + 4)":    14,
+			"((1))":          1,
+			"7 % 4 * 2":      6,
+			"2^3^2":          512,
+			"-2^2":           -4,
+			"2^-1":           0.5,
+			"--3":            3,
+			"1.5e2 / 0.25":   600,
+			" 8 / 2 / 2 ":    2,
+			"-(1.5 + 2) * 2": -7,
+			"0.5 + 0.25":     0.75,
+		} {
+			val, err := Eval(src)
+			r.NoError(err, src)
+			r.Equal(expected, val, src)
+		}
+	})
+
+	t.Run("reports errors by column", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, msg := range map[string]string{
+			"1 +":       "column 4: unexpected end of expression",
+			"(1 + 2":    "column 7: unexpected end of expression",
+			"1 + * 2":   `column 5: unexpected "*"`,
+			"2 ) ":      `column 3: unexpected ")"`,
+			"":          "column 1: unexpected end of expression",
+			"4 / (2-2)": "column 1: division by zero",
+		} {
+			_, err := Eval(src)
+			r.Error(err, src)
+			r.Equal(msg, err.Error(), src)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+// Config is a parsed configuration file.
+type Config struct {
+	// Sections are the sections in the order they appear. Entries before
+	// the first header belong to a section with an empty name.
+	Sections []*Section
+}
+
+// Get returns the value of key in the named section. Later entries
+// override earlier ones, including across repeated sections.
+func (c *Config) Get(section, key string) (string, bool) {
+	var (
+		val   string
+		found bool
+	)
+
+	for _, s := range c.Sections {
+		if s.Name != section {
+			continue
+		}
+
+		for _, e := range s.Entries {
+			if e.Key == key {
+				val, found = e.Value, true
+			}
+		}
+	}
+
+	return val, found
+}
+
+// Section is a [name] header and the entries that follow it.
+type Section struct {
+	Name    string
+	Line    int
+	Entries []*Entry
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (s *Section) SetPosition(start, end, line int, filename string) {
+	s.Line = line
+}
+
+// Entry is a single key = value line.
+type Entry struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (e *Entry) SetPosition(start, end, line int, filename string) {
+	e.Line = line
+}
+
+// LineError describes a line that couldn't be parsed.
+type LineError struct {
+	Filename string
+	Line     int
+	Text     string
+	Msg      string
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (e *LineError) SetPosition(start, end, line int, filename string) {
+	e.Filename = filename
+	e.Line = line
+}
+
+func (e *LineError) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("line %d: %s: %q", e.Line, e.Msg, e.Text)
+	}
+
+	return fmt.Sprintf("%s:%d: %s: %q", e.Filename, e.Line, e.Msg, e.Text)
+}
+
+// ErrorList is every malformed line in a file, in order.
+type ErrorList []*LineError
+
+func (l ErrorList) Error() string {
+	var msgs []string
+
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// The grammar is a sequence of lines. Every line matches exactly one of
+// the alternatives in line, and the last ones match anything up to the end
+// of the line, so a malformed line never stops the parse. Instead it turns
+// into a *LineError and parsing resumes on the next line, letting Parse
+// report every problem in the file at once.
+var (
+	space = p.Star(p.Set(' ', '\t'))
+
+	eol = p.Or(p.S("\r\n"), p.S("\n"), p.EOS())
+
+	restOfLine = p.Star(p.Rune(func(r rune) bool {
+		return r != '\n' && r != '\r'
+	}))
+
+	comment = p.Seq(p.Set(';', '#'), restOfLine)
+
+	blank = p.Seq(space, p.Maybe(comment), eol)
+
+	header = p.Action(
+		p.Seq(
+			space, p.S("["),
+			p.Named("name", p.Capture(p.Plus(p.Rune(func(r rune) bool {
+				return r != ']' && r != '\n' && r != '\r'
+			})))),
+			p.S("]"), space, p.Maybe(comment), eol,
+		),
+		func(v p.Values) interface{} {
+			return &Section{Name: strings.TrimSpace(v.Get("name").(string))}
+		})
+
+	entry = p.Action(
+		p.Seq(
+			space,
+			p.Named("key", p.Capture(p.Plus(p.Rune(func(r rune) bool {
+				return !strings.ContainsRune("=:;#[\r\n", r)
+			})))),
+			p.Set('=', ':'),
+			p.Named("value", p.Capture(restOfLine)),
+			eol,
+		),
+		func(v p.Values) interface{} {
+			return &Entry{
+				Key:   strings.TrimSpace(v.Get("key").(string)),
+				Value: strings.TrimSpace(v.Get("value").(string)),
+			}
+		})
+
+	line = p.Or(
+		header,
+		entry,
+		blank,
+		malformed(p.S("[]"), "empty section name"),
+		malformed(p.S("["), "section header is missing its closing ]"),
+		malformed(p.Set('=', ':'), "entry is missing a key"),
+		malformed(p.S(""), "expected a [section], key = value, or a comment"),
+	)
+
+	file = p.Collect(p.Star(p.Seq(p.Not(p.EOS()), line)))
+)
+
+// malformed returns a rule that matches the rest of the line when it
+// begins with prefix, producing a *LineError with msg.
+func malformed(prefix p.Rule, msg string) p.Rule {
+	return p.Action(
+		p.Seq(
+			p.Named("text", p.Capture(p.Seq(space, prefix, restOfLine))),
+			eol,
+		),
+		func(v p.Values) interface{} {
+			return &LineError{Text: v.Get("text").(string), Msg: msg}
+		})
+}
+
+// Parse parses src as a configuration file. filename is used only in
+// error messages. If any lines are malformed, the error is an ErrorList.
+func Parse(filename, src string) (*Config, error) {
+	val, _, err := p.New(p.WithFilename(filename)).Parse(file, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		cfg  = &Config{}
+		cur  = &Section{}
+		errs ErrorList
+	)
+
+	cfg.Sections = append(cfg.Sections, cur)
+
+	for _, v := range val.([]interface{}) {
+		switch v := v.(type) {
+		case *Section:
+			cur = v
+			cfg.Sections = append(cfg.Sections, cur)
+		case *Entry:
+			cur.Entries = append(cur.Entries, v)
+		case *LineError:
+			errs = append(errs, v)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("parses sections and entries", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg, err := Parse("app.ini", "; global settings\nname = demo\n\n[server]\nhost = localhost # not a comment\nport: 8080\n\n[server]  ; reopened\nport = 9090\n")
+		r.NoError(err)
+
+		r.Len(cfg.Sections, 3)
+
+		val, ok := cfg.Get("", "name")
+		r.True(ok)
+		r.Equal("demo", val)
+
+		val, ok = cfg.Get("server", "host")
+		r.True(ok)
+		r.Equal("localhost # not a comment", val)
+
+		val, ok = cfg.Get("server", "port")
+		r.True(ok)
+		r.Equal("9090", val)
+
+		_, ok = cfg.Get("client", "port")
+		r.False(ok)
+
+		r.Equal(4, cfg.Sections[1].Line)
+		r.Equal(6, cfg.Sections[1].Entries[1].Line)
+	})
+
+	t.Run("reports every malformed line", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Parse("app.ini", "[server\nhost = a\n= b\njust words\n[]\nport = 1")
+		r.Error(err)
+
+		errs, ok := err.(ErrorList)
+		r.True(ok)
+		r.Len(errs, 4)
+
+		r.Equal(1, errs[0].Line)
+		r.Equal("section header is missing its closing ]", errs[0].Msg)
+
+		r.Equal(3, errs[1].Line)
+		r.Equal("entry is missing a key", errs[1].Msg)
+
+		r.Equal(4, errs[2].Line)
+		r.Equal("just words", errs[2].Text)
+
+		r.Equal("app.ini:5: empty section name: \"[]\"", errs[3].Error())
+	})
+}
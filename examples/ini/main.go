@@ -0,0 +1,37 @@
+// Command ini parses the configuration file named on the command line and
+// prints each entry as section.key = value, or reports every malformed line.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: ini <file>")
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cfg, err := Parse(os.Args[1], string(data))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, s := range cfg.Sections {
+		for _, e := range s.Entries {
+			if s.Name == "" {
+				fmt.Printf("%s = %s\n", e.Key, e.Value)
+			} else {
+				fmt.Printf("%s.%s = %s\n", s.Name, e.Key, e.Value)
+			}
+		}
+	}
+}
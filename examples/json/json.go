@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	p "github.com/lab47/peggysue"
+)
+
+// Pos is the span of input a node was parsed from. It implements
+// peggysue.SetPositioner, so every node built by an Action has it filled in.
+type Pos struct {
+	Start, End int
+	Line       int
+}
+
+func (p *Pos) SetPosition(start, end, line int, filename string) {
+	p.Start = start
+	p.End = end
+	p.Line = line
+}
+
+// Node is implemented by each kind of JSON value.
+type Node interface {
+	Span() Pos
+}
+
+type (
+	Object struct {
+		Pos
+		Members []*Member
+	}
+
+	Member struct {
+		Pos
+		Key   string
+		Value Node
+	}
+
+	Array struct {
+		Pos
+		Elems []Node
+	}
+
+	String struct {
+		Pos
+		Value string
+	}
+
+	// Number keeps the literal text, so that callers can decide how to
+	// convert it without losing precision.
+	Number struct {
+		Pos
+		Text string
+	}
+
+	Bool struct {
+		Pos
+		Value bool
+	}
+
+	Null struct {
+		Pos
+	}
+)
+
+func (p Pos) Span() Pos { return p }
+
+// Float64 converts the number to a float64.
+func (n *Number) Float64() (float64, error) {
+	return strconv.ParseFloat(n.Text, 64)
+}
+
+var (
+	ws = p.Star(p.Set(' ', '\t', '\n', '\r'))
+
+	value = p.R("value")
+
+	// The body of a string is validated by a Scan rather than built from
+	// smaller rules. Strings make up most of a typical document, so this is
+	// where hand optimization pays off the most.
+	str = p.Transform(
+		p.Seq(p.S(`"`), p.Scan(scanString), p.S(`"`)),
+		func(s string) interface{} {
+			return unquote(s[1 : len(s)-1])
+		})
+
+	digits = p.Plus(p.Range('0', '9'))
+
+	// Capture the whole number and keep the text, rather than converting
+	// each piece as it's matched.
+	number = p.Capture(p.Seq(
+		p.Maybe(p.S("-")),
+		p.Or(p.S("0"), p.Seq(p.Range('1', '9'), p.Star(p.Range('0', '9')))),
+		p.Maybe(p.Seq(p.S("."), digits)),
+		p.Maybe(p.Seq(p.Set('e', 'E'), p.Maybe(p.Set('+', '-')), digits)),
+	))
+
+	member = p.Action(
+		p.Seq(p.Named("key", str), ws, p.S(":"), ws, p.Named("value", value)),
+		func(v p.Values) interface{} {
+			return &Member{Key: v.Get("key").(string), Value: v.Get("value").(Node)}
+		})
+
+	object = p.Action(
+		p.Seq(p.S("{"), ws, p.Named("members", p.SepBy(member, p.Seq(p.S(","), ws))), p.S("}")),
+		func(v p.Values) interface{} {
+			obj := &Object{}
+
+			for _, m := range v.Get("members").([]interface{}) {
+				obj.Members = append(obj.Members, m.(*Member))
+			}
+
+			return obj
+		})
+
+	array = p.Action(
+		p.Seq(p.S("["), ws, p.Named("elems", p.SepBy(value, p.Seq(p.S(","), ws))), p.S("]")),
+		func(v p.Values) interface{} {
+			arr := &Array{}
+
+			for _, e := range v.Get("elems").([]interface{}) {
+				arr.Elems = append(arr.Elems, e.(Node))
+			}
+
+			return arr
+		})
+
+	// Document is the whole JSON text: a single value surrounded by
+	// optional whitespace.
+	//
+	// The value of the match is a Node.
+	Document = p.Seq(ws, value)
+)
+
+func init() {
+	node := func(r p.Rule, fn func(v interface{}) Node) p.Rule {
+		return p.Action(p.Named("v", r), func(v p.Values) interface{} {
+			return fn(v.Get("v"))
+		})
+	}
+
+	// Every JSON value can be identified by its first byte, so a
+	// PrefixTable picks the only alternative that can match rather than
+	// trying each in turn. Because nothing is ever retried at the same
+	// position, there is no need to Memo anything; value is a Ref only
+	// because the grammar is recursive.
+	numberNode := node(number, func(v interface{}) Node { return &Number{Text: v.(string)} })
+
+	entries := []interface{}{
+		"{", object,
+		"[", array,
+		`"`, node(str, func(v interface{}) Node { return &String{Value: v.(string)} }),
+		"t", p.Action(p.S("true"), func(p.Values) interface{} { return &Bool{Value: true} }),
+		"f", p.Action(p.S("false"), func(p.Values) interface{} { return &Bool{Value: false} }),
+		"n", p.Action(p.S("null"), func(p.Values) interface{} { return &Null{} }),
+		"-", numberNode,
+	}
+
+	for c := byte('0'); c <= '9'; c++ {
+		entries = append(entries, c, numberNode)
+	}
+
+	value.Set(p.Seq(p.PrefixTable(entries...), ws))
+}
+
+// scanString returns the length of the body of a string, up to but not
+// including the closing quote, or -1 if the body is invalid.
+func scanString(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return i
+		case c < 0x20:
+			return -1
+		case c == '\\':
+			i++
+			if i >= len(s) {
+				return -1
+			}
+
+			switch s[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(s) {
+					return -1
+				}
+
+				if _, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err != nil {
+					return -1
+				}
+
+				i += 4
+			default:
+				return -1
+			}
+		}
+	}
+
+	return -1
+}
+
+// unquote decodes the escapes in a string body that has already been
+// validated by scanString.
+func unquote(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+
+		switch s[i] {
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			r := hex4(s[i+1:])
+			i += 4
+
+			// A surrogate pair is written as two escapes.
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], `\u`) {
+				if dec := utf16.DecodeRune(r, hex4(s[i+3:])); dec != utf8.RuneError {
+					r = dec
+					i += 6
+				}
+			}
+
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+
+	return sb.String()
+}
+
+func hex4(s string) rune {
+	v, _ := strconv.ParseUint(s[:4], 16, 16)
+	return rune(v)
+}
+
+// Parse parses a JSON document.
+func Parse(src string) (Node, error) {
+	val, ok, err := p.New().Parse(Document, src)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errors.New("invalid JSON document")
+	}
+
+	return val.(Node), nil
+}
+
+// Interface converts a node into the same values that encoding/json
+// produces when unmarshaling into an interface{}.
+func Interface(n Node) interface{} {
+	switch n := n.(type) {
+	case *Object:
+		m := make(map[string]interface{}, len(n.Members))
+		for _, mem := range n.Members {
+			m[mem.Key] = Interface(mem.Value)
+		}
+
+		return m
+	case *Array:
+		a := make([]interface{}, len(n.Elems))
+		for i, e := range n.Elems {
+			a[i] = Interface(e)
+		}
+
+		return a
+	case *String:
+		return n.Value
+	case *Number:
+		f, _ := n.Float64()
+		return f
+	case *Bool:
+		return n.Value
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("matches encoding/json", func(t *testing.T) {
+		r := require.New(t)
+
+		for _, src := range []string{
+			`null`,
+			` true `,
+			`-0.5e+3`,
+			`"a\"b\\c\/\n\u00e9\ud83d\ude00"`,
+			`[]`,
+			`{}`,
+			`[1, [2, [3]], {"a": {"b": null}}]`,
+			"{\n  \"name\": \"peggysue\",\n  \"tags\": [\"peg\", \"go\"],\n  \"stars\": 1e3\n}",
+		} {
+			node, err := Parse(src)
+			r.NoError(err, src)
+
+			var expected interface{}
+			r.NoError(json.Unmarshal([]byte(src), &expected))
+
+			r.Equal(expected, Interface(node), src)
+		}
+	})
+
+	t.Run("records positions", func(t *testing.T) {
+		r := require.New(t)
+
+		src := "{\n  \"list\": [1, true],\n  \"s\": \"x\"\n}"
+
+		node, err := Parse(src)
+		r.NoError(err)
+
+		obj := node.(*Object)
+		r.Equal(Pos{Start: 0, End: len(src), Line: 1}, obj.Pos)
+
+		list := obj.Members[0].Value.(*Array)
+		r.Equal(2, list.Line)
+		r.Equal("[1, true]", src[list.Start:list.End])
+
+		b := list.Elems[1].(*Bool)
+		r.Equal("true", src[b.Start:b.End])
+
+		s := obj.Members[1].Value.(*String)
+		r.Equal(3, s.Line)
+		r.Equal(`"x"`, src[s.Start:s.End])
+	})
+
+	t.Run("rejects invalid documents", func(t *testing.T) {
+		r := require.New(t)
+
+		for _, src := range []string{
+			``,
+			`[1,]`,
+			`{"a" 1}`,
+			`01`,
+			`"tab	inside"`,
+			`"\x"`,
+			`"\u12"`,
+			`[1] [2]`,
+			`tru`,
+		} {
+			_, err := Parse(src)
+			r.Error(err, src)
+		}
+	})
+}
+
+func benchmarkDocument() string {
+	var sb strings.Builder
+
+	sb.WriteString("[")
+
+	for i := 0; i < 200; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, `{"id": %d, "name": "item %d", "price": %d.25, "tags": ["a", "b\n"], "active": %v, "next": null}`, i, i, i, i%2 == 0)
+	}
+
+	sb.WriteString("]")
+
+	return sb.String()
+}
+
+func BenchmarkParse(b *testing.B) {
+	doc := benchmarkDocument()
+
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodingJSON(b *testing.B) {
+	doc := []byte(benchmarkDocument())
+
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var v interface{}
+		if err := json.Unmarshal(doc, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
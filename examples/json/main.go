@@ -0,0 +1,53 @@
+// Command json parses a JSON document from stdin and prints the position
+// and kind of each value in it.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	doc, err := Parse(string(src))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dump(doc, 0)
+}
+
+func dump(n Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	pos := n.Span()
+
+	switch n := n.(type) {
+	case *Object:
+		fmt.Printf("%sobject @%d:%d-%d\n", indent, pos.Line, pos.Start, pos.End)
+		for _, m := range n.Members {
+			fmt.Printf("%s  %q:\n", indent, m.Key)
+			dump(m.Value, depth+2)
+		}
+	case *Array:
+		fmt.Printf("%sarray @%d:%d-%d\n", indent, pos.Line, pos.Start, pos.End)
+		for _, e := range n.Elems {
+			dump(e, depth+1)
+		}
+	case *String:
+		fmt.Printf("%sstring %q @%d:%d-%d\n", indent, n.Value, pos.Line, pos.Start, pos.End)
+	case *Number:
+		fmt.Printf("%snumber %s @%d:%d-%d\n", indent, n.Text, pos.Line, pos.Start, pos.End)
+	case *Bool:
+		fmt.Printf("%sbool %v @%d:%d-%d\n", indent, n.Value, pos.Line, pos.Start, pos.End)
+	case *Null:
+		fmt.Printf("%snull @%d:%d-%d\n", indent, pos.Line, pos.Start, pos.End)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Builtin is a procedure implemented in Go.
+type Builtin func(args []Value) (Value, error)
+
+// Lambda is a procedure created by lambda.
+type Lambda struct {
+	Params []Symbol
+	Body   []Value
+	Env    *Env
+}
+
+// Env maps symbols to values. Lookups that miss fall through to the
+// parent environment.
+type Env struct {
+	vars   map[Symbol]Value
+	parent *Env
+}
+
+// NewEnv returns a child of parent. A nil parent creates a global
+// environment containing the builtins.
+func NewEnv(parent *Env) *Env {
+	env := &Env{vars: make(map[Symbol]Value), parent: parent}
+
+	if parent == nil {
+		for name, fn := range builtins {
+			env.vars[name] = fn
+		}
+	}
+
+	return env
+}
+
+// Lookup returns the value bound to sym.
+func (e *Env) Lookup(sym Symbol) (Value, error) {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[sym]; ok {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("undefined symbol: %s", sym)
+}
+
+// Define binds sym to v in e.
+func (e *Env) Define(sym Symbol, v Value) {
+	e.vars[sym] = v
+}
+
+// Eval evaluates v in env.
+func Eval(v Value, env *Env) (Value, error) {
+	switch v := v.(type) {
+	case Symbol:
+		return env.Lookup(v)
+	case List:
+		if len(v) == 0 {
+			return v, nil
+		}
+
+		if sym, ok := v[0].(Symbol); ok {
+			switch sym {
+			case "quote":
+				if len(v) != 2 {
+					return nil, fmt.Errorf("quote takes 1 argument")
+				}
+				return v[1], nil
+			case "if":
+				return evalIf(v, env)
+			case "define":
+				return evalDefine(v, env)
+			case "lambda":
+				return evalLambda(v, env)
+			case "begin":
+				return evalBody(v[1:], env)
+			}
+		}
+
+		fn, err := Eval(v[0], env)
+		if err != nil {
+			return nil, err
+		}
+
+		args := make([]Value, len(v)-1)
+		for i, a := range v[1:] {
+			if args[i], err = Eval(a, env); err != nil {
+				return nil, err
+			}
+		}
+
+		return Apply(fn, args)
+	default:
+		return v, nil
+	}
+}
+
+// Apply calls the procedure fn with args.
+func Apply(fn Value, args []Value) (Value, error) {
+	switch fn := fn.(type) {
+	case Builtin:
+		return fn(args)
+	case *Lambda:
+		if len(args) != len(fn.Params) {
+			return nil, fmt.Errorf("expected %d arguments, got %d", len(fn.Params), len(args))
+		}
+
+		env := NewEnv(fn.Env)
+		for i, p := range fn.Params {
+			env.Define(p, args[i])
+		}
+
+		return evalBody(fn.Body, env)
+	default:
+		return nil, fmt.Errorf("not a procedure: %s", Print(fn))
+	}
+}
+
+// evalBody evaluates each form in body, returning the value of the last.
+func evalBody(body []Value, env *Env) (Value, error) {
+	var (
+		res Value = List(nil)
+		err error
+	)
+
+	for _, form := range body {
+		if res, err = Eval(form, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func evalIf(v List, env *Env) (Value, error) {
+	if len(v) != 3 && len(v) != 4 {
+		return nil, fmt.Errorf("if takes 2 or 3 arguments")
+	}
+
+	cond, err := Eval(v[1], env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like Scheme, only #f is false.
+	if cond != false {
+		return Eval(v[2], env)
+	}
+
+	if len(v) == 4 {
+		return Eval(v[3], env)
+	}
+
+	return List(nil), nil
+}
+
+// evalDefine handles both (define name value) and the shorthand
+// (define (name params...) body...).
+func evalDefine(v List, env *Env) (Value, error) {
+	if len(v) < 3 {
+		return nil, fmt.Errorf("define takes at least 2 arguments")
+	}
+
+	switch target := v[1].(type) {
+	case Symbol:
+		val, err := Eval(v[2], env)
+		if err != nil {
+			return nil, err
+		}
+
+		env.Define(target, val)
+
+		return target, nil
+	case List:
+		if len(target) == 0 {
+			return nil, fmt.Errorf("define is missing a name")
+		}
+
+		name, ok := target[0].(Symbol)
+		if !ok {
+			return nil, fmt.Errorf("define name must be a symbol")
+		}
+
+		fn, err := evalLambda(append(List{Symbol("lambda"), target[1:]}, v[2:]...), env)
+		if err != nil {
+			return nil, err
+		}
+
+		env.Define(name, fn)
+
+		return name, nil
+	default:
+		return nil, fmt.Errorf("cannot define %s", Print(target))
+	}
+}
+
+func evalLambda(v List, env *Env) (Value, error) {
+	if len(v) < 3 {
+		return nil, fmt.Errorf("lambda takes parameters and a body")
+	}
+
+	params, ok := v[1].(List)
+	if !ok {
+		return nil, fmt.Errorf("lambda parameters must be a list")
+	}
+
+	fn := &Lambda{Body: v[2:], Env: env}
+
+	for _, p := range params {
+		sym, ok := p.(Symbol)
+		if !ok {
+			return nil, fmt.Errorf("lambda parameter must be a symbol: %s", Print(p))
+		}
+
+		fn.Params = append(fn.Params, sym)
+	}
+
+	return fn, nil
+}
+
+func numbers(name string, args []Value) ([]float64, error) {
+	nums := make([]float64, len(args))
+
+	for i, a := range args {
+		n, ok := a.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: not a number: %s", name, Print(a))
+		}
+
+		nums[i] = n
+	}
+
+	return nums, nil
+}
+
+// arith returns a builtin folding op over its arguments, starting from
+// the first argument, or from unit when applied to fewer than two.
+func arith(name string, unit float64, op func(a, b float64) float64) Builtin {
+	return func(args []Value) (Value, error) {
+		nums, err := numbers(name, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(nums) < 2 {
+			nums = append([]float64{unit}, nums...)
+		}
+
+		acc := nums[0]
+		for _, n := range nums[1:] {
+			acc = op(acc, n)
+		}
+
+		return acc, nil
+	}
+}
+
+// compare returns a builtin checking that op holds between each pair of
+// adjacent arguments.
+func compare(name string, op func(a, b float64) bool) Builtin {
+	return func(args []Value) (Value, error) {
+		nums, err := numbers(name, args)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 1; i < len(nums); i++ {
+			if !op(nums[i-1], nums[i]) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+}
+
+func pair(name string, args []Value) (List, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s takes 1 argument", name)
+	}
+
+	l, ok := args[0].(List)
+	if !ok || len(l) == 0 {
+		return nil, fmt.Errorf("%s: not a non-empty list: %s", name, Print(args[0]))
+	}
+
+	return l, nil
+}
+
+var builtins = map[Symbol]Builtin{
+	"+": arith("+", 0, func(a, b float64) float64 { return a + b }),
+	"-": arith("-", 0, func(a, b float64) float64 { return a - b }),
+	"*": arith("*", 1, func(a, b float64) float64 { return a * b }),
+	"/": arith("/", 1, func(a, b float64) float64 { return a / b }),
+
+	"=":  compare("=", func(a, b float64) bool { return a == b }),
+	"<":  compare("<", func(a, b float64) bool { return a < b }),
+	">":  compare(">", func(a, b float64) bool { return a > b }),
+	"<=": compare("<=", func(a, b float64) bool { return a <= b }),
+	">=": compare(">=", func(a, b float64) bool { return a >= b }),
+
+	"list": func(args []Value) (Value, error) {
+		if len(args) == 0 {
+			return List(nil), nil
+		}
+		return List(append([]Value(nil), args...)), nil
+	},
+	"car": func(args []Value) (Value, error) {
+		l, err := pair("car", args)
+		if err != nil {
+			return nil, err
+		}
+		return l[0], nil
+	},
+	"cdr": func(args []Value) (Value, error) {
+		l, err := pair("cdr", args)
+		if err != nil {
+			return nil, err
+		}
+		if len(l) == 1 {
+			return List(nil), nil
+		}
+		return l[1:], nil
+	},
+	"cons": func(args []Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("cons takes 2 arguments")
+		}
+		l, ok := args[1].(List)
+		if !ok {
+			return nil, fmt.Errorf("cons: not a list: %s", Print(args[1]))
+		}
+		return append(List{args[0]}, l...), nil
+	},
+	"null?": func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("null? takes 1 argument")
+		}
+		l, ok := args[0].(List)
+		return ok && len(l) == 0, nil
+	},
+}
+
+// Print returns the written representation of v.
+func Print(v Value) string {
+	switch v := v.(type) {
+	case float64:
+		// Print whole numbers in full, so 10! is 3628800 rather than
+		// 3.6288e+06.
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		if v {
+			return "#t"
+		}
+		return "#f"
+	case Symbol:
+		return string(v)
+	case List:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = Print(e)
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	case Builtin:
+		return "#<builtin>"
+	case *Lambda:
+		return "#<lambda>"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Run reads and evaluates every form in src in env, returning the value
+// of the last one.
+func Run(src string, env *Env) (Value, error) {
+	forms, err := Read(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return evalBody(forms, env)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	t.Run("reads atoms and lists", func(t *testing.T) {
+		r := require.New(t)
+
+		vals, err := Read(`  ; a comment
+(define x 1.5) 'sym "a\nb" #t () (1+ -2 -)`)
+		r.NoError(err)
+
+		r.Equal([]Value{
+			List{Symbol("define"), Symbol("x"), 1.5},
+			List{Symbol("quote"), Symbol("sym")},
+			"a\nb",
+			true,
+			List(nil),
+			List{Symbol("1+"), -2.0, Symbol("-")},
+		}, vals)
+	})
+
+	t.Run("reports unbalanced input", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Read("(a (b)")
+		r.EqualError(err, "1:7: unexpected end of input")
+
+		_, err = Read("(a))")
+		r.EqualError(err, `1:4: unexpected ")"`)
+	})
+}
+
+func TestEval(t *testing.T) {
+	t.Run("evaluates programs", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, expected := range map[string]string{
+			"(+ 1 2 3)":                      "6",
+			"(- 5)":                          "-5",
+			"'(a (b \"c\"))":                 `(a (b "c"))`,
+			"(if (< 1 2) 'yes 'no)":          "yes",
+			"(cons 1 (cdr '(a b c)))":        "(1 b c)",
+			"(null? (cdr (list 1)))":         "#t",
+			"(define (sq x) (* x x)) (sq 7)": "49",
+			`(define (fact n) (if (<= n 1) 1 (* n (fact (- n 1)))))
+			 (fact 10)`: "3628800",
+			`(define (make-adder n) (lambda (x) (+ x n)))
+			 (define add2 (make-adder 2))
+			 (add2 40)`: "42",
+		} {
+			val, err := Run(src, NewEnv(nil))
+			r.NoError(err, src)
+			r.Equal(expected, Print(val), src)
+		}
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Run("(undefined 1)", NewEnv(nil))
+		r.EqualError(err, "undefined symbol: undefined")
+
+		_, err = Run("(1 2)", NewEnv(nil))
+		r.EqualError(err, "not a procedure: 1")
+
+		_, err = Run("(car '())", NewEnv(nil))
+		r.EqualError(err, "car: not a non-empty list: ()")
+	})
+}
@@ -0,0 +1,25 @@
+// Command lisp evaluates the Lisp program read from stdin and prints the
+// value of its last expression.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	val, err := Run(string(src), NewEnv(nil))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(Print(val))
+}
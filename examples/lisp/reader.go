@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	p "github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/toolkit"
+)
+
+// Value is any Lisp value: float64, string, bool, Symbol, List, or a
+// procedure.
+type Value interface{}
+
+// Symbol is an identifier, such as define or +.
+type Symbol string
+
+// List is a parenthesized list. The empty list is nil.
+type List []Value
+
+// A Lisp reader needs very little grammar: a datum is an atom, a list of
+// datums, or a quoted datum. The only recursion is through datum, so it is
+// the one Ref, declared first and set once every rule that refers to it
+// exists. The Ref is what lets list and quote mention datum before its
+// definition is complete.
+var (
+	datum = p.R("datum")
+
+	ws = toolkit.NewWSSpec().Newlines(true).LineComment(";").Rule()
+	tk = toolkit.Tokens(ws)
+
+	// atomEnd ensures an atom isn't the prefix of a longer one, so that
+	// 1+ is read as a symbol rather than the number 1 followed by +.
+	atomEnd = p.Check(p.Or(p.Set(' ', '\t', '\r', '\n', '(', ')', '"', ';', '\''), p.EOS()))
+
+	number = p.ActionErr(
+		p.Seq(p.Named("num", toolkit.NewNumberSpec().Bases(10).Rule()), atomEnd),
+		func(v p.Values) (interface{}, error) {
+			return v.Get("num").(*toolkit.NumberValue).AsFloat64()
+		})
+
+	boolean = p.Or(
+		p.Action(p.Seq(p.S("#t"), atomEnd), func(v p.Values) interface{} { return true }),
+		p.Action(p.Seq(p.S("#f"), atomEnd), func(v p.Values) interface{} { return false }),
+	)
+
+	str = p.Action(p.Named("str", toolkit.DoubleQuotedString), func(v p.Values) interface{} {
+		return v.Get("str").(*toolkit.StringValue).Value
+	})
+
+	symbol = p.Transform(
+		p.Plus(p.Rune(func(r rune) bool {
+			switch r {
+			case ' ', '\t', '\r', '\n', '(', ')', '"', ';', '\'':
+				return false
+			}
+			return true
+		})),
+		func(s string) interface{} {
+			return Symbol(s)
+		})
+
+	list = p.Action(
+		p.Seq(tk.Tok("("), p.Named("items", p.Collect(p.Star(datum))), tk.Tok(")")),
+		func(v p.Values) interface{} {
+			items := v.Get("items").([]interface{})
+			if len(items) == 0 {
+				return List(nil)
+			}
+
+			l := make(List, len(items))
+			for i, item := range items {
+				l[i] = item
+			}
+
+			return l
+		})
+
+	// quote expands 'x into (quote x) as it's read.
+	quote = p.Action(
+		p.Seq(tk.Tok("'"), p.Named("d", datum)),
+		func(v p.Values) interface{} {
+			return List{Symbol("quote"), v.Get("d")}
+		})
+
+	program = p.Seq(ws, p.Collect(p.Star(datum)))
+)
+
+func init() {
+	datum.Set(p.Or(list, quote, tk.T(p.Or(str, number, boolean, symbol))))
+}
+
+// Read parses every datum in src.
+func Read(src string) ([]Value, error) {
+	res := p.New().Run(program, src)
+
+	var (
+		nm *p.NoMatchError
+		nc *p.ErrInputNotConsumed
+	)
+
+	switch err := res.Err(); {
+	case err == nil:
+	case errors.As(err, &nm):
+		return nil, fmt.Errorf("%s: unexpected input", nm.Pos)
+	case errors.As(err, &nc):
+		if nc.Pos.Offset >= len(src) {
+			return nil, fmt.Errorf("%s: unexpected end of input", nc.Pos)
+		}
+		return nil, fmt.Errorf("%s: unexpected %q", nc.Pos, src[nc.Pos.Offset:nc.Pos.Offset+1])
+	default:
+		return nil, err
+	}
+
+	var vals []Value
+	for _, v := range res.Value.([]interface{}) {
+		vals = append(vals, v)
+	}
+
+	return vals, nil
+}
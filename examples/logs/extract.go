@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	p "github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/toolkit"
+)
+
+// Record is one structured log line, such as:
+//
+//	2024-05-01T12:00:00Z INFO msg="request done" path=/a status=200
+type Record struct {
+	Time   time.Time
+	Level  string
+	Fields map[string]string
+}
+
+var (
+	spaces = p.Plus(p.S(" "))
+
+	word = p.Plus(p.Rune(func(r rune) bool {
+		return r != ' ' && r != '=' && r != '"' && r != '\n' && r != '\r'
+	}))
+
+	timestamp = p.ActionErr(p.Named("ts", p.Capture(word)), func(v p.Values) (interface{}, error) {
+		return time.Parse(time.RFC3339, v.Get("ts").(string))
+	})
+
+	// header is the timestamp and level that begin every line. It's kept
+	// separate from line so that the cheap part of a line can be parsed
+	// on its own, see Extractor.Header.
+	header = p.Action(
+		p.Seq(
+			p.Named("time", timestamp),
+			spaces,
+			p.Named("level", p.Capture(p.Plus(p.Range('A', 'Z')))),
+		),
+		func(v p.Values) interface{} {
+			return &Record{
+				Time:  v.Get("time").(time.Time),
+				Level: v.Get("level").(string),
+			}
+		})
+
+	value = p.Or(
+		p.Action(p.Named("str", toolkit.DoubleQuotedString), func(v p.Values) interface{} {
+			return v.Get("str").(*toolkit.StringValue).Value
+		}),
+		p.Capture(p.Star(p.Rune(func(r rune) bool {
+			return r != ' ' && r != '\n' && r != '\r'
+		}))),
+	)
+
+	field = p.Action(
+		p.Seq(p.Named("key", p.Capture(word)), p.S("="), p.Named("value", value)),
+		func(v p.Values) interface{} {
+			return [2]string{v.Get("key").(string), v.Get("value").(string)}
+		})
+
+	line = p.Action(
+		p.Seq(
+			p.Named("rec", header),
+			p.Named("fields", p.Collect(p.Star(p.Seq(spaces, field)))),
+			p.Star(p.S(" ")),
+		),
+		func(v p.Values) interface{} {
+			rec := v.Get("rec").(*Record)
+			rec.Fields = make(map[string]string)
+
+			for _, f := range v.Get("fields").([]interface{}) {
+				kv := f.([2]string)
+				rec.Fields[kv[0]] = kv[1]
+			}
+
+			return rec
+		})
+
+	newlines = p.Plus(p.Or(p.S("\n"), p.S("\r\n")))
+)
+
+// Extractor parses log lines into Records. The rules are built once, at
+// package initialization, and the Parser is built once per Extractor, so
+// the per line cost is only the parse itself. Reuse an Extractor rather
+// than creating one per line.
+type Extractor struct {
+	parser *p.Parser
+}
+
+// NewExtractor returns an Extractor.
+func NewExtractor() *Extractor {
+	return &Extractor{parser: p.New()}
+}
+
+// Line parses a single log line, which must not contain its newline.
+func (e *Extractor) Line(text string) (*Record, error) {
+	val, ok, err := e.parser.Parse(line, text)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("malformed log line: %q", text)
+	}
+
+	return val.(*Record), nil
+}
+
+// Header parses only the timestamp and level at the start of text,
+// ignoring the rest of it. The Fields of the returned Record are nil. It's
+// useful for filtering lines before paying for a full parse.
+func (e *Extractor) Header(text string) (*Record, error) {
+	val, _, ok, err := e.parser.ParseAt(header, text, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("malformed log line: %q", text)
+	}
+
+	return val.(*Record), nil
+}
+
+// All parses every line in data, which is useful when the whole log is
+// already in memory. On error, the records parsed before the malformed
+// line are returned along with the error.
+func (e *Extractor) All(data string) ([]*Record, error) {
+	vals, spans, err := e.parser.ParseAll(line, data, newlines)
+
+	recs := make([]*Record, len(vals))
+	for i, v := range vals {
+		recs[i] = v.(*Record)
+	}
+
+	if err != nil {
+		line := 1
+		if len(spans) > 0 {
+			line = spans[len(spans)-1].End.Line + 1
+		}
+
+		return recs, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	return recs, nil
+}
+
+// Stream reads lines from r and calls fn with each one that keep accepts,
+// without holding more than one line in memory. keep is given the Record
+// from Header, so only the lines it accepts are fully parsed. A nil keep
+// accepts every line.
+func (e *Extractor) Stream(r io.Reader, keep func(*Record) bool, fn func(*Record) error) error {
+	sc := bufio.NewScanner(r)
+
+	for n := 1; sc.Scan(); n++ {
+		text := sc.Text()
+		if text == "" {
+			continue
+		}
+
+		if keep != nil {
+			hdr, err := e.Header(text)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+
+			if !keep(hdr) {
+				continue
+			}
+		}
+
+		rec, err := e.Line(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractor(t *testing.T) {
+	t.Run("parses a line", func(t *testing.T) {
+		r := require.New(t)
+
+		rec, err := NewExtractor().Line(`2024-05-01T12:00:00Z WARN msg="slow db\tcall" path=/a/b empty= dur=12ms`)
+		r.NoError(err)
+
+		r.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), rec.Time)
+		r.Equal("WARN", rec.Level)
+		r.Equal(map[string]string{
+			"msg":   "slow db\tcall",
+			"path":  "/a/b",
+			"empty": "",
+			"dur":   "12ms",
+		}, rec.Fields)
+
+		_, err = NewExtractor().Line("not a log line")
+		r.Error(err)
+	})
+
+	t.Run("parses only the header", func(t *testing.T) {
+		r := require.New(t)
+
+		rec, err := NewExtractor().Header(`2024-05-01T12:00:00Z ERROR anything "at all`)
+		r.NoError(err)
+		r.Equal("ERROR", rec.Level)
+		r.Nil(rec.Fields)
+	})
+
+	t.Run("parses a whole log in memory", func(t *testing.T) {
+		r := require.New(t)
+
+		e := NewExtractor()
+
+		recs, err := e.All(generate(10))
+		r.NoError(err)
+		r.Len(recs, 10)
+		r.Equal("/login", recs[1].Fields["path"])
+
+		recs, err = e.All(generate(3) + "garbage\n")
+		r.Error(err)
+		r.Contains(err.Error(), "line 4:")
+		r.Len(recs, 3)
+	})
+
+	t.Run("streams and filters lines", func(t *testing.T) {
+		r := require.New(t)
+
+		var recs []*Record
+
+		err := NewExtractor().Stream(strings.NewReader(generate(100)),
+			func(rec *Record) bool { return rec.Level == "ERROR" },
+			func(rec *Record) error {
+				recs = append(recs, rec)
+				return nil
+			})
+		r.NoError(err)
+		r.Len(recs, 20)
+
+		for _, rec := range recs {
+			r.Equal("ERROR", rec.Level)
+			r.Equal("500", rec.Fields["status"])
+		}
+
+		err = NewExtractor().Stream(strings.NewReader(generate(2)+"oops\n"), nil, func(*Record) error { return nil })
+		r.Error(err)
+		r.Contains(err.Error(), "line 3:")
+	})
+}
+
+func BenchmarkStream(b *testing.B) {
+	data := generate(10000)
+
+	e := NewExtractor()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := e.Stream(strings.NewReader(data), nil, func(*Record) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Command logs extracts structured records from log lines and reports the
+// throughput of doing so. It reads lines from stdin, or with -generate N,
+// parses N generated lines instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	fGenerate = flag.Int("generate", 0, "parse this many generated lines instead of stdin")
+	fLevel    = flag.String("level", "", "only extract lines with this level")
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func main() {
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if *fGenerate > 0 {
+		in = strings.NewReader(generate(*fGenerate))
+	}
+
+	var keep func(*Record) bool
+	if *fLevel != "" {
+		keep = func(r *Record) bool { return r.Level == *fLevel }
+	}
+
+	var (
+		cr       = &countingReader{r: in}
+		statuses = make(map[string]int)
+		lines    int
+		start    = time.Now()
+	)
+
+	err := NewExtractor().Stream(cr, keep, func(r *Record) error {
+		lines++
+		statuses[r.Fields["status"]]++
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dur := time.Since(start)
+
+	fmt.Printf("extracted %d lines in %s (%.0f lines/s, %.1f MB/s)\n",
+		lines, dur, float64(lines)/dur.Seconds(), float64(cr.n)/dur.Seconds()/1e6)
+
+	var codes []string
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		fmt.Printf("  status=%s: %d\n", code, statuses[code])
+	}
+}
+
+// generate returns n log lines in the format Record describes.
+func generate(n int) string {
+	var (
+		sb     strings.Builder
+		levels = []string{"INFO", "INFO", "INFO", "WARN", "ERROR"}
+		paths  = []string{"/", "/login", "/api/items", "/api/items/42"}
+		codes  = []int{200, 200, 200, 404, 500}
+		t      = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%s %s msg=\"request done\" method=GET path=%s status=%d dur=%dms\n",
+			t.Add(time.Duration(i)*time.Millisecond).Format(time.RFC3339),
+			levels[i%len(levels)], paths[i%len(paths)], codes[i%len(codes)], i%97)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,174 @@
+package main
+
+// Pos records where a node begins. It implements peggysue.SetPositioner,
+// so nodes created by Action and Pratt rules get their line filled in
+// automatically.
+type Pos struct {
+	Line int
+}
+
+func (p *Pos) SetPosition(start, end, line int, filename string) {
+	p.Line = line
+}
+
+// Expr is implemented by all expression nodes.
+type Expr interface {
+	expr()
+}
+
+// Stmt is implemented by all statement nodes.
+type Stmt interface {
+	stmt()
+}
+
+type (
+	// Literal is a number (float64), string, boolean, or nil.
+	Literal struct {
+		Pos
+		Value interface{}
+	}
+
+	Variable struct {
+		Pos
+		Name string
+	}
+
+	Assign struct {
+		Pos
+		Name  string
+		Value Expr
+	}
+
+	// Binary is an arithmetic, comparison, or equality operator.
+	Binary struct {
+		Pos
+		Left  Expr
+		Op    string
+		Right Expr
+	}
+
+	// Logical is "and" or "or", which short circuit.
+	Logical struct {
+		Pos
+		Left  Expr
+		Op    string
+		Right Expr
+	}
+
+	Unary struct {
+		Pos
+		Op    string
+		Right Expr
+	}
+
+	Call struct {
+		Pos
+		Callee Expr
+		Args   []Expr
+	}
+
+	// Get is a property access, such as obj.name.
+	Get struct {
+		Pos
+		Object Expr
+		Name   string
+	}
+
+	// Set is an assignment to a property, such as obj.name = value.
+	Set struct {
+		Pos
+		Object Expr
+		Name   string
+		Value  Expr
+	}
+
+	This struct {
+		Pos
+	}
+
+	Super struct {
+		Pos
+		Method string
+	}
+
+	Grouping struct {
+		Pos
+		Expr Expr
+	}
+)
+
+func (*Literal) expr()  {}
+func (*Variable) expr() {}
+func (*Assign) expr()   {}
+func (*Binary) expr()   {}
+func (*Logical) expr()  {}
+func (*Unary) expr()    {}
+func (*Call) expr()     {}
+func (*Get) expr()      {}
+func (*Set) expr()      {}
+func (*This) expr()     {}
+func (*Super) expr()    {}
+func (*Grouping) expr() {}
+
+// The statements without a Pos are built with peggysue.Apply, which fills
+// in fields from the named values of the rule using the ast tags.
+type (
+	Expression struct {
+		Expr Expr `ast:"expr"`
+	}
+
+	Print struct {
+		Expr Expr `ast:"expr"`
+	}
+
+	Var struct {
+		Pos
+		Name string
+		Init Expr
+	}
+
+	Block struct {
+		Pos
+		Stmts []Stmt
+	}
+
+	If struct {
+		Cond Expr `ast:"cond"`
+		Then Stmt `ast:"then"`
+		Else Stmt `ast:"else"`
+	}
+
+	While struct {
+		Cond Expr `ast:"cond"`
+		Body Stmt `ast:"body"`
+	}
+
+	Function struct {
+		Pos
+		Name   string
+		Params []string
+		Body   []Stmt
+	}
+
+	Return struct {
+		Pos
+		Value Expr
+	}
+
+	Class struct {
+		Pos
+		Name       string
+		Superclass *Variable
+		Methods    []*Function
+	}
+)
+
+func (*Expression) stmt() {}
+func (*Print) stmt()      {}
+func (*Var) stmt()        {}
+func (*Block) stmt()      {}
+func (*If) stmt()         {}
+func (*While) stmt()      {}
+func (*Function) stmt()   {}
+func (*Return) stmt()     {}
+func (*Class) stmt()      {}
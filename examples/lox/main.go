@@ -0,0 +1,43 @@
+// Command lox parses a Lox program, the language from Crafting Interpreters,
+// and prints its syntax tree.
+//
+// Usage:
+//
+//	lox [file]
+//
+// If no file is given, the program is read from stdin.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	var (
+		src []byte
+		err error
+	)
+
+	if len(os.Args) > 1 {
+		src, err = os.ReadFile(os.Args[1])
+	} else {
+		src, err = io.ReadAll(os.Stdin)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(74)
+	}
+
+	stmts, err := Parse(string(src))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(65)
+	}
+
+	for _, s := range stmts {
+		fmt.Println(Sprint(s))
+	}
+}
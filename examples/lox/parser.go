@@ -0,0 +1,381 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+
+	p "github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/toolkit"
+)
+
+var keywords = []string{
+	"and", "class", "else", "false", "for", "fun", "if", "nil",
+	"or", "print", "return", "super", "this", "true", "var", "while",
+}
+
+var program = grammar()
+
+// grammar builds the Lox grammar from Crafting Interpreters. Whitespace and
+// comments are skipped after each token, so the program rule skips any
+// leading whitespace once and then every other rule can assume it's at the
+// start of a token.
+func grammar() p.Rule {
+	var (
+		ws = toolkit.NewWSSpec().Newlines(true).LineComment("//").Rule()
+		tk = toolkit.Tokens(ws)
+
+		identChar = p.Rune(func(r rune) bool {
+			return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+		})
+
+		ident = tk.T(toolkit.IdentifierExcluding(keywords...))
+
+		number = tk.T(toolkit.NewNumberSpec().
+			Bases(10).
+			Sign(false).
+			Underscores(toolkit.UnderscoresNone).
+			Rule())
+
+		str = tk.T(toolkit.MakeRawString(`"`, false))
+
+		declaration = p.R("declaration")
+		statement   = p.R("statement")
+		expression  = p.R("expression")
+		operators   = p.R("operators")
+		primary     = p.R("primary")
+		block       = p.R("block")
+	)
+
+	// op matches an operator and produces it as a string. The operator
+	// must not be followed by any of the bytes in notBefore, so that "<"
+	// doesn't match the start of "<=".
+	op := func(str, notBefore string) p.Rule {
+		rules := []p.Rule{p.Capture(p.S(str))}
+		if notBefore != "" {
+			rules = append(rules, p.Not(p.Set([]rune(notBefore)...)))
+		}
+
+		return tk.T(p.Seq(rules...))
+	}
+
+	// kwOp is a keyword used as an operator, such as "and".
+	kwOp := func(kw string) p.Rule {
+		return tk.T(p.Seq(p.Capture(p.S(kw)), p.Not(identChar)))
+	}
+
+	assignOp := tk.T(p.Seq(p.S("="), p.Not(p.S("="))))
+
+	literal := func(kw string, val interface{}) p.Rule {
+		return p.Action(tk.Kw(kw), func(p.Values) interface{} {
+			return &Literal{Value: val}
+		})
+	}
+
+	primary.Set(p.Or(
+		literal("true", true),
+		literal("false", false),
+		literal("nil", nil),
+		p.Action(tk.Kw("this"), func(p.Values) interface{} {
+			return &This{}
+		}),
+		p.Action(p.Seq(tk.Kw("super"), tk.Tok("."), p.Named("method", ident)), func(v p.Values) interface{} {
+			return &Super{Method: v.Get("method").(string)}
+		}),
+		p.Action(p.Named("num", number), func(v p.Values) interface{} {
+			f, _ := v.Get("num").(*toolkit.NumberValue).AsFloat64()
+			return &Literal{Value: f}
+		}),
+		p.Action(p.Named("str", str), func(v p.Values) interface{} {
+			return &Literal{Value: v.Get("str").(*toolkit.StringValue).Value}
+		}),
+		p.Action(p.Named("name", ident), func(v p.Values) interface{} {
+			return &Variable{Name: v.Get("name").(string)}
+		}),
+		p.Action(p.Seq(tk.Tok("("), p.Named("expr", expression), tk.Tok(")")), func(v p.Values) interface{} {
+			return &Grouping{Expr: v.Get("expr").(Expr)}
+		}),
+	))
+
+	binary := func(lhs, op, rhs interface{}) interface{} {
+		return &Binary{Left: lhs.(Expr), Op: op.(string), Right: rhs.(Expr)}
+	}
+
+	logical := func(lhs, op, rhs interface{}) interface{} {
+		return &Logical{Left: lhs.(Expr), Op: op.(string), Right: rhs.(Expr)}
+	}
+
+	unary := func(op, v interface{}) interface{} {
+		return &Unary{Op: op.(string), Right: v.(Expr)}
+	}
+
+	args := p.Action(
+		p.Seq(
+			tk.Tok("("),
+			p.Named("args", toolkit.List(expression, tk.Tok(","), toolkit.ListOpts{AllowEmpty: true})),
+			tk.Tok(")"),
+		),
+		func(v p.Values) interface{} {
+			var args []Expr
+			for _, a := range v.Get("args").([]interface{}) {
+				args = append(args, a.(Expr))
+			}
+
+			// Always produce a non-nil slice, so that the postfix operator
+			// has a value even when there are no arguments.
+			if args == nil {
+				args = []Expr{}
+			}
+
+			return args
+		})
+
+	// The binary and unary operators, calls, and property access are all
+	// handled by a single Pratt rule. Each level of the book's grammar
+	// becomes a binding power.
+	operators.Set(p.Pratt(primary).
+		Infix(kwOp("or"), 1, p.AssocLeft, logical).
+		Infix(kwOp("and"), 2, p.AssocLeft, logical).
+		Infix(op("==", ""), 3, p.AssocLeft, binary).
+		Infix(op("!=", ""), 3, p.AssocLeft, binary).
+		Infix(op(">=", ""), 4, p.AssocLeft, binary).
+		Infix(op(">", "="), 4, p.AssocLeft, binary).
+		Infix(op("<=", ""), 4, p.AssocLeft, binary).
+		Infix(op("<", "="), 4, p.AssocLeft, binary).
+		Infix(op("+", ""), 5, p.AssocLeft, binary).
+		Infix(op("-", ""), 5, p.AssocLeft, binary).
+		Infix(op("*", ""), 6, p.AssocLeft, binary).
+		Infix(op("/", ""), 6, p.AssocLeft, binary).
+		Prefix(op("!", "="), 7, unary).
+		Prefix(op("-", ""), 7, unary).
+		Postfix(args, 8, func(v, args interface{}) interface{} {
+			return &Call{Callee: v.(Expr), Args: args.([]Expr)}
+		}).
+		Postfix(p.Seq(tk.Tok("."), ident), 8, func(v, name interface{}) interface{} {
+			return &Get{Object: v.(Expr), Name: name.(string)}
+		}))
+
+	// Assignment is right associative and its target can be any
+	// expression, which is then checked. This is how the book handles it
+	// as well, as it allows for a better error than a syntax error.
+	assignment := p.ActionErr(
+		p.Seq(p.Named("target", operators), assignOp, p.Named("value", expression)),
+		func(v p.Values) (interface{}, error) {
+			value := v.Get("value").(Expr)
+
+			switch t := v.Get("target").(type) {
+			case *Variable:
+				return &Assign{Name: t.Name, Value: value}, nil
+			case *Get:
+				return &Set{Object: t.Object, Name: t.Name, Value: value}, nil
+			default:
+				return nil, errors.New("Invalid assignment target.")
+			}
+		})
+
+	expression.Set(p.Or(assignment, operators))
+
+	exprStmt := p.Scope(p.Apply(p.Seq(p.Named("expr", expression), tk.Tok(";")), Expression{}))
+
+	varDecl := p.Action(
+		p.Seq(
+			tk.Kw("var"),
+			p.Named("name", ident),
+			p.Maybe(p.Seq(assignOp, p.Named("init", expression))),
+			tk.Tok(";"),
+		),
+		func(v p.Values) interface{} {
+			init, _ := v.Get("init").(Expr)
+			return &Var{Name: v.Get("name").(string), Init: init}
+		})
+
+	block.Set(p.Action(
+		p.Seq(tk.Tok("{"), p.Named("stmts", p.Collect(p.Star(declaration))), tk.Tok("}")),
+		func(v p.Values) interface{} {
+			return &Block{Stmts: stmts(v.Get("stmts"))}
+		}))
+
+	// for is desugared into a while loop, as the book does.
+	forStmt := p.Action(
+		p.Seq(
+			tk.Kw("for"),
+			tk.Tok("("),
+			p.Or(p.Named("init", varDecl), p.Named("init", exprStmt), tk.Tok(";")),
+			p.Maybe(p.Named("cond", expression)),
+			tk.Tok(";"),
+			p.Maybe(p.Named("incr", expression)),
+			tk.Tok(")"),
+			p.Named("body", statement),
+		),
+		func(v p.Values) interface{} {
+			body := v.Get("body").(Stmt)
+
+			if incr, ok := v.Get("incr").(Expr); ok {
+				body = &Block{Stmts: []Stmt{body, &Expression{Expr: incr}}}
+			}
+
+			cond, ok := v.Get("cond").(Expr)
+			if !ok {
+				cond = &Literal{Value: true}
+			}
+
+			var loop Stmt = &While{Cond: cond, Body: body}
+
+			if init, ok := v.Get("init").(Stmt); ok {
+				loop = &Block{Stmts: []Stmt{init, loop}}
+			}
+
+			return loop
+		})
+
+	function := p.Action(
+		p.Seq(
+			p.Named("name", ident),
+			tk.Tok("("),
+			p.Named("params", toolkit.List(ident, tk.Tok(","), toolkit.ListOpts{AllowEmpty: true})),
+			tk.Tok(")"),
+			p.Named("body", block),
+		),
+		func(v p.Values) interface{} {
+			fn := &Function{
+				Name: v.Get("name").(string),
+				Body: v.Get("body").(*Block).Stmts,
+			}
+
+			for _, param := range v.Get("params").([]interface{}) {
+				fn.Params = append(fn.Params, param.(string))
+			}
+
+			return fn
+		})
+
+	classDecl := p.Action(
+		p.Seq(
+			tk.Kw("class"),
+			p.Named("name", ident),
+			p.Maybe(p.Seq(
+				tk.Tok("<"),
+				p.Named("super", p.Action(p.Named("name", ident), func(v p.Values) interface{} {
+					return &Variable{Name: v.Get("name").(string)}
+				})),
+			)),
+			tk.Tok("{"),
+			p.Named("methods", p.Collect(p.Star(function))),
+			tk.Tok("}"),
+		),
+		func(v p.Values) interface{} {
+			class := &Class{Name: v.Get("name").(string)}
+			class.Superclass, _ = v.Get("super").(*Variable)
+
+			for _, m := range v.Get("methods").([]interface{}) {
+				class.Methods = append(class.Methods, m.(*Function))
+			}
+
+			return class
+		})
+
+	statement.Set(p.Or(
+		forStmt,
+		p.Scope(p.Apply(p.Seq(
+			tk.Kw("if"),
+			tk.Tok("("),
+			p.Named("cond", expression),
+			tk.Tok(")"),
+			p.Named("then", statement),
+			p.Maybe(p.Seq(tk.Kw("else"), p.Named("else", statement))),
+		), If{})),
+		p.Scope(p.Apply(p.Seq(tk.Kw("print"), p.Named("expr", expression), tk.Tok(";")), Print{})),
+		p.Action(
+			p.Seq(tk.Kw("return"), p.Maybe(p.Named("value", expression)), tk.Tok(";")),
+			func(v p.Values) interface{} {
+				value, _ := v.Get("value").(Expr)
+				return &Return{Value: value}
+			}),
+		p.Scope(p.Apply(p.Seq(
+			tk.Kw("while"),
+			tk.Tok("("),
+			p.Named("cond", expression),
+			tk.Tok(")"),
+			p.Named("body", statement),
+		), While{})),
+		block,
+		exprStmt,
+	))
+
+	declaration.Set(p.Or(
+		classDecl,
+		p.Seq(tk.Kw("fun"), function),
+		varDecl,
+		statement,
+	))
+
+	return p.Action(
+		p.Seq(ws, p.Named("stmts", p.Collect(p.Star(declaration)))),
+		func(v p.Values) interface{} {
+			return stmts(v.Get("stmts"))
+		})
+}
+
+func stmts(v interface{}) []Stmt {
+	var ret []Stmt
+
+	for _, s := range v.([]interface{}) {
+		ret = append(ret, s.(Stmt))
+	}
+
+	return ret
+}
+
+// Parse parses a Lox program. Errors are reported in the same style as the
+// book's interpreter, with the line they occurred on.
+func Parse(src string) ([]Stmt, error) {
+	val, ok, err := p.New().Parse(program, src)
+	if err != nil {
+		return nil, describe(src, err)
+	}
+
+	if !ok {
+		return nil, errors.New("[line 1] Error: Expect declaration.")
+	}
+
+	return val.([]Stmt), nil
+}
+
+// describe converts errors from the parser into Lox style error messages.
+func describe(src string, err error) error {
+	var (
+		se *p.SemanticError
+		nc *p.ErrInputNotConsumed
+	)
+
+	switch {
+	case errors.As(err, &se):
+		return fmt.Errorf("[line %d] Error: %s", se.Pos.Line, se.Err)
+	case errors.As(err, &nc):
+		// Pos is the furthest the parser got before failing, which is
+		// where the problem most likely is.
+		pos := nc.Pos
+		if pos.Offset >= len(src) {
+			return fmt.Errorf("[line %d] Error at end: Unexpected end of input.", pos.Line)
+		}
+
+		return fmt.Errorf("[line %d] Error at '%s': Unexpected input.", pos.Line, tokenAt(src[pos.Offset:]))
+	default:
+		return err
+	}
+}
+
+// tokenAt returns the word, or the single character, at the start of str.
+func tokenAt(str string) string {
+	for i, r := range str {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if i == 0 {
+				return string(r)
+			}
+
+			return str[:i]
+		}
+	}
+
+	return str
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	sprint := func(r *require.Assertions, src string) string {
+		stmts, err := Parse(src)
+		r.NoError(err, src)
+
+		var parts []string
+		for _, s := range stmts {
+			parts = append(parts, Sprint(s))
+		}
+
+		return strings.Join(parts, " ")
+	}
+
+	t.Run("parses expressions with precedence", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, out := range map[string]string{
+			`1 + 2 * 3;`:              "(; (+ 1 (* 2 3)))",
+			`(1 + 2) * 3;`:            "(; (* (group (+ 1 2)) 3))",
+			`-a - -b;`:                "(; (- (- a) (- b)))",
+			`!a == b;`:                "(; (== (! a) b))",
+			`a <= b != c > d;`:        "(; (!= (<= a b) (> c d)))",
+			`a or b and c;`:           "(; (or a (and b c)))",
+			`a = b = c;`:              "(; (= a (= b c)))",
+			`obj.x.y = f(1, "s")(2);`: `(; (=. (. obj x) y (call (call f 1 "s") 2)))`,
+			`super.init(this, nil);`:  "(; (call (super init) this nil))",
+			`orchid;`:                 "(; orchid)",
+			`1.5 / 0.25;`:             "(; (/ 1.5 0.25))",
+		} {
+			r.Equal(out, sprint(r, src), src)
+		}
+	})
+
+	t.Run("parses statements", func(t *testing.T) {
+		r := require.New(t)
+
+		src := `
+// a comment
+var x = 1;
+var y;
+if (x > 0) print "pos"; else { print "neg"; }
+while (x < 10) x = x + 1;
+fun add(a, b) { return a + b; }
+fun noop() { return; }
+class Point < Base {
+  init(x) { this.x = x; }
+  len() { return 0; }
+}
+`
+
+		r.Equal(strings.Join([]string{
+			`(var x 1)`,
+			`(var y)`,
+			`(if (> x 0) (print "pos") (block (print "neg")))`,
+			`(while (< x 10) (; (= x (+ x 1))))`,
+			`(fun add (a b) (return (+ a b)))`,
+			`(fun noop () (return))`,
+			`(class Point < Base (fun init (x) (; (=. this x x))) (fun len () (return 0)))`,
+		}, " "), sprint(r, src))
+	})
+
+	t.Run("desugars for loops", func(t *testing.T) {
+		r := require.New(t)
+
+		r.Equal(
+			"(block (var i 0) (while (< i 3) (block (print i) (; (= i (+ i 1))))))",
+			sprint(r, `for (var i = 0; i < 3; i = i + 1) print i;`),
+		)
+
+		r.Equal("(while true (print 1))", sprint(r, `for (;;) print 1;`))
+	})
+
+	t.Run("records line numbers", func(t *testing.T) {
+		r := require.New(t)
+
+		stmts, err := Parse("var a;\n\nfun f() {\n  return\n    a + 1;\n}\n")
+		r.NoError(err)
+
+		fn := stmts[1].(*Function)
+		r.Equal(3, fn.Line)
+
+		ret := fn.Body[0].(*Return)
+		r.Equal(4, ret.Line)
+		r.Equal(5, ret.Value.(*Binary).Line)
+	})
+
+	t.Run("reports errors with line numbers", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Parse("var a = 1;\nprint a +;\n")
+		r.EqualError(err, "[line 2] Error at ';': Unexpected input.")
+
+		_, err = Parse("var a = 1;\n\na + b = 3;\n")
+		r.EqualError(err, "[line 3] Error: Invalid assignment target.")
+
+		_, err = Parse("print (1")
+		r.EqualError(err, "[line 1] Error at end: Unexpected end of input.")
+
+		_, err = Parse("var if = 1;")
+		r.EqualError(err, "[line 1] Error at 'if': Unexpected input.")
+	})
+}
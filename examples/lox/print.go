@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sprint renders a node as an s-expression, like the book's AstPrinter.
+func Sprint(node interface{}) string {
+	switch n := node.(type) {
+	case *Literal:
+		switch v := n.Value.(type) {
+		case nil:
+			return "nil"
+		case string:
+			return strconv.Quote(v)
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			return fmt.Sprint(v)
+		}
+	case *Variable:
+		return n.Name
+	case *Assign:
+		return parens("=", n.Name, n.Value)
+	case *Binary:
+		return parens(n.Op, n.Left, n.Right)
+	case *Logical:
+		return parens(n.Op, n.Left, n.Right)
+	case *Unary:
+		return parens(n.Op, n.Right)
+	case *Call:
+		parts := []interface{}{n.Callee}
+		for _, a := range n.Args {
+			parts = append(parts, a)
+		}
+
+		return parens("call", parts...)
+	case *Get:
+		return parens(".", n.Object, n.Name)
+	case *Set:
+		return parens("=.", n.Object, n.Name, n.Value)
+	case *This:
+		return "this"
+	case *Super:
+		return parens("super", n.Method)
+	case *Grouping:
+		return parens("group", n.Expr)
+	case *Expression:
+		return parens(";", n.Expr)
+	case *Print:
+		return parens("print", n.Expr)
+	case *Var:
+		if n.Init == nil {
+			return parens("var", n.Name)
+		}
+
+		return parens("var", n.Name, n.Init)
+	case *Block:
+		return parens("block", stmtParts(n.Stmts)...)
+	case *If:
+		if n.Else == nil {
+			return parens("if", n.Cond, n.Then)
+		}
+
+		return parens("if", n.Cond, n.Then, n.Else)
+	case *While:
+		return parens("while", n.Cond, n.Body)
+	case *Function:
+		parts := []interface{}{n.Name, "(" + strings.Join(n.Params, " ") + ")"}
+		return parens("fun", append(parts, stmtParts(n.Body)...)...)
+	case *Return:
+		if n.Value == nil {
+			return "(return)"
+		}
+
+		return parens("return", n.Value)
+	case *Class:
+		parts := []interface{}{n.Name}
+		if n.Superclass != nil {
+			parts = append(parts, "<", n.Superclass.Name)
+		}
+
+		for _, m := range n.Methods {
+			parts = append(parts, m)
+		}
+
+		return parens("class", parts...)
+	case string:
+		return n
+	default:
+		return fmt.Sprintf("<unknown %T>", n)
+	}
+}
+
+func stmtParts(stmts []Stmt) []interface{} {
+	parts := make([]interface{}, len(stmts))
+	for i, s := range stmts {
+		parts[i] = s
+	}
+
+	return parts
+}
+
+func parens(name string, parts ...interface{}) string {
+	var sb strings.Builder
+
+	sb.WriteString("(")
+	sb.WriteString(name)
+
+	for _, part := range parts {
+		sb.WriteString(" ")
+		sb.WriteString(Sprint(part))
+	}
+
+	sb.WriteString(")")
+
+	return sb.String()
+}
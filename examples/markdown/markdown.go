@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+// Unlike an expression language, Markdown is a sequence of blocks, each
+// made of whole lines. Every block rule below starts at the beginning of a
+// line and consumes its trailing line break, so the grammar's shape is a
+// loop over lines rather than a tree of operators. Inline markup, such as
+// emphasis, is then parsed within the text of a single line.
+//
+// The supported subset is:
+//
+//	# Header            (levels 1 through 6)
+//	- item, * item      (unordered lists, also +)
+//	1. item             (ordered lists)
+//	```lang ... ```     (fenced code blocks)
+//	paragraphs          (consecutive non-blank lines)
+//	**strong**, *em*, _em_, `code`
+var (
+	space = p.Set(' ', '\t')
+
+	eol = p.Or(p.S("\r\n"), p.S("\n"), p.EOS())
+
+	notEOL = p.Rune(func(r rune) bool {
+		return r != '\n' && r != '\r'
+	})
+
+	// bol only matches at the start of a line. Block rules begin with it
+	// to make the line anchoring explicit: if a block rule were ever
+	// reached mid-line, it fails instead of misreading the rest of the
+	// line as a new block.
+	bol = p.CheckActionCtx(func(ctx *p.MatchContext) bool {
+		return ctx.Column == 1
+	})
+
+	// Inline rules. Each produces a string of HTML.
+
+	code = p.Action(
+		p.Seq(p.S("`"), p.Named("code", p.Capture(until(p.S("`"), notEOL))), p.S("`")),
+		func(v p.Values) interface{} {
+			return "<code>" + html.EscapeString(v.Get("code").(string)) + "</code>"
+		})
+
+	inline = p.R("inline")
+
+	strong = wrap("strong", p.S("**"))
+
+	em = p.Or(wrap("em", p.S("*")), wrap("em", p.S("_")))
+
+	// text consumes a run of characters that can't start markup in one go,
+	// falling back to a single character so that unmatched markup, such as
+	// a lone *, is output literally.
+	text = p.Transform(
+		p.Or(
+			p.Plus(p.Rune(func(r rune) bool {
+				return !strings.ContainsRune("`*_\r\n", r)
+			})),
+			notEOL,
+		),
+		func(s string) interface{} {
+			return html.EscapeString(s)
+		})
+
+	inlines = p.Many(inline, 0, -1, join)
+
+	// Block rules. Each produces a string of HTML, except blank which
+	// produces nothing.
+
+	blank = p.Seq(p.Star(space), eol)
+
+	closeFence = p.Seq(p.S("```"), p.Star(space), eol)
+
+	fence = p.Action(
+		p.Seq(
+			p.S("```"),
+			p.Named("lang", p.Capture(p.Star(notEOL))),
+			eol,
+			p.Named("body", p.Capture(until(closeFence, p.Seq(p.Not(p.EOS()), p.Star(notEOL), eol)))),
+			p.Or(closeFence, p.EOS()),
+		),
+		func(v p.Values) interface{} {
+			var class string
+			if lang := strings.TrimSpace(v.Get("lang").(string)); lang != "" {
+				class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(lang))
+			}
+
+			return fmt.Sprintf("<pre><code%s>%s</code></pre>\n", class, html.EscapeString(v.Get("body").(string)))
+		})
+
+	headerMark = p.Seq(p.Many(p.S("#"), 1, 6, nil), p.Plus(space))
+
+	header = p.Action(
+		p.Seq(
+			p.Named("level", p.Capture(p.Many(p.S("#"), 1, 6, nil))),
+			p.Plus(space),
+			p.Named("text", inlines),
+			eol,
+		),
+		func(v p.Values) interface{} {
+			level := len(v.Get("level").(string))
+			return fmt.Sprintf("<h%d>%s</h%d>\n", level, strings.TrimSpace(v.Get("text").(string)), level)
+		})
+
+	bullet = p.Seq(p.Set('-', '*', '+'), p.Plus(space))
+
+	number = p.Seq(p.Plus(p.Range('0', '9')), p.Set('.', ')'), p.Plus(space))
+
+	unordered = list("ul", bullet)
+
+	ordered = list("ol", number)
+
+	paragraph = p.Many(
+		p.Action(
+			p.Seq(
+				p.Not(blank),
+				p.Not(p.Or(p.S("```"), headerMark, bullet, number)),
+				p.Named("text", inlines),
+				eol,
+			),
+			func(v p.Values) interface{} {
+				return strings.TrimSpace(v.Get("text").(string))
+			}),
+		1, -1, func(lines []interface{}) interface{} {
+			var parts []string
+			for _, l := range lines {
+				parts = append(parts, l.(string))
+			}
+
+			return "<p>" + strings.Join(parts, "\n") + "</p>\n"
+		})
+
+	block = p.Seq(bol, p.Or(fence, header, unordered, ordered, blank, paragraph))
+
+	document = p.Many(p.Seq(p.Not(p.EOS()), block), 0, -1, join)
+)
+
+func init() {
+	inline.Set(p.Or(code, strong, em, text))
+}
+
+// until matches item repeatedly, stopping before end. It never fails: if
+// end doesn't appear, it consumes every item it can.
+func until(end, item p.Rule) p.Rule {
+	return p.Star(p.Seq(p.Not(end), item))
+}
+
+// wrap returns a rule for inline markup delimited by delim on both sides,
+// such as **strong**, producing the HTML element tag. The content can't
+// begin with a space, so a lone delimiter like "2 * 3" isn't markup.
+func wrap(tag string, delim p.Rule) p.Rule {
+	return p.Action(
+		p.Seq(
+			delim,
+			p.Not(space),
+			p.Named("body", p.Many(p.Seq(p.Not(delim), inline), 1, -1, join)),
+			delim,
+		),
+		func(v p.Values) interface{} {
+			return "<" + tag + ">" + v.Get("body").(string) + "</" + tag + ">"
+		})
+}
+
+// list returns a rule for a run of list items that each start with
+// marker, producing the HTML list element tag.
+func list(tag string, marker p.Rule) p.Rule {
+	item := p.Action(
+		p.Seq(marker, p.Named("text", inlines), eol),
+		func(v p.Values) interface{} {
+			return "<li>" + strings.TrimSpace(v.Get("text").(string)) + "</li>\n"
+		})
+
+	return p.Many(item, 1, -1, func(items []interface{}) interface{} {
+		return "<" + tag + ">\n" + join(items).(string) + "</" + tag + ">\n"
+	})
+}
+
+// join concatenates the strings in values, skipping nils.
+func join(values []interface{}) interface{} {
+	var sb strings.Builder
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			sb.WriteString(s)
+		}
+	}
+
+	return sb.String()
+}
+
+// Render converts the Markdown in src to HTML.
+func Render(src string) (string, error) {
+	val, _, err := p.New().Parse(document, src)
+	if err != nil {
+		return "", err
+	}
+
+	return val.(string), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	t.Run("renders blocks", func(t *testing.T) {
+		r := require.New(t)
+
+		out, err := Render("# Title\n\nSome text\nspans lines.\n\n- one\n- two\n\n1. first\n2) second\n\n```go\nif a < b {\n\n}\n```\n### Last #\n")
+		r.NoError(err)
+
+		r.Equal("<h1>Title</h1>\n"+
+			"<p>Some text\nspans lines.</p>\n"+
+			"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"+
+			"<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n"+
+			"<pre><code class=\"language-go\">if a &lt; b {\n\n}\n</code></pre>\n"+
+			"<h3>Last #</h3>\n", out)
+	})
+
+	t.Run("renders inline markup", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, expected := range map[string]string{
+			"**bold** and *em* and _em_":   "<p><strong>bold</strong> and <em>em</em> and <em>em</em></p>\n",
+			"**nested *em***":              "<p><strong>nested <em>em</em></strong></p>\n",
+			"use `a*b` <here>":             "<p>use <code>a*b</code> &lt;here&gt;</p>\n",
+			"2 * 3 and a lone *":           "<p>2 * 3 and a lone *</p>\n",
+			"#nospace is text":             "<p>#nospace is text</p>\n",
+			"- item with **bold**\r\ntext": "<ul>\n<li>item with <strong>bold</strong></li>\n</ul>\n<p>text</p>\n",
+		} {
+			out, err := Render(src)
+			r.NoError(err, src)
+			r.Equal(expected, out, src)
+		}
+	})
+
+	t.Run("closes unterminated code fences at the end", func(t *testing.T) {
+		r := require.New(t)
+
+		out, err := Render("```\ncode")
+		r.NoError(err)
+		r.Equal("<pre><code>code</code></pre>\n", out)
+	})
+}
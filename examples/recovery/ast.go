@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is the location of a node, recorded by the parser through
+// peggysue.SetPositioner.
+type Pos struct {
+	Offset int
+	Line   int
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (p *Pos) SetPosition(start, end, line int, filename string) {
+	p.Offset = start
+	p.Line = line
+}
+
+// Stmt is a statement.
+type Stmt interface {
+	stmt()
+}
+
+// Expr is an expression.
+type Expr interface {
+	expr()
+}
+
+// Let is let name = value;
+type Let struct {
+	Pos
+	Name  string
+	Value Expr
+}
+
+// Print is print value;
+type Print struct {
+	Pos
+	Value Expr
+}
+
+// Block is { stmts }
+type Block struct {
+	Pos
+	Stmts []Stmt
+}
+
+// ExprStmt is an expression evaluated for its effect, value;
+type ExprStmt struct {
+	Pos
+	Value Expr
+}
+
+// BadStmt stands in for input that couldn't be parsed as a statement.
+// Text is the input that was skipped.
+type BadStmt struct {
+	Pos
+	Text string
+}
+
+func (*Let) stmt()      {}
+func (*Print) stmt()    {}
+func (*Block) stmt()    {}
+func (*ExprStmt) stmt() {}
+func (*BadStmt) stmt()  {}
+
+// Num is a number literal.
+type Num struct {
+	Pos
+	Text string
+}
+
+// Var is a reference to a variable.
+type Var struct {
+	Pos
+	Name string
+}
+
+// Binary is Left Op Right.
+type Binary struct {
+	Op          string
+	Left, Right Expr
+}
+
+// BadExpr stands in for a missing or malformed expression.
+type BadExpr struct {
+	Pos
+}
+
+func (*Num) expr()     {}
+func (*Var) expr()     {}
+func (*Binary) expr()  {}
+func (*BadExpr) expr() {}
+
+// Sprint returns a compact, s-expression style form of stmts. Nodes that
+// stand in for errors are printed as <bad>.
+func Sprint(stmts []Stmt) string {
+	parts := make([]string, len(stmts))
+
+	for i, s := range stmts {
+		parts[i] = sprintStmt(s)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func sprintStmt(s Stmt) string {
+	switch s := s.(type) {
+	case *Let:
+		name := s.Name
+		if name == "" {
+			name = "<bad>"
+		}
+		return fmt.Sprintf("(let %s %s)", name, sprintExpr(s.Value))
+	case *Print:
+		return fmt.Sprintf("(print %s)", sprintExpr(s.Value))
+	case *Block:
+		return fmt.Sprintf("{%s}", Sprint(s.Stmts))
+	case *ExprStmt:
+		return sprintExpr(s.Value)
+	default:
+		return "<bad>"
+	}
+}
+
+func sprintExpr(e Expr) string {
+	switch e := e.(type) {
+	case *Num:
+		return e.Text
+	case *Var:
+		return e.Name
+	case *Binary:
+		return fmt.Sprintf("(%s %s %s)", e.Op, sprintExpr(e.Left), sprintExpr(e.Right))
+	default:
+		return "<bad>"
+	}
+}
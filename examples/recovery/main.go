@@ -0,0 +1,30 @@
+// Command recovery parses a small statement language from stdin and
+// prints every error it finds, followed by the partial AST that it was
+// still able to build.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	stmts, diags := Parse(string(src))
+
+	for _, d := range diags {
+		fmt.Println(d.Format(string(src)))
+	}
+
+	fmt.Println(Sprint(stmts))
+
+	if len(diags) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	p "github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/toolkit"
+)
+
+// Diagnostic is a problem found in the input.
+type Diagnostic struct {
+	Pos
+	Msg string
+}
+
+// Format returns the diagnostic as a message followed by the line of src
+// it refers to, with a caret under the offending column.
+func (d *Diagnostic) Format(src string) string {
+	start := strings.LastIndexByte(src[:d.Offset], '\n') + 1
+
+	end := strings.IndexByte(src[d.Offset:], '\n')
+	if end == -1 {
+		end = len(src)
+	} else {
+		end += d.Offset
+	}
+
+	line := src[start:end]
+	col := d.Offset - start
+
+	// Keep tabs in the indentation so the caret lines up with the line
+	// above it however tabs are displayed.
+	indent := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return '\t'
+		}
+		return ' '
+	}, line[:col])
+
+	return fmt.Sprintf("%d:%d: %s\n    %s\n    %s^", d.Line, col+1, d.Msg, line, indent)
+}
+
+// The strategy for recovering from errors has two parts.
+//
+// Where a specific token or expression is required, expect and expectExpr
+// try it and, if it's missing, report a diagnostic and carry on as though
+// it was there. The statement is still built, with a BadExpr standing in
+// for anything missing, which is how the partial AST is produced.
+//
+// When a statement can't be recognized at all, or is followed by junk
+// instead of its ;, the input is skipped up to the next ; or }, which are
+// the places where parsing can confidently resume. The skipped input
+// becomes a BadStmt.
+//
+// Diagnostics are recorded in the state store rather than a side table.
+// The store is rolled back when the parser backtracks, so a diagnostic
+// reported within an alternative that's later abandoned disappears with
+// it, and only the errors along the path actually taken are reported.
+var (
+	stmt = p.R("stmt")
+	expr = p.R("expr")
+
+	ws = toolkit.NewWSSpec().Newlines(true).LineComment("//").Rule()
+	tk = toolkit.Tokens(ws)
+
+	ident = tk.T(toolkit.IdentifierExcluding("let", "print"))
+
+	// here produces a Diagnostic positioned at the current input.
+	here = p.Action(p.S(""), func(v p.Values) interface{} {
+		return &Diagnostic{}
+	})
+
+	// skip consumes input up to and including the next ;, or up to the
+	// next } or the end of input, and always at least one character.
+	skip = p.Scan(func(s string) int {
+		i := strings.IndexAny(s, ";}")
+		switch {
+		case i == -1:
+			return len(s)
+		case s[i] == ';':
+			return i + 1
+		case i == 0:
+			return 1
+		default:
+			return i
+		}
+	})
+
+	num = p.Action(
+		p.Named("text", tk.T(p.Capture(p.Plus(p.Range('0', '9'))))),
+		func(v p.Values) interface{} {
+			return &Num{Text: v.Get("text").(string)}
+		})
+
+	variable = p.Action(p.Named("name", ident), func(v p.Values) interface{} {
+		return &Var{Name: v.Get("name").(string)}
+	})
+
+	paren = p.Action(
+		p.Seq(
+			tk.Tok("("),
+			p.Named("value", expectExpr("expected an expression after '('")),
+			expect(")", "expected ')'"),
+		),
+		func(v p.Values) interface{} {
+			return v.Get("value")
+		})
+
+	primary = p.Or(num, variable, paren)
+
+	factor = binary(primary, "*", "/")
+
+	term = binary(factor, "+", "-")
+
+	// semi ends a statement. If the ; is missing, whatever is there
+	// instead is skipped.
+	semi = p.Or(
+		tk.Tok(";"),
+		p.Seq(report("expected ';'"), p.Maybe(p.Seq(p.Not(p.S("}")), skip)), ws),
+	)
+
+	letStmt = p.Action(
+		p.Seq(
+			tk.Kw("let"),
+			p.Named("name", p.Or(ident, report("expected a name after 'let'"))),
+			expect("=", "expected '='"),
+			p.Named("value", expectExpr("expected an expression after '='")),
+			semi,
+		),
+		func(v p.Values) interface{} {
+			name, _ := v.Get("name").(string)
+			return &Let{Name: name, Value: v.Get("value").(Expr)}
+		})
+
+	printStmt = p.Action(
+		p.Seq(
+			tk.Kw("print"),
+			p.Named("value", expectExpr("expected an expression after 'print'")),
+			semi,
+		),
+		func(v p.Values) interface{} {
+			return &Print{Value: v.Get("value").(Expr)}
+		})
+
+	block = p.Action(
+		p.Seq(
+			tk.Tok("{"),
+			p.Named("stmts", stmts(p.Not(p.S("}")))),
+			expect("}", "expected '}' to close the block"),
+		),
+		func(v p.Values) interface{} {
+			return &Block{Stmts: v.Get("stmts").([]Stmt)}
+		})
+
+	exprStmt = p.Action(
+		p.Seq(p.Named("value", expr), semi),
+		func(v p.Values) interface{} {
+			return &ExprStmt{Value: v.Get("value").(Expr)}
+		})
+
+	badStmt = p.Action(
+		p.Seq(report("expected a statement"), p.Named("text", p.Capture(skip)), ws),
+		func(v p.Values) interface{} {
+			return &BadStmt{Text: v.Get("text").(string)}
+		})
+
+	program = p.Action(
+		p.Seq(
+			ws,
+			p.Named("stmts", stmts(p.Not(p.EOS()))),
+			p.Named("diags", p.Maybe(p.StateGet("diags"))),
+		),
+		func(v p.Values) interface{} {
+			diags, _ := v.Get("diags").([]*Diagnostic)
+			return &result{stmts: v.Get("stmts").([]Stmt), diags: diags}
+		})
+)
+
+func init() {
+	expr.Set(term)
+	stmt.Set(p.Or(letStmt, printStmt, block, exprStmt, badStmt))
+}
+
+// report returns a rule that records a diagnostic with msg at the current
+// position. It always matches without consuming input.
+func report(msg string) p.Rule {
+	return p.Scope(p.Seq(
+		p.Named("at", here),
+		p.StateUpdate("diags", func(old interface{}, v p.Values) interface{} {
+			d := v.Get("at").(*Diagnostic)
+			d.Msg = msg
+
+			// Copy rather than append in place, so that earlier versions
+			// of the list, which the store may restore, are unchanged.
+			diags, _ := old.([]*Diagnostic)
+			return append(append([]*Diagnostic(nil), diags...), d)
+		}),
+	))
+}
+
+// expect matches the token tok, or reports msg if it's missing.
+func expect(tok, msg string) p.Rule {
+	return p.Or(tk.Tok(tok), report(msg))
+}
+
+// expectExpr matches an expression, or reports msg and produces a BadExpr
+// if there isn't one.
+func expectExpr(msg string) p.Rule {
+	return p.Or(expr, p.Action(p.Named("at", report(msg)), func(v p.Values) interface{} {
+		return &BadExpr{Pos: v.Get("at").(*Diagnostic).Pos}
+	}))
+}
+
+// binary returns a rule for a left associative chain of operand separated
+// by any of ops. A missing right operand is reported and replaced by a
+// BadExpr.
+func binary(operand p.Rule, ops ...string) p.Rule {
+	var opRules []p.Rule
+	for _, op := range ops {
+		opRules = append(opRules, p.S(op))
+	}
+
+	rest := p.Action(
+		p.Seq(
+			p.Named("op", tk.T(p.Capture(p.Or(opRules...)))),
+			p.Named("rhs", p.Or(operand, p.Action(p.Named("at", report("expected an expression")), func(v p.Values) interface{} {
+				return &BadExpr{Pos: v.Get("at").(*Diagnostic).Pos}
+			}))),
+		),
+		func(v p.Values) interface{} {
+			return &Binary{Op: v.Get("op").(string), Right: v.Get("rhs").(Expr)}
+		})
+
+	return p.Action(
+		p.Seq(p.Named("lhs", operand), p.Named("rest", p.Collect(p.Star(rest)))),
+		func(v p.Values) interface{} {
+			e := v.Get("lhs").(Expr)
+
+			for _, r := range v.Get("rest").([]interface{}) {
+				b := r.(*Binary)
+				b.Left = e
+				e = b
+			}
+
+			return e
+		})
+}
+
+// stmts returns a rule collecting statements for as long as guard
+// matches.
+func stmts(guard p.Rule) p.Rule {
+	return p.Action(
+		p.Named("stmts", p.Collect(p.Star(p.Seq(guard, stmt)))),
+		func(v p.Values) interface{} {
+			out := []Stmt{}
+
+			for _, s := range v.Get("stmts").([]interface{}) {
+				out = append(out, s.(Stmt))
+			}
+
+			return out
+		})
+}
+
+type result struct {
+	stmts []Stmt
+	diags []*Diagnostic
+}
+
+// Parse parses src, recovering from errors. It always returns the
+// statements it could build, along with a diagnostic for each error, in
+// the order they appear in src.
+func Parse(src string) ([]Stmt, []*Diagnostic) {
+	val, _, err := p.New().Parse(program, src)
+	if err != nil {
+		// The grammar can skip any input, so this only happens if it
+		// has a bug.
+		panic(err)
+	}
+
+	res := val.(*result)
+
+	sort.SliceStable(res.diags, func(i, j int) bool {
+		return res.diags[i].Offset < res.diags[j].Offset
+	})
+
+	return res.stmts, res.diags
+}
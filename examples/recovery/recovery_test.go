@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("parses valid programs without diagnostics", func(t *testing.T) {
+		r := require.New(t)
+
+		stmts, diags := Parse("let x = 1 + 2 * 3;\n{ print x; x; } // done\n")
+		r.Empty(diags)
+		r.Equal("(let x (+ 1 (* 2 3))) {(print x) x}", Sprint(stmts))
+	})
+
+	t.Run("recovers from errors and builds a partial tree", func(t *testing.T) {
+		r := require.New(t)
+
+		src := "let = 1;\nlet y 2;\nprint (y + ;\n) ) ;\nlet z = 3 4;\n{ print z;\n"
+
+		stmts, diags := Parse(src)
+
+		var msgs []string
+		for _, d := range diags {
+			msgs = append(msgs, d.Format(src))
+		}
+
+		r.Equal([]string{
+			"1:5: expected a name after 'let'\n    let = 1;\n        ^",
+			"2:7: expected '='\n    let y 2;\n          ^",
+			"3:12: expected an expression\n    print (y + ;\n               ^",
+			"3:12: expected ')'\n    print (y + ;\n               ^",
+			"4:1: expected a statement\n    ) ) ;\n    ^",
+			"5:11: expected ';'\n    let z = 3 4;\n              ^",
+			"7:1: expected '}' to close the block\n    \n    ^",
+		}, msgs)
+
+		r.Equal("(let <bad> 1) (let y 2) (print (+ y <bad>)) <bad> (let z 3) {(print z)}", Sprint(stmts))
+	})
+
+	t.Run("keeps tabs when placing the caret", func(t *testing.T) {
+		r := require.New(t)
+
+		src := "\tprint ;"
+
+		_, diags := Parse(src)
+		r.Len(diags, 1)
+		r.Equal("1:8: expected an expression after 'print'\n    \tprint ;\n    \t      ^", diags[0].Format(src))
+	})
+}
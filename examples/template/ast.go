@@ -0,0 +1,69 @@
+package main
+
+// Node is a part of a template.
+type Node interface {
+	node()
+}
+
+// Text is raw template text, output as is.
+type Text struct {
+	Value string
+}
+
+// Output is {{ expr }}. The value is HTML escaped when rendered.
+type Output struct {
+	Expr Expr
+}
+
+// If is {{#if cond}} then {{else}} else {{/if}}. Else is optional.
+type If struct {
+	Cond Expr
+	Then []Node
+	Else []Node
+}
+
+// Each is {{#each name in expr}} body {{/each}}, rendering body once per
+// element of expr with name bound to the element.
+type Each struct {
+	Name string
+	List Expr
+	Body []Node
+}
+
+func (*Text) node()   {}
+func (*Output) node() {}
+func (*If) node()     {}
+func (*Each) node()   {}
+
+// Expr is an expression within a tag.
+type Expr interface {
+	expr()
+}
+
+// Path looks up a dotted name, such as user.name, in the data.
+type Path struct {
+	Names []string
+}
+
+// Literal is a number or a string without interpolations.
+type Literal struct {
+	Value interface{}
+}
+
+// Interp is a string containing ${expr} interpolations. Parts are
+// *Literal text and the interpolated expressions, in order.
+type Interp struct {
+	Parts []Expr
+}
+
+// Filter applies the named filter to the value of Expr, as in
+// name | upper.
+type Filter struct {
+	Expr Expr
+	Name string
+}
+
+func (*Path) expr()    {}
+func (*Literal) expr() {}
+func (*Interp) expr()  {}
+func (*Filter) expr()  {}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	p "github.com/lab47/peggysue"
+	"github.com/lab47/peggysue/toolkit"
+)
+
+// A template is in one of two modes. In text mode everything is copied
+// through until the next {{, which switches to tag mode. In tag mode the
+// input is an expression grammar with whitespace skipping, until the
+// closing }} switches back. The two modes are simply two sets of rules:
+// text mode is a single Scan, and the tag rules are the only ones that
+// use tk, so only they skip whitespace.
+//
+// String literals within tags add a third mode. Their text is scanned
+// like template text, but ${ switches back into expression mode until
+// the matching }. Because expr is a Ref, a string can contain an
+// expression that contains a string, to any depth.
+var (
+	nodes = p.R("nodes")
+	expr  = p.R("expr")
+
+	ws = p.Star(p.Set(' ', '\t', '\r', '\n'))
+	tk = toolkit.Tokens(ws)
+
+	// text is raw template text, everything up to the next {{.
+	text = p.Transform(
+		p.Scan(func(s string) int {
+			i := strings.Index(s, "{{")
+			if i == -1 {
+				i = len(s)
+			}
+
+			if i == 0 {
+				return -1
+			}
+
+			return i
+		}),
+		func(s string) interface{} {
+			return &Text{Value: s}
+		})
+
+	// comment is {{! ... }}, which produces nothing.
+	comment = p.Seq(
+		p.S("{{!"),
+		p.Scan(func(s string) int {
+			return strings.Index(s, "}}")
+		}),
+		p.S("}}"),
+	)
+
+	// open and closeTag switch into and out of tag mode.
+	open     = tk.Tok("{{")
+	closeTag = p.S("}}")
+
+	ident = p.Capture(p.Seq(
+		p.Rune(func(r rune) bool { return r == '_' || isLetter(r) }),
+		p.Star(p.Rune(func(r rune) bool { return r == '_' || isLetter(r) || ('0' <= r && r <= '9') })),
+	))
+
+	output = p.Action(
+		p.Seq(
+			open,
+			p.Not(p.Or(p.Set('#', '/', '!'), p.Seq(p.S("else"), ws, closeTag))),
+			p.Named("expr", expr),
+			closeTag,
+		),
+		func(v p.Values) interface{} {
+			return &Output{Expr: v.Get("expr").(Expr)}
+		})
+
+	elseTag = p.Seq(open, tk.Tok("else"), closeTag)
+
+	ifBlock = p.Action(
+		p.Seq(
+			open, tk.Tok("#if"),
+			p.Named("cond", expr),
+			closeTag,
+			p.Named("then", nodes),
+			p.Maybe(p.Seq(elseTag, p.Named("else", nodes))),
+			endTag("if"),
+		),
+		func(v p.Values) interface{} {
+			n := &If{
+				Cond: v.Get("cond").(Expr),
+				Then: v.Get("then").([]Node),
+			}
+
+			if e, ok := v.Get("else").([]Node); ok {
+				n.Else = e
+			}
+
+			return n
+		})
+
+	eachBlock = p.Action(
+		p.Seq(
+			open, tk.Tok("#each"),
+			p.Named("name", tk.T(ident)),
+			tk.Tok("in"),
+			p.Named("list", expr),
+			closeTag,
+			p.Named("body", nodes),
+			endTag("each"),
+		),
+		func(v p.Values) interface{} {
+			return &Each{
+				Name: v.Get("name").(string),
+				List: v.Get("list").(Expr),
+				Body: v.Get("body").([]Node),
+			}
+		})
+
+	node = p.Or(text, comment, ifBlock, eachBlock, output)
+
+	path = p.Action(
+		p.Named("path", tk.T(p.Capture(p.Seq(ident, p.Star(p.Seq(p.S("."), ident)))))),
+		func(v p.Values) interface{} {
+			return &Path{Names: strings.Split(v.Get("path").(string), ".")}
+		})
+
+	number = p.ActionErr(
+		p.Named("num", tk.T(toolkit.NewNumberSpec().Bases(10).Rule())),
+		func(v p.Values) (interface{}, error) {
+			f, err := v.Get("num").(*toolkit.NumberValue).AsFloat64()
+			if err != nil {
+				return nil, err
+			}
+
+			return &Literal{Value: f}, nil
+		})
+
+	// strText is the literal text of a string, up to a quote, an escape,
+	// or the start of an interpolation.
+	strText = p.Transform(
+		p.Scan(func(s string) int {
+			for i := 0; i < len(s); i++ {
+				switch {
+				case s[i] == '"', s[i] == '\\', strings.HasPrefix(s[i:], "${"):
+					if i == 0 {
+						return -1
+					}
+					return i
+				}
+			}
+
+			return len(s)
+		}),
+		func(s string) interface{} {
+			return &Literal{Value: s}
+		})
+
+	strEscape = p.Seq(p.S(`\`), p.Transform(p.Any(), func(s string) interface{} {
+		switch s {
+		case "n":
+			s = "\n"
+		case "t":
+			s = "\t"
+		}
+
+		return &Literal{Value: s}
+	}))
+
+	interp = p.Seq(tk.Tok("${"), expr, p.S("}"))
+
+	str = p.Action(
+		p.Seq(
+			p.S(`"`),
+			p.Named("parts", p.Collect(p.Star(p.Or(strText, strEscape, interp)))),
+			tk.Tok(`"`),
+		),
+		func(v p.Values) interface{} {
+			var parts []Expr
+
+			for _, part := range v.Get("parts").([]interface{}) {
+				parts = append(parts, part.(Expr))
+			}
+
+			return simplify(parts)
+		})
+
+	primary = p.Or(str, number, path, p.Seq(tk.Tok("("), expr, tk.Tok(")")))
+
+	filters = map[string]bool{"upper": true, "lower": true, "len": true, "trim": true}
+
+	filtered = p.ActionErr(
+		p.Seq(
+			p.Named("expr", primary),
+			p.Named("filters", p.Collect(p.Star(p.Seq(tk.Tok("|"), tk.T(ident))))),
+		),
+		func(v p.Values) (interface{}, error) {
+			e := v.Get("expr").(Expr)
+
+			for _, f := range v.Get("filters").([]interface{}) {
+				name := f.(string)
+				if !filters[name] {
+					return nil, fmt.Errorf("unknown filter: %s", name)
+				}
+
+				e = &Filter{Expr: e, Name: name}
+			}
+
+			return e, nil
+		})
+
+	template = p.Seq(nodes, p.EOS())
+)
+
+func init() {
+	expr.Set(filtered)
+
+	nodes.Set(p.Action(
+		p.Named("nodes", p.Collect(p.Star(node))),
+		func(v p.Values) interface{} {
+			out := []Node{}
+
+			for _, n := range v.Get("nodes").([]interface{}) {
+				if n, ok := n.(Node); ok {
+					out = append(out, n)
+				}
+			}
+
+			return out
+		}))
+}
+
+// endTag matches any {{/name}} and checks the name in an ActionErr, so
+// that a mismatched close produces a clear error instead of a failed
+// match far away from the mistake.
+func endTag(block string) p.Rule {
+	return p.ActionErr(
+		p.Seq(open, tk.Tok("/"), p.Named("name", tk.T(ident)), closeTag),
+		func(v p.Values) (interface{}, error) {
+			if name := v.Get("name").(string); name != block {
+				return nil, fmt.Errorf("{{#%s}} closed by {{/%s}}", block, name)
+			}
+			return nil, nil
+		})
+}
+
+// isLetter reports whether r is an ASCII letter.
+func isLetter(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+// simplify turns a string with no interpolations into a plain Literal.
+func simplify(parts []Expr) Expr {
+	var sb strings.Builder
+
+	for _, part := range parts {
+		lit, ok := part.(*Literal)
+		if !ok {
+			return &Interp{Parts: parts}
+		}
+
+		sb.WriteString(lit.Value.(string))
+	}
+
+	return &Literal{Value: sb.String()}
+}
+
+// Parse parses a template.
+func Parse(src string) ([]Node, error) {
+	res := p.New().Run(template, src)
+
+	var (
+		se *p.SemanticError
+		nm *p.NoMatchError
+	)
+
+	switch err := res.Err(); {
+	case err == nil:
+		return res.Value.([]Node), nil
+	case errors.As(err, &se):
+		return nil, fmt.Errorf("%s: %s", se.Pos, se.Err)
+	case errors.As(err, &nm):
+		if nm.Pos.Offset >= len(src) {
+			return nil, fmt.Errorf("%s: unexpected end of template", nm.Pos)
+		}
+		return nil, fmt.Errorf("%s: unexpected %q", nm.Pos, src[nm.Pos.Offset:nm.Pos.Offset+1])
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+)
+
+// scope holds the variables bound by each blocks, falling back to the
+// data the template was rendered with.
+type scope struct {
+	vars   map[string]interface{}
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (interface{}, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+// Render renders nodes with data. Paths that aren't found in data render
+// as empty, like mustache.
+func Render(nodes []Node, data map[string]interface{}) (string, error) {
+	var sb strings.Builder
+
+	if err := render(&sb, nodes, &scope{vars: data}); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func render(sb *strings.Builder, nodes []Node, sc *scope) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Text:
+			sb.WriteString(n.Value)
+		case *Output:
+			v, err := eval(n.Expr, sc)
+			if err != nil {
+				return err
+			}
+
+			if v != nil {
+				sb.WriteString(html.EscapeString(fmt.Sprint(v)))
+			}
+		case *If:
+			v, err := eval(n.Cond, sc)
+			if err != nil {
+				return err
+			}
+
+			body := n.Else
+			if truthy(v) {
+				body = n.Then
+			}
+
+			if err := render(sb, body, sc); err != nil {
+				return err
+			}
+		case *Each:
+			v, err := eval(n.List, sc)
+			if err != nil {
+				return err
+			}
+
+			if v == nil {
+				continue
+			}
+
+			rv := reflect.ValueOf(v)
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				return fmt.Errorf("each: %s is not a list", fmt.Sprint(v))
+			}
+
+			for i := 0; i < rv.Len(); i++ {
+				inner := &scope{
+					vars:   map[string]interface{}{n.Name: rv.Index(i).Interface()},
+					parent: sc,
+				}
+
+				if err := render(sb, n.Body, inner); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func eval(e Expr, sc *scope) (interface{}, error) {
+	switch e := e.(type) {
+	case *Literal:
+		return e.Value, nil
+	case *Path:
+		v, ok := sc.lookup(e.Names[0])
+		if !ok {
+			return nil, nil
+		}
+
+		for _, name := range e.Names[1:] {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+
+			v = m[name]
+		}
+
+		return v, nil
+	case *Interp:
+		var sb strings.Builder
+
+		for _, part := range e.Parts {
+			v, err := eval(part, sc)
+			if err != nil {
+				return nil, err
+			}
+
+			if v != nil {
+				sb.WriteString(fmt.Sprint(v))
+			}
+		}
+
+		return sb.String(), nil
+	case *Filter:
+		v, err := eval(e.Expr, sc)
+		if err != nil {
+			return nil, err
+		}
+
+		return applyFilter(e.Name, v)
+	default:
+		return nil, fmt.Errorf("unknown expression: %T", e)
+	}
+}
+
+func applyFilter(name string, v interface{}) (interface{}, error) {
+	switch name {
+	case "upper":
+		return strings.ToUpper(toString(v)), nil
+	case "lower":
+		return strings.ToLower(toString(v)), nil
+	case "trim":
+		return strings.TrimSpace(toString(v)), nil
+	case "len":
+		if v == nil {
+			return 0, nil
+		}
+
+		switch rv := reflect.ValueOf(v); rv.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			return rv.Len(), nil
+		default:
+			return nil, fmt.Errorf("len: %s has no length", fmt.Sprint(v))
+		}
+	default:
+		return nil, fmt.Errorf("unknown filter: %s", name)
+	}
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// truthy reports whether v counts as true in an if: anything but nil,
+// false, zero, or an empty string, list, or map.
+func truthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() != 0
+	default:
+		return true
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":  "Ada",
+			"admin": true,
+		},
+		"items": []interface{}{"pen", "<ink>"},
+		"empty": []interface{}{},
+	}
+
+	t.Run("renders text, output, and blocks", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, expected := range map[string]string{
+			"plain text, no tags":                                       "plain text, no tags",
+			"Hi {{ user.name }}!":                                       "Hi Ada!",
+			"{{user.name|upper}} {{ missing }}.":                        "ADA .",
+			"a{{! ignored }}b":                                          "ab",
+			"{{#if user.admin}}admin{{/if}}":                            "admin",
+			"{{#if empty}}yes{{ else }}no{{/if}}":                       "no",
+			"{{#each i in items}}[{{i}}]{{/each}}":                      "[pen][&lt;ink&gt;]",
+			"{{ items | len }} items":                                   "2 items",
+			`{{ "hello, ${user.name | lower}" }}`:                       "hello, ada",
+			`{{ "a ${"b ${ user.name }"} c" }}`:                         "a b Ada c",
+			`{{ "\"quoted\"\tok" }}`:                                    "&#34;quoted&#34;\tok",
+			"{{#each i in items}}{{#if i}}{{i|upper}}{{/if}},{{/each}}": "PEN,&lt;INK&gt;,",
+		} {
+			nodes, err := Parse(src)
+			r.NoError(err, src)
+
+			out, err := Render(nodes, data)
+			r.NoError(err, src)
+			r.Equal(expected, out, src)
+		}
+	})
+
+	t.Run("reports template errors", func(t *testing.T) {
+		r := require.New(t)
+
+		for src, msg := range map[string]string{
+			"{{#if x}}a{{/each}}":    "1:11: {{#if}} closed by {{/each}}",
+			"{{ name | shout }}":     "1:4: unknown filter: shout",
+			"{{#if x}}never closed":  "1:22: unexpected end of template",
+			"{{ name ":               "1:9: unexpected end of template",
+			"{{ \"open ${ name\" }}": `1:17: unexpected "\""`,
+		} {
+			_, err := Parse(src)
+			r.Error(err, src)
+			r.Equal(msg, err.Error(), src)
+		}
+	})
+}
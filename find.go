@@ -0,0 +1,481 @@
+package peggysue
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FindFirst searches the input for the first position at which the rule
+// matches, the way regexp's FindStringIndex does for a regexp. Unlike Parse,
+// the rule does not need to match at the start of the input, nor to consume
+// the rest of it.
+//
+// When the bytes that a match can begin with can be determined from the
+// rule, positions that begin with any other byte are skipped without trying
+// the rule. Otherwise, the rule is tried at the start of each rune.
+//
+// If a match is found, the value of the rule is returned along with the span
+// of input it matched.
+func (p *Parser) FindFirst(r Rule, input string) (val interface{}, span Span, found bool, err error) {
+	if err := p.checkInputSize(len(input)); err != nil {
+		return nil, Span{}, false, err
+	}
+
+	s := p.newState(input, p.filename)
+
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	start, res, ok := s.find(r, 0, firstBytes(r, p.fold))
+	if s.err != nil {
+		return nil, Span{}, false, s.err
+	}
+
+	if !ok {
+		return nil, Span{}, false, nil
+	}
+
+	return res.value, Span{Start: s.position(start), End: s.position(s.pos)}, true, nil
+}
+
+// Match is a match of a rule found in the input by FindAll.
+type Match struct {
+	// Value is the value of the rule.
+	Value interface{}
+
+	// Span is the input that the rule matched.
+	Span Span
+}
+
+// FindAll searches the input for successive non-overlapping matches of the
+// rule, and returns the value and span of each, in the order they appear.
+// If n >= 0, at most n matches are returned. A nil slice is returned if
+// there are none.
+//
+// As with regexp's FindAllStringIndex, after a match of no input the
+// search continues from the next rune, and a match of no input that
+// immediately follows another match is ignored.
+func (p *Parser) FindAll(r Rule, input string, n int) ([]Match, error) {
+	var matches []Match
+
+	err := p.findAll(r, input, n, func(s *state, start int, val interface{}) {
+		matches = append(matches, Match{
+			Value: val,
+			Span:  Span{Start: s.position(start), End: s.position(s.pos)},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// ReplaceAll returns a copy of the input in which each non-overlapping
+// match of the rule, found as FindAll does, has been replaced by the string
+// returned by fn. fn is passed the value of the rule and the text that it
+// matched. If there are no matches, the input is returned as is.
+//
+// If the input is decoded using WithEncoding, the copy is made of the
+// decoded UTF-8 text.
+func (p *Parser) ReplaceAll(r Rule, input string, fn func(val interface{}, text string) string) (string, error) {
+	var (
+		sb    strings.Builder
+		last  int
+		rest  string
+		found bool
+	)
+
+	err := p.findAll(r, input, -1, func(s *state, start int, val interface{}) {
+		sb.WriteString(s.input[last:start])
+		sb.WriteString(fn(val, s.input[start:s.pos]))
+		last = s.pos
+		rest = s.input[s.pos:]
+		found = true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !found {
+		return input, nil
+	}
+
+	sb.WriteString(rest)
+
+	return sb.String(), nil
+}
+
+// Split slices the input into the substrings between the matches of sep,
+// found as FindAll does, and returns them. Unlike a regexp, sep can be any
+// rule, such as a comma that is not within quotes. The substrings are
+// split the same way as regexp's Split with a count of -1, so that splitting
+// by a rule that matches no input splits the input into runes.
+//
+// If the input is decoded using WithEncoding, the substrings are of the
+// decoded UTF-8 text.
+func (p *Parser) Split(sep Rule, input string) ([]string, error) {
+	if input == "" {
+		return []string{""}, nil
+	}
+
+	var (
+		parts    []string
+		beg, end int
+		text     = input
+	)
+
+	err := p.findAll(sep, input, -1, func(s *state, start int, _ interface{}) {
+		text = s.input
+		end = start
+
+		if s.pos != 0 {
+			parts = append(parts, text[beg:end])
+		}
+
+		beg = s.pos
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if end != len(text) {
+		parts = append(parts, text[beg:])
+	}
+
+	return parts, nil
+}
+
+// findAll calls fn for each of up to n successive non-overlapping matches of
+// r in the input, or all of them if n < 0. When fn is called, the match
+// spans from start to s.pos.
+func (p *Parser) findAll(r Rule, input string, n int, fn func(s *state, start int, val interface{})) error {
+	if err := p.checkInputSize(len(input)); err != nil {
+		return err
+	}
+
+	s := p.newState(input, p.filename)
+
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	first := firstBytes(r, p.fold)
+
+	pos, prevEnd := 0, -1
+
+	for count := 0; n < 0 || count < n; {
+		start, res, ok := s.find(r, pos, first)
+		if s.err != nil {
+			return s.err
+		}
+
+		if !ok {
+			break
+		}
+
+		end := s.pos
+
+		if end > start || start != prevEnd {
+			fn(s, start, res.value)
+			count++
+		}
+
+		prevEnd = end
+
+		if end > start {
+			pos = end
+		} else {
+			if start == s.inputSize {
+				break
+			}
+
+			_, sz := utf8.DecodeRuneInString(s.input[start:])
+			pos = start + sz
+		}
+	}
+
+	return nil
+}
+
+// find tries r at each position from pos onwards until it matches, and
+// returns where the match began. If first is not nil, only positions that
+// begin with a byte in first are tried.
+func (s *state) find(r Rule, pos int, first *byteSet) (int, result, bool) {
+	top := s.mark()
+
+	for pos <= s.inputSize {
+		if first != nil {
+			for pos < s.inputSize && !first.has(s.input[pos]) {
+				pos++
+			}
+
+			// A rule with a first byte set can not match at the end of the
+			// input.
+			if pos == s.inputSize {
+				break
+			}
+		}
+
+		top.pos = pos
+		s.restore(top)
+
+		res := s.run(r)
+		if s.err != nil {
+			return pos, result{}, false
+		}
+
+		if res.matched {
+			return pos, res, true
+		}
+
+		if pos == s.inputSize {
+			break
+		}
+
+		_, sz := utf8.DecodeRuneInString(s.input[pos:])
+		pos += sz
+	}
+
+	s.restore(top)
+
+	return pos, result{}, false
+}
+
+// byteSet is a set of bytes.
+type byteSet [4]uint64
+
+func (b *byteSet) add(c byte) {
+	b[c>>6] |= 1 << (c & 63)
+}
+
+func (b *byteSet) has(c byte) bool {
+	return b[c>>6]&(1<<(c&63)) != 0
+}
+
+func (b *byteSet) union(o *byteSet) {
+	for i := range b {
+		b[i] |= o[i]
+	}
+}
+
+// addRune adds the first byte of the UTF-8 encoding of rn, and, if fold is
+// true, of the runes that are equivalent to it under simple case folding.
+func (b *byteSet) addRune(rn rune, fold bool) {
+	var buf [utf8.UTFMax]byte
+
+	utf8.EncodeRune(buf[:], rn)
+	b.add(buf[0])
+
+	if fold {
+		for f := unicode.SimpleFold(rn); f != rn; f = unicode.SimpleFold(f) {
+			utf8.EncodeRune(buf[:], f)
+			b.add(buf[0])
+		}
+	}
+}
+
+// addRange adds the first bytes of the runes from start to end.
+func (b *byteSet) addRange(start, end rune, fold bool) {
+	// Large ranges of non-ASCII runes begin with any of the leading bytes
+	// of multibyte UTF-8 sequences.
+	if end-start > 256 && end >= utf8.RuneSelf {
+		for c := 0xC2; c <= 0xF4; c++ {
+			b.add(byte(c))
+		}
+
+		if fold {
+			// ASCII runes may fold to runes outside of it, such as the
+			// kelvin sign, which are covered above.
+			for rn := start; rn < utf8.RuneSelf && rn <= end; rn++ {
+				b.addRune(rn, true)
+			}
+		} else {
+			for rn := start; rn < utf8.RuneSelf && rn <= end; rn++ {
+				b.add(byte(rn))
+			}
+		}
+
+		return
+	}
+
+	for rn := start; rn <= end; rn++ {
+		b.addRune(rn, fold)
+	}
+}
+
+// firstBytes returns the bytes that a match of r can begin with, or nil if
+// they can't be determined or r can match without consuming any input.
+// fold is true if the parser matches regardless of case.
+func firstBytes(r Rule, fold bool) *byteSet {
+	fa := &firstAnalysis{
+		fold:     fold,
+		refs:     make(map[Rule]firstResult),
+		computed: make(map[Rule]int),
+	}
+
+	// Recursive Refs are analyzed using the result of the previous pass,
+	// so passes are made until the results stop changing.
+	var res firstResult
+
+	for {
+		fa.pass++
+		fa.changed = false
+
+		res = fa.first(r)
+		if !fa.changed {
+			break
+		}
+	}
+
+	if !res.ok || res.empty {
+		return nil
+	}
+
+	return &res.set
+}
+
+type firstResult struct {
+	set byteSet
+
+	// empty is true if the rule can match without consuming input.
+	empty bool
+
+	// ok is false if the bytes can't be determined.
+	ok bool
+}
+
+var unknownFirst = firstResult{}
+
+type firstAnalysis struct {
+	fold bool
+
+	// refs holds the latest result for each Ref, and computed the pass
+	// in which it was calculated. Before a Ref has been analyzed, its
+	// result is that of a rule that never matches.
+	refs     map[Rule]firstResult
+	computed map[Rule]int
+	pass     int
+	changed  bool
+}
+
+func (fa *firstAnalysis) first(r Rule) firstResult {
+	r = unchain(r)
+
+	var res firstResult
+	res.ok = true
+
+	switch m := r.(type) {
+	case *matchString:
+		if m.str == "" {
+			res.empty = true
+		} else {
+			rn, _ := utf8.DecodeRuneInString(m.str)
+			res.set.addRune(rn, fa.fold)
+		}
+	case *matchString1:
+		res.set.addRune(rune(m.b), fa.fold)
+	case *matchString2:
+		res.set.addRune(rune(m.a), fa.fold)
+	case *matchCharRange:
+		res.set.addRange(m.start, m.end, fa.fold || m.fold)
+	case *matchCharSet:
+		for _, rn := range m.set {
+			res.set.addRune(rn, fa.fold || m.fold)
+		}
+	case *matchPrefixTable:
+		for b := range m.rules {
+			res.set.add(b)
+		}
+	case *matchOr, *matchEither, *matchBranch:
+		for _, sub := range alternatives(m) {
+			sr := fa.first(sub)
+			if !sr.ok {
+				return unknownFirst
+			}
+
+			res.set.union(&sr.set)
+			res.empty = res.empty || sr.empty
+		}
+	case *matchPratt:
+		subs := []Rule{m.primary}
+		for _, op := range m.prefix {
+			subs = append(subs, op.rule)
+		}
+
+		for _, sub := range subs {
+			sr := fa.first(sub)
+			if !sr.ok {
+				return unknownFirst
+			}
+
+			res.set.union(&sr.set)
+			res.empty = res.empty || sr.empty
+		}
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		res.empty = true
+
+		for _, sub := range subRules(m) {
+			sr := fa.first(sub)
+			if !sr.ok {
+				return unknownFirst
+			}
+
+			res.set.union(&sr.set)
+
+			if !sr.empty {
+				res.empty = false
+				break
+			}
+		}
+	case *matchZeroOrMore, *matchOptional, *matchMaybeValue, *matchFold:
+		res = fa.first(subRules(m)[0])
+		res.empty = true
+	case *matchOneOrMore, *matchCall, *matchAction, *matchApply, *matchScope, *matchNamed, *matchTransform, *matchCapture:
+		res = fa.first(subRules(m)[0])
+	case *matchMany:
+		res = fa.first(m.rule)
+		res.empty = res.empty || m.min <= 0
+	case *matchCount:
+		res = fa.first(m.rule)
+		res.empty = res.empty || m.num <= 0
+	case *matchSepBy:
+		res = fa.first(m.rule)
+		res.empty = res.empty || m.min <= 0
+	case *matchBind:
+		// The rule returned by the function is only known while parsing.
+		res = fa.first(m.rule)
+		if res.empty {
+			return unknownFirst
+		}
+	case *matchRef:
+		prev, ok := fa.refs[m]
+		if !ok {
+			prev = firstResult{ok: true}
+			fa.refs[m] = prev
+		}
+
+		if fa.computed[m] == fa.pass {
+			return prev
+		}
+
+		fa.computed[m] = fa.pass
+
+		res = fa.first(m.rule)
+		if res != prev {
+			fa.refs[m] = res
+			fa.changed = true
+		}
+	case *matchCheck, *matchNot, *matchNotByte, *matchEOS, *matchCheckAction, *matchCheckActionCtx,
+		*matchStateSet, *matchStateUpdate, *matchStateGet, *matchStatePush, *matchStatePop, *matchDebug:
+		// These don't consume input. Lookaheads only further restrict
+		// what follows, so treating them as matching anything is safe.
+		res.empty = true
+	default:
+		// Any, Rune, Re, Scan, Dispatch, and the like may begin with any
+		// byte, or a byte that can't be determined.
+		return unknownFirst
+	}
+
+	return res
+}
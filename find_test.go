@@ -0,0 +1,314 @@
+package peggysue
+
+import (
+	"strconv"
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindFirst(t *testing.T) {
+	word := Capture(Plus(Range('0', '9')))
+
+	t.Run("finds the first match in the input", func(t *testing.T) {
+		r := require.New(t)
+
+		val, span, found, err := New().FindFirst(word, "abc 123 def 45")
+		r.NoError(err)
+		r.True(found)
+		r.Equal("123", val)
+		r.Equal(4, span.Start.Offset)
+		r.Equal(7, span.End.Offset)
+		r.Equal(1, span.Start.Line)
+		r.Equal(5, span.Start.Column)
+	})
+
+	t.Run("reports when there is no match", func(t *testing.T) {
+		r := require.New(t)
+
+		val, _, found, err := New().FindFirst(word, "abc def")
+		r.NoError(err)
+		r.False(found)
+		r.Nil(val)
+	})
+
+	t.Run("skips positions that can not begin a match", func(t *testing.T) {
+		r := require.New(t)
+
+		set := firstBytes(Or(S("if"), Seq(Maybe(S("-")), Range('0', '9'))), false)
+		r.NotNil(set)
+		r.True(set.has('i'))
+		r.True(set.has('-'))
+		r.True(set.has('5'))
+		r.False(set.has('f'))
+
+		r.Nil(firstBytes(Star(S("a")), false))
+		r.Nil(firstBytes(Rune(unicode.IsDigit), false))
+
+		set = firstBytes(S("select"), true)
+		r.True(set.has('s'))
+		r.True(set.has('S'))
+	})
+
+	t.Run("includes the bytes of left recursive rules", func(t *testing.T) {
+		r := require.New(t)
+
+		list := R("list")
+		list.Set(Or(Seq(list, S(",")), Maybe(S("x"))))
+
+		r.Nil(firstBytes(list, false))
+
+		set := firstBytes(Seq(list, S(";")), false)
+		r.NotNil(set)
+		r.True(set.has(','))
+		r.True(set.has('x'))
+		r.True(set.has(';'))
+	})
+
+	t.Run("tries every position for rules with unknown first bytes", func(t *testing.T) {
+		r := require.New(t)
+
+		val, span, found, err := New().FindFirst(Capture(Plus(Rune(unicode.IsDigit))), "ab ٣4")
+		r.NoError(err)
+		r.True(found)
+		r.Equal("٣4", val)
+		r.Equal(3, span.Start.Offset)
+	})
+
+	t.Run("matches case insensitively", func(t *testing.T) {
+		r := require.New(t)
+
+		val, span, found, err := New(WithCaseInsensitive(true)).FindFirst(Capture(S("select")), "-- SELECT")
+		r.NoError(err)
+		r.True(found)
+		r.Equal("SELECT", val)
+		r.Equal(3, span.Start.Offset)
+	})
+
+	t.Run("matches rules that match empty at the start", func(t *testing.T) {
+		r := require.New(t)
+
+		_, span, found, err := New().FindFirst(Star(S("a")), "bbb")
+		r.NoError(err)
+		r.True(found)
+		r.Equal(0, span.Start.Offset)
+		r.Equal(0, span.End.Offset)
+	})
+
+	t.Run("limits the input size", func(t *testing.T) {
+		r := require.New(t)
+
+		_, _, _, err := New(WithMaxInputSize(2)).FindFirst(word, "abc")
+
+		var tl *InputTooLargeError
+		r.ErrorAs(err, &tl)
+	})
+}
+
+func TestFindAll(t *testing.T) {
+	word := Capture(Plus(Range('0', '9')))
+
+	t.Run("finds every match in the input", func(t *testing.T) {
+		r := require.New(t)
+
+		matches, err := New().FindAll(word, "a 1 bb 23\n456", -1)
+		r.NoError(err)
+		r.Len(matches, 3)
+
+		r.Equal("1", matches[0].Value)
+		r.Equal(2, matches[0].Span.Start.Offset)
+		r.Equal("23", matches[1].Value)
+		r.Equal(9, matches[1].Span.End.Offset)
+		r.Equal("456", matches[2].Value)
+		r.Equal(2, matches[2].Span.Start.Line)
+		r.Equal(1, matches[2].Span.Start.Column)
+	})
+
+	t.Run("limits the number of matches", func(t *testing.T) {
+		r := require.New(t)
+
+		matches, err := New().FindAll(word, "1 2 3", 2)
+		r.NoError(err)
+		r.Len(matches, 2)
+
+		matches, err = New().FindAll(word, "1 2 3", 0)
+		r.NoError(err)
+		r.Nil(matches)
+
+		matches, err = New().FindAll(word, "none", -1)
+		r.NoError(err)
+		r.Nil(matches)
+	})
+
+	t.Run("extracts structured values", func(t *testing.T) {
+		r := require.New(t)
+
+		key := Capture(Plus(Range('a', 'z')))
+		pair := Action(Seq(Named("k", key), S("="), Named("v", word)), func(v Values) interface{} {
+			return v.Get("k").(string) + ":" + v.Get("v").(string)
+		})
+
+		matches, err := New().FindAll(pair, "set a=1, then bb=22 and c= 3", -1)
+		r.NoError(err)
+		r.Len(matches, 2)
+		r.Equal("a:1", matches[0].Value)
+		r.Equal("bb:22", matches[1].Value)
+	})
+
+	t.Run("handles rules that match no input", func(t *testing.T) {
+		r := require.New(t)
+
+		matches, err := New().FindAll(Capture(Star(S("a"))), "baaé", -1)
+		r.NoError(err)
+
+		var vals []interface{}
+		for _, m := range matches {
+			vals = append(vals, m.Value)
+		}
+
+		// The same matches as regexp's FindAllString("a*", -1).
+		r.Equal([]interface{}{"", "aa", ""}, vals)
+		r.Equal(5, matches[2].Span.Start.Offset)
+	})
+}
+
+func TestReplaceAll(t *testing.T) {
+	num := Transform(Plus(Range('0', '9')), func(s string) interface{} {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+
+	t.Run("replaces each match", func(t *testing.T) {
+		r := require.New(t)
+
+		out, err := New().ReplaceAll(num, "a 1 b 20 c", func(val interface{}, text string) string {
+			return strconv.Itoa(val.(int)*2) + "(" + text + ")"
+		})
+		r.NoError(err)
+		r.Equal("a 2(1) b 40(20) c", out)
+	})
+
+	t.Run("redacts structured text", func(t *testing.T) {
+		r := require.New(t)
+
+		digit := Range('0', '9')
+		card := Seq(Times(digit, 4), Times(Seq(S("-"), Times(digit, 4)), 3))
+
+		out, err := New().ReplaceAll(card, "paid with 1234-5678-9012-3456 on 2024-01-02", func(_ interface{}, text string) string {
+			return "****-****-****-" + text[len(text)-4:]
+		})
+		r.NoError(err)
+		r.Equal("paid with ****-****-****-3456 on 2024-01-02", out)
+	})
+
+	t.Run("returns the input when there are no matches", func(t *testing.T) {
+		r := require.New(t)
+
+		out, err := New().ReplaceAll(num, "none", func(interface{}, string) string { return "x" })
+		r.NoError(err)
+		r.Equal("none", out)
+	})
+
+	t.Run("replaces matches of no input", func(t *testing.T) {
+		r := require.New(t)
+
+		out, err := New().ReplaceAll(Star(S("a")), "baab", func(_ interface{}, text string) string {
+			return "<" + text + ">"
+		})
+		r.NoError(err)
+
+		// The same result as regexp's ReplaceAllString("baab", "<$0>").
+		r.Equal("<>b<aa>b<>", out)
+	})
+}
+
+func TestSplit(t *testing.T) {
+	t.Run("splits on a separator", func(t *testing.T) {
+		r := require.New(t)
+
+		sep := Seq(Star(S(" ")), S(","), Star(S(" ")))
+
+		parts, err := New().Split(sep, "a, b ,c,,d,")
+		r.NoError(err)
+		r.Equal([]string{"a", "b", "c", "", "d", ""}, parts)
+
+		parts, err = New().Split(sep, "abc")
+		r.NoError(err)
+		r.Equal([]string{"abc"}, parts)
+
+		parts, err = New().Split(sep, "")
+		r.NoError(err)
+		r.Equal([]string{""}, parts)
+	})
+
+	t.Run("splits on commas that are not within quotes", func(t *testing.T) {
+		r := require.New(t)
+
+		// A comma is outside of quotes if it is followed by an even
+		// number of them.
+		text := Star(Seq(Not(S(`"`)), Any()))
+		sep := Seq(S(","), Check(Seq(Star(Seq(text, S(`"`), text, S(`"`))), text, EOS())))
+
+		parts, err := New().Split(sep, `a,"b,c",d`)
+		r.NoError(err)
+		r.Equal([]string{"a", `"b,c"`, "d"}, parts)
+	})
+
+	t.Run("splits into runes on a rule that matches no input", func(t *testing.T) {
+		r := require.New(t)
+
+		parts, err := New().Split(S(""), "aé")
+		r.NoError(err)
+		r.Equal([]string{"a", "é"}, parts)
+	})
+}
+
+func TestUnanchored(t *testing.T) {
+	date := Capture(Seq(Times(Range('0', '9'), 4), S("-"), Times(Range('0', '9'), 2)))
+
+	t.Run("matches after noise", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithUnanchored(true), WithPartial(true))
+
+		pr := p.Run(date, "released on 2024-06, maybe")
+		r.True(pr.Matched)
+		r.Equal("2024-06", pr.Value)
+		r.Equal(12, pr.Span.Start.Offset)
+		r.Equal(19, pr.Span.End.Offset)
+		r.False(pr.Consumed)
+
+		val, ok, err := p.Parse(date, "v 1999-12 x")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("1999-12", val)
+
+		_, ok, err = p.Parse(date, "no date")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("requires the rest of the input without partial", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithUnanchored(true))
+
+		val, ok, err := p.Parse(date, "released on 2024-06")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("2024-06", val)
+
+		_, ok, err = p.Parse(date, "released on 2024-06, maybe")
+		r.False(ok)
+		r.ErrorIs(err, ErrPartialInput)
+	})
+
+	t.Run("matches at the start by default", func(t *testing.T) {
+		r := require.New(t)
+
+		_, ok, err := New(WithPartial(true)).Parse(date, "v 1999-12")
+		r.NoError(err)
+		r.False(ok)
+	})
+}
@@ -0,0 +1,70 @@
+package peggysue
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// foldByte reports if a and b are equal, ignoring the case of ASCII letters.
+func foldByte(a, b byte) bool {
+	if a == b {
+		return true
+	}
+
+	la := a | 0x20
+	return la >= 'a' && la <= 'z' && la == b|0x20
+}
+
+// foldEqual reports if a and b are equal under Unicode simple case folding.
+func foldEqual(a, b rune) bool {
+	if a == b {
+		return true
+	}
+
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// foldInRange reports if rn, or any rune equivalent to it under Unicode
+// simple case folding, is between start and end inclusive.
+func foldInRange(rn, start, end rune) bool {
+	if rn >= start && rn <= end {
+		return true
+	}
+
+	for f := unicode.SimpleFold(rn); f != rn; f = unicode.SimpleFold(f) {
+		if f >= start && f <= end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// foldPrefix reports if str begins with prefix under Unicode simple case
+// folding. It compares rune by rune, since runes that fold to each other may
+// have encodings of different lengths, such as the Kelvin sign and "k", so
+// it also returns how many bytes of str matched.
+func foldPrefix(str, prefix string) (int, bool) {
+	n := 0
+
+	for _, pr := range prefix {
+		if n >= len(str) {
+			return 0, false
+		}
+
+		rn, sz := utf8.DecodeRuneInString(str[n:])
+		if !foldEqual(rn, pr) {
+			return 0, false
+		}
+
+		n += sz
+	}
+
+	return n, true
+}
@@ -94,4 +94,198 @@ func TestForms(t *testing.T) {
 			rhs: "3",
 		}, v)
 	})
+
+	t.Run("precedence levels", func(t *testing.T) {
+		r := require.New(t)
+
+		n := Capture(Re("[0-9]+"))
+		op := func(ops ...rune) Rule {
+			return Capture(Set(ops...))
+		}
+
+		e := Branches("e", func(bb BranchesBuilder, e Rule) {
+			bb.AddLevel(1, AssocNone, op('<'))
+			bb.AddLevel(2, AssocLeft, op('+', '-'))
+			bb.AddLevel(3, AssocLeft, op('*'))
+			bb.AddLevel(3, AssocLeft, op('/'))
+			bb.AddLevel(4, AssocRight, op('^'))
+			bb.Add("n", n)
+			bb.Add("paren", Seq(S("("), Named("e", e), S(")"), Action(S(""), func(v Values) interface{} {
+				return v.Get("e")
+			})))
+		})
+
+		p := New()
+
+		bin := func(lhs interface{}, op string, rhs interface{}) BinaryOp {
+			return BinaryOp{LHS: lhs, Op: op, RHS: rhs}
+		}
+
+		for _, tc := range []struct {
+			input string
+			value interface{}
+		}{
+			{"1", "1"},
+			{"1+2*3", bin("1", "+", bin("2", "*", "3"))},
+			{"1-2-3", bin(bin("1", "-", "2"), "-", "3")},
+			{"1*2/3", bin(bin("1", "*", "2"), "/", "3")},
+			{"2^3^4", bin("2", "^", bin("3", "^", "4"))},
+			{"(1+2)*3", bin(bin("1", "+", "2"), "*", "3")},
+			{"1+2<3", bin(bin("1", "+", "2"), "<", "3")},
+		} {
+			v, ok, err := p.Parse(e, tc.input)
+			r.NoError(err, tc.input)
+			r.True(ok, tc.input)
+			r.Equal(tc.value, v, tc.input)
+		}
+
+		_, _, err := p.Parse(e, "1<2<3")
+		r.Error(err)
+
+		v, ok, err := New(WithPartial(true)).Parse(e, "1<2<3")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("1", v)
+
+		r.Panics(func() {
+			Branches("bad", func(bb BranchesBuilder, e Rule) {
+				bb.AddLevel(1, AssocLeft, S("+"))
+				bb.AddLevel(1, AssocRight, S("-"))
+				bb.Add("n", n)
+			})
+		})
+	})
+
+	t.Run("precedence annotated branches", func(t *testing.T) {
+		r := require.New(t)
+
+		type unary struct {
+			op      string
+			operand interface{}
+		}
+
+		n := Capture(Re("[0-9]+"))
+
+		binary := func(lhs Rule, op string, rhs Rule) Rule {
+			return Action(
+				Seq(Named("lhs", lhs), S(op), Named("rhs", rhs)),
+				func(v Values) interface{} {
+					return BinaryOp{LHS: v.Get("lhs"), Op: op, RHS: v.Get("rhs")}
+				},
+			)
+		}
+
+		e := Branches("e", func(bb BranchesBuilder, e Rule) {
+			bb.AddPrec("sub", 1, AssocLeft, func(lhs, rhs Rule) Rule {
+				return binary(lhs, "-", rhs)
+			})
+			bb.AddLevel(1, AssocLeft, Capture(S("+")))
+			bb.AddPrec("neg", 2, AssocRight, func(lhs, rhs Rule) Rule {
+				return Action(Seq(S("-"), Named("x", rhs)), func(v Values) interface{} {
+					return unary{op: "-", operand: v.Get("x")}
+				})
+			})
+			bb.AddPrec("pow", 3, AssocRight, func(lhs, rhs Rule) Rule {
+				return binary(lhs, "^", rhs)
+			})
+			bb.AddPrec("fact", 4, AssocLeft, func(lhs, rhs Rule) Rule {
+				return Action(Seq(Named("x", lhs), S("!")), func(v Values) interface{} {
+					return unary{op: "!", operand: v.Get("x")}
+				})
+			})
+			bb.Add("n", n)
+			bb.Add("paren", Seq(S("("), Named("e", e), S(")"), Action(S(""), func(v Values) interface{} {
+				return v.Get("e")
+			})))
+		})
+
+		p := New()
+
+		bin := func(lhs interface{}, op string, rhs interface{}) BinaryOp {
+			return BinaryOp{LHS: lhs, Op: op, RHS: rhs}
+		}
+
+		for _, tc := range []struct {
+			input string
+			value interface{}
+		}{
+			{"1", "1"},
+			{"1-2-3", bin(bin("1", "-", "2"), "-", "3")},
+			{"1-2+3", bin(bin("1", "-", "2"), "+", "3")},
+			{"--1", unary{"-", unary{"-", "1"}}},
+			{"1--2", bin("1", "-", unary{"-", "2"})},
+			{"2^3^4", bin("2", "^", bin("3", "^", "4"))},
+			{"-2^3", unary{"-", bin("2", "^", "3")}},
+			{"3!!", unary{"!", unary{"!", "3"}}},
+			{"2^3!", bin("2", "^", unary{"!", "3"})},
+			{"(1-2)!", unary{"!", bin("1", "-", "2")}},
+		} {
+			v, ok, err := p.Parse(e, tc.input)
+			r.NoError(err, tc.input)
+			r.True(ok, tc.input)
+			r.Equal(tc.value, v, tc.input)
+		}
+
+		r.Panics(func() {
+			Branches("bad", func(bb BranchesBuilder, e Rule) {
+				bb.AddLevel(1, AssocLeft, S("+"))
+				bb.AddPrec("neg", 1, AssocRight, func(lhs, rhs Rule) Rule {
+					return Seq(S("-"), rhs)
+				})
+				bb.Add("n", n)
+			})
+		})
+	})
+
+	t.Run("associativity", func(t *testing.T) {
+		r := require.New(t)
+
+		n := Capture(Re("[a-z0-9]+"))
+
+		binary := func(e Rule, ops ...rune) Rule {
+			return Action(
+				Seq(Named("lhs", e), Named("op", Capture(Set(ops...))), Named("rhs", e)),
+				func(v Values) interface{} {
+					return op{lhs: v.Get("lhs"), op: v.Get("op").(string), rhs: v.Get("rhs")}
+				},
+			)
+		}
+
+		e := Branches("e", func(bb BranchesBuilder, e Rule) {
+			bb.AddAssoc("sub", AssocLeft, binary(e, '-', '+'))
+			bb.AddAssoc("assign", AssocRight, binary(e, '='))
+			bb.Add("pow", binary(e, '^'))
+			bb.Add("n", n)
+			bb.Add("paren", Seq(S("("), Named("e", e), S(")"), Action(S(""), func(v Values) interface{} {
+				return v.Get("e")
+			})))
+		})
+
+		for _, tc := range []struct {
+			input string
+			value interface{}
+		}{
+			{"1", "1"},
+			{"1-2", op{"1", "-", "2"}},
+			{"1-2+3", op{op{"1", "-", "2"}, "+", "3"}},
+			{"1-2-3-4", op{op{op{"1", "-", "2"}, "-", "3"}, "-", "4"}},
+			{"1-(2-3)", op{"1", "-", op{"2", "-", "3"}}},
+			{"a=b=c", op{"a", "=", op{"b", "=", "c"}}},
+			{"2^3^4", op{"2", "^", op{"3", "^", "4"}}},
+			{"a=1-2", op{"a", "=", op{"1", "-", "2"}}},
+		} {
+			for _, memo := range []bool{true, false} {
+				v, ok, err := New(WithMemo(memo)).Parse(e, tc.input)
+				r.NoError(err, tc.input)
+				r.True(ok, tc.input)
+				r.Equal(tc.value, v, tc.input)
+			}
+		}
+
+		r.Panics(func() {
+			Branches("bad", func(bb BranchesBuilder, e Rule) {
+				bb.AddAssoc("cmp", AssocNone, binary(e, '<'))
+			})
+		})
+	})
 }
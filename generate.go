@@ -0,0 +1,302 @@
+package peggysue
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// Generate returns random input built from the structure of the rule, for
+// use in property tests such as checking that a printer and the grammar
+// agree. Each choice picks a random alternative and each repetition a small
+// random count. Once Refs have been expanded maxDepth deep, the generator
+// picks the alternatives and counts that finish soonest, so the input is
+// finite even for recursive rules.
+//
+// The input is only likely to match the rule, not certain to. Lookaheads
+// such as Not and Check, state rules, and rules whose input can't be
+// determined, such as Re, Scan, and Bind, are treated as matching nothing,
+// so callers should skip inputs that the rule fails to match.
+func Generate(r Rule, rnd *rand.Rand, maxDepth int) string {
+	g := &generator{
+		rnd:      rnd,
+		maxDepth: maxDepth,
+		costs:    refCosts(r),
+	}
+
+	g.gen(r)
+
+	return g.sb.String()
+}
+
+// maxRepeat is the most times a repetition is generated while under the
+// depth limit, beyond its minimum.
+const maxRepeat = 3
+
+type generator struct {
+	rnd      *rand.Rand
+	maxDepth int
+	depth    int
+	costs    map[*matchRef]int
+	sb       strings.Builder
+}
+
+// deep reports if the generator should finish as soon as it can.
+func (g *generator) deep() bool {
+	return g.depth >= g.maxDepth
+}
+
+// repeat returns the number of times to generate a repetition with the
+// given bounds, where max is -1 for no limit.
+func (g *generator) repeat(min, max int) int {
+	if g.deep() {
+		return min
+	}
+
+	if max < 0 || max > min+maxRepeat {
+		max = min + maxRepeat
+	}
+
+	return min + g.rnd.Intn(max-min+1)
+}
+
+func (g *generator) choose(alts []Rule) {
+	if len(alts) == 0 {
+		return
+	}
+
+	if !g.deep() {
+		g.gen(alts[g.rnd.Intn(len(alts))])
+		return
+	}
+
+	best := alts[0]
+	bestCost := ruleCost(best, g.costs)
+
+	for _, alt := range alts[1:] {
+		if c := ruleCost(alt, g.costs); c < bestCost {
+			best, bestCost = alt, c
+		}
+	}
+
+	g.gen(best)
+}
+
+func (g *generator) rangeRune(start, end rune) rune {
+	return start + rune(g.rnd.Int63n(int64(end-start)+1))
+}
+
+func (g *generator) gen(r Rule) {
+	r = unchain(r)
+
+	switch m := r.(type) {
+	case *matchString:
+		g.sb.WriteString(m.str)
+	case *matchString1:
+		g.sb.WriteByte(m.b)
+	case *matchString2:
+		g.sb.WriteByte(m.a)
+		g.sb.WriteByte(m.b)
+	case *matchCharRange:
+		g.sb.WriteRune(g.rangeRune(m.start, m.end))
+	case *matchCharSet:
+		if len(m.set) > 0 {
+			g.sb.WriteRune(m.set[g.rnd.Intn(len(m.set))])
+		}
+	case *matchAny:
+		g.sb.WriteRune(g.rangeRune('a', 'z'))
+	case *matchOr, *matchEither, *matchBranch:
+		g.choose(alternatives(m))
+	case *matchPrefixTable:
+		g.choose(subRules(m))
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		for _, sub := range subRules(m) {
+			g.gen(sub)
+		}
+	case *matchZeroOrMore:
+		for i := g.repeat(0, -1); i > 0; i-- {
+			g.gen(m.rule)
+		}
+	case *matchOneOrMore:
+		for i := g.repeat(1, -1); i > 0; i-- {
+			g.gen(m.rule)
+		}
+	case *matchOptional, *matchMaybeValue:
+		if g.repeat(0, 1) == 1 {
+			g.gen(subRules(m)[0])
+		}
+	case *matchFold:
+		for i := g.repeat(0, -1); i > 0; i-- {
+			g.gen(m.rule)
+		}
+	case *matchMany:
+		for i := g.repeat(m.min, m.max); i > 0; i-- {
+			g.gen(m.rule)
+		}
+	case *matchCount:
+		for i := 0; i < m.num; i++ {
+			g.gen(m.rule)
+		}
+	case *matchSepBy:
+		for i, n := 0, g.repeat(m.min, m.max); i < n; i++ {
+			if i > 0 {
+				g.gen(m.sep)
+			}
+
+			g.gen(m.rule)
+		}
+	case *matchPratt:
+		g.genPratt(m)
+	case *matchCall, *matchAction, *matchApply, *matchScope, *matchNamed, *matchTransform, *matchCapture, *matchRecover:
+		g.gen(subRules(m)[0])
+	case *matchRef:
+		g.depth++
+		g.gen(m.rule)
+		g.depth--
+	}
+}
+
+// genPratt generates an operand, optionally with prefix and postfix
+// operators, followed by a random number of infix operators and operands.
+func (g *generator) genPratt(m *matchPratt) {
+	operand := func() {
+		if len(m.prefix) > 0 && g.repeat(0, 1) == 1 {
+			g.gen(m.prefix[g.rnd.Intn(len(m.prefix))].rule)
+		}
+
+		g.gen(m.primary)
+
+		if len(m.postfix) > 0 && g.repeat(0, 1) == 1 {
+			g.gen(m.postfix[g.rnd.Intn(len(m.postfix))].rule)
+		}
+	}
+
+	operand()
+
+	if len(m.infix) == 0 {
+		return
+	}
+
+	for i := g.repeat(0, -1); i > 0; i-- {
+		g.gen(m.infix[g.rnd.Intn(len(m.infix))].rule)
+		operand()
+	}
+}
+
+// noCost is the cost of a rule that can't finish, such as a Ref that only
+// refers to itself.
+const noCost = 1 << 30
+
+// refCosts returns the cost, as computed by ruleCost, of each Ref
+// reachable from r. It iterates until the costs stop changing, since Refs
+// can refer to each other.
+func refCosts(r Rule) map[*matchRef]int {
+	costs := make(map[*matchRef]int)
+	seen := make(map[Rule]bool)
+
+	var visit func(r Rule)
+
+	visit = func(r Rule) {
+		r = unchain(r)
+
+		if r == nil || seen[r] {
+			return
+		}
+
+		seen[r] = true
+
+		if ref, ok := r.(*matchRef); ok {
+			costs[ref] = noCost
+		}
+
+		for _, sub := range subRules(r) {
+			visit(sub)
+		}
+	}
+
+	visit(r)
+
+	for changed := true; changed; {
+		changed = false
+
+		for ref, prev := range costs {
+			if c := addCost(ruleCost(ref.rule, costs), 1); c < prev {
+				costs[ref] = c
+				changed = true
+			}
+		}
+	}
+
+	return costs
+}
+
+func addCost(a, b int) int {
+	if a+b > noCost {
+		return noCost
+	}
+
+	return a + b
+}
+
+// ruleCost returns the fewest Refs that must be expanded to generate r,
+// given the costs of the Refs, which include expanding the Ref itself.
+func ruleCost(r Rule, costs map[*matchRef]int) int {
+	r = unchain(r)
+
+	switch m := r.(type) {
+	case *matchRef:
+		if c, ok := costs[m]; ok {
+			return c
+		}
+
+		return noCost
+	case *matchOr, *matchEither, *matchBranch, *matchPrefixTable:
+		best := noCost
+
+		alts := alternatives(m)
+		if _, ok := m.(*matchPrefixTable); ok {
+			alts = subRules(m)
+		}
+
+		for _, alt := range alts {
+			if c := ruleCost(alt, costs); c < best {
+				best = c
+			}
+		}
+
+		return best
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		total := 0
+
+		for _, sub := range subRules(m) {
+			total = addCost(total, ruleCost(sub, costs))
+		}
+
+		return total
+	case *matchZeroOrMore, *matchOptional, *matchMaybeValue, *matchFold:
+		return 0
+	case *matchMany:
+		if m.min == 0 {
+			return 0
+		}
+
+		return ruleCost(m.rule, costs)
+	case *matchCount:
+		if m.num == 0 {
+			return 0
+		}
+
+		return ruleCost(m.rule, costs)
+	case *matchSepBy:
+		if m.min == 0 {
+			return 0
+		}
+
+		return ruleCost(m.rule, costs)
+	case *matchPratt:
+		return ruleCost(m.primary, costs)
+	case *matchOneOrMore, *matchCall, *matchAction, *matchApply, *matchScope, *matchNamed, *matchTransform, *matchCapture, *matchRecover:
+		return ruleCost(subRules(m)[0], costs)
+	default:
+		return 0
+	}
+}
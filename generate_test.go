@@ -0,0 +1,51 @@
+package peggysue
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Run("generates input the rule matches", func(t *testing.T) {
+		list := R("list")
+		item := Or(Plus(Range('a', 'z')), list)
+		list.Set(Seq(S("("), SepBy(item, S(" ")), S(")")))
+
+		rnd := rand.New(rand.NewSource(1))
+
+		for i := 0; i < 50; i++ {
+			input := Generate(list, rnd, 4)
+
+			_, ok, err := New().Parse(list, input)
+			require.NoError(t, err, input)
+			require.True(t, ok, input)
+		}
+	})
+
+	t.Run("finishes recursive rules at the depth limit", func(t *testing.T) {
+		nest := R("nest")
+		nest.Set(Or(Seq(S("["), nest, S("]")), S("x")))
+
+		rnd := rand.New(rand.NewSource(1))
+
+		for i := 0; i < 20; i++ {
+			input := Generate(nest, rnd, 3)
+			require.LessOrEqual(t, len(input), 7)
+			require.Equal(t, byte('x'), input[len(input)/2])
+		}
+
+		require.Equal(t, "x", Generate(nest, rnd, 0))
+	})
+
+	t.Run("is deterministic for a seed", func(t *testing.T) {
+		r := Seq(Star(Set('a', 'b', 'c')), Many(Range('0', '9'), 2, 4, nil))
+
+		a := Generate(r, rand.New(rand.NewSource(7)), 5)
+		b := Generate(r, rand.New(rand.NewSource(7)), 5)
+
+		require.Equal(t, a, b)
+		require.Regexp(t, `^[abc]*[0-9]{2,4}$`, a)
+	})
+}
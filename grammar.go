@@ -0,0 +1,97 @@
+package peggysue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNoRoot is returned when parsing with a Grammar that has no root rule.
+var ErrNoRoot = errors.New("grammar has no root rule")
+
+// UndefinedRulesError is returned by Grammar.Validate when rules have been
+// referenced but never defined.
+type UndefinedRulesError struct {
+	// Names are the names of the undefined rules, sorted.
+	Names []string
+}
+
+func (e *UndefinedRulesError) Error() string {
+	return "undefined rules: " + strings.Join(e.Names, ", ")
+}
+
+// Grammar bundles a set of named rules, the rule to start parsing from, and
+// the options to parse with. It provides larger grammars a single value to
+// organize, validate, and share.
+type Grammar struct {
+	labels *labels
+	root   string
+	parser *Parser
+
+	// ids, rules, and leftRec are set by Compile.
+	ids     map[Rule]int
+	rules   []Rule
+	leftRec []string
+}
+
+// NewGrammar returns an empty Grammar that parses with the given options.
+func NewGrammar(opts ...Option) *Grammar {
+	return &Grammar{
+		labels: &labels{refs: make(map[string]Ref)},
+		parser: New(opts...),
+	}
+}
+
+// Ref returns the named rule, creating it if it has not yet been defined so
+// that rules can refer to rules that are defined later.
+func (g *Grammar) Ref(name string) Rule {
+	return g.labels.Ref(name)
+}
+
+// Define sets the rule for the given name.
+func (g *Grammar) Define(name string, rule Rule) Ref {
+	return g.labels.Set(name, rule)
+}
+
+// Root sets the name of the rule that Parse starts from.
+func (g *Grammar) Root(name string) {
+	g.root = name
+}
+
+// Validate checks that the root rule and all referenced rules have
+// been defined.
+func (g *Grammar) Validate() error {
+	if g.root == "" {
+		return ErrNoRoot
+	}
+
+	var undefined []string
+
+	if _, ok := g.labels.refs[g.root]; !ok {
+		undefined = append(undefined, g.root)
+	}
+
+	for name, ref := range g.labels.refs {
+		if mr, ok := ref.(*matchRef); ok && mr.rule == nil {
+			undefined = append(undefined, name)
+		}
+	}
+
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return &UndefinedRulesError{Names: undefined}
+	}
+
+	return nil
+}
+
+// Parse validates the grammar and then parses the input starting from the
+// root rule, as with Parser.Parse.
+func (g *Grammar) Parse(input string) (val interface{}, matched bool, err error) {
+	if err := g.Validate(); err != nil {
+		return nil, false, fmt.Errorf("invalid grammar: %w", err)
+	}
+
+	return g.parser.Parse(g.labels.refs[g.root], input)
+}
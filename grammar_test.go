@@ -0,0 +1,163 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrammar(t *testing.T) {
+	t.Run("parses from the root rule", func(t *testing.T) {
+		r := require.New(t)
+
+		g := NewGrammar(WithPartial(true))
+
+		g.Define("list", Collect(Plus(Seq(g.Ref("item"), Maybe(S(","))))))
+		g.Define("item", Capture(Plus(Range('a', 'z'))))
+		g.Root("list")
+
+		r.NoError(g.Validate())
+
+		val, ok, err := g.Parse("a,bc,d!")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"a", "bc", "d"}, val)
+	})
+
+	t.Run("reports undefined rules", func(t *testing.T) {
+		r := require.New(t)
+
+		g := NewGrammar()
+
+		_, _, err := g.Parse("a")
+		r.ErrorIs(err, ErrNoRoot)
+
+		g.Define("list", Seq(g.Ref("item"), g.Ref("sep")))
+		g.Root("doc")
+
+		err = g.Validate()
+
+		var ue *UndefinedRulesError
+		r.ErrorAs(err, &ue)
+		r.Equal([]string{"doc", "item", "sep"}, ue.Names)
+		r.Equal("undefined rules: doc, item, sep", err.Error())
+
+		_, _, err = g.Parse("a")
+		r.ErrorAs(err, &ue)
+	})
+
+	t.Run("finds left recursive rules when compiled", func(t *testing.T) {
+		r := require.New(t)
+
+		g := NewGrammar()
+
+		// a is defined before b, so whether it's left recursive can't be
+		// known until b is defined.
+		g.Define("a", Or(Seq(g.Ref("b"), S("x")), S("y")))
+		g.Define("b", Seq(g.Ref("a"), S("z")))
+		g.Define("c", S("!"))
+		g.Define("list", Seq(g.Ref("a"), Maybe(g.Ref("c"))))
+		g.Root("list")
+
+		r.NoError(g.Compile())
+		r.Equal([]string{"a", "b"}, g.LeftRecursive())
+
+		r.True(g.Ref("a").(Ref).LeftRecursive())
+		r.False(g.Ref("c").(Ref).LeftRecursive())
+
+		_, ok, err := g.Parse("yzx!")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("matches left recursive rules the same whichever is matched first", func(t *testing.T) {
+		r := require.New(t)
+
+		type parse struct {
+			end     int
+			matched bool
+		}
+
+		// parseAll defines A <- B "a" / "x" and B <- A "b" / "y", then
+		// parses "yab" with each of the rules named in order.
+		parseAll := func(order ...string) map[string]parse {
+			a, b := R("A"), R("B")
+			a.Set(Or(Seq(b, S("a")), S("x")))
+			b.Set(Or(Seq(a, S("b")), S("y")))
+
+			rules := map[string]Rule{"A": a, "B": b}
+			results := map[string]parse{}
+
+			for _, name := range order {
+				_, end, matched, _ := New().ParseAt(rules[name], "yab", 0)
+				results[name] = parse{end: end, matched: matched}
+			}
+
+			return results
+		}
+
+		ab := parseAll("A", "B")
+		ba := parseAll("B", "A")
+
+		r.Equal(ab, ba)
+		r.Equal(parse{end: 2, matched: true}, ab["A"])
+		r.Equal(parse{end: 1, matched: true}, ab["B"])
+	})
+
+	t.Run("assigns rule IDs when compiled", func(t *testing.T) {
+		r := require.New(t)
+
+		build := func() (*Grammar, Rule) {
+			g := NewGrammar()
+
+			item := Capture(Plus(Range('a', 'z')))
+
+			g.Define("list", Seq(g.Ref("item"), Star(Seq(S(","), g.Ref("item")))))
+			g.Define("item", item)
+			g.Root("list")
+
+			return g, item
+		}
+
+		g, item := build()
+		r.Equal(-1, g.RuleID(item))
+
+		r.NoError(g.Compile())
+
+		rules := g.Rules()
+		r.Equal(0, g.RuleID(g.Ref("list")))
+
+		for i, rule := range rules {
+			r.Equal(i, g.RuleID(rule), "ids are dense")
+			r.Equal(rule, g.RuleByID(i))
+		}
+
+		r.Equal(item, g.RuleByID(g.RuleID(item)))
+		r.Nil(g.RuleByID(-1))
+		r.Nil(g.RuleByID(len(rules)))
+
+		// A second, identical grammar is given the same IDs.
+		g2, item2 := build()
+		r.NoError(g2.Compile())
+
+		r.Len(g2.Rules(), len(rules))
+		r.Equal(g.RuleID(item), g2.RuleID(item2))
+		r.Equal(-1, g2.RuleID(item))
+
+		// Compiling again keeps the IDs.
+		id := g.RuleID(item)
+		r.NoError(g.Compile())
+		r.Equal(id, g.RuleID(item))
+
+		// Rules shared between grammars are numbered within each.
+		g3 := NewGrammar()
+		g3.Define("other", Seq(S("x"), item))
+		g3.Root("other")
+		r.NoError(g3.Compile())
+		r.Equal(id, g.RuleID(item))
+		r.Equal(item, g3.RuleByID(g3.RuleID(item)))
+		r.Less(g3.RuleID(item), len(g3.Rules()))
+
+		r.Error(NewGrammar().Compile())
+	})
+}
@@ -0,0 +1,191 @@
+package peggysue
+
+import "sort"
+
+// HighlightSpan is a region of the input returned by Highlight.
+type HighlightSpan struct {
+	Span Span
+
+	// Rule is the name of the innermost highlighted rule that matched the
+	// region, or empty if none did.
+	Rule string
+}
+
+// Highlight parses the input with the rule, as Parse does, and returns the
+// regions of the input matched by named Refs, such as "keyword", "string"
+// or "comment". This is enough to drive syntax highlighting without writing
+// any actions.
+//
+// If rules are given, only Refs with those names are highlighted, otherwise
+// every named Ref is. Where highlighted rules are nested, the innermost rule
+// is used for the input it matched, and the outer rule for the rest.
+//
+// The regions are returned in order and cover all of the input that the
+// rule matched without overlapping. Input that isn't matched by any
+// highlighted rule, such as whitespace, is returned as regions with an
+// empty Rule. Rules that only matched as part of an alternative that was
+// later abandoned are not included.
+func (p *Parser) Highlight(r Rule, input string, rules ...string) ([]HighlightSpan, error) {
+	if err := p.checkInputSize(len(input)); err != nil {
+		return nil, err
+	}
+
+	s := p.newState(input, p.filename)
+
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	if len(rules) == 0 {
+		s.recordRef = func(name string) bool {
+			return name != ""
+		}
+	} else {
+		names := make(map[string]bool, len(rules))
+		for _, name := range rules {
+			names[name] = true
+		}
+
+		s.recordRef = func(name string) bool {
+			return names[name]
+		}
+	}
+
+	res := s.run(r)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if !res.matched {
+		return nil, s.noMatch()
+	}
+
+	if s.pos != s.inputSize && !p.partial {
+		return nil, s.notConsumed()
+	}
+
+	var spans []*spanList
+
+	for _, sl := range s.sortedSpans() {
+		if sl.err == nil {
+			spans = append(spans, sl)
+		}
+	}
+
+	h := &highlighter{s: s, spans: spans}
+	h.region(0, s.pos, "")
+
+	return h.out, nil
+}
+
+// spanList is an immutable list of the spans matched by recorded Refs, and
+// skipped by Recover, most recent first. As it's immutable, savepoints
+// restore it along with the position, discarding the spans of rules that
+// are backtracked over.
+type spanList struct {
+	start, end int
+	rule       string
+
+	// err is set for input skipped by Recover, and node for a value
+	// recorded for OnNode. binding is set for a value recorded for
+	// WithBindings, in which case node is the value and rule the name it
+	// was bound to.
+	err     error
+	node    interface{}
+	binding bool
+
+	prev *spanList
+}
+
+func (s *state) recordSpan(m *matchRef, start int) {
+	name := m.Name()
+
+	if s.pos == start || !s.recordRef(name) {
+		return
+	}
+
+	s.spans = &spanList{start: start, end: s.pos, rule: name, prev: s.spans}
+}
+
+// sortedSpans returns the spans of recorded Refs and errors in the order
+// they appear in the input, with spans before the spans they contain.
+func (s *state) sortedSpans() []*spanList {
+	var spans []*spanList
+
+	for sl := s.spans; sl != nil; sl = sl.prev {
+		if sl.node == nil && !sl.binding {
+			spans = append(spans, sl)
+		}
+	}
+
+	// The list holds rules in the order they finished matching, most
+	// recent first, so outer rules come before the rules they contain.
+	// Sorting by start and then by longest keeps that order for rules that
+	// matched the same input.
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+
+		return spans[i].end > spans[j].end
+	})
+
+	return spans
+}
+
+// rebaseSpans returns the list formed by adding the spans that list has in
+// addition to base onto onto.
+func rebaseSpans(list, base, onto *spanList) *spanList {
+	var added []*spanList
+
+	for sl := list; sl != base && sl != nil; sl = sl.prev {
+		added = append(added, sl)
+	}
+
+	for i := len(added) - 1; i >= 0; i-- {
+		sl := added[i]
+		onto = &spanList{start: sl.start, end: sl.end, rule: sl.rule, err: sl.err, node: sl.node, binding: sl.binding, prev: onto}
+	}
+
+	return onto
+}
+
+type highlighter struct {
+	s     *state
+	spans []*spanList
+	next  int
+	out   []HighlightSpan
+}
+
+// region outputs the region from start to end, which was matched by rule,
+// splitting it around the spans of the rules it contains.
+func (h *highlighter) region(start, end int, rule string) {
+	pos := start
+
+	for h.next < len(h.spans) && h.spans[h.next].start < end {
+		sl := h.spans[h.next]
+		h.next++
+
+		// Spans never partially overlap, but be defensive about it.
+		if sl.start < pos || sl.end > end {
+			continue
+		}
+
+		h.emit(pos, sl.start, rule)
+		h.region(sl.start, sl.end, sl.rule)
+
+		pos = sl.end
+	}
+
+	h.emit(pos, end, rule)
+}
+
+func (h *highlighter) emit(start, end int, rule string) {
+	if start == end {
+		return
+	}
+
+	h.out = append(h.out, HighlightSpan{
+		Span: Span{Start: h.s.position(start), End: h.s.position(end)},
+		Rule: rule,
+	})
+}
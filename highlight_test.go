@@ -0,0 +1,151 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlight(t *testing.T) {
+	ws := Star(Set(' ', '\n'))
+
+	keyword := R("keyword")
+	keyword.Set(Seq(Or(S("let"), S("fn")), Not(Range('a', 'z'))))
+
+	ident := R("ident")
+	ident.Set(Seq(Not(keyword), Plus(Range('a', 'z'))))
+
+	number := R("number")
+	number.Set(Plus(Range('0', '9')))
+
+	str := R("string")
+	str.Set(Seq(S(`"`), Star(Seq(Not(S(`"`)), Any())), S(`"`)))
+
+	call := R("call")
+	call.Set(Seq(ident, S("("), Maybe(number), S(")")))
+
+	value := R("value")
+	value.Set(Or(call, ident, number, str))
+
+	stmt := R("stmt")
+	stmt.Set(Seq(keyword, ws, ident, ws, S("="), ws, value, ws))
+
+	program := Plus(stmt)
+
+	collect := func(hs []HighlightSpan, input string) [][2]string {
+		var out [][2]string
+		for _, h := range hs {
+			out = append(out, [2]string{input[h.Span.Start.Offset:h.Span.End.Offset], h.Rule})
+		}
+		return out
+	}
+
+	t.Run("returns spans covering the input", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "let x = \"hi\"\nlet y = f(1)"
+
+		hs, err := New().Highlight(program, input, "keyword", "ident", "number", "string")
+		r.NoError(err)
+
+		r.Equal([][2]string{
+			{"let", "keyword"},
+			{" ", ""},
+			{"x", "ident"},
+			{" = ", ""},
+			{`"hi"`, "string"},
+			{"\n", ""},
+			{"let", "keyword"},
+			{" ", ""},
+			{"y", "ident"},
+			{" = ", ""},
+			{"f", "ident"},
+			{"(", ""},
+			{"1", "number"},
+			{")", ""},
+		}, collect(hs, input))
+
+		r.Equal(2, hs[6].Span.Start.Line)
+		r.Equal(1, hs[6].Span.Start.Column)
+	})
+
+	t.Run("uses the innermost named rule", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "fn z = g()"
+
+		hs, err := New().Highlight(program, input)
+		r.NoError(err)
+
+		r.Equal([][2]string{
+			{"fn", "keyword"},
+			{" ", "stmt"},
+			{"z", "ident"},
+			{" = ", "stmt"},
+			{"g", "ident"},
+			{"()", "call"},
+		}, collect(hs, input))
+	})
+
+	t.Run("drops rules that were backtracked over", func(t *testing.T) {
+		r := require.New(t)
+
+		// ident is tried as part of call, and matched again on its own,
+		// but is only reported once.
+		input := "let a = b"
+
+		hs, err := New().Highlight(program, input, "ident", "call")
+		r.NoError(err)
+
+		r.Equal([][2]string{
+			{"let ", ""},
+			{"a", "ident"},
+			{" = ", ""},
+			{"b", "ident"},
+		}, collect(hs, input))
+	})
+
+	t.Run("reuses memoized rules", func(t *testing.T) {
+		r := require.New(t)
+
+		rest := R("rest")
+		rest.Set(Seq(S(" "), number))
+
+		// rest is memoized while trying the first alternative and reused
+		// by the second, after a different rule matched before it.
+		rule := Or(Seq(keyword, rest, S("!")), Seq(ident, rest))
+
+		input := "letx 12"
+
+		hs, err := New().Highlight(rule, input, "keyword", "ident", "number")
+		r.NoError(err)
+
+		r.Equal([][2]string{
+			{"letx", "ident"},
+			{" ", ""},
+			{"12", "number"},
+		}, collect(hs, input))
+
+		rule = Or(Seq(ident, rest, S("!")), Seq(Capture(Plus(Range('a', 'z'))), rest))
+		input = "ab 12"
+
+		hs, err = New().Highlight(rule, input, "ident", "number")
+		r.NoError(err)
+
+		r.Equal([][2]string{
+			{"ab ", ""},
+			{"12", "number"},
+		}, collect(hs, input))
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := New().Highlight(program, "let = 1")
+		r.Error(err)
+
+		hs, err := New(WithPartial(true)).Highlight(number, "12 x")
+		r.NoError(err)
+		r.Equal([][2]string{{"12", "number"}}, collect(hs, "12 x"))
+	})
+}
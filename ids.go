@@ -0,0 +1,199 @@
+package peggysue
+
+import "sort"
+
+// Compile validates the grammar and assigns an ID to each rule reachable
+// from it, including anonymous rules such as the parts of a Seq. IDs are
+// small integers, numbered from 0 within each grammar, which lets tools
+// such as tracers, coverage maps, and serializers refer to rules compactly.
+// Compile also determines which Refs are left recursive, which would
+// otherwise be done the first time each Ref is matched.
+//
+// Rules are numbered in a fixed order: depth first from the root, then
+// from the remaining named rules sorted by name, so the same grammar is
+// given the same IDs on every run. A rule shared between grammars, such as
+// one from the toolkit, may have a different ID in each.
+func (g *Grammar) Compile() error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(g.labels.refs))
+	for name := range g.labels.refs {
+		if name != g.root {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	names = append([]string{g.root}, names...)
+
+	ids := make(map[Rule]int)
+
+	var (
+		rules   []Rule
+		leftRec []string
+	)
+
+	var visit func(r Rule)
+
+	visit = func(r Rule) {
+		r = unchain(r)
+
+		if r == nil {
+			return
+		}
+
+		if _, ok := ids[r]; ok {
+			return
+		}
+
+		ids[r] = len(rules)
+		rules = append(rules, r)
+
+		if ref, ok := r.(*matchRef); ok && ref.LeftRecursive() && ref.name != "" {
+			leftRec = append(leftRec, ref.name)
+		}
+
+		for _, sub := range subRules(r) {
+			visit(sub)
+		}
+	}
+
+	for _, name := range names {
+		visit(g.labels.refs[name])
+	}
+
+	sort.Strings(leftRec)
+
+	g.ids, g.rules, g.leftRec = ids, rules, leftRec
+
+	return nil
+}
+
+// RuleID returns the ID of r in the grammar, or -1 if r is not part of it.
+// The grammar must have been compiled.
+func (g *Grammar) RuleID(r Rule) int {
+	if id, ok := g.ids[unchain(r)]; ok {
+		return id
+	}
+
+	return -1
+}
+
+// RuleByID returns the rule in the grammar with the given ID, or nil if
+// there isn't one. The grammar must have been compiled.
+func (g *Grammar) RuleByID(id int) Rule {
+	if id < 0 || id >= len(g.rules) {
+		return nil
+	}
+
+	return g.rules[id]
+}
+
+// Rules returns the rules in the grammar in the order that Compile
+// numbered them. The grammar must have been compiled.
+func (g *Grammar) Rules() []Rule {
+	return g.rules
+}
+
+// LeftRecursive returns the names of the left recursive rules in the
+// grammar, sorted. The grammar must have been compiled.
+func (g *Grammar) LeftRecursive() []string {
+	return g.leftRec
+}
+
+// subRules returns the rules that r matches directly, in a stable order.
+func subRules(r Rule) []Rule {
+	switch m := unchain(r).(type) {
+	case *matchRef:
+		return []Rule{m.rule}
+	case *matchOr:
+		return m.rules
+	case *matchSeq:
+		return m.rules
+	case *matchSeqAll:
+		return m.rules
+	case *matchEither:
+		return []Rule{m.a, m.b}
+	case *matchBoth:
+		return []Rule{m.a, m.b}
+	case *matchThree:
+		return []Rule{m.a, m.b, m.c}
+	case *matchBranch:
+		var rules []Rule
+		for _, b := range m.rules {
+			rules = append(rules, b.r)
+		}
+		for _, l := range m.levels {
+			if l.op != nil {
+				rules = append(rules, l.op)
+			}
+		}
+		return append(rules, m.ref)
+	case *matchPrefixTable:
+		keys := make([]int, 0, len(m.rules))
+		for k := range m.rules {
+			keys = append(keys, int(k))
+		}
+
+		sort.Ints(keys)
+
+		rules := make([]Rule, len(keys))
+		for i, k := range keys {
+			rules[i] = m.rules[byte(k)]
+		}
+		return rules
+	case *matchPratt:
+		rules := []Rule{m.primary}
+		for _, ops := range [][]prattOp{m.prefix, m.infix, m.postfix} {
+			for _, op := range ops {
+				rules = append(rules, op.rule)
+			}
+		}
+		return rules
+	case *matchSepBy:
+		return []Rule{m.rule, m.sep}
+	case *matchCount:
+		return []Rule{m.rule}
+	case *matchZeroOrMore:
+		return []Rule{m.rule}
+	case *matchOneOrMore:
+		return []Rule{m.rule}
+	case *matchMany:
+		return []Rule{m.rule}
+	case *matchFold:
+		return []Rule{m.rule}
+	case *matchOptional:
+		return []Rule{m.rule}
+	case *matchMaybeValue:
+		return []Rule{m.rule}
+	case *matchCheck:
+		return []Rule{m.rule}
+	case *matchNot:
+		return []Rule{m.rule}
+	case *matchCall:
+		return []Rule{m.rule}
+	case *matchBind:
+		return []Rule{m.rule}
+	case *matchAction:
+		return []Rule{m.rule}
+	case *matchApply:
+		return []Rule{m.rule}
+	case *matchScope:
+		return []Rule{m.rule}
+	case *matchNamed:
+		return []Rule{m.rule}
+	case *matchTransform:
+		return []Rule{m.rule}
+	case *matchRecover:
+		return []Rule{m.rule, m.sync}
+	case *matchCapture:
+		return []Rule{m.rule}
+	case *matchCustom:
+		return customRules(m.cr)
+	default:
+		return nil
+	}
+}
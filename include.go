@@ -0,0 +1,146 @@
+package peggysue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IncludeFunc returns the name and contents of the file that an include
+// directive refers to. val is the value of the directive rule, and from is
+// the position of the directive, within the file that contains it.
+type IncludeFunc func(val interface{}, from Pos) (filename, content string, err error)
+
+// IncludeCycleError is returned by ExpandIncludes when a file includes
+// itself, directly or through other files.
+type IncludeCycleError struct {
+	// Files are the files in the cycle, starting and ending with the file
+	// that includes itself.
+	Files []string
+}
+
+func (e *IncludeCycleError) Error() string {
+	return "include cycle: " + strings.Join(e.Files, " -> ")
+}
+
+// ExpandIncludes splices included files into the input, for languages with
+// include directives. Each match of directive in the input, found as FindAll
+// does, is replaced by the contents returned by include, in which directives
+// are expanded in turn. The input is named by the filename given to
+// WithFilename.
+//
+// It returns the expanded input, along with the FileRegions that describe
+// which file each part of it came from, so that the positions reported by a
+// parser created with WithFileRegions are within the original files.
+// ParseIncludes does both.
+func (p *Parser) ExpandIncludes(directive Rule, input string, include IncludeFunc) (string, []FileRegion, error) {
+	if p.encoding != EncodingUTF8 {
+		return "", nil, fmt.Errorf("ExpandIncludes does not support encodings other than UTF-8")
+	}
+
+	if len(p.regions) > 0 {
+		return "", nil, fmt.Errorf("ExpandIncludes does not support file regions")
+	}
+
+	var sb strings.Builder
+
+	ie := &includeExpander{p: p, directive: directive, include: include, out: &sb}
+
+	if err := ie.expand(p.filename, input, []string{p.filename}); err != nil {
+		return "", nil, err
+	}
+
+	return sb.String(), ie.regions, nil
+}
+
+// ParseIncludes expands the include directives in the input, as
+// ExpandIncludes does, and parses the result with r, as Parse does.
+// Positions in errors and values are within the files the input came from.
+func (p *Parser) ParseIncludes(r, directive Rule, input string, include IncludeFunc) (val interface{}, matched bool, err error) {
+	expanded, regions, err := p.ExpandIncludes(directive, input, include)
+	if err != nil {
+		return nil, false, err
+	}
+
+	cp := *p
+	cp.regions = regions
+
+	return cp.Parse(r, expanded)
+}
+
+type includeExpander struct {
+	p         *Parser
+	directive Rule
+	include   IncludeFunc
+
+	out     *strings.Builder
+	regions []FileRegion
+}
+
+// expand writes content, which is the file named filename, to the output,
+// expanding the directives within it. files are the files being expanded,
+// ending with filename.
+func (ie *includeExpander) expand(filename, content string, files []string) error {
+	cp := *ie.p
+	cp.filename = filename
+	cp.mapper = nil
+
+	var (
+		last int
+		err  error
+	)
+
+	findErr := cp.findAll(ie.directive, content, -1, func(s *state, start int, val interface{}) {
+		if err != nil {
+			return
+		}
+
+		end := s.pos
+
+		var name, sub string
+
+		name, sub, err = ie.include(val, s.position(start))
+		if err != nil {
+			return
+		}
+
+		for i, f := range files {
+			if f == name {
+				err = &IncludeCycleError{Files: append(append([]string(nil), files[i:]...), name)}
+				return
+			}
+		}
+
+		ie.out.WriteString(content[last:start])
+
+		ie.regions = append(ie.regions, FileRegion{Start: ie.out.Len(), Filename: name})
+
+		err = ie.expand(name, sub, append(files, name))
+		if err != nil {
+			return
+		}
+
+		// The rest of the file resumes where the directive ended, which
+		// may be in the middle of a line.
+		resume := s.position(end)
+
+		ie.regions = append(ie.regions, FileRegion{
+			Start:    ie.out.Len(),
+			Filename: filename,
+			Line:     resume.Line,
+			Column:   resume.Column,
+		})
+
+		last = end
+	})
+	if findErr != nil {
+		return findErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ie.out.WriteString(content[last:])
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package peggysue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncludes(t *testing.T) {
+	directive := Seq(S("include "), Capture(Plus(Range('a', 'z'))), S(";"))
+
+	files := map[string]string{
+		"defs":  "d1\ninclude more;\nd2",
+		"more":  "m1\nm!",
+		"self":  "include loop;",
+		"loop":  "include self;",
+		"plain": "p",
+	}
+
+	include := func(val interface{}, from Pos) (string, string, error) {
+		name := val.(string)
+
+		content, ok := files[name]
+		if !ok {
+			return "", "", fmt.Errorf("%s: no file named %s", from, name)
+		}
+
+		return name, content, nil
+	}
+
+	t.Run("splices included files into the input", func(t *testing.T) {
+		r := require.New(t)
+
+		out, regions, err := New(WithFilename("main")).ExpandIncludes(directive, "a\nb include plain; c\ninclude defs;", include)
+		r.NoError(err)
+
+		r.Equal("a\nb p c\nd1\nm1\nm!\nd2", out)
+		r.Equal([]FileRegion{
+			{Start: 4, Filename: "plain"},
+			{Start: 5, Filename: "main", Line: 2, Column: 17},
+			{Start: 8, Filename: "defs"},
+			{Start: 11, Filename: "more"},
+			{Start: 16, Filename: "defs", Line: 2, Column: 14},
+			{Start: 19, Filename: "main", Line: 3, Column: 14},
+		}, regions)
+	})
+
+	t.Run("reports positions within the included files", func(t *testing.T) {
+		r := require.New(t)
+
+		word := Plus(Or(Range('a', 'z'), Range('0', '9')))
+		doc := Seq(word, Star(Seq(Set(' ', '\n'), word)))
+
+		_, _, err := New(WithFilename("main")).ParseIncludes(doc, directive, "a b\ninclude defs;", include)
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(err, &nc)
+		r.Equal("more:2:2", nc.Pos.String())
+
+		val, ok, err := New(WithFilename("main")).ParseIncludes(Capture(doc), directive, "a include plain; b", include)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("a p b", val)
+	})
+
+	t.Run("reports include errors", func(t *testing.T) {
+		r := require.New(t)
+
+		_, _, err := New(WithFilename("main")).ExpandIncludes(directive, "x\n include nope;", include)
+		r.EqualError(err, "main:2:2: no file named nope")
+
+		_, _, err = New(WithFilename("main")).ExpandIncludes(directive, "include self;", include)
+
+		var ce *IncludeCycleError
+		r.ErrorAs(err, &ce)
+		r.Equal([]string{"self", "loop", "self"}, ce.Files)
+	})
+}
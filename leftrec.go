@@ -0,0 +1,96 @@
+package peggysue
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// leftRecMu serializes the left recursion analysis of Refs that are
+	// first matched concurrently.
+	leftRecMu sync.Mutex
+
+	// refOrder counts the Refs that have been set, to order them.
+	refOrder uint64
+)
+
+// analyzeLeftRec determines if the Ref is left recursive. It is not done by
+// Set because the rules that the Ref refers to may not be set yet, and
+// analyzing a large grammar repeatedly as each Ref is set is slow. Instead,
+// it is done by Grammar.Compile or when the Ref is first matched, and the
+// result is kept.
+//
+// The result is the same as if it were done by Set: only a Ref that can
+// match itself in a left position through Refs set before it grows its
+// match by repeatedly matching its rule. The other Refs in a cycle of left
+// recursion, which was completed by a Ref set after them, are memoized as
+// usual. It depends only on the rules and the order they were set in, not
+// on which Refs have been matched.
+func (r *matchRef) analyzeLeftRec() {
+	if atomic.LoadUint32(&r.analyzed) == 1 {
+		return
+	}
+
+	leftRecMu.Lock()
+	defer leftRecMu.Unlock()
+
+	if r.analyzed == 1 || r.rule == nil {
+		return
+	}
+
+	r.leftRec = leftReaches(r, r.setAfter())
+	r.leftRecMember = !r.leftRec && leftReaches(r, nil)
+
+	atomic.StoreUint32(&r.analyzed, 1)
+}
+
+// setAfter returns the refs reachable from r that were set after it.
+func (r *matchRef) setAfter() []*matchRef {
+	var later []*matchRef
+
+	seen := map[Rule]bool{}
+
+	var visit func(x Rule)
+
+	visit = func(x Rule) {
+		x = unchain(x)
+
+		if x == nil || seen[x] {
+			return
+		}
+
+		seen[x] = true
+
+		if m, ok := x.(*matchRef); ok && m.order > r.order {
+			later = append(later, m)
+		}
+
+		for _, sub := range subRules(x) {
+			visit(sub)
+		}
+	}
+
+	visit(r.rule)
+
+	return later
+}
+
+// leftReaches reports whether r's rule can match r in a left position,
+// without passing through the refs in blocked.
+func leftReaches(r *matchRef, blocked []*matchRef) bool {
+	if r.rule == r {
+		return true
+	}
+
+	rs := make(ruleSet)
+
+	for _, b := range blocked {
+		rs.Add(b.rule)
+	}
+
+	if !rs.Add(r.rule) {
+		return false
+	}
+
+	return r.rule.detectLeftRec(r, rs)
+}
@@ -0,0 +1,91 @@
+package peggysue
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// InputTooLargeError is returned when the input is larger than the limit set
+// with WithMaxInputSize. The input is rejected before any of it is parsed.
+type InputTooLargeError struct {
+	Limit int
+
+	// Size is the size of the input, or, with ParseReader, how much of it
+	// had been read when the limit was exceeded.
+	Size int
+}
+
+func (e *InputTooLargeError) Error() string {
+	return fmt.Sprintf("input of %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+// MemoLimitError is returned when the memory used by memoized results grows
+// beyond the limit set with WithMaxMemoBytes.
+type MemoLimitError struct {
+	Limit int
+
+	// Pos is the position where the limit was exceeded.
+	Pos Pos
+
+	// Rule is the name of the Ref whose result was being memoized.
+	Rule string
+}
+
+func (e *MemoLimitError) Error() string {
+	return fmt.Sprintf("%s: memoization limit of %d bytes exceeded in %s", e.Pos, e.Limit, e.Rule)
+}
+
+// WithMaxInputSize sets the largest input, in bytes, that the parser accepts.
+// Larger inputs fail with an InputTooLargeError without being parsed, which
+// allows services that parse untrusted input to cap the resources used. A
+// limit of 0, the default, means there is no limit.
+func WithMaxInputSize(n int) Option {
+	return func(p *Parser) {
+		p.maxInputSize = n
+	}
+}
+
+// WithMaxMemoBytes sets the most memory, in bytes, that memoized Ref results
+// may use during a parse. When exceeded, parsing stops and a MemoLimitError
+// is returned. The memory used is estimated from the number of results
+// stored and does not include the values that rules produce. A limit of 0,
+// the default, means there is no limit.
+func WithMaxMemoBytes(n int) Option {
+	return func(p *Parser) {
+		p.maxMemoBytes = n
+	}
+}
+
+const (
+	// memoEntrySize estimates the memory used by one memoized result: the
+	// memoResult and its slot in the map for its position.
+	memoEntrySize = int(unsafe.Sizeof(memoResult{}) + unsafe.Sizeof(Rule(nil)) + unsafe.Sizeof(&memoResult{}))
+
+	// memoPositionSize estimates the memory used by the map of memoized
+	// results at a position, and its slot in the map of positions.
+	memoPositionSize = 48 + int(unsafe.Sizeof(0)+unsafe.Sizeof(map[Rule]*memoResult(nil)))
+)
+
+// checkInputSize returns an InputTooLargeError if size exceeds the limit set
+// with WithMaxInputSize.
+func (p *Parser) checkInputSize(size int) error {
+	if p.maxInputSize > 0 && size > p.maxInputSize {
+		return &InputTooLargeError{Limit: p.maxInputSize, Size: size}
+	}
+
+	return nil
+}
+
+// addMemo accounts for n more bytes of memoized results, stopping parsing
+// if the limit set with WithMaxMemoBytes is exceeded.
+func (s *state) addMemo(m Rule, n int) {
+	s.memoBytes += n
+
+	if limit := s.p.maxMemoBytes; limit > 0 && s.memoBytes > limit {
+		s.abort(&MemoLimitError{
+			Limit: limit,
+			Pos:   s.position(s.pos),
+			Rule:  m.Name(),
+		})
+	}
+}
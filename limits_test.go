@@ -0,0 +1,72 @@
+package peggysue
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	t.Run("rejects input that is too large", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithMaxInputSize(4))
+		rule := Star(Range('a', 'z'))
+
+		_, ok, err := p.Parse(rule, "abcd")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(rule, "abcde")
+		r.False(ok)
+
+		var tl *InputTooLargeError
+		r.ErrorAs(err, &tl)
+		r.Equal(4, tl.Limit)
+		r.Equal(5, tl.Size)
+
+		pr := p.Run(rule, "abcde")
+		r.False(pr.Matched)
+		r.ErrorAs(pr.Err(), &tl)
+
+		_, _, err = p.ParseAll(Range('a', 'z'), "abcde", nil)
+		r.ErrorAs(err, &tl)
+
+		err = p.ParseReader(Range('a', 'z'), strings.NewReader("abcde"), nil, func(interface{}, Span) error { return nil })
+		r.ErrorAs(err, &tl)
+
+		path := filepath.Join(t.TempDir(), "input")
+		r.NoError(os.WriteFile(path, []byte("abcde"), 0644))
+
+		_, _, err = p.ParseFile(rule, path)
+		r.ErrorAs(err, &tl)
+	})
+
+	t.Run("stops when memoized results use too much memory", func(t *testing.T) {
+		r := require.New(t)
+
+		letter := R("letter")
+		letter.Set(Range('a', 'z'))
+
+		rule := Star(letter)
+
+		input := strings.Repeat("a", 100)
+
+		_, ok, err := New(WithMaxMemoBytes(1<<20)).Parse(rule, input)
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = New(WithMaxMemoBytes(1000)).Parse(rule, input)
+		r.False(ok)
+
+		var ml *MemoLimitError
+		r.ErrorAs(err, &ml)
+		r.Equal(1000, ml.Limit)
+		r.Equal("letter", ml.Rule)
+		r.Greater(ml.Pos.Offset, 0)
+		r.Less(ml.Pos.Offset, 100)
+	})
+}
@@ -10,7 +10,7 @@ func TestLines(t *testing.T) {
 	t.Run("can calculate line from byte position", func(t *testing.T) {
 		var s state
 
-		s.linePos = computeLines("foo\nbar\n\nbaz")
+		s.lines = NewLineIndex("foo\nbar\n\nbaz")
 
 		r := assert.New(t)
 
@@ -22,4 +22,172 @@ func TestLines(t *testing.T) {
 		r.Equal(4, s.line(10))
 
 	})
+
+	t.Run("recognizes CRLF and lone CR line terminators", func(t *testing.T) {
+		var s state
+
+		s.lines = NewLineIndex("foo\r\nbar\rbaz\nqux")
+
+		r := assert.New(t)
+
+		r.Equal(1, s.line(3))
+		r.Equal(1, s.line(4))
+		r.Equal(2, s.line(5))
+		r.Equal(1, s.column(5))
+		r.Equal(2, s.line(8))
+		r.Equal(3, s.line(9))
+		r.Equal(1, s.column(9))
+		r.Equal(4, s.line(13))
+
+		s.lines = NewLineIndex("foo\r\nbar\rbaz\nqux", WithLineTerminators(LineLF))
+
+		r.Equal(2, s.line(5))
+		r.Equal(2, s.line(9))
+		r.Equal(3, s.line(13))
+		r.Equal(5, s.column(9))
+
+		s.lines = NewLineIndex("foo\r\nbar", WithLineTerminators(LineCR|LineLF))
+		r.Equal(2, s.line(5))
+	})
+
+	t.Run("can calculate column from byte position", func(t *testing.T) {
+		var s state
+
+		s.lines = NewLineIndex("foo\nbar\n\nbaz")
+
+		r := assert.New(t)
+
+		r.Equal(1, s.column(0))
+		r.Equal(4, s.column(3))
+		r.Equal(1, s.column(4))
+		r.Equal(3, s.column(6))
+		r.Equal(1, s.column(8))
+		r.Equal(2, s.column(10))
+	})
+	t.Run("can calculate columns in runes and display width", func(t *testing.T) {
+		var s state
+
+		s.input = "a\tb\n\xc3\xa9\tz\te\u0301x"
+		s.lines = NewLineIndex(s.input)
+
+		r := assert.New(t)
+
+		r.Equal(3, s.column(2))
+
+		s.lines.columnMode = ColumnRunes
+		r.Equal(3, s.column(2))
+		r.Equal(3, s.column(7))
+
+		s.lines.columnMode = ColumnDisplay
+		r.Equal(9, s.column(2))
+		r.Equal(9, s.column(7))
+		r.Equal(10, s.column(8))
+		r.Equal(18, s.column(10))
+		r.Equal(18, s.column(12))
+
+		s.lines.tabWidth = 4
+		r.Equal(5, s.column(2))
+		r.Equal(6, s.column(8))
+	})
+}
+
+func TestLineIndex(t *testing.T) {
+	t.Run("converts offsets to lines and columns", func(t *testing.T) {
+		r := assert.New(t)
+
+		li := NewLineIndex("foo\r\nbar\n\nbaz")
+
+		r.Equal(4, li.Lines())
+		r.Equal(1, li.Line(0))
+		r.Equal(4, li.Col(3))
+		r.Equal(2, li.Line(5))
+		r.Equal(1, li.Col(5))
+		r.Equal(3, li.Line(9))
+		r.Equal(4, li.Line(12))
+		r.Equal(3, li.Col(12))
+	})
+
+	t.Run("converts lines and columns to offsets", func(t *testing.T) {
+		r := assert.New(t)
+
+		li := NewLineIndex("foo\r\nbar\n\nbaz")
+
+		for _, tc := range []struct {
+			line, col, pos int
+		}{
+			{1, 1, 0},
+			{1, 4, 3},
+			{2, 1, 5},
+			{2, 3, 7},
+			{3, 1, 9},
+			{4, 4, 13},
+		} {
+			pos, ok := li.PosFor(tc.line, tc.col)
+			r.True(ok, "%d:%d", tc.line, tc.col)
+			r.Equal(tc.pos, pos, "%d:%d", tc.line, tc.col)
+
+			r.Equal(tc.line, li.Line(pos))
+			r.Equal(tc.col, li.Col(pos))
+		}
+
+		for _, lc := range [][2]int{{0, 1}, {1, 0}, {1, 5}, {3, 2}, {5, 1}} {
+			_, ok := li.PosFor(lc[0], lc[1])
+			r.False(ok, "%d:%d", lc[0], lc[1])
+		}
+	})
+
+	t.Run("counts columns as the parser is configured to", func(t *testing.T) {
+		r := assert.New(t)
+
+		input := "a\tb\n\xc3\xa9\tz"
+
+		li := NewLineIndex(input, WithColumnMode(ColumnDisplay), WithTabWidth(4))
+
+		r.Equal(5, li.Col(2))
+		r.Equal(6, li.Col(8))
+
+		pos, ok := li.PosFor(2, 6)
+		r.True(ok)
+		r.Equal(8, pos)
+
+		pos, ok = li.PosFor(1, 3)
+		r.True(ok)
+		r.Equal(1, pos)
+
+		li = NewLineIndex(input, WithColumnMode(ColumnRunes))
+
+		pos, ok = li.PosFor(2, 2)
+		r.True(ok)
+		r.Equal(6, pos)
+
+		s := New(WithColumnMode(ColumnDisplay), WithTabWidth(4)).newState(input, "")
+		defer returnValues(s.values)
+
+		r.Equal(li.Line(8), s.position(8).Line)
+		r.Equal(6, s.position(8).Column)
+	})
+
+	t.Run("round trips the offset of each rune", func(t *testing.T) {
+		r := assert.New(t)
+
+		input := "x\t\xc3\xa9y\u0301\tz\nab"
+
+		for _, mode := range []ColumnMode{ColumnBytes, ColumnRunes, ColumnDisplay} {
+			li := NewLineIndex(input, WithColumnMode(mode))
+
+			for pos := range input {
+				got, ok := li.PosFor(li.Line(pos), li.Col(pos))
+				r.True(ok, "%d: %d", mode, pos)
+
+				if mode == ColumnDisplay {
+					// A combining mark takes up no columns, so it shares
+					// its column with the rune that follows it.
+					r.Equal(li.Col(pos), li.Col(got), "%d: %d", mode, pos)
+					continue
+				}
+
+				r.Equal(pos, got, "%d: %d", mode, pos)
+			}
+		}
+	})
 }
@@ -0,0 +1,157 @@
+package peggysue
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// LineIndex converts between byte offsets in an input and lines and columns,
+// using the same rules as the positions reported by a Parser. It lets error
+// reporting and editor integrations outside of a parse agree with the parser
+// on where things are.
+type LineIndex struct {
+	input string
+	lt    LineTerminator
+
+	// ends is the offset of the last byte of each line terminator.
+	ends []int
+
+	columnMode ColumnMode
+	tabWidth   int
+}
+
+// NewLineIndex indexes the lines of input. The options that affect
+// positions, WithLineTerminators, WithColumnMode, and WithTabWidth, are
+// honored, and others are ignored, so the options used to create a Parser
+// can be passed as is.
+func NewLineIndex(input string, opts ...Option) *LineIndex {
+	var p Parser
+
+	for _, o := range opts {
+		o(&p)
+	}
+
+	return newLineIndex(input, &p)
+}
+
+func newLineIndex(input string, p *Parser) *LineIndex {
+	lt := p.lineTerminators
+	if lt == 0 {
+		lt = LineAny
+	}
+
+	return &LineIndex{
+		input:      input,
+		lt:         lt,
+		ends:       computeLinesWith(input, lt),
+		columnMode: p.columnMode,
+		tabWidth:   p.tabWidth,
+	}
+}
+
+// Lines returns the number of lines in the input.
+func (li *LineIndex) Lines() int {
+	return len(li.ends) + 1
+}
+
+// Line returns the 1-based line of the byte offset pos.
+func (li *LineIndex) Line(pos int) int {
+	return sort.SearchInts(li.ends, pos) + 1
+}
+
+// Col returns the 1-based column of the byte offset pos, counted as the
+// column mode says.
+func (li *LineIndex) Col(pos int) int {
+	return li.columns(li.lineStart(li.Line(pos)), pos) + 1
+}
+
+// PosFor returns the byte offset of the 1-based line and column, the inverse
+// of Line and Col. The column may be one past the end of the line, which is
+// the offset of its line terminator. It returns false if there is no such
+// line or column. With ColumnDisplay, a column within a tab is the offset of
+// the tab.
+func (li *LineIndex) PosFor(line, col int) (int, bool) {
+	if line < 1 || line > li.Lines() || col < 1 {
+		return 0, false
+	}
+
+	start, end := li.lineStart(line), li.lineEnd(line)
+
+	if li.columnMode == ColumnBytes {
+		if start+col-1 > end {
+			return 0, false
+		}
+
+		return start + col - 1, true
+	}
+
+	tabWidth := li.tabWidth
+	if tabWidth <= 0 {
+		tabWidth = DefaultTabWidth
+	}
+
+	// Columns are counted in a single pass over the line, with cur the
+	// 0-based column of pos.
+	cur := 0
+
+	for pos, r := range li.input[start:end] {
+		if cur+1 == col {
+			return start + pos, true
+		}
+
+		next := cur + 1
+		if li.columnMode == ColumnDisplay {
+			next = nextDisplayColumn(cur, r, tabWidth)
+		}
+
+		if cur+1 < col && next+1 > col {
+			return start + pos, true
+		}
+
+		cur = next
+	}
+
+	if cur+1 == col {
+		return end, true
+	}
+
+	return 0, false
+}
+
+// lineStart returns the offset of the first byte of the 1-based line.
+func (li *LineIndex) lineStart(line int) int {
+	if line <= 1 {
+		return 0
+	}
+
+	return li.ends[line-2] + 1
+}
+
+// lineEnd returns the offset of the line terminator that ends the 1-based
+// line, or the size of the input for the last line.
+func (li *LineIndex) lineEnd(line int) int {
+	if line > len(li.ends) {
+		return len(li.input)
+	}
+
+	end := li.ends[line-1]
+
+	if li.lt&LineCRLF != 0 && li.input[end] == '\n' && end > 0 && li.input[end-1] == '\r' {
+		end--
+	}
+
+	return end
+}
+
+// columns returns the number of columns between start and pos, which are on
+// the same line.
+func (li *LineIndex) columns(start, pos int) int {
+	switch li.columnMode {
+	case ColumnRunes:
+		return utf8.RuneCountInString(li.input[start:pos])
+	case ColumnDisplay:
+		return displayColumn(li.input[start:pos], li.tabWidth)
+	default:
+		return pos - start
+	}
+}
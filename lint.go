@@ -0,0 +1,374 @@
+package peggysue
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Warning is a likely mistake in a grammar reported by Lint, or a risk
+// reported by BacktrackRisks.
+type Warning struct {
+	// Rule is the name of the rule the warning is about, or of the nearest
+	// named rule that contains it. It is empty if there is none.
+	Rule string
+
+	Message string
+
+	// Suggestion describes how to rewrite the rule, if there is a
+	// straightforward way to.
+	Suggestion string
+}
+
+func (w Warning) String() string {
+	msg := w.Message
+	if w.Suggestion != "" {
+		msg += "; " + w.Suggestion
+	}
+
+	if w.Rule == "" {
+		return msg
+	}
+
+	return w.Rule + ": " + msg
+}
+
+// Lint statically analyzes the rules reachable from root and reports
+// likely mistakes. Currently it reports ordered choices, such as Or, with
+// alternatives that can never be reached, either because an earlier
+// alternative always matches, or because an earlier alternative matches
+// whenever the later one would, as in Or(S("<"), S("<=")).
+//
+// The analysis is conservative: it only reports alternatives that are
+// certainly unreachable, so a grammar without warnings may still contain
+// some.
+func Lint(root Rule) []Warning {
+	l := &linter{
+		seen:     make(map[Rule]bool),
+		visiting: make(map[Rule]bool),
+	}
+
+	l.walk(root, "")
+
+	return l.warnings
+}
+
+// Lint validates the grammar and then runs Lint on its root rule.
+func (g *Grammar) Lint() ([]Warning, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	return Lint(g.labels.refs[g.root]), nil
+}
+
+type linter struct {
+	seen     map[Rule]bool
+	visiting map[Rule]bool
+	warnings []Warning
+}
+
+func (l *linter) warn(def, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, Warning{
+		Rule:    def,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// walk lints r and the rules it contains. def is the name of the nearest
+// named rule containing r.
+func (l *linter) walk(r Rule, def string) {
+	r = unchain(r)
+
+	if r == nil || l.seen[r] {
+		return
+	}
+
+	l.seen[r] = true
+
+	if name := r.Name(); name != "" {
+		def = name
+	}
+
+	l.checkChoice(def, alternatives(r))
+
+	for _, sub := range subRules(r) {
+		l.walk(sub, def)
+	}
+}
+
+// alternatives returns the alternatives of r if it is an ordered choice.
+func alternatives(r Rule) []Rule {
+	switch m := r.(type) {
+	case *matchOr:
+		return m.rules
+	case *matchEither:
+		return []Rule{m.a, m.b}
+	case *matchBranch:
+		rules := make([]Rule, len(m.rules))
+		for i, b := range m.rules {
+			rules[i] = b.r
+		}
+		return rules
+	default:
+		return nil
+	}
+}
+
+func (l *linter) checkChoice(def string, alts []Rule) {
+	for i, a := range alts {
+		if i == len(alts)-1 {
+			break
+		}
+
+		if l.always(a) {
+			l.warn(def, "alternatives after %s are unreachable because it always matches", Print(a))
+			break
+		}
+
+		for _, later := range alts[i+1:] {
+			if l.shadows(a, later) {
+				l.warn(def, "alternative %s is unreachable because %s matches first", Print(later), Print(a))
+			}
+		}
+	}
+}
+
+// shadows reports whether a always matches when b would, when a is tried
+// first.
+func (l *linter) shadows(a, b Rule) bool {
+	if unchain(a) == unchain(b) {
+		return true
+	}
+
+	pb := l.prefix(b)
+
+	if str, ok := l.exact(a); ok {
+		return strings.HasPrefix(pb, str)
+	}
+
+	if pb == "" {
+		return false
+	}
+
+	rn, _ := utf8.DecodeRuneInString(pb)
+
+	switch m := unchain(a).(type) {
+	case *matchAny:
+		return true
+	case *matchCharRange:
+		return rn >= m.start && rn <= m.end
+	case *matchCharSet:
+		for _, x := range m.set {
+			if x == rn {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inner returns the rule that r wraps if r matches exactly when the
+// wrapped rule does, such as a Ref or an Action, or nil otherwise.
+func inner(r Rule) Rule {
+	switch m := r.(type) {
+	case *matchRef:
+		return m.rule
+	case *matchAction:
+		return m.rule
+	case *matchApply:
+		return m.rule
+	case *matchScope:
+		return m.rule
+	case *matchNamed:
+		return m.rule
+	case *matchTransform:
+		return m.rule
+	case *matchCapture:
+		if m.opts&CaptureUnquote != 0 {
+			return nil
+		}
+		return m.rule
+	case *matchCall:
+		return m.rule
+	default:
+		return nil
+	}
+}
+
+// enter guards against following a cycle of refs forever. It returns
+// false if r is already being analyzed.
+func (l *linter) enter(r Rule) bool {
+	if l.visiting[r] {
+		return false
+	}
+
+	l.visiting[r] = true
+	return true
+}
+
+// always reports whether r matches on any input.
+func (l *linter) always(r Rule) bool {
+	r = unchain(r)
+
+	if r == nil || !l.enter(r) {
+		return false
+	}
+
+	defer delete(l.visiting, r)
+
+	switch m := r.(type) {
+	case *matchString:
+		return m.str == ""
+	case *matchOptional, *matchZeroOrMore, *matchMaybeValue, *matchFold:
+		return true
+	case *matchSepBy:
+		return m.min <= 0
+	case *matchMany:
+		return m.min <= 0
+	case *matchCount:
+		return m.num <= 0 || l.always(m.rule)
+	case *matchOneOrMore:
+		return l.always(m.rule)
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		for _, sub := range subRules(m) {
+			if !l.always(sub) {
+				return false
+			}
+		}
+		return true
+	case *matchOr, *matchEither, *matchBranch:
+		for _, sub := range alternatives(m) {
+			if l.always(sub) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if sub := inner(r); sub != nil {
+		return l.always(sub)
+	}
+
+	return false
+}
+
+// exact returns the string that r matches if r matches exactly when the
+// input begins with it.
+func (l *linter) exact(r Rule) (string, bool) {
+	r = unchain(r)
+
+	if r == nil || !l.enter(r) {
+		return "", false
+	}
+
+	defer delete(l.visiting, r)
+
+	switch m := r.(type) {
+	case *matchString:
+		return m.str, true
+	case *matchString1:
+		return string(m.b), true
+	case *matchString2:
+		return string([]byte{m.a, m.b}), true
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		var sb strings.Builder
+
+		for _, sub := range subRules(m) {
+			str, ok := l.exact(sub)
+			if !ok {
+				return "", false
+			}
+
+			sb.WriteString(str)
+		}
+
+		return sb.String(), true
+	}
+
+	if sub := inner(r); sub != nil {
+		return l.exact(sub)
+	}
+
+	return "", false
+}
+
+// prefix returns a string that the input must begin with for r to match.
+// It is empty if nothing is known about the input.
+func (l *linter) prefix(r Rule) string {
+	r = unchain(r)
+
+	if str, ok := l.exact(r); ok {
+		return str
+	}
+
+	if r == nil || !l.enter(r) {
+		return ""
+	}
+
+	defer delete(l.visiting, r)
+
+	switch m := r.(type) {
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		var sb strings.Builder
+
+		for _, sub := range subRules(m) {
+			str, ok := l.exact(sub)
+			if !ok {
+				sb.WriteString(l.prefix(sub))
+				break
+			}
+
+			sb.WriteString(str)
+		}
+
+		return sb.String()
+	case *matchOr, *matchEither, *matchBranch:
+		alts := alternatives(m)
+		if len(alts) == 0 {
+			return ""
+		}
+
+		common := l.prefix(alts[0])
+
+		for _, sub := range alts[1:] {
+			if common == "" {
+				break
+			}
+
+			common = commonPrefix(common, l.prefix(sub))
+		}
+
+		return common
+	case *matchOneOrMore:
+		return l.prefix(m.rule)
+	case *matchMany:
+		if m.min > 0 {
+			return l.prefix(m.rule)
+		}
+		return ""
+	case *matchCount:
+		if m.num > 0 {
+			return l.prefix(m.rule)
+		}
+		return ""
+	case *matchBind:
+		return l.prefix(m.rule)
+	}
+
+	if sub := inner(r); sub != nil {
+		return l.prefix(sub)
+	}
+
+	return ""
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:i]
+}
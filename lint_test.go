@@ -0,0 +1,76 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	t.Run("reports a literal shadowed by its prefix", func(t *testing.T) {
+		r := require.New(t)
+
+		op := N("op", Or(S("<"), S("<="), S(">")))
+
+		warnings := Lint(op)
+		r.Len(warnings, 1)
+		r.Equal("op", warnings[0].Rule)
+		r.Equal(`alternative "<=" is unreachable because "<" matches first`, warnings[0].Message)
+	})
+
+	t.Run("reports alternatives after one that always matches", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := Or(S("a"), Star(S("b")), S("c"))
+
+		warnings := Lint(rule)
+		r.Len(warnings, 1)
+		r.Equal("", warnings[0].Rule)
+		r.Equal(`alternatives after "b"* are unreachable because it always matches`, warnings[0].String())
+	})
+
+	t.Run("looks through sequences, refs, and actions", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			kw   = R("kw")
+			stmt = R("stmt")
+		)
+
+		kw.Set(Action(S("if"), func(v Values) interface{} { return nil }))
+		stmt.Set(Or(
+			kw,
+			Seq(S("i"), S("f"), S("("), Range('a', 'z'), S(")")),
+			Range('x', 'z'),
+			Seq(S("x"), S(":")),
+		))
+
+		warnings := Lint(stmt)
+		r.Len(warnings, 2)
+		r.Equal(`alternative "i" "f" "(" [a-z] ")" is unreachable because kw matches first`, warnings[0].Message)
+		r.Equal(`alternative "x" ":" is unreachable because [x-z] matches first`, warnings[1].Message)
+	})
+
+	t.Run("accepts a correctly ordered choice", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := Or(S("<="), S("<"), Seq(Range('0', '9'), S("x")), Range('0', '9'), Maybe(S("-")))
+
+		r.Empty(Lint(rule))
+	})
+
+	t.Run("follows recursive rules", func(t *testing.T) {
+		r := require.New(t)
+
+		g := NewGrammar()
+
+		g.Define("list", Seq(S("("), Star(g.Ref("item")), S(")")))
+		g.Define("item", Or(g.Ref("list"), S("a"), S("a")))
+		g.Root("list")
+
+		warnings, err := g.Lint()
+		r.NoError(err)
+		r.Len(warnings, 1)
+		r.Equal(`item: alternative "a" is unreachable because "a" matches first`, warnings[0].String())
+	})
+}
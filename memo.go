@@ -0,0 +1,29 @@
+package peggysue
+
+// WithMemo controls whether the results of Refs are memoized, which is on
+// by default. Memoization keeps the time to parse linear however much the
+// grammar backtracks, but allocates tables that can dominate the time taken
+// to parse short inputs, or inputs that a grammar parses with little
+// backtracking. Left recursive Refs are always memoized, since that is how
+// their matches are grown.
+func WithMemo(on bool) Option {
+	return func(p *Parser) {
+		p.noMemo = !on
+	}
+}
+
+// WithMemoThreshold turns off memoization, as WithMemo(false) does, for
+// inputs smaller than n bytes. Without memoization, backtracking can take
+// time exponential in the size of the input, so n should be small enough
+// that this cost is bounded, such as the size of a single field or command.
+func WithMemoThreshold(n int) Option {
+	return func(p *Parser) {
+		p.memoThreshold = n
+	}
+}
+
+// memoize reports whether Refs should be memoized while parsing input of
+// the given size.
+func (p *Parser) memoize(size int) bool {
+	return !p.noMemo && size >= p.memoThreshold
+}
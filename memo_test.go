@@ -0,0 +1,80 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMemo(t *testing.T) {
+	num := R("num")
+	num.Set(Capture(Plus(Range('0', '9'))))
+
+	sum := Capture(Seq(num, Star(Seq(S("+"), num))))
+
+	t.Run("skips memoization when off", func(t *testing.T) {
+		r := require.New(t)
+
+		res := New(WithMemo(false)).Run(sum, "1+22")
+		r.NoError(res.Err())
+		r.Equal("1+22", res.Value)
+		r.Equal(0, res.Stats.MemoEntries)
+	})
+
+	t.Run("still grows left recursive rules", func(t *testing.T) {
+		r := require.New(t)
+
+		expr := R("expr")
+		expr.Set(Or(
+			Action(Seq(Named("l", expr), S("-"), Named("r", num)), func(v Values) interface{} {
+				return "(" + v.Get("l").(string) + "-" + v.Get("r").(string) + ")"
+			}),
+			num,
+		))
+
+		val, ok, err := New(WithMemo(false)).Parse(expr, "1-2-3")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("((1-2)-3)", val)
+	})
+
+	t.Run("skips memoization below the threshold", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithMemoThreshold(8))
+
+		res := p.Run(sum, "1+22")
+		r.NoError(res.Err())
+		r.Equal(0, res.Stats.MemoEntries)
+
+		res = p.Run(sum, "1+22+333")
+		r.NoError(res.Err())
+		r.Equal(3, res.Stats.MemoEntries)
+	})
+}
+
+func BenchmarkParseMemo(b *testing.B) {
+	num := R("num")
+	num.Set(Plus(Range('0', '9')))
+
+	calc := Or(
+		Seq(num, S("-"), num),
+		Seq(num, S("+"), num),
+	)
+
+	b.Run("memo", func(b *testing.B) {
+		p := New()
+
+		for i := 0; i < b.N; i++ {
+			p.Parse(calc, "3+4")
+		}
+	})
+
+	b.Run("no memo", func(b *testing.B) {
+		p := New(WithMemo(false))
+
+		for i := 0; i < b.N; i++ {
+			p.Parse(calc, "3+4")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package peggysue
+
+import "reflect"
+
+type nodeHook struct {
+	typ reflect.Type
+	fn  func(node interface{}, span Span)
+}
+
+// OnNode registers fn to be called with each value of type typ produced by
+// an Action, ActionErr, Apply, or Transform, along with the span of input
+// that produced it. If typ is an interface type, fn is called with every
+// value that implements it. This allows passes such as collecting
+// definitions or building an index to be written once, rather than in
+// every Action that creates a node.
+//
+// The hooks are called once a parse with Parse, ParseAt, ParseFile, Run,
+// ParseAll, or Unmarshal has matched, in the order that the values were
+// produced, and only for values that are part of the result. Values
+// produced by alternatives that were later abandoned are skipped.
+//
+// OnNode must not be called while the parser is in use.
+func (p *Parser) OnNode(typ reflect.Type, fn func(node interface{}, span Span)) {
+	p.nodeHooks = append(p.nodeHooks, nodeHook{typ: typ, fn: fn})
+}
+
+// OnNode registers fn to be called with the values of type typ produced
+// while parsing with the grammar, see Parser.OnNode.
+func (g *Grammar) OnNode(typ reflect.Type, fn func(node interface{}, span Span)) {
+	g.parser.OnNode(typ, fn)
+}
+
+func (h *nodeHook) matches(val interface{}) bool {
+	vt := reflect.TypeOf(val)
+
+	if h.typ.Kind() == reflect.Interface {
+		return vt.Implements(h.typ)
+	}
+
+	return vt == h.typ
+}
+
+// recordNode records val, which was produced from the input from start to
+// the current position, if any hooks want it.
+func (s *state) recordNode(start int, val interface{}) {
+	if val == nil {
+		return
+	}
+
+	for i := range s.p.nodeHooks {
+		if s.p.nodeHooks[i].matches(val) {
+			s.spans = &spanList{start: start, end: s.pos, node: val, prev: s.spans}
+			return
+		}
+	}
+}
+
+// runNodeHooks calls the hooks with the recorded values.
+func (s *state) runNodeHooks() {
+	if len(s.p.nodeHooks) == 0 {
+		return
+	}
+
+	var nodes []*spanList
+
+	for sl := s.spans; sl != nil; sl = sl.prev {
+		if sl.node != nil && !sl.binding {
+			nodes = append(nodes, sl)
+		}
+	}
+
+	for i := len(nodes) - 1; i >= 0; i-- {
+		sl := nodes[i]
+		span := Span{Start: s.position(sl.start), End: s.position(sl.end)}
+
+		for _, h := range s.p.nodeHooks {
+			if h.matches(sl.node) {
+				h.fn(sl.node, span)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package peggysue
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type hookIdent struct {
+	Name string
+}
+
+type hookDecl struct {
+	Name  *hookIdent
+	Value int
+}
+
+type hookNode interface {
+	hookNode()
+}
+
+func (*hookIdent) hookNode() {}
+func (*hookDecl) hookNode()  {}
+
+func TestOnNode(t *testing.T) {
+	ws := Star(S(" "))
+
+	ident := Transform(Plus(Range('a', 'z')), func(s string) interface{} {
+		return &hookIdent{Name: s}
+	})
+
+	num := Transform(Plus(Range('0', '9')), func(s string) interface{} {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+
+	decl := R("decl")
+	decl.Set(Or(
+		// Abandoned when the ; is missing, after ident has produced a value.
+		Seq(S("let "), ident, S(" = "), num, S("!")),
+		Action(Seq(S("let "), Named("name", ident), S(" = "), Named("value", num), S(";")), func(v Values) interface{} {
+			return &hookDecl{Name: v.Get("name").(*hookIdent), Value: v.Get("value").(int)}
+		}),
+	))
+
+	program := Star(Seq(decl, ws))
+
+	t.Run("calls hooks for the values of the result", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New()
+
+		var (
+			idents []string
+			starts []int
+			decls  int
+		)
+
+		p.OnNode(reflect.TypeOf(&hookIdent{}), func(node interface{}, span Span) {
+			idents = append(idents, node.(*hookIdent).Name)
+			starts = append(starts, span.Start.Offset)
+		})
+
+		p.OnNode(reflect.TypeOf(&hookDecl{}), func(node interface{}, span Span) {
+			decls++
+		})
+
+		_, ok, err := p.Parse(program, "let a = 1; let bc = 2;")
+		r.NoError(err)
+		r.True(ok)
+
+		r.Equal([]string{"a", "bc"}, idents)
+		r.Equal([]int{4, 15}, starts)
+		r.Equal(2, decls)
+	})
+
+	t.Run("matches interface types in the order values are produced", func(t *testing.T) {
+		r := require.New(t)
+
+		g := NewGrammar()
+		g.Define("program", program)
+		g.Root("program")
+
+		var kinds []string
+
+		g.OnNode(reflect.TypeOf((*hookNode)(nil)).Elem(), func(node interface{}, span Span) {
+			kinds = append(kinds, reflect.TypeOf(node).Elem().Name())
+		})
+
+		_, ok, err := g.Parse("let a = 1;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]string{"hookIdent", "hookDecl"}, kinds)
+	})
+
+	t.Run("does not call hooks when the parse fails", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New()
+
+		var calls int
+		p.OnNode(reflect.TypeOf(&hookIdent{}), func(interface{}, Span) {
+			calls++
+		})
+
+		_, ok, _ := p.Parse(decl, "let a = 1")
+		r.False(ok)
+		r.Zero(calls)
+	})
+}
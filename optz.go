@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type matchScan struct {
@@ -60,12 +61,22 @@ func (m *matchString1) match(s *state) result {
 		return result{}
 	}
 
-	if s.input[s.pos] == m.b {
+	if s.input[s.pos] == m.b || (s.fold && foldByte(s.input[s.pos], m.b)) {
 		s.good(m)
 		s.advance(1, m)
 		return result{matched: true}
 	}
 
+	// A multibyte rune may fold to an ASCII letter, such as the Kelvin
+	// sign to "k".
+	if s.fold && s.input[s.pos] >= utf8.RuneSelf {
+		if n, ok := foldPrefix(s.cur(), string(m.b)); ok {
+			s.good(m)
+			s.advance(n, m)
+			return result{matched: true}
+		}
+	}
+
 	s.bad(m)
 	return result{}
 }
@@ -90,19 +101,23 @@ func (m *matchString2) match(s *state) result {
 		return result{}
 	}
 
-	if s.input[s.pos] != m.a {
-		s.bad(m)
-		return result{}
+	if (s.input[s.pos] == m.a || (s.fold && foldByte(s.input[s.pos], m.a))) &&
+		(s.input[s.pos+1] == m.b || (s.fold && foldByte(s.input[s.pos+1], m.b))) {
+		s.good(m)
+		s.advance(2, m)
+		return result{matched: true}
 	}
 
-	if s.input[s.pos+1] != m.b {
-		s.bad(m)
-		return result{}
+	if s.fold {
+		if n, ok := foldPrefix(s.cur(), string([]byte{m.a, m.b})); ok {
+			s.good(m)
+			s.advance(n, m)
+			return result{matched: true}
+		}
 	}
 
-	s.good(m)
-	s.advance(2, m)
-	return result{matched: true}
+	s.bad(m)
+	return result{}
 }
 
 func (m *matchString2) detectLeftRec(r Rule, rs ruleSet) bool {
@@ -207,7 +222,7 @@ type matchEither struct {
 func (m *matchEither) match(s *state) result {
 	save := s.mark()
 
-	res := m.a.match(s)
+	res := s.match(m.a)
 	if res.matched {
 		s.good(m)
 		return res
@@ -215,7 +230,7 @@ func (m *matchEither) match(s *state) result {
 
 	s.restore(save)
 
-	res = m.b.match(s)
+	res = s.match(m.b)
 	if res.matched {
 		s.good(m)
 		return res
@@ -265,6 +280,15 @@ func (m *matchNotByte) match(s *state) result {
 		return result{}
 	}
 
+	if s.fold {
+		if foldByte(m.b, s.input[s.pos]) {
+			return result{}
+		}
+
+		_, ok := foldPrefix(s.cur(), string(m.b))
+		return result{matched: !ok}
+	}
+
 	return result{matched: m.b != s.input[s.pos]}
 }
 
@@ -286,14 +310,14 @@ type matchBoth struct {
 func (m *matchBoth) match(s *state) result {
 	mark := s.mark()
 
-	res := m.a.match(s)
+	res := s.match(m.a)
 	if !res.matched {
 		s.restore(mark)
 		s.bad(m)
 		return result{}
 	}
 
-	res2 := m.b.match(s)
+	res2 := s.match(m.b)
 	if !res2.matched {
 		s.restore(mark)
 		s.bad(m)
@@ -342,14 +366,14 @@ type matchThree struct {
 func (m *matchThree) match(s *state) result {
 	pos := s.mark()
 
-	res := m.a.match(s)
+	res := s.match(m.a)
 	if !res.matched {
 		s.restore(pos)
 		s.bad(m)
 		return result{}
 	}
 
-	res2 := m.b.match(s)
+	res2 := s.match(m.b)
 	if !res2.matched {
 		s.restore(pos)
 		s.bad(m)
@@ -360,7 +384,7 @@ func (m *matchThree) match(s *state) result {
 		res.value = res2.value
 	}
 
-	res3 := m.c.match(s)
+	res3 := s.match(m.c)
 	if !res3.matched {
 		s.restore(pos)
 		s.bad(m)
@@ -397,3 +421,94 @@ func (m *matchThree) print() string {
 	}
 	return strings.Join(subs, " ")
 }
+
+// matchNotClass is an automatic optimization rule. It's used when Seq() is
+// passed Not(class) followed by Any(), where class is a Range, a Set, or a
+// single byte S, which is the usual way of writing a negated character
+// class such as the body of a string or comment. It consumes one rune that
+// is not in the class.
+type matchNotClass struct {
+	basicRule
+	class Rule
+}
+
+// notClass returns the lowered form of Seq(a, b) if it is a negated
+// character class followed by Any(), or nil if it isn't.
+func notClass(a, b Rule) Rule {
+	if _, ok := unchain(b).(*matchAny); !ok {
+		return nil
+	}
+
+	var class Rule
+
+	switch n := unchain(a).(type) {
+	case *matchNotByte:
+		class = &matchString1{b: n.b}
+	case *matchNot:
+		class = unchain(n.rule)
+	default:
+		return nil
+	}
+
+	switch class.(type) {
+	case *matchCharRange, *matchCharSet, *matchString1:
+		return &matchNotClass{class: class}
+	default:
+		return nil
+	}
+}
+
+func (m *matchNotClass) match(s *state) result {
+	pos := s.pos
+	if pos >= s.inputSize {
+		s.bad(m)
+		return result{}
+	}
+
+	b := s.input[pos]
+
+	var (
+		rn rune
+		sz int
+	)
+
+	if b < utf8.RuneSelf {
+		rn = rune(b)
+		sz = 1
+	} else {
+		rn, sz = utf8.DecodeRuneInString(s.cur())
+	}
+
+	var in bool
+
+	switch c := m.class.(type) {
+	case *matchCharRange:
+		in = (rn >= c.start && rn <= c.end) || ((c.fold || s.fold) && foldInRange(rn, c.start, c.end))
+	case *matchCharSet:
+		for _, mr := range c.set {
+			if rn == mr || ((c.fold || s.fold) && foldEqual(rn, mr)) {
+				in = true
+				break
+			}
+		}
+	case *matchString1:
+		in = b == c.b || (s.fold && foldEqual(rn, rune(c.b)))
+	}
+
+	if in {
+		s.bad(m)
+		return result{}
+	}
+
+	s.goodRange(m, sz)
+	s.advance(sz, m)
+	return result{matched: true}
+}
+
+func (m *matchNotClass) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchNotClass) print() string {
+	return "!" + m.class.print() + " ."
+}
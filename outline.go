@@ -0,0 +1,120 @@
+package peggysue
+
+// OutlineItem is an entry in the outline of a document, such as a function
+// or a section heading. It is returned by Outline.
+type OutlineItem struct {
+	// Rule is the name of the rule that matched the item.
+	Rule string
+
+	// Title is the text of the item's title, or empty if it has none.
+	Title string
+
+	// Span is the input covered by the item.
+	Span Span
+
+	// Children are the items nested within this one.
+	Children []*OutlineItem
+}
+
+// Outline returns the outline of the tree rooted at n, which was returned by
+// ParseTree for input. sections maps the names of the rules to include in
+// the outline to the name of the rule, within each of them, that matches
+// the item's title. For instance, {"func": "ident", "class": "ident"} would
+// outline the functions and classes of a program, nesting methods within
+// their classes, titled by their names.
+//
+// The title is the text of the first node matched by the title rule within
+// the item, outside of any nested items. If the title rule is empty, or
+// does not match, the title is empty.
+func (n *Node) Outline(input string, sections map[string]string) []*OutlineItem {
+	var (
+		items []*OutlineItem
+		stack []*OutlineItem
+	)
+
+	var visit func(n *Node)
+
+	visit = func(n *Node) {
+		var item *OutlineItem
+
+		if _, ok := sections[n.Rule]; ok && !n.IsError() {
+			item = &OutlineItem{Rule: n.Rule, Span: n.Span}
+
+			if len(stack) == 0 {
+				items = append(items, item)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, item)
+			}
+
+			stack = append(stack, item)
+		} else if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+
+			if parent.Title == "" && n.Rule != "" && n.Rule == sections[parent.Rule] {
+				parent.Title = input[n.Span.Start.Offset:n.Span.End.Offset]
+			}
+		}
+
+		for _, c := range n.Children {
+			visit(c)
+		}
+
+		if item != nil {
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	visit(n)
+
+	return items
+}
+
+// FoldingRange is a range of lines that an editor can fold away. It is
+// returned by FoldingRanges.
+type FoldingRange struct {
+	// StartLine and EndLine are the first and last lines of the range.
+	// Like the lines of Pos, they are 1-based.
+	StartLine int
+	EndLine   int
+
+	// Rule is the name of the rule of the outline item.
+	Rule string
+}
+
+// FoldingRanges returns the ranges of lines covered by the outline items,
+// and the items nested within them, that span more than one line. They are
+// ordered by their first line.
+//
+// An item that ends at the start of a line, after a line terminator that it
+// matched, is considered to end on the line before.
+func FoldingRanges(items []*OutlineItem) []FoldingRange {
+	var ranges []FoldingRange
+
+	var visit func(items []*OutlineItem)
+
+	visit = func(items []*OutlineItem) {
+		for _, item := range items {
+			start, end := item.Span.Start, item.Span.End
+
+			endLine := end.Line
+			if end.Column == 1 && end.Line > start.Line {
+				endLine--
+			}
+
+			if endLine > start.Line {
+				ranges = append(ranges, FoldingRange{
+					StartLine: start.Line,
+					EndLine:   endLine,
+					Rule:      item.Rule,
+				})
+			}
+
+			visit(item.Children)
+		}
+	}
+
+	visit(items)
+
+	return ranges
+}
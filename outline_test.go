@@ -0,0 +1,89 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutline(t *testing.T) {
+	ws := Star(Set(' ', '\n'))
+
+	ident := R("ident")
+	ident.Set(Seq(Plus(Range('a', 'z')), ws))
+
+	stmt := R("stmt")
+	stmt.Set(Seq(ident, S(";"), ws))
+
+	fn := R("func")
+	fn.Set(Seq(S("fn"), ws, ident, S("{"), ws, Star(stmt), S("}"), ws))
+
+	class := R("class")
+	class.Set(Seq(S("class"), ws, ident, S("{"), ws, Star(Or(fn, stmt)), S("}"), ws))
+
+	program := Seq(ws, Star(Or(class, fn)), EOS())
+
+	input := "class point {\n  x;\n  fn len {\n    y;\n  }\n}\nfn main { z; }\n"
+
+	sections := map[string]string{"class": "ident", "func": "ident"}
+
+	t.Run("outlines the document", func(t *testing.T) {
+		r := require.New(t)
+
+		root := New().ParseTree(program, input)
+		r.Empty(root.Errors())
+
+		items := root.Outline(input, sections)
+		r.Len(items, 2)
+
+		r.Equal("class", items[0].Rule)
+		r.Equal("point ", items[0].Title)
+		r.Len(items[0].Children, 1)
+		r.Equal("func", items[0].Children[0].Rule)
+		r.Equal("len ", items[0].Children[0].Title)
+
+		r.Equal("func", items[1].Rule)
+		r.Equal("main ", items[1].Title)
+		r.Empty(items[1].Children)
+		r.Equal(7, items[1].Span.Start.Line)
+	})
+
+	t.Run("returns folding ranges", func(t *testing.T) {
+		r := require.New(t)
+
+		root := New().ParseTree(program, input)
+
+		r.Equal([]FoldingRange{
+			{StartLine: 1, EndLine: 6, Rule: "class"},
+			{StartLine: 3, EndLine: 5, Rule: "func"},
+		}, FoldingRanges(root.Outline(input, sections)))
+	})
+
+	t.Run("leaves the title empty without a title rule", func(t *testing.T) {
+		r := require.New(t)
+
+		root := New().ParseTree(program, input)
+
+		items := root.Outline(input, map[string]string{"func": ""})
+		r.Len(items, 2)
+		r.Equal("", items[0].Title)
+	})
+
+	t.Run("walks the tree", func(t *testing.T) {
+		r := require.New(t)
+
+		root := New().ParseTree(program, input)
+
+		var names []string
+		root.Walk(func(n *Node) bool {
+			if n.Rule == "ident" {
+				names = append(names, input[n.Span.Start.Offset:n.Span.End.Offset])
+			}
+
+			// Skip the contents of functions.
+			return n.Rule != "func"
+		})
+
+		r.Equal([]string{"point ", "x"}, names)
+	})
+}
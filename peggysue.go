@@ -6,9 +6,11 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"unicode/utf8"
 
 	"github.com/hashicorp/go-hclog"
@@ -121,10 +123,6 @@ type matchString struct {
 
 func (m *matchString) match(s *state) result {
 	sz := len(m.str)
-	if sz > len(s.cur()) {
-		s.bad(m)
-		return result{}
-	}
 
 	if strings.HasPrefix(s.cur(), m.str) {
 		s.goodRange(m, sz)
@@ -132,6 +130,14 @@ func (m *matchString) match(s *state) result {
 		return result{matched: true}
 	}
 
+	if s.fold {
+		if n, ok := foldPrefix(s.cur(), m.str); ok {
+			s.goodRange(m, n)
+			s.advance(n, m)
+			return result{matched: true}
+		}
+	}
+
 	s.bad(m)
 	return result{}
 }
@@ -144,7 +150,9 @@ func (m *matchString) print() string {
 	return strconv.Quote(m.str)
 }
 
-// S returns a Rule that will match a literal string exactly.
+// S returns a Rule that will match a literal string exactly. When the
+// parser is created with WithCaseInsensitive, the string is matched
+// regardless of case.
 //
 // The value of the match is nil.
 func S(str string) Rule {
@@ -199,6 +207,7 @@ func Re(re string) Rule {
 type matchCharRange struct {
 	basicRule
 	start, end rune
+	fold       bool
 }
 
 func (m *matchCharRange) match(s *state) result {
@@ -222,7 +231,7 @@ func (m *matchCharRange) match(s *state) result {
 		rn, sz = utf8.DecodeRuneInString(s.cur())
 	}
 
-	if rn < m.start || rn > m.end {
+	if (rn < m.start || rn > m.end) && !((m.fold || s.fold) && foldInRange(rn, m.start, m.end)) {
 		s.bad(m)
 		return result{}
 	}
@@ -237,13 +246,18 @@ func (m *matchCharRange) detectLeftRec(r Rule, rs ruleSet) bool {
 }
 
 func (m *matchCharRange) print() string {
+	if m.fold {
+		return fmt.Sprintf("[%c-%c]i", m.start, m.end)
+	}
+
 	return fmt.Sprintf("[%c-%c]", m.start, m.end)
 }
 
 // Range returns a rule that will match the next rune in the input
 // stream as being at least 'start', and at most 'end'. This corresponds
 // with the regexp pattern `[A-Z]` but is much faster as it does not require
-// any regexp tracking.
+// any regexp tracking. When the parser is created with WithCaseInsensitive,
+// runes are matched regardless of case.
 //
 // The value of the match is nil.
 func Range(start, end rune) Rule {
@@ -253,9 +267,23 @@ func Range(start, end rune) Rule {
 	}
 }
 
+// RangeFold is like Range, but also matches runes that are equivalent
+// under Unicode simple case folding to a rune between 'start' and 'end'.
+// For instance, RangeFold('a', 'z') matches both "q" and "Q".
+//
+// The value of the match is nil.
+func RangeFold(start, end rune) Rule {
+	return &matchCharRange{
+		start: start,
+		end:   end,
+		fold:  true,
+	}
+}
+
 type matchCharSet struct {
 	basicRule
-	set []rune
+	set  []rune
+	fold bool
 }
 
 func (m *matchCharSet) match(s *state) result {
@@ -280,7 +308,7 @@ func (m *matchCharSet) match(s *state) result {
 	}
 
 	for _, mr := range m.set {
-		if rn == mr {
+		if rn == mr || ((m.fold || s.fold) && foldEqual(rn, mr)) {
 			s.good(m)
 			s.advance(sz, m)
 			return result{matched: true}
@@ -302,13 +330,19 @@ func (m *matchCharSet) print() string {
 		strs = append(strs, fmt.Sprintf("%q", r))
 
 	}
+
+	if m.fold {
+		return "{" + strings.Join(strs, ",") + "}i"
+	}
+
 	return "{" + strings.Join(strs, ",") + "}"
 }
 
 // Set returns a rule that will match the next rune in the input
 // stream as one of the given runes. This corresponds
 // with the regexp pattern `[abc]` but is much faster as it does not require
-// any regexp tracking.
+// any regexp tracking. When the parser is created with WithCaseInsensitive,
+// runes are matched regardless of case.
 //
 // The value of the match is nil.
 func Set(runes ...rune) Rule {
@@ -317,6 +351,18 @@ func Set(runes ...rune) Rule {
 	}
 }
 
+// SetFold is like Set, but also matches runes that are equivalent under
+// Unicode simple case folding to one of the given runes. For instance,
+// SetFold('e') matches both "e" and "E".
+//
+// The value of the match is nil.
+func SetFold(runes ...rune) Rule {
+	return &matchCharSet{
+		set:  runes,
+		fold: true,
+	}
+}
+
 type matchRunePredicate struct {
 	basicRule
 	fn func(r rune) bool
@@ -437,26 +483,41 @@ func Or(rules ...Rule) Rule {
 type branch struct {
 	name string
 	r    Rule
+
+	// leftAssoc is set for a branch added with AddAssoc and AssocLeft.
+	leftAssoc bool
 }
 
 type matchBranch struct {
 	basicRule
-	rules []branch
-	ref   Ref
+	rules  []branch
+	ref    Ref
+	levels []level
 }
 
 func (m *matchBranch) match(s *state) result {
 	save := s.mark()
 
 	rs := s.refStack
+	assocRef, assocPos := s.assocRef, s.assocPos
 
 	defer func() {
 		s.refStack = rs
+		s.assocRef, s.assocPos = assocRef, assocPos
 	}()
 
 	for _, r := range m.rules {
 		s.refStack = append(rs, r.name)
 
+		// Within a left associative branch, the ref that invoked the
+		// branches only matches its seed after the start of the branch,
+		// see matchRef.matchSeed.
+		if r.leftAssoc {
+			s.assocRef, s.assocPos = s.curRef, save.pos
+		} else {
+			s.assocRef = nil
+		}
+
 		res := s.match(r.r)
 		if res.matched {
 			s.good(m)
@@ -498,7 +559,19 @@ func (m *matchBranch) print() string {
 }
 
 func (m *matchBranch) Add(name string, r Rule) Rule {
-	m.rules = append(m.rules, branch{"+" + name, r})
+	m.rules = append(m.rules, branch{name: "+" + name, r: r})
+
+	return r
+}
+
+func (m *matchBranch) AddAssoc(name string, assoc Assoc, r Rule) Rule {
+	switch assoc {
+	case AssocLeft, AssocRight:
+	default:
+		panic(fmt.Sprintf("branch %s must be left or right associative", name))
+	}
+
+	m.rules = append(m.rules, branch{name: "+" + name, r: r, leftAssoc: assoc == AssocLeft})
 
 	return r
 }
@@ -507,9 +580,179 @@ func (m *matchBranch) Ref() Ref {
 	return m.ref
 }
 
+func (m *matchBranch) AddLevel(prec int, assoc Assoc, op Rule) {
+	m.levels = append(m.levels, level{prec: prec, assoc: assoc, op: op})
+}
+
+func (m *matchBranch) AddPrec(name string, prec int, assoc Assoc, branch func(lhs, rhs Rule) Rule) {
+	m.levels = append(m.levels, level{prec: prec, assoc: assoc, name: name, build: branch})
+}
+
+// Assoc is the associativity of the operators in a precedence level.
+type Assoc int
+
+const (
+	// AssocLeft groups a chain of operators from the left, so "1-2-3"
+	// is "(1-2)-3".
+	AssocLeft Assoc = iota
+
+	// AssocRight groups a chain of operators from the right, so "1^2^3"
+	// is "1^(2^3)".
+	AssocRight
+
+	// AssocNone allows only a single operator. The operator is not
+	// matched when another follows its right operand, so in "1<2<3" only
+	// "1" is matched, and the rest of the input is left unconsumed.
+	AssocNone
+)
+
+// BinaryOp is the value of an operator matched by a precedence level
+// declared with BranchesBuilder.AddLevel.
+type BinaryOp struct {
+	// LHS and RHS are the values of the operands.
+	LHS interface{}
+	RHS interface{}
+
+	// Op is the value of the level's operator rule.
+	Op interface{}
+}
+
+// level is a precedence level declared with AddLevel, which has op set, or
+// a branch declared with AddPrec, which has name and build set.
+type level struct {
+	prec  int
+	assoc Assoc
+	op    Rule
+
+	name  string
+	build func(lhs, rhs Rule) Rule
+}
+
+// buildLevels sets m.ref to the lowest precedence level, where each level is
+// a Ref whose operands are the next higher level, and the operands of the
+// highest level are the branches.
+func (m *matchBranch) buildLevels(name string) {
+	levels := append([]level(nil), m.levels...)
+
+	sort.SliceStable(levels, func(i, j int) bool {
+		return levels[i].prec < levels[j].prec
+	})
+
+	next := R(name + "-operand")
+	next.Set(m)
+
+	for end := len(levels); end > 0; {
+		start := end - 1
+		for start > 0 && levels[start-1].prec == levels[end-1].prec {
+			start--
+		}
+
+		var lvl Ref
+
+		if start == 0 {
+			lvl = m.ref
+		} else {
+			lvl = R(fmt.Sprintf("%s-%d", name, levels[start].prec))
+		}
+
+		lhs, rhs := Rule(next), Rule(next)
+
+		switch levels[start].assoc {
+		case AssocLeft:
+			lhs = lvl
+		case AssocRight:
+			rhs = lvl
+		}
+
+		// The operators declared with AddLevel are matched by a single
+		// alternative, placed where the first of them was declared.
+		var (
+			alts  []Rule
+			ops   []Rule
+			opsAt = -1
+		)
+
+		for _, l := range levels[start:end] {
+			if l.assoc != levels[start].assoc {
+				panic(fmt.Sprintf("conflicting associativity in precedence level %d of %s", l.prec, name))
+			}
+
+			if l.build != nil {
+				alts = append(alts, l.build(lhs, rhs))
+				continue
+			}
+
+			if opsAt == -1 {
+				opsAt = len(alts)
+				alts = append(alts, nil)
+			}
+
+			ops = append(ops, l.op)
+		}
+
+		if opsAt != -1 {
+			seq := []Rule{Named("lhs", lhs), Named("op", Or(ops...)), Named("rhs", rhs)}
+
+			if levels[start].assoc == AssocNone {
+				seq = append(seq, Or(EOS(), Not(Or(ops...))))
+			}
+
+			alts[opsAt] = Action(
+				Seq(seq...),
+				func(v Values) interface{} {
+					return BinaryOp{LHS: v.Get("lhs"), Op: v.Get("op"), RHS: v.Get("rhs")}
+				},
+			)
+		}
+
+		lvl.Set(Or(append(alts, next)...))
+
+		next = lvl
+		end = start
+	}
+}
+
 type BranchesBuilder interface {
 	// Add another branch
 	Add(name string, branch Rule) Rule
+
+	// AddAssoc adds a branch that is an operator on the rule passed to the
+	// Branches function, such as Seq(e, S("-"), e), with the given
+	// associativity, which must be AssocLeft or AssocRight. Left
+	// recursion grows a chain of such operators from the right, so a
+	// branch added with Add is right associative, and "1=2=3" is
+	// "1=(2=3)". For a left associative branch, the rule only matches a
+	// single operand, without growing, when it is used after the start of
+	// the branch, so "1-2-3" is "(1-2)-3". Operands nested within other
+	// branches, such as parentheses, still match any expression.
+	//
+	// Associativity only applies to Branches without precedence levels,
+	// whose branches are all at the same precedence. Use AddPrec to
+	// combine the two.
+	AddAssoc(name string, assoc Assoc, branch Rule) Rule
+
+	// AddLevel declares a precedence level of binary operators, matched by
+	// op, whose operands are higher precedence levels or, for the highest
+	// level, the branches. Levels with a larger prec bind more tightly.
+	// Multiple calls with the same prec add operators to the same level,
+	// and must use the same assoc. The value of an operator is a BinaryOp.
+	AddLevel(prec int, assoc Assoc, op Rule)
+
+	// AddPrec adds a branch to the precedence level prec, so that a single
+	// Branches can describe a whole precedence tower, including prefix,
+	// postfix, and other operators that AddLevel can't. branch is called
+	// with the rules to use for the operands: lhs for an operand that
+	// begins the branch, and rhs for one that ends it. Depending on assoc,
+	// they are this level or the next higher one, so a left associative
+	// subtraction is Seq(lhs, S("-"), rhs), a right associative prefix
+	// negation is Seq(S("-"), rhs), and a postfix call is Seq(lhs, args).
+	// Operands elsewhere, such as within brackets, should use the rule
+	// passed to the Branches function, which matches any expression.
+	//
+	// Levels are shared with AddLevel, and the branches of a level are
+	// tried in the order they were added. The value of the branch is the
+	// value of the rule that branch returns.
+	AddPrec(name string, prec int, assoc Assoc, branch func(lhs, rhs Rule) Rule)
 }
 
 // Or returns a Rule that will try each of the given rules, completing when
@@ -524,6 +767,11 @@ func Branches(name string, f func(b BranchesBuilder, r Rule)) Rule {
 
 	f(mb, mb.ref)
 
+	if len(mb.levels) > 0 {
+		mb.buildLevels(name)
+		return mb.ref
+	}
+
 	mb.ref.Set(mb)
 
 	return mb.ref
@@ -590,6 +838,9 @@ func Seq(rules ...Rule) Rule {
 	case 1:
 		return rules[0]
 	case 2:
+		if r := notClass(rules[0], rules[1]); r != nil {
+			return r
+		}
 		return &matchBoth{a: rules[0], b: rules[1]}
 	case 3:
 		return &matchThree{a: rules[0], b: rules[1], c: rules[2]}
@@ -598,6 +849,96 @@ func Seq(rules ...Rule) Rule {
 	}
 }
 
+// SeqWS returns a rule like Seq, but that also matches skip between each of
+// the given rules, such as to allow white space between the tokens of a
+// statement without a separate rule for each. skip is optional and is not
+// matched before the first rule, after the last, or within the rules
+// themselves, so it only applies where it is asked for.
+//
+// The value of the match is the value of the right most sub-rule that
+// produced a non-nil value, so skip should not produce one.
+func SeqWS(skip Rule, rules ...Rule) Rule {
+	if len(rules) < 2 {
+		return Seq(rules...)
+	}
+
+	opt := Maybe(skip)
+
+	seq := make([]Rule, 0, len(rules)*2-1)
+
+	for i, r := range rules {
+		if i > 0 {
+			seq = append(seq, opt)
+		}
+
+		seq = append(seq, r)
+	}
+
+	return Seq(seq...)
+}
+
+type matchSeqAll struct {
+	basicRule
+	rules []Rule
+}
+
+func (m *matchSeqAll) match(s *state) result {
+	mark := s.mark()
+
+	values := make([]interface{}, len(m.rules))
+
+	for i, r := range m.rules {
+		res := s.match(r)
+		if !res.matched {
+			s.restore(mark)
+			s.bad(m)
+			return result{}
+		}
+
+		values[i] = res.value
+	}
+
+	s.good(m)
+	return result{value: values, matched: true}
+}
+
+func (m *matchSeqAll) detectLeftRec(r Rule, rs ruleSet) bool {
+	sub := m.rules[0]
+
+	if !rs.Add(sub) {
+		return false
+	}
+
+	if sub == r {
+		return true
+	}
+
+	return sub.detectLeftRec(r, rs)
+}
+
+func (m *matchSeqAll) print() string {
+	var subs []string
+
+	for _, r := range m.rules {
+		subs = append(subs, Print(r))
+	}
+	return strings.Join(subs, " ")
+}
+
+// SeqAll returns a rule that will attempt to match each of the given rules
+// in order, just like Seq. Rather than only passing up the right most value,
+// it collects the value of every sub-rule.
+//
+// The value of the match is a []interface{} containing the value of each
+// sub-rule, in order, including nil values.
+func SeqAll(rules ...Rule) Rule {
+	if len(rules) == 0 {
+		panic("SeqAll requires at least one rule")
+	}
+
+	return &matchSeqAll{rules: rules}
+}
+
 type matchCount struct {
 	basicRule
 	rule Rule
@@ -650,12 +991,17 @@ type matchZeroOrMore struct {
 }
 
 func (m *matchZeroOrMore) match(s *state) result {
+	check := s.p.progressCheck
 
 	for {
 		mark := s.mark()
 
 		res := s.match(m.rule)
 		if res.matched {
+			if check && s.pos == mark.pos {
+				s.noProgress(m, mark.pos)
+			}
+
 			continue
 		}
 
@@ -684,7 +1030,8 @@ func (m *matchZeroOrMore) print() string {
 // PEGs.
 //
 // The value of the match is the value of the last iteration of applying
-// the sub rule.
+// the sub rule. Use StarCapture or Collect to obtain the values of all
+// iterations.
 func Star(rule Rule) Rule {
 	return &matchZeroOrMore{rule: rule}
 }
@@ -704,12 +1051,21 @@ func (m *matchOneOrMore) match(s *state) result {
 	}
 
 	val := res.value
+	check := s.p.progressCheck
+
+	if check && s.pos == mark.pos {
+		s.noProgress(m, mark.pos)
+	}
 
 	for {
 		mark := s.mark()
 
 		res := s.match(m.rule)
 		if res.matched {
+			if check && s.pos == mark.pos {
+				s.noProgress(m, mark.pos)
+			}
+
 			val = res.value
 			continue
 		}
@@ -729,7 +1085,7 @@ func (m *matchOneOrMore) detectLeftRec(r Rule, rs ruleSet) bool {
 }
 
 func addParens(r Rule) string {
-	switch r.(type) {
+	switch unchain(r).(type) {
 	case *matchOr, *matchSeq:
 		return "(" + Print(r) + ")"
 	default:
@@ -747,7 +1103,8 @@ func (m *matchOneOrMore) print() string {
 // most PEGs.
 //
 // The value of the match is the value of the last successful match of
-// the sub-rule
+// the sub-rule. Use PlusCapture or Collect to obtain the values of all
+// iterations.
 func Plus(rule Rule) Rule {
 	return &matchOneOrMore{rule: rule}
 }
@@ -784,6 +1141,10 @@ func (m *matchMany) match(s *state) result {
 
 		}
 
+		if s.p.progressCheck && s.pos == mark.pos && m.max == -1 {
+			s.noProgress(m, mark.pos)
+		}
+
 		results = append(results, res.value)
 
 		if m.max != -1 && len(results) == m.max {
@@ -848,103 +1209,129 @@ func copyGroup(values []interface{}) interface{} {
 	return slices.Clone(values)
 }
 
+// PlusCapture returns a rule that matches it's given rule one or more times,
+// like Plus.
+//
+// The value of the match is a []interface{} of the value of each iteration.
 func PlusCapture(rule Rule) Rule {
 	return Many(rule, 1, -1, copyGroup)
 }
 
-type matchOptional struct {
-	basicRule
-	rule Rule
+// StarCapture returns a rule that matches it's given rule zero or more times,
+// like Star.
+//
+// The value of the match is a []interface{} of the value of each iteration.
+func StarCapture(rule Rule) Rule {
+	return Many(rule, 0, -1, copyGroup)
 }
 
-func (m *matchOptional) match(s *state) result {
-	mark := s.mark()
-
-	res := s.match(m.rule)
-
-	if !res.matched {
-		s.restore(mark)
-	}
-
-	res.matched = true
+// Times returns a rule that matches it's given rule exactly `n` times,
+// such as the 4 hex digits of a unicode escape. It is the same as Count,
+// but gathers the values of all iterations.
+//
+// The value of the match is a []interface{} of the value of each iteration.
+func Times(rule Rule, n int) Rule {
+	return Many(rule, n, n, copyGroup)
+}
 
-	return s.check(m, res)
+// TimesRange returns a rule that matches it's given rule at least `min`
+// times and at most `max` times, like Many. If max is -1, there is no
+// maximum.
+//
+// The value of the match is a []interface{} of the value of each iteration.
+func TimesRange(rule Rule, min, max int) Rule {
+	return Many(rule, min, max, copyGroup)
 }
 
-func (m *matchOptional) detectLeftRec(r Rule, rs ruleSet) bool {
-	if !rs.Add(m.rule) {
-		return false
+// Collect converts a repetition rule (as created by Star, Plus, Count, or Many)
+// into one that gathers the values of all iterations rather than returning only
+// the value of the last one. Because the values are copied, they are safe to
+// retain. Collect panics if given any other kind of rule.
+//
+// The value of the match is a []interface{} of the value of each iteration.
+func Collect(rule Rule) Rule {
+	var r Rule
+
+	switch sv := unchain(rule).(type) {
+	case *matchZeroOrMore:
+		r = Many(sv.rule, 0, -1, copyGroup)
+	case *matchOneOrMore:
+		r = Many(sv.rule, 1, -1, copyGroup)
+	case *matchCount:
+		r = Many(sv.rule, sv.num, sv.num, copyGroup)
+	case *matchMany:
+		r = Many(sv.rule, sv.min, sv.max, copyGroup)
+	default:
+		panic("Collect must be passed a repetition rule")
 	}
 
-	return m.rule == r || m.rule.detectLeftRec(r, rs)
-}
-
-func (m *matchOptional) print() string {
-	return Print(m.rule) + "?"
-}
+	r.SetName(rule.Name())
 
-// Maybe returns a rule that will allow it's rule to match, but
-// will always return that it's successfully matched, regardless
-// of what it's rule does. This corresponds with the question mark
-// rule ("e?") in most PEGs.
-//
-// The value of the match is the value of the sub-rule.
-func Maybe(rule Rule) Rule {
-	return &matchOptional{rule: rule}
+	return r
 }
 
-type matchCheck struct {
+type matchSepBy struct {
 	basicRule
-	rule Rule
+	rule     Rule
+	sep      Rule
+	min, max int
+	fn       func([]interface{}) interface{}
 }
 
-func (m *matchCheck) match(s *state) result {
-	defer s.restore(s.mark())
+func (m *matchSepBy) match(s *state) result {
+	var results []interface{}
 
-	return s.check(m, s.match(m.rule))
-}
+	top := s.mark()
 
-func (m *matchCheck) detectLeftRec(r Rule, rs ruleSet) bool {
-	if !rs.Add(m.rule) {
-		return false
-	}
+	res := s.match(m.rule)
+	if res.matched {
+		results = append(results, res.value)
 
-	return m.rule == r || m.rule.detectLeftRec(r, rs)
-}
+		for m.max == -1 || len(results) < m.max {
+			mark := s.mark()
 
-func (m *matchCheck) print() string {
-	return "&" + Print(m.rule)
-}
+			if !s.match(m.sep).matched {
+				s.restore(mark)
+				break
+			}
 
-// Check returns a rule that will attempt to match it's given rule
-// and returns it's given rules match result, but it does not consume
-// an input on the stream. This corresponds with the and-predicate ("&e") in
-// most PEGs.
-//
-// The value of the match is the value of the sub-rule.
-func Check(rule Rule) Rule {
-	return &matchCheck{rule: rule}
-}
+			res := s.match(m.rule)
+			if !res.matched {
+				s.restore(mark)
+				break
+			}
 
-type matchNot struct {
-	basicRule
-	rule Rule
-}
+			results = append(results, res.value)
 
-func (m *matchNot) match(s *state) result {
-	defer s.restore(s.mark())
+			// Guard against a separator and rule that both match without
+			// consuming any input, which would otherwise loop forever.
+			if s.pos == mark.pos {
+				if s.p.progressCheck {
+					s.noProgress(m, mark.pos)
+				}
 
-	if s.pos >= len(s.input) {
+				break
+			}
+		}
+	}
+
+	if len(results) < m.min {
+		s.restore(top)
+		s.bad(m)
 		return result{}
 	}
 
-	res := s.match(m.rule)
-	res.matched = !res.matched
+	var val interface{} = results
 
-	return s.check(m, res)
+	if m.fn != nil {
+		val = m.fn(results)
+	}
+
+	s.good(m)
+	return result{value: val, matched: true}
 }
 
-func (m *matchNot) detectLeftRec(r Rule, rs ruleSet) bool {
+func (m *matchSepBy) detectLeftRec(r Rule, rs ruleSet) bool {
 	if !rs.Add(m.rule) {
 		return false
 	}
@@ -952,11 +1339,280 @@ func (m *matchNot) detectLeftRec(r Rule, rs ruleSet) bool {
 	return m.rule == r || m.rule.detectLeftRec(r, rs)
 }
 
-func (m *matchNot) print() string {
-	return "!" + Print(m.rule)
+func (m *matchSepBy) print() string {
+	return sepByString(Print(m.rule), Print(m.sep), m.min, m.max)
 }
 
-// Not returns a rule that will attempt to match it's given rule.
+// sepByString describes a separated repetition of rule in terms of
+// sequences and bounded repetitions.
+func sepByString(rule, sep string, min, max int) string {
+	lo, hi := min-1, max-1
+	if lo < 0 {
+		lo = 0
+	}
+	if max == -1 {
+		hi = -1
+	}
+
+	rest := fmt.Sprintf("(%s %s)", sep, rule)
+
+	switch {
+	case lo == 0 && hi == -1:
+		rest += "*"
+	case lo == 1 && hi == -1:
+		rest += "+"
+	default:
+		rest += fmt.Sprintf("[%d,%d]", lo, hi)
+	}
+
+	if min == 0 {
+		return fmt.Sprintf("(%s %s)?", rule, rest)
+	}
+
+	return rule + " " + rest
+}
+
+// SepBy returns a rule that matches zero or more of it's given rule, each
+// separated by sep, such as the arguments of a function call. A trailing
+// separator is not consumed.
+//
+// The value of the match is a []interface{} of the value of each rule match.
+// The values of sep are discarded.
+func SepBy(rule, sep Rule) Rule {
+	return &matchSepBy{rule: rule, sep: sep, max: -1}
+}
+
+// ManySep is like SepBy, but matches it's given rule at least `min` times
+// and at most `max` times, like Many. If max is -1, there is no maximum.
+// Once max matches have been made, no further separator is consumed. If
+// `fn` is not nil, it is called with the values of each rule match. Unlike
+// Many, the values slice is not reused and may be retained.
+//
+// ManySep panics if max is not -1 and is less than 1 or less than min.
+//
+// The value of the match is the return value of `fn` or, if `fn` is nil,
+// a []interface{} of the value of each rule match. The values of sep are
+// discarded.
+func ManySep(rule, sep Rule, min, max int, fn func(values []interface{}) interface{}) Rule {
+	if max != -1 && (max < 1 || max < min) {
+		panic(fmt.Sprintf("invalid ManySep bounds: min %d, max %d", min, max))
+	}
+
+	return &matchSepBy{rule: rule, sep: sep, min: min, max: max, fn: fn}
+}
+
+type matchFold struct {
+	basicRule
+	seed    func() interface{}
+	rule    Rule
+	combine func(acc, v interface{}) interface{}
+}
+
+func (m *matchFold) match(s *state) result {
+	acc := m.seed()
+
+	for {
+		mark := s.mark()
+
+		res := s.match(m.rule)
+		if !res.matched {
+			s.restore(mark)
+			break
+		}
+
+		acc = m.combine(acc, res.value)
+
+		// Guard against rules that match without consuming any input,
+		// which would otherwise loop forever.
+		if s.pos == mark.pos {
+			if s.p.progressCheck {
+				s.noProgress(m, mark.pos)
+			}
+
+			break
+		}
+	}
+
+	s.good(m)
+	return result{value: acc, matched: true}
+}
+
+func (m *matchFold) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchFold) print() string {
+	return addParens(m.rule) + "*"
+}
+
+// Fold returns a rule that matches it's given rule zero or more times, like
+// Star. Before the first iteration, seed is called to create the initial
+// accumulator. Each time the rule matches, combine is called with the current
+// accumulator and the rule's value, and it's return value becomes the new
+// accumulator. This allows values to be built up as the input is matched,
+// rather than gathering them into a slice first as Many does.
+//
+// The value of the match is the final accumulator.
+func Fold(seed func() interface{}, rule Rule, combine func(acc, v interface{}) interface{}) Rule {
+	return &matchFold{seed: seed, rule: rule, combine: combine}
+}
+
+type matchOptional struct {
+	basicRule
+	rule Rule
+}
+
+func (m *matchOptional) match(s *state) result {
+	mark := s.mark()
+
+	res := s.match(m.rule)
+
+	if !res.matched {
+		s.restore(mark)
+	}
+
+	res.matched = true
+
+	return s.check(m, res)
+}
+
+func (m *matchOptional) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchOptional) print() string {
+	return Print(m.rule) + "?"
+}
+
+// Maybe returns a rule that will allow it's rule to match, but
+// will always return that it's successfully matched, regardless
+// of what it's rule does. This corresponds with the question mark
+// rule ("e?") in most PEGs.
+//
+// The value of the match is the value of the sub-rule.
+func Maybe(rule Rule) Rule {
+	return &matchOptional{rule: rule}
+}
+
+// Optional is the value produced by MaybeValue. It allows actions to
+// distinguish between a sub-rule that matched and produced nil, and a
+// sub-rule that did not match at all.
+type Optional struct {
+	Value   interface{}
+	Matched bool
+}
+
+type matchMaybeValue struct {
+	basicRule
+	rule Rule
+}
+
+func (m *matchMaybeValue) match(s *state) result {
+	mark := s.mark()
+
+	res := s.match(m.rule)
+	if !res.matched {
+		s.restore(mark)
+		return s.check(m, result{value: Optional{}, matched: true})
+	}
+
+	return s.check(m, result{value: Optional{Value: res.value, Matched: true}, matched: true})
+}
+
+func (m *matchMaybeValue) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchMaybeValue) print() string {
+	return Print(m.rule) + "?"
+}
+
+// MaybeValue is like Maybe, but rather than passing through the value of
+// it's rule, the value records if the rule matched at all. This is useful
+// for optional parts of a rule, like a sign or an else branch, where the
+// action needs to know if the part was present.
+//
+// The value of the match is an Optional.
+func MaybeValue(rule Rule) Rule {
+	return &matchMaybeValue{rule: rule}
+}
+
+type matchCheck struct {
+	basicRule
+	rule Rule
+}
+
+func (m *matchCheck) match(s *state) result {
+	defer s.restore(s.mark())
+
+	return s.check(m, s.match(m.rule))
+}
+
+func (m *matchCheck) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchCheck) print() string {
+	return "&" + Print(m.rule)
+}
+
+// Check returns a rule that will attempt to match it's given rule
+// and returns it's given rules match result, but it does not consume
+// an input on the stream. This corresponds with the and-predicate ("&e") in
+// most PEGs.
+//
+// The value of the match is the value of the sub-rule.
+func Check(rule Rule) Rule {
+	return &matchCheck{rule: rule}
+}
+
+type matchNot struct {
+	basicRule
+	rule Rule
+}
+
+func (m *matchNot) match(s *state) result {
+	defer s.restore(s.mark())
+
+	if s.pos >= len(s.input) {
+		return result{}
+	}
+
+	res := s.match(m.rule)
+	res.matched = !res.matched
+
+	return s.check(m, res)
+}
+
+func (m *matchNot) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchNot) print() string {
+	return "!" + Print(m.rule)
+}
+
+// Not returns a rule that will attempt to match it's given rule.
 // If the rule matches, it returns that it did not match (inverting
 // the match result). Regardless of matching, it does not consume any
 // input on the stream. This corresponds with the not-predicate ("!e") in
@@ -992,9 +1648,20 @@ type Ref interface {
 
 type matchRef struct {
 	basicRule
-	name    string
-	rule    Rule
-	leftRec bool
+	rule Rule
+
+	// leftRec is set if the ref grows its match as a left recursive rule,
+	// and leftRecMember if it is only part of a cycle of left recursion
+	// that another ref grows. See analyzeLeftRec.
+	leftRec       bool
+	leftRecMember bool
+
+	// order is the order the ref was set in, relative to all other refs.
+	order uint64
+
+	// analyzed is set atomically once the left recursion analysis has
+	// been done.
+	analyzed uint32
 }
 
 func (r *matchRef) Set(rule Rule) {
@@ -1004,6 +1671,8 @@ func (r *matchRef) Set(rule Rule) {
 		panic(fmt.Sprintf("rule already set: %s", r.name))
 	}
 
+	rule = unchain(rule)
+
 	// When invoking a ref, introduce a new scope since this matches the
 	// semantics of all parsers, where within a single named rule, there
 	// is a unique scope of produced values from it's parts.
@@ -1012,21 +1681,12 @@ func (r *matchRef) Set(rule Rule) {
 	}
 
 	r.rule = rule
-
-	rs := make(ruleSet)
-
-	if rule == r {
-		r.leftRec = true
-	} else {
-		rs.Add(rule)
-		if rule.detectLeftRec(r, rs) {
-			r.leftRec = true
-		}
-	}
+	r.order = atomic.AddUint64(&refOrder, 1)
 }
 
 func (r *matchRef) LeftRecursive() bool {
-	return r.leftRec
+	r.analyzeLeftRec()
+	return r.leftRec || r.leftRecMember
 }
 
 func (m *matchRef) match(s *state) result {
@@ -1034,12 +1694,49 @@ func (m *matchRef) match(s *state) result {
 		panic(fmt.Sprintf("unset ref detected: %s", m.name))
 	}
 
+	if atomic.LoadUint32(&m.analyzed) == 0 {
+		m.analyzeLeftRec()
+	}
+
+	start := s.pos
+
+	var res result
+
+	if s.p.tracer != nil {
+		res = m.matchTraced(s)
+	} else {
+		res = m.matchMemo(s)
+	}
+
+	if s.recordRef != nil && res.matched {
+		s.recordSpan(m, start)
+	}
+
+	return res
+}
+
+func (m *matchRef) matchMemo(s *state) result {
+
 	cur := s.curRef
 	defer func() {
 		s.curRef = cur
+		s.depth--
 	}()
 
 	s.curRef = m
+	s.depth++
+
+	if limit := s.p.recursionLimit; limit > 0 && s.depth > limit {
+		s.abort(&RecursionLimitError{
+			Limit: limit,
+			Pos:   s.position(s.pos),
+			Rule:  m.Name(),
+		})
+	}
+
+	if s.noMemo && !m.leftRec {
+		return s.check(m, s.match(m.rule))
+	}
 
 	// The memoization code was ported from
 	// https://github.com/we-like-parsers/pegen_experiments/blob/master/story7/memo.py
@@ -1049,15 +1746,31 @@ func (m *matchRef) match(s *state) result {
 	}
 
 	pos := s.mark()
-	memo := s.memos[pos]
+	memo := s.memos[pos.pos]
 	if memo == nil {
+		s.addMemo(m, memoPositionSize)
+
 		memo = make(map[Rule]*memoResult)
-		s.memos[pos] = memo
+		s.memos[pos.pos] = memo
+	}
+
+	if m.leftRec && s.assocRef == Ref(m) && pos.pos > s.assocPos {
+		return m.matchSeed(s, pos, memo)
 	}
 
-	if res, ok := memo[m]; ok {
+	// A memoized result is only valid if the state store is the same as
+	// when the result was calculated, since rules may depend on it.
+	if res, ok := memo[m]; ok && res.store == pos.store {
 		res.used++
-		s.restore(res.endPos)
+		s.restore(res.end)
+
+		// The recorded spans follow whatever rules were matched before,
+		// so they must be moved onto the spans of the rules matched this
+		// time.
+		if res.spans != pos.spans {
+			s.spans = rebaseSpans(s.spans, res.spans, pos.spans)
+		}
+
 		return s.check(m, res.result)
 	} else if m.leftRec {
 		var (
@@ -1065,7 +1778,9 @@ func (m *matchRef) match(s *state) result {
 			lastPos = pos
 		)
 
-		mr := &memoResult{endPos: pos}
+		s.addMemo(m, memoEntrySize)
+
+		mr := &memoResult{end: pos, store: pos.store, spans: pos.spans}
 		memo[m] = mr
 
 		for {
@@ -1074,7 +1789,13 @@ func (m *matchRef) match(s *state) result {
 			res := s.match(m.rule)
 			endPos := s.mark()
 
-			if endPos <= lastPos {
+			if endPos.pos <= lastPos.pos {
+				// A left recursive rule that matches without consuming
+				// input can never grow, which is almost always a bug.
+				if s.p.progressCheck && res.matched && endPos.pos == pos.pos {
+					s.noProgress(m, pos.pos)
+				}
+
 				break
 			}
 
@@ -1082,26 +1803,65 @@ func (m *matchRef) match(s *state) result {
 			lastPos = endPos
 
 			mr.result = res
-			mr.endPos = endPos
+			mr.end = endPos
 		}
 
 		s.restore(lastPos)
 		return s.check(m, lastRes)
 	} else {
-		if res, ok := memo[m]; ok {
-			s.restore(res.endPos)
-			return res.result
-		}
-
 		res := s.match(m.rule)
 		endPos := s.mark()
 
-		memo[m] = &memoResult{result: res, endPos: endPos}
+		s.addMemo(m, memoEntrySize)
+
+		memo[m] = &memoResult{result: res, end: endPos, store: pos.store, spans: pos.spans}
 
 		return s.check(m, res)
 	}
 }
 
+// seedKey is the key that the seed of a left recursive ref is memoized
+// under, separately from its grown result.
+type seedKey struct {
+	*matchRef
+}
+
+// matchSeed matches m without growing it, as the first round of growing a
+// left recursive ref does, where the recursive uses of m fail. It is used for
+// the right operand of a left associative branch.
+func (m *matchRef) matchSeed(s *state, pos savepoint, memo map[Rule]*memoResult) result {
+	key := seedKey{m}
+
+	if res, ok := memo[key]; ok && res.store == pos.store {
+		res.used++
+		s.restore(res.end)
+
+		if res.spans != pos.spans {
+			s.spans = rebaseSpans(s.spans, res.spans, pos.spans)
+		}
+
+		return s.check(m, res.result)
+	}
+
+	prev, ok := memo[m]
+	memo[m] = &memoResult{end: pos, store: pos.store, spans: pos.spans}
+
+	res := s.match(m.rule)
+	endPos := s.mark()
+
+	if ok {
+		memo[m] = prev
+	} else {
+		delete(memo, m)
+	}
+
+	s.addMemo(m, memoEntrySize)
+
+	memo[key] = &memoResult{result: res, end: endPos, store: pos.store, spans: pos.spans}
+
+	return s.check(m, res)
+}
+
 func (m *matchRef) detectLeftRec(r Rule, rs ruleSet) bool {
 	if !rs.Add(m.rule) {
 		return false
@@ -1276,15 +2036,70 @@ func (m *matchCall) print() string {
 // are available like Named'd values in Actions. This provides an interface for
 // propegating values between Actions, allow them to parse based on some state.
 //
-// The value of the match is the value of the given rule.
-func Call(r Rule, fn func(Values) map[string]interface{}) Rule {
-	return &matchCall{rule: r, fn: fn}
+// The value of the match is the value of the given rule.
+func Call(r Rule, fn func(Values) map[string]interface{}) Rule {
+	return &matchCall{rule: r, fn: fn}
+}
+
+type matchBind struct {
+	basicRule
+	rule Rule
+	fn   func(value interface{}) Rule
+}
+
+func (m *matchBind) match(s *state) result {
+	pos := s.mark()
+
+	res := s.match(m.rule)
+	if !res.matched {
+		s.restore(pos)
+		return s.check(m, res)
+	}
+
+	next := m.fn(res.value)
+	if next == nil {
+		s.restore(pos)
+		s.bad(m)
+		return result{}
+	}
+
+	res = s.match(next)
+	if !res.matched {
+		s.restore(pos)
+	}
+
+	return s.check(m, res)
+}
+
+func (m *matchBind) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchBind) print() string {
+	return Print(m.rule) + " >>= <go-func>"
+}
+
+// Bind returns a rule that matches it's given rule and then passes the value
+// to the given function. The function returns the rule to match next, allowing
+// the remainder of the match to depend on a previously parsed value. This is
+// needed for constructs that a pure PEG can not express, such as a length
+// prefix followed by that many items. If the function returns nil, the match
+// fails.
+//
+// The value of the match is the value of the rule returned by the function.
+func Bind(rule Rule, fn func(value interface{}) Rule) Rule {
+	return &matchBind{rule: rule, fn: fn}
 }
 
 type matchAction struct {
 	basicRule
 	rule Rule
 	fn   func(Values) interface{}
+	efn  func(Values) (interface{}, error)
 }
 
 func (m *matchAction) match(s *state) result {
@@ -1292,10 +2107,33 @@ func (m *matchAction) match(s *state) result {
 
 	res := s.match(m.rule)
 	if res.matched {
-		res.value = m.fn(s.values)
+		s.enterAction(m, pos.pos)
+
+		if m.efn != nil {
+			val, err := m.efn(s.values)
+			s.leaveAction()
+
+			if err != nil {
+				s.abort(&SemanticError{
+					Pos:  s.position(pos.pos),
+					Rule: s.refName(),
+					Err:  err,
+				})
+			}
+
+			res.value = val
+		} else {
+			res.value = m.fn(s.values)
+			s.leaveAction()
+		}
 
 		if sp, ok := res.value.(SetPositioner); ok {
-			sp.SetPosition(pos, s.mark(), s.line(pos), s.filename)
+			start := s.position(pos.pos)
+			sp.SetPosition(start.Offset, s.endOffset(s.pos), start.Line, start.Filename)
+		}
+
+		if s.p.nodeHooks != nil {
+			s.recordNode(pos.pos, res.value)
 		}
 	} else {
 		s.restore(pos)
@@ -1326,6 +2164,15 @@ func Action(r Rule, fn func(Values) interface{}) Rule {
 	return &matchScope{rule: &matchAction{rule: r, fn: fn}}
 }
 
+// ActionErr is like Action, but the function may also return an error. A
+// non-nil error stops parsing entirely, rather than causing the rule to fail
+// to match, and is returned to the caller wrapped in a SemanticError.
+//
+// The value of the match is the return value of the given function.
+func ActionErr(r Rule, fn func(Values) (interface{}, error)) Rule {
+	return &matchScope{rule: &matchAction{rule: r, efn: fn}}
+}
+
 type matchApply struct {
 	basicRule
 	rule Rule
@@ -1338,6 +2185,10 @@ func (m *matchApply) match(s *state) result {
 	res := s.match(m.rule)
 	if res.matched {
 		res.value = m.expand(s)
+
+		if s.p.nodeHooks != nil {
+			s.recordNode(pos.pos, res.value)
+		}
 	} else {
 		s.restore(pos)
 	}
@@ -1466,8 +2317,14 @@ type matchNamed struct {
 }
 
 func (m *matchNamed) match(s *state) result {
+	start := s.pos
+
 	res := s.match(m.rule)
 	if res.matched {
+		if s.p.bindings {
+			s.recordBinding(m.name, start, res.value)
+		}
+
 		if s.p.debug {
 			fmt.Printf("N (%p) %s => %#v\n", s.values, m.name, res.value)
 		}
@@ -1519,10 +2376,17 @@ func (m *matchTransform) match(s *state) result {
 
 	res := s.match(m.rule)
 	if res.matched {
-		res.value = m.fn(s.input[pos:s.mark()])
+		s.enterAction(m, pos.pos)
+		res.value = m.fn(s.input[pos.pos:s.pos])
+		s.leaveAction()
 
 		if sp, ok := res.value.(SetPositioner); ok {
-			sp.SetPosition(pos, s.mark(), s.line(pos), s.filename)
+			start := s.position(pos.pos)
+			sp.SetPosition(start.Offset, s.endOffset(s.pos), start.Line, start.Filename)
+		}
+
+		if s.p.nodeHooks != nil {
+			s.recordNode(pos.pos, res.value)
 		}
 	} else {
 		s.restore(pos)
@@ -1555,16 +2419,34 @@ func Transform(r Rule, fn func(string) interface{}) Rule {
 type matchCapture struct {
 	basicRule
 	rule Rule
+	opts CaptureOption
 }
 
 func (m *matchCapture) match(s *state) result {
 	pos := s.mark()
 
 	res := s.match(m.rule)
-	if res.matched {
-		res.value = s.input[pos:s.mark()]
-	} else {
+	if !res.matched {
 		s.restore(pos)
+		return s.check(m, res)
+	}
+
+	str := s.input[pos.pos:s.pos]
+
+	if m.opts != 0 {
+		var ok bool
+
+		str, ok = m.opts.apply(str)
+		if !ok {
+			s.restore(pos)
+			return s.check(m, result{})
+		}
+	}
+
+	res.value = str
+
+	if s.p.bindings {
+		s.recordBinding("", pos.pos, str)
 	}
 
 	return s.check(m, res)
@@ -1593,6 +2475,55 @@ func Capture(r Rule) Rule {
 	return &matchCapture{rule: r}
 }
 
+// CaptureOption is a normalization applied by CaptureWith to the matched
+// text. Options can be combined, and are applied in the order they are
+// declared.
+type CaptureOption int
+
+const (
+	// CaptureTrim removes leading and trailing white space.
+	CaptureTrim CaptureOption = 1 << iota
+
+	// CaptureUnquote interprets the text as a Go string or character
+	// literal, as strconv.Unquote does. If it isn't one, the rule does not
+	// match.
+	CaptureUnquote
+
+	// CaptureFold converts the text to lower case, for case insensitive
+	// keywords and identifiers.
+	CaptureFold
+)
+
+func (o CaptureOption) apply(str string) (string, bool) {
+	if o&CaptureTrim != 0 {
+		str = strings.TrimSpace(str)
+	}
+
+	if o&CaptureUnquote != 0 {
+		var err error
+
+		str, err = strconv.Unquote(str)
+		if err != nil {
+			return "", false
+		}
+	}
+
+	if o&CaptureFold != 0 {
+		str = strings.ToLower(str)
+	}
+
+	return str, true
+}
+
+// CaptureWith is like Capture, but normalizes the matched text as opts
+// describe. It avoids the allocations of a Transform, for normalizations
+// that are common in hot tokens.
+//
+// The value of the match is the normalized text.
+func CaptureWith(r Rule, opts CaptureOption) Rule {
+	return &matchCapture{rule: r, opts: opts}
+}
+
 type matchCheckAction struct {
 	basicRule
 	fn func(vals Values) bool
@@ -1601,7 +2532,11 @@ type matchCheckAction struct {
 func (m *matchCheckAction) match(s *state) result {
 	defer s.restore(s.mark())
 
-	if m.fn(s.values) {
+	s.enterAction(m, s.pos)
+	ok := m.fn(s.values)
+	s.leaveAction()
+
+	if ok {
 		s.good(m)
 		return result{matched: true}
 	}
@@ -1628,6 +2563,93 @@ func (m *matchCheckAction) print() string {
 	return "&<go-func>"
 }
 
+// MatchContext describes the current position in the input stream. It is
+// passed to the function given to CheckActionCtx.
+type MatchContext struct {
+	// Values provides access to the current scope, just like the Values
+	// passed to CheckAction.
+	Values Values
+
+	// Pos is the byte offset of the current position.
+	Pos int
+
+	// Line and Column are the 1-based line and byte column of the current
+	// position.
+	Line   int
+	Column int
+
+	// Filename is the name of the file being parsed, if any.
+	Filename string
+
+	// State provides access to the state store.
+	State State
+
+	rest string
+}
+
+// Peek returns up to n bytes of the input starting at the current position.
+func (c *MatchContext) Peek(n int) string {
+	if n > len(c.rest) {
+		n = len(c.rest)
+	}
+
+	return c.rest[:n]
+}
+
+// AtEOS indicates if the current position is at the end of the input.
+func (c *MatchContext) AtEOS() bool {
+	return c.rest == ""
+}
+
+type matchCheckActionCtx struct {
+	basicRule
+	fn func(ctx *MatchContext) bool
+}
+
+func (m *matchCheckActionCtx) match(s *state) result {
+	pos := s.position(s.pos)
+
+	ctx := MatchContext{
+		Values:   s.values,
+		Pos:      pos.Offset,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Filename: pos.Filename,
+		State:    s.store,
+		rest:     s.cur(),
+	}
+
+	s.enterAction(m, s.pos)
+	ok := m.fn(&ctx)
+	s.leaveAction()
+
+	if ok {
+		s.good(m)
+		return result{matched: true}
+	}
+
+	s.bad(m)
+	return result{}
+}
+
+func (m *matchCheckActionCtx) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchCheckActionCtx) print() string {
+	return "&<go-func>"
+}
+
+// CheckActionCtx is like CheckAction, but the function is passed a MatchContext
+// which, in addition to the current scope, describes the current position in
+// the input stream. This allows for context sensitive checks, like only matching
+// at the start of a line.
+//
+// The value of the match is nil.
+func CheckActionCtx(fn func(ctx *MatchContext) bool) Rule {
+	return &matchCheckActionCtx{fn: fn}
+}
+
 type matchEOS struct {
 	basicRule
 }
@@ -1689,65 +2711,158 @@ func Debug() Rule {
 // That's all the rules!
 
 // Labels provides a simple database for named refs. This is used to cleanup rule
-// set creation.
+// set creation. Refs are named after their label, so there is no need to call
+// N or SetName for them to be identified in Print, debug output, and errors.
 type Labels interface {
 	// Ref creates or returns a Ref of the given name.
 	Ref(name string) Rule
 
 	// Set assigns the given rule to a Ref of the given name.
 	Set(name string, rule Rule) Ref
+
+	// Merge adds the refs of other, so that the rules of several grammars
+	// can refer to each other by their full names. A ref that is used but
+	// not set in one is set to the ref of the same name in the other,
+	// including a label used within this namespace before the merge, such
+	// as "json.value". It is an error for both to set a ref of the same
+	// name, in which case nothing is merged.
+	Merge(other Labels) error
 }
 
-// Refs returns a Labels value.
-func Refs() Labels {
+// Refs returns a Labels value. If a namespace is given, the refs are named
+// within it, so the label "value" in the namespace "json" is a ref named
+// "json.value". Multiple namespaces are nested, so Refs("x", "json") names
+// it "x.json.value". Namespaces keep the refs of grammars that are combined
+// with Merge from colliding.
+//
+// Within a namespace, a label is first looked up within it, and then as the
+// full name of a ref merged from another namespace, so rules can refer to
+// "json.value" after merging in the json grammar.
+func Refs(namespace ...string) Labels {
 	return &labels{
-		refs: make(map[string]Ref),
+		refs:   make(map[string]Ref),
+		prefix: strings.Join(namespace, "."),
 	}
 }
 
 type labels struct {
 	refs map[string]Ref
+
+	// prefix is the namespace, which is prepended to labels with a dot.
+	prefix string
+}
+
+// lookup returns the full name of a label and its ref, if there is one.
+func (l *labels) lookup(name string) (string, Ref) {
+	full := name
+	if l.prefix != "" {
+		full = l.prefix + "." + name
+	}
+
+	if ref, ok := l.refs[full]; ok {
+		return full, ref
+	}
+
+	if ref, ok := l.refs[name]; ok && full != name {
+		return name, ref
+	}
+
+	return full, nil
 }
 
 func (l *labels) Ref(name string) Rule {
-	if ref, ok := l.refs[name]; ok {
+	full, ref := l.lookup(name)
+	if ref != nil {
 		return ref
 	}
 
-	ref := R(name)
+	ref = R(full)
 
-	l.refs[name] = ref
+	l.refs[full] = ref
 
 	return ref
 }
 
 func (l *labels) Set(name string, rule Rule) Ref {
-	if ref, ok := l.refs[name]; ok {
+	full, ref := l.lookup(name)
+	if ref != nil {
 		ref.Set(rule)
 		return ref
 	}
 
-	ref := R(name)
+	ref = R(full)
 
-	l.refs[name] = ref
+	l.refs[full] = ref
 
 	ref.Set(rule)
 	return ref
 }
 
-type ErrInputNotConsumed struct {
-	MaxPos  int
-	MaxRule Rule
+func (l *labels) Merge(other Labels) error {
+	o, ok := other.(*labels)
+	if !ok {
+		return fmt.Errorf("can not merge labels of type %T", other)
+	}
+
+	names := make([]string, 0, len(o.refs))
+	for name := range o.refs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if cur, ok := l.refs[name]; ok && cur != o.refs[name] && isSet(cur) && isSet(o.refs[name]) {
+			return fmt.Errorf("can not merge labels: %s is set in both", name)
+		}
+	}
+
+	for _, name := range names {
+		ref := o.refs[name]
+
+		cur, ok := l.refs[name]
+
+		switch {
+		case !ok:
+			l.refs[name] = ref
+		case cur == ref:
+		case isSet(ref):
+			cur.Set(ref)
+		default:
+			ref.Set(cur)
+		}
+	}
+
+	// Labels used within the namespace before the merge, such as
+	// "json.value", were created in it, and now refer to the merged refs.
+	if l.prefix != "" {
+		for _, name := range names {
+			placeholder, ok := l.refs[l.prefix+"."+name]
+			if ok && !isSet(placeholder) {
+				placeholder.Set(l.refs[name])
+				delete(l.refs, l.prefix+"."+name)
+			}
+		}
+	}
+
+	return nil
 }
 
-func (*ErrInputNotConsumed) Error() string {
-	return "full input not consume"
+// isSet reports whether the rule of ref has been set.
+func isSet(ref Ref) bool {
+	m, ok := ref.(*matchRef)
+	return !ok || m.rule != nil
 }
 
 type memoResult struct {
 	result
-	endPos int
-	used   int
+	end   savepoint
+	store *stateStore
+	used  int
+
+	// spans is the list of recorded spans when the result was
+	// calculated.
+	spans *spanList
 }
 
 type state struct {
@@ -1755,17 +2870,59 @@ type state struct {
 	input     string
 	inputSize int
 	pos       int
+	fold      bool
+	store     *stateStore
 	memos     map[int]map[Rule]*memoResult
+	noMemo    bool
+	memoBytes int
 	values    Values
 	args      map[string]interface{}
 
 	filename string
-	linePos  []int
+	srcMap   *sourceMap
+
+	// lines is built by lineIndex when a position is first needed, so
+	// that parses which never report one don't index the input.
+	lines *LineIndex
+
+	// lineBase is added to the line of positions, and colBase to the
+	// column of positions on the first line. They are set when the input
+	// is a window onto a larger stream, see ParseReader.
+	lineBase int
+	colBase  int
 
 	curRef  Ref
 	maxPos  int
 	maxRule Rule
 
+	// assocRef is the ref that only matches its seed at positions after
+	// assocPos, within a left associative branch. See
+	// BranchesBuilder.AddAssoc.
+	assocRef Ref
+	assocPos int
+
+	// nextProgress is the position that maxPos must reach before the
+	// progress function is next called.
+	nextProgress int
+	progressStep int
+	progressPos  int
+
+	// recordRef reports which named Refs to record in spans, see
+	// Highlight and ParseTree. It is nil when Refs are not recorded.
+	// Recover always records the input it skips in spans.
+	recordRef func(name string) bool
+	spans     *spanList
+
+	// matchStart is where the rule began matching, see WithUnanchored.
+	matchStart int
+
+	depth int
+	err   error
+
+	action    Rule
+	actionRef Ref
+	actionPos int
+
 	debug     bool
 	refStack  []string
 	check     func(r Rule, res result) result
@@ -1826,15 +2983,29 @@ func (s *state) advance(l int, r Rule) {
 	if s.maxRule == nil || s.pos > s.maxPos {
 		s.maxPos = s.pos
 		s.maxRule = s.curRef
+
+		if s.pos >= s.nextProgress {
+			s.reportProgress()
+		}
 	}
 }
 
-func (s *state) mark() int {
-	return s.pos
+// savepoint records everything that must be reset when backtracking:
+// the position in the input stream and the state store.
+type savepoint struct {
+	pos   int
+	store *stateStore
+	spans *spanList
+}
+
+func (s *state) mark() savepoint {
+	return savepoint{pos: s.pos, store: s.store, spans: s.spans}
 }
 
-func (s *state) restore(p int) {
-	s.pos = p
+func (s *state) restore(p savepoint) {
+	s.pos = p.pos
+	s.store = p.store
+	s.spans = p.spans
 }
 
 func (s *state) goodRangeDebug(r Rule, sz int) {
@@ -1844,13 +3015,13 @@ func (s *state) goodRangeDebug(r Rule, sz int) {
 func goodRangeId(r Rule, sz int) {}
 
 func (s *state) goodDebug(r Rule) {
-	fmt.Printf("G @ %d (%q) => %s\n", s.mark(), s.curRune(), Print(r))
+	fmt.Printf("G @ %d (%q) => %s\n", s.pos, s.curRune(), Print(r))
 }
 
 func goodId(r Rule) {}
 
 func (s *state) badDebug(r Rule) {
-	fmt.Printf("B @ %d (%q) => %s\n", s.mark(), s.curRune(), Print(r))
+	fmt.Printf("B @ %d (%q) => %s\n", s.pos, s.curRune(), Print(r))
 }
 
 func badId(r Rule) {}
@@ -1871,9 +3042,40 @@ func checkId(r Rule, res result) result {
 
 // Parser is the interface for running a rule against some input
 type Parser struct {
-	log     hclog.Logger
-	partial bool
-	debug   bool
+	log        hclog.Logger
+	partial    bool
+	unanchored bool
+	fold       bool
+	debug      bool
+
+	encoding Encoding
+	skipBOM  bool
+
+	columnMode ColumnMode
+	tabWidth   int
+
+	lineTerminators LineTerminator
+
+	filename string
+	regions  []FileRegion
+	mapper   OffsetMapper
+
+	recursionLimit int
+	progressCheck  bool
+	maxInputSize   int
+	maxMemoBytes   int
+	noMemo         bool
+	memoThreshold  int
+
+	tracer    Tracer
+	progress  func(pos, total int)
+	nodeHooks []nodeHook
+
+	callCounts map[Rule]int
+	bindings   bool
+	cancel     <-chan struct{}
+
+	streamLookahead int
 }
 
 type Option func(p *Parser)
@@ -1896,6 +3098,29 @@ func WithPartial(on bool) Option {
 	}
 }
 
+// WithUnanchored allows the rule to begin matching at any position in the
+// input, rather than only at the start, as FindFirst does. The first
+// position at which the rule matches is used. This is useful when a known
+// construct is embedded in input that isn't worth modeling in the grammar.
+//
+// Unless combined with WithPartial, the match must still extend to the end
+// of the input. The span of the match, including where it began, is
+// available from the ParseResult returned by Run.
+func WithUnanchored(on bool) Option {
+	return func(p *Parser) {
+		p.unanchored = on
+	}
+}
+
+// WithCaseInsensitive causes the S, Set, and Range rules to match without
+// regard to case. This is useful for languages that are case insensitive, such
+// as SQL, without having to rewrite every literal in the grammar.
+func WithCaseInsensitive(on bool) Option {
+	return func(p *Parser) {
+		p.fold = on
+	}
+}
+
 // New creates a new Parser value
 func New(opts ...Option) *Parser {
 	p := &Parser{
@@ -1909,39 +3134,171 @@ func New(opts ...Option) *Parser {
 	return p
 }
 
-func computeLines(input string) []int {
+// LineTerminator is a set of byte sequences that are recognized as ending
+// a line when calculating line and column numbers.
+type LineTerminator uint8
+
+const (
+	// LineLF recognizes "\n".
+	LineLF LineTerminator = 1 << iota
+
+	// LineCR recognizes a "\r" that is not followed by "\n".
+	LineCR
+
+	// LineCRLF recognizes "\r\n" as a single line terminator. Without
+	// LineCRLF, the "\r" is considered part of the line, since LineCR
+	// never matches a "\r" that is followed by "\n".
+	LineCRLF
+
+	// LineAny recognizes all line terminators. This is the default.
+	LineAny = LineLF | LineCR | LineCRLF
+)
+
+// WithLineTerminators sets which line terminators are recognized when
+// calculating line and column numbers.
+func WithLineTerminators(lt LineTerminator) Option {
+	return func(p *Parser) {
+		p.lineTerminators = lt
+	}
+}
+
+// computeLinesWith returns the offset of the last byte of each line
+// terminator in input.
+func computeLinesWith(input string, lt LineTerminator) []int {
 	var out []int
 
-	for i, b := range input {
-		if b == '\n' {
-			out = append(out, i)
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case '\n':
+			if lt&LineLF != 0 {
+				out = append(out, i)
+			}
+		case '\r':
+			if i+1 < len(input) && input[i+1] == '\n' {
+				if lt&LineCRLF != 0 {
+					out = append(out, i+1)
+					i++
+				}
+			} else if lt&LineCR != 0 {
+				out = append(out, i)
+			}
 		}
 	}
 
 	return out
 }
 
+func (s *state) lineIndex() *LineIndex {
+	if s.lines == nil {
+		s.lines = newLineIndex(s.input, s.p)
+	}
+
+	return s.lines
+}
+
 func (s *state) line(bp int) int {
-	for i, lp := range s.linePos {
-		if bp <= lp {
-			return i + 1
-		}
+	return s.lineBase + s.lineIndex().Line(bp)
+}
+
+func (s *state) column(bp int) int {
+	li := s.lineIndex()
+	col := li.Col(bp)
+
+	if li.Line(bp) == 1 {
+		col += s.colBase
 	}
 
-	return len(s.linePos) + 1
+	return col
 }
 
 func (p *Parser) parse(r Rule, input, filename string) (*state, result) {
-	s := &state{
+	return p.parseAt(r, input, filename, 0)
+}
+
+func (p *Parser) parseAt(r Rule, input, filename string, offset int) (*state, result) {
+	if err := p.checkInputSize(len(input)); err != nil {
+		// Fail before doing any work on the input, such as finding the
+		// start of each line.
+		return &state{p: p, err: err}, result{}
+	}
+
+	s := p.newState(input, filename)
+
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	if offset > 0 {
+		s.pos = s.srcMap.decoded(offset)
+	}
+
+	s.matchStart = s.pos
+
+	var res result
+
+	if p.unanchored {
+		start, fres, ok := s.find(r, s.pos, firstBytes(r, p.fold))
+		if ok {
+			s.matchStart = start
+		}
+
+		res = fres
+	} else {
+		res = s.run(r)
+	}
+
+	if res.matched && s.err == nil {
+		s.runNodeHooks()
+	}
+
+	return s, res
+}
+
+// newState creates the state to parse input. The caller is responsible for
+// returning s.values once parsing is finished.
+func (p *Parser) newState(input, filename string) *state {
+	input, srcMap := decodeInput(input, p.encoding, p.skipBOM)
+
+	return p.initState(input, srcMap, filename)
+}
+
+// statePool holds states that have been released, so that the common case
+// of calling Parse repeatedly doesn't allocate, and collect, a state each time.
+var statePool = sync.Pool{
+	New: func() interface{} {
+		return &state{}
+	},
+}
+
+// release returns s to the pool once nothing refers to it. It is cleared so
+// that the pool doesn't keep the input and results of the parse alive.
+func (s *state) release() {
+	*s = state{}
+	statePool.Put(s)
+}
+
+// initState creates the state to parse input that has already been decoded.
+// Callers that know s is no longer used once they return release it.
+func (p *Parser) initState(input string, srcMap *sourceMap, filename string) *state {
+	values := cvPool.Get().(*compactedValues)
+
+	s := statePool.Get().(*state)
+	*s = state{
 		p:         p,
 		input:     input,
 		inputSize: len(input),
-		values:    cvPool.Get().(Values),
+		values:    values,
 		debug:     p.debug,
-		linePos:   computeLines(input),
+		fold:      p.fold,
 		filename:  filename,
+		srcMap:    srcMap,
+
+		noMemo: !p.memoize(len(input)),
 	}
 
+	values.s = s
+
+	s.startProgress()
+
 	if p.debug {
 		s.check = s.checkDebug
 		s.good = s.goodDebug
@@ -1956,50 +3313,163 @@ func (p *Parser) parse(r Rule, input, filename string) (*state, result) {
 		s.match = s.matchFast
 	}
 
-	defer returnValues(s.values)
+	if p.callCounts != nil {
+		s.countCalls()
+	}
+
+	if p.cancel != nil {
+		s.checkCancel()
+	}
 
-	return s, s.match(r)
+	return s
 }
 
 // Parse attempts to match the given rule against the input string. If
 // the rule matches, the value of the rule is returned. If the rule matches
-// a portion of input, the ErrInputNotConsumed error is returned.
+// a portion of input, the ErrInputNotConsumed error is returned. If the rule
+// does not match, matched is false and err is nil. Errors that stop parsing,
+// such as a SemanticError, are returned as err. If the rule matched by
+// recovering from errors with Recover, the value is returned along with the
+// first RecoveredError.
 func (p *Parser) Parse(r Rule, input string) (val interface{}, matched bool, err error) {
-	s, res := p.parse(r, input, "")
+	s, res := p.parse(r, input, p.filename)
+	defer s.release()
+
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
 	if !res.matched {
 		return nil, false, nil
 	}
 
 	if !p.partial {
 		if s.pos != s.inputSize {
-			return res.value, false, &ErrInputNotConsumed{
-				MaxPos:  s.maxPos,
-				MaxRule: s.maxRule,
-			}
+			return res.value, false, s.notConsumed()
 		}
 	}
 
+	// The rule matched by recovering from errors, so the value is
+	// returned along with the first of them.
+	if errs := s.recovered(); len(errs) > 0 {
+		return res.value, true, errs[0]
+	}
+
 	return res.value, true, nil
 }
 
+// ParseAt attempts to match the given rule against the input string, starting
+// at the byte offset given. This allows rules to be used on a portion of a
+// larger document while positions are still reported relative to the whole
+// input. The input after the match is not required to be consumed.
+//
+// If the rule matches, the value of the rule is returned along with the
+// byte offset in input of the end of the match, so that the next parse can
+// begin there. It is not translated by an OffsetMapper, unlike the offsets
+// of positions reported for the match.
+func (p *Parser) ParseAt(r Rule, input string, offset int) (val interface{}, end int, matched bool, err error) {
+	if offset < 0 || offset > len(input) {
+		return nil, offset, false, fmt.Errorf("offset %d is outside of the input", offset)
+	}
+
+	s, res := p.parseAt(r, input, p.filename, offset)
+	defer s.release()
+
+	if s.err != nil {
+		return nil, offset, false, s.err
+	}
+
+	if !res.matched {
+		return nil, offset, false, nil
+	}
+
+	return res.value, s.srcMap.original(s.pos), true, nil
+}
+
+// ParseAll repeatedly matches the given rule against the input until the input
+// is exhausted, which is the common case of parsing a file of statements or
+// records. If skip is not nil, it is matched before each item and at the end
+// of the input, allowing for separators, whitespace, or comments between items.
+//
+// The values of each match are returned along with the span of input that
+// each one matched. If the rule fails to match before the input is exhausted,
+// the values parsed so far are returned along with an ErrInputNotConsumed.
+func (p *Parser) ParseAll(r Rule, input string, skip Rule) (values []interface{}, spans []Span, err error) {
+	if err := p.checkInputSize(len(input)); err != nil {
+		return nil, nil, err
+	}
+
+	s := p.newState(input, p.filename)
+
+	defer s.release()
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	for {
+		if skip != nil {
+			mark := s.mark()
+			if !s.run(skip).matched {
+				s.restore(mark)
+			}
+		}
+
+		if s.err != nil {
+			return values, spans, s.err
+		}
+
+		if s.pos >= s.inputSize {
+			s.runNodeHooks()
+			return values, spans, nil
+		}
+
+		start := s.pos
+
+		res := s.run(r)
+		if s.err != nil {
+			return values, spans, s.err
+		}
+
+		if !res.matched || s.pos == start {
+			return values, spans, s.notConsumed()
+		}
+
+		values = append(values, res.value)
+		spans = append(spans, Span{Start: s.position(start), End: s.position(s.pos)})
+	}
+}
+
 // ParseFile reads the data from the file at the path and parses it using the given Rule
 func (p *Parser) ParseFile(r Rule, path string) (val interface{}, matched bool, err error) {
+	if p.maxInputSize > 0 {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err := p.checkInputSize(int(fi.Size())); err != nil {
+			return nil, false, err
+		}
+	}
+
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, false, err
 	}
 
 	s, res := p.parse(r, string(data), path)
+	defer s.release()
+
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
 	if !res.matched {
 		return nil, false, nil
 	}
 
 	if !p.partial {
 		if s.pos != s.inputSize {
-			return res.value, false, &ErrInputNotConsumed{
-				MaxPos:  s.maxPos,
-				MaxRule: s.maxRule,
-			}
+			return res.value, false, s.notConsumed()
 		}
 	}
 
@@ -2,6 +2,7 @@ package peggysue
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -27,6 +28,100 @@ func TestParse(t *testing.T) {
 		r.False(ok)
 	})
 
+	t.Run("parses case insensitively", func(t *testing.T) {
+		p := New(WithCaseInsensitive(true))
+
+		r := require.New(t)
+
+		rule := Seq(S("select"), S(" "), S("ab"), Plus(Range('a', 'f')), Set('x', 'y'))
+
+		for _, in := range []string{"select abfx", "SELECT ABFX", "SeLeCt aBcDeY"} {
+			_, ok, err := p.Parse(rule, in)
+			r.NoError(err)
+			r.True(ok, in)
+		}
+
+		_, ok, err := p.Parse(rule, "SELECT ABGX")
+		r.NoError(err)
+		r.False(ok)
+
+		_, ok, err = p.Parse(Set('ß'), "ẞ")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = New().Parse(rule, "SELECT ABFX")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("folds literals rune by rune", func(t *testing.T) {
+		p := New(WithCaseInsensitive(true))
+
+		r := require.New(t)
+
+		// The Kelvin sign folds to "k" but is 3 bytes long.
+		val, ok, err := p.Parse(Seq(Capture(S("kilo")), EOS()), "\u212aILO")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("\u212aILO", val)
+
+		_, ok, err = p.Parse(Seq(S("k"), EOS()), "\u212a")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(Seq(S("ok"), EOS()), "O\u212a")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(Seq(S("\u212aelvin"), EOS()), "kelvin")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(Seq(Not(S("k")), Any(), EOS()), "\u212a")
+		r.NoError(err)
+		r.False(ok)
+
+		_, ok, err = New().Parse(Seq(S("kilo"), EOS()), "\u212aILO")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("parses case folded ranges and sets", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		ident := Plus(RangeFold('a', 'z'))
+
+		_, ok, err := p.Parse(ident, "helloWORLD")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(Plus(RangeFold('α', 'ω')), "αΒγ")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(ident, "hello1")
+		r.Error(err)
+		r.False(ok)
+
+		exp := Seq(S("1"), SetFold('e'), S("5"))
+
+		_, ok, err = p.Parse(exp, "1E5")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(exp, "1e5")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(SetFold('k'), "\u212a")
+		r.NoError(err)
+		r.True(ok)
+
+		r.Equal("[a-z]i", Print(RangeFold('a', 'z')))
+	})
+
 	t.Run("parses a regexp", func(t *testing.T) {
 		p := New()
 
@@ -89,6 +184,86 @@ func TestParse(t *testing.T) {
 		r.True(ok)
 	})
 
+	t.Run("parses a sequence collecting all values", func(t *testing.T) {
+		p := New()
+
+		r1 := SeqAll(Capture(S("foo")), S(" "), Capture(S("blah")))
+
+		val, ok, err := p.Parse(r1, "foo blah")
+		r := require.New(t)
+
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"foo", nil, "blah"}, val)
+
+		_, ok, err = p.Parse(r1, "foo")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("parses a sequence with white space between its rules", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New()
+
+		ws := Star(Set(' ', '\t'))
+		name := Capture(Plus(Range('a', 'z')))
+
+		r1 := SeqWS(ws, S("let"), Named("name", name), S("="), Action(Capture(Plus(Range('0', '9'))), func(v Values) interface{} {
+			return v.Get("name")
+		}))
+
+		for _, input := range []string{"let x=1", "let  x = 1", "let\tx\t=\t1"} {
+			val, ok, err := p.Parse(r1, input)
+			r.NoError(err, input)
+			r.True(ok, input)
+			r.Equal("x", val, input)
+		}
+
+		_, ok, err := p.Parse(r1, " let x=1")
+		r.NoError(err)
+		r.False(ok)
+
+		_, _, err = p.Parse(r1, "let x=1 ")
+		r.ErrorIs(err, ErrPartialInput)
+
+		val, ok, err := p.Parse(SeqWS(ws, name), "ab")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("ab", val)
+	})
+
+	t.Run("normalizes captured text", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New()
+
+		for _, tc := range []struct {
+			opts  CaptureOption
+			input string
+			value string
+		}{
+			{CaptureTrim, "  foo \t", "foo"},
+			{CaptureFold, "SeLeCt", "select"},
+			{CaptureUnquote, `"a\tb"`, "a\tb"},
+			{CaptureUnquote, "`raw`", "raw"},
+			{CaptureTrim | CaptureUnquote | CaptureFold, ` "ABC" `, "abc"},
+		} {
+			val, ok, err := p.Parse(CaptureWith(Plus(Any()), tc.opts), tc.input)
+			r.NoError(err, tc.input)
+			r.True(ok, tc.input)
+			r.Equal(tc.value, val, tc.input)
+		}
+
+		_, ok, err := p.Parse(Or(CaptureWith(Plus(Any()), CaptureUnquote), S(`"bad`)), `"bad`)
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(CaptureWith(Plus(Any()), CaptureUnquote), `"bad`)
+		r.NoError(err)
+		r.False(ok)
+	})
+
 	t.Run("parses an or of sequences", func(t *testing.T) {
 		p := New()
 
@@ -162,6 +337,65 @@ func TestParse(t *testing.T) {
 		r.True(ok)
 	})
 
+	t.Run("collects the values of repetitions", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+		digit := Capture(Range('0', '9'))
+
+		val, ok, err := p.Parse(StarCapture(digit), "123")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"1", "2", "3"}, val)
+
+		val, ok, err = p.Parse(StarCapture(digit), "")
+		r.NoError(err)
+		r.True(ok)
+		r.Len(val, 0)
+
+		val, ok, err = p.Parse(Collect(Plus(digit)), "45")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"4", "5"}, val)
+
+		val, ok, err = p.Parse(Collect(Count(digit, 2)), "67")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"6", "7"}, val)
+
+		r.Panics(func() {
+			Collect(digit)
+		})
+	})
+
+	t.Run("folds the values of repetitions", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+		digit := Transform(Range('0', '9'), func(s string) interface{} {
+			i, _ := strconv.Atoi(s)
+			return i
+		})
+
+		sum := Fold(
+			func() interface{} { return 0 },
+			Seq(digit, Maybe(S(","))),
+			func(acc, v interface{}) interface{} {
+				return acc.(int) + v.(int)
+			},
+		)
+
+		val, ok, err := p.Parse(sum, "1,2,3")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(6, val)
+
+		val, ok, err = p.Parse(sum, "")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(0, val)
+	})
+
 	t.Run("parses an optional", func(t *testing.T) {
 		p := New()
 
@@ -178,6 +412,30 @@ func TestParse(t *testing.T) {
 		r.False(ok)
 	})
 
+	t.Run("parses an optional that reports if it matched", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+		r1 := Seq(MaybeValue(S("-")), S("1"))
+
+		val, ok, err := p.Parse(r1, "-1")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(Optional{Matched: true}, val)
+
+		val, ok, err = p.Parse(r1, "1")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(Optional{}, val)
+
+		r2 := MaybeValue(Capture(S("foo")))
+
+		val, ok, err = p.Parse(r2, "foo")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(Optional{Value: "foo", Matched: true}, val)
+	})
+
 	t.Run("parses a check", func(t *testing.T) {
 		p := New()
 
@@ -213,6 +471,43 @@ func TestParse(t *testing.T) {
 		r.False(ok)
 	})
 
+	t.Run("lowers negated character classes", func(t *testing.T) {
+		r := require.New(t)
+
+		for _, class := range []Rule{Range('a', 'z'), Set('"', '\\', 'é'), S("x"), RangeFold('a', 'c')} {
+			lowered := Seq(Not(class), Any())
+			r.IsType(&matchNotClass{}, lowered)
+
+			plain := &matchBoth{a: &matchNot{rule: class}, b: Any()}
+
+			for _, fold := range []bool{false, true} {
+				p := New(WithPartial(true), WithCaseInsensitive(fold))
+
+				for _, in := range []string{"", "a", "B", "x", "X", "é", "É", "\\", "7", "日"} {
+					_, exp, err := p.Parse(Star(plain), in)
+					r.NoError(err)
+
+					_, end, expOK, err := p.ParseAt(plain, in, 0)
+					r.NoError(err)
+
+					_, got, gotOK, err := p.ParseAt(lowered, in, 0)
+					r.NoError(err)
+
+					r.Equal(expOK, gotOK, "%s %q fold=%v", Print(class), in, fold)
+					r.Equal(end, got, "%s %q fold=%v", Print(class), in, fold)
+
+					_, ok, err := p.Parse(Star(lowered), in)
+					r.NoError(err)
+					r.Equal(exp, ok)
+				}
+			}
+		}
+
+		r.IsType(&matchBoth{}, Seq(Not(S("xy")), Any()))
+		r.IsType(&matchBoth{}, Seq(Not(Range('a', 'z')), S("a")))
+		r.Equal("![a-z] .", Print(Seq(Not(Range('a', 'z')), Any())))
+	})
+
 	t.Run("can use a reference", func(t *testing.T) {
 		p := New()
 
@@ -296,6 +591,92 @@ func TestParse(t *testing.T) {
 		r.NotNil(st.memos[0][f1])
 	})
 
+	t.Run("names refs created by a label factory", func(t *testing.T) {
+		r := require.New(t)
+
+		l := Refs()
+
+		r1 := Seq(l.Ref("one"), S("+"))
+		two := l.Set("two", S("2"))
+
+		r.Equal("one", l.Ref("one").Name())
+		r.Equal("one", Repr(l.Ref("one")))
+		r.Equal("two", Print(two))
+		r.Equal(`one "+"`, Print(r1))
+
+		r.PanicsWithValue("rule already set: two", func() {
+			two.Set(S("3"))
+		})
+
+		r.PanicsWithValue("unset ref detected: one", func() {
+			New().Parse(r1, "1+")
+		})
+	})
+
+	t.Run("names refs within a namespace", func(t *testing.T) {
+		r := require.New(t)
+
+		l := Refs("json")
+
+		value := l.Set("value", Capture(Re("[0-9]+")))
+
+		r.Equal("json.value", value.Name())
+		r.Equal(value, l.Ref("value"))
+		r.Equal("x.json.value", Refs("x", "json").Ref("value").Name())
+	})
+
+	t.Run("merges labels from different namespaces", func(t *testing.T) {
+		r := require.New(t)
+
+		json := Refs("json")
+		json.Set("value", Capture(Re("[0-9]+")))
+
+		app := Refs("app")
+		doc := app.Set("doc", Seq(S("="), app.Ref("json.value")))
+		app.Set("value", S("v"))
+
+		r.NoError(app.Merge(json))
+		r.Equal(json.Ref("value"), app.Ref("json.value"))
+		r.Equal("app.value", app.Ref("value").Name())
+
+		v, ok, err := New().Parse(doc, "=42")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("42", v)
+	})
+
+	t.Run("links refs that are only set in one of the merged labels", func(t *testing.T) {
+		r := require.New(t)
+
+		a := Refs()
+		a.Set("one", Seq(a.Ref("two"), S("!")))
+
+		b := Refs()
+		b.Set("two", S("2"))
+		b.Ref("one")
+
+		r.NoError(a.Merge(b))
+
+		_, ok, err := New().Parse(b.Ref("one"), "2!")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("does not merge labels that set the same ref", func(t *testing.T) {
+		r := require.New(t)
+
+		a := Refs()
+		a.Set("one", S("1"))
+		two := a.Ref("two")
+
+		b := Refs()
+		b.Set("one", S("uno"))
+		b.Set("two", S("2"))
+
+		r.EqualError(a.Merge(b), "can not merge labels: one is set in both")
+		r.False(isSet(two.(Ref)))
+	})
+
 	t.Run("allows for actions to produce results", func(t *testing.T) {
 		p := New()
 
@@ -363,6 +744,82 @@ func TestParse(t *testing.T) {
 		r.False(ok)
 	})
 
+	t.Run("allows check actions with the match context", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		bol := CheckActionCtx(func(ctx *MatchContext) bool {
+			return ctx.Column == 1
+		})
+
+		word := Seq(bol, Plus(Range('a', 'z')))
+		r1 := Seq(word, Star(Seq(S("\n"), word)))
+
+		_, ok, err := p.Parse(r1, "foo\nbar")
+		r.NoError(err)
+		r.True(ok)
+
+		r2 := Seq(S("foo"), Maybe(S(" ")), word)
+
+		_, ok, err = p.Parse(r2, "foo bar")
+		r.NoError(err)
+		r.False(ok)
+
+		var ctx MatchContext
+
+		r3 := Seq(S("a\nb"), CheckActionCtx(func(c *MatchContext) bool {
+			ctx = *c
+			return c.Peek(10) == "cd"
+		}), S("cd"))
+
+		_, ok, err = p.Parse(r3, "a\nbcd")
+		r.NoError(err)
+		r.True(ok)
+
+		r.Equal(3, ctx.Pos)
+		r.Equal(2, ctx.Line)
+		r.Equal(2, ctx.Column)
+		r.Equal("c", ctx.Peek(1))
+		r.False(ctx.AtEOS())
+	})
+
+	t.Run("binds the next rule to a parsed value", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		length := Transform(Plus(Range('0', '9')), func(s string) interface{} {
+			i, _ := strconv.Atoi(s)
+			return i
+		})
+
+		r1 := Bind(Seq(length, S(":")), func(v interface{}) Rule {
+			return Capture(Count(Any(), v.(int)))
+		})
+
+		val, ok, err := p.Parse(r1, "3:abc")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("abc", val)
+
+		_, ok, err = p.Parse(r1, "3:ab")
+		r.NoError(err)
+		r.False(ok)
+
+		_, ok, err = p.Parse(r1, "2:abc")
+		r.Error(err)
+		r.False(ok)
+
+		r2 := Bind(length, func(v interface{}) Rule {
+			return nil
+		})
+
+		_, ok, err = p.Parse(r2, "1")
+		r.NoError(err)
+		r.False(ok)
+	})
+
 	t.Run("can populate positions on results", func(t *testing.T) {
 		p := New()
 
@@ -456,6 +913,84 @@ func TestParse(t *testing.T) {
 		r.Equal(2, st.maxPos)
 	})
 
+	t.Run("parses starting at an offset", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		num := Transform(Plus(Range('0', '9')), func(str string) interface{} {
+			i, _ := strconv.Atoi(str)
+			return &testIntNode{Val: i}
+		})
+
+		input := "let x = 12 + 3;\nlet y = 45;"
+
+		val, end, ok, err := p.ParseAt(num, input, 8)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(10, end)
+
+		n := val.(*testIntNode)
+		r.Equal(12, n.Val)
+		r.Equal(8, n.posStart)
+		r.Equal(10, n.posEnd)
+
+		val, end, ok, err = p.ParseAt(num, input, 24)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(26, end)
+		r.Equal(2, val.(*testIntNode).line)
+
+		_, end, ok, err = p.ParseAt(num, input, 0)
+		r.NoError(err)
+		r.False(ok)
+		r.Equal(0, end)
+
+		_, _, _, err = p.ParseAt(num, input, 100)
+		r.Error(err)
+
+		// The end is an offset in the input, even when positions are
+		// mapped elsewhere.
+		shift := WithOffsetMapper(OffsetMapperFunc(func(pos Pos) Pos {
+			pos.Offset += 100
+			return pos
+		}))
+
+		val, end, ok, err = New(shift).ParseAt(num, input, 8)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(10, end)
+		r.Equal(110, val.(*testIntNode).posEnd)
+	})
+
+	t.Run("parses repeated items", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		num := Transform(Plus(Range('0', '9')), func(str string) interface{} {
+			i, _ := strconv.Atoi(str)
+			return i
+		})
+
+		ws := Star(Set(' ', '\n', ','))
+
+		vals, spans, err := p.ParseAll(num, "1, 22\n333 ", ws)
+		r.NoError(err)
+		r.Equal([]interface{}{1, 22, 333}, vals)
+		r.Len(spans, 3)
+		r.Equal(Span{Start: Pos{Offset: 3, Line: 1, Column: 4}, End: Pos{Offset: 5, Line: 1, Column: 6}}, spans[1])
+		r.Equal("2:1-2:4", spans[2].String())
+
+		vals, _, err = p.ParseAll(num, "1 2 x 3", ws)
+		r.Error(err)
+		r.Equal([]interface{}{1, 2}, vals)
+
+		vals, _, err = p.ParseAll(num, "", nil)
+		r.NoError(err)
+		r.Empty(vals)
+	})
+
 	t.Run("a simple calculator", func(t *testing.T) {
 		r := require.New(t)
 		num := Transform(Plus(Range('0', '9')), func(s string) interface{} {
@@ -527,6 +1062,103 @@ func TestParse(t *testing.T) {
 		r.Equal(4, n.j.Val)
 	})
 
+	t.Run("parses a separated list", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithPartial(true))
+
+		list := SepBy(Capture(Range('a', 'z')), S(","))
+
+		r.Equal(`(< [a-z] > ("," < [a-z] >)*)?`, Print(list))
+
+		val, ok, err := p.Parse(list, "a,b,c")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"a", "b", "c"}, val)
+
+		_, ok, err = p.Parse(Seq(list, S(",")), "a,b,")
+		r.NoError(err)
+		r.True(ok)
+
+		val, ok, err = p.Parse(list, "")
+		r.NoError(err)
+		r.True(ok)
+		r.Len(val, 0)
+	})
+
+	t.Run("matches a rule a fixed number of times", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithPartial(true))
+
+		digit := Capture(Range('0', '9'))
+
+		val, ok, err := p.Parse(Times(digit, 3), "1234")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"1", "2", "3"}, val)
+
+		_, ok, err = p.Parse(Times(digit, 3), "12")
+		r.NoError(err)
+		r.False(ok)
+
+		val, ok, err = p.Parse(TimesRange(digit, 1, 2), "123")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"1", "2"}, val)
+
+		val, ok, err = p.Parse(TimesRange(digit, 0, -1), "")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{}, val)
+	})
+
+	t.Run("parses a bounded separated list", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithPartial(true))
+
+		flag := Capture(Range('a', 'z'))
+
+		flags := ManySep(flag, S(","), 2, 4, nil)
+
+		r.Equal(`< [a-z] > ("," < [a-z] >)[1,3]`, Print(flags))
+
+		val, ok, err := p.Parse(flags, "a,b,c")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"a", "b", "c"}, val)
+
+		_, ok, err = p.Parse(flags, "a")
+		r.NoError(err)
+		r.False(ok)
+
+		val, ok, err = p.Parse(Seq(flags, Capture(S(",e"))), "a,b,c,d,e")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(",e", val)
+
+		count := ManySep(flag, S(","), 0, 2, func(values []interface{}) interface{} {
+			return len(values)
+		})
+
+		r.Equal(`(< [a-z] > ("," < [a-z] >)[0,1])?`, Print(count))
+
+		val, ok, err = p.Parse(count, "")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(0, val)
+
+		val, ok, err = p.Parse(count, "a,b,c")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(2, val)
+
+		r.Panics(func() {
+			ManySep(flag, S(","), 3, 2, nil)
+		})
+	})
+
 }
 
 type testIntNode struct {
@@ -581,3 +1213,17 @@ func BenchmarkParse(b *testing.B) {
 		p.Parse(calc, "3+4")
 	}
 }
+
+func BenchmarkNotClass(b *testing.B) {
+	p := New()
+
+	body := Seq(S(`"`), Star(Seq(Not(Set('"', '\\')), Any())), S(`"`))
+
+	input := `"` + strings.Repeat("a string body without escapes ", 10) + `"`
+
+	b.SetBytes(int64(len(input)))
+
+	for i := 0; i < b.N; i++ {
+		p.Parse(body, input)
+	}
+}
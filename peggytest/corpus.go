@@ -0,0 +1,287 @@
+package peggytest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	p "github.com/lab47/peggysue"
+)
+
+// Corpus parses each file in a directory of sample inputs and checks that
+// parsing them has not become much slower than it was when the baseline was
+// recorded. A change to a grammar that introduces pathological backtracking
+// often still parses correctly, so without timing it only shows up when a
+// user hits a slow input.
+//
+// The baseline is a JSON file mapping each file's name to its parse time.
+// When the test is run with -peggytest.update, or -update if the test package
+// defines it, the baseline is written with the current times instead of being
+// compared.
+type Corpus struct {
+	// Parser is the parser to use. If nil, a parser created with New is used.
+	Parser *p.Parser
+
+	// Rule is the rule each file is parsed with.
+	Rule p.Rule
+
+	// Dir is the directory of the inputs.
+	Dir string
+
+	// Pattern selects the files in Dir to parse. It defaults to "*".
+	Pattern string
+
+	// Baseline is the path of the baseline file. It defaults to
+	// "corpus.baseline.json" in Dir, which is never parsed.
+	Baseline string
+
+	// Factor is how many times slower than its baseline a file may parse
+	// before the test fails. It defaults to 3.
+	Factor float64
+
+	// Slack is added to each allowed time, so that files that parse in a
+	// few microseconds don't fail from timing noise. It defaults to 1ms.
+	Slack time.Duration
+
+	// Budget, if set, is the longest any one parse may take, whether or
+	// not the file has a baseline. A parse that exceeds it is canceled.
+	Budget time.Duration
+
+	// Runs is the number of times each file is parsed. The fastest time is
+	// used, to reduce noise. It defaults to 3.
+	Runs int
+}
+
+// CorpusResult is the parse time of a file, as returned by Corpus.Run.
+// Baseline is zero if the file has no baseline.
+type CorpusResult struct {
+	File     string
+	Time     time.Duration
+	Baseline time.Duration
+}
+
+// Run parses each file as a subtest, failing those that don't parse, exceed
+// the budget, or regress beyond Factor times their baseline. Files without a
+// baseline only have to parse within the budget. It returns the times, so
+// tests can log or chart them.
+func (c *Corpus) Run(t *testing.T) []CorpusResult {
+	t.Helper()
+
+	parser := c.Parser
+	if parser == nil {
+		parser = p.New()
+	}
+
+	pattern := c.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	baselinePath := c.Baseline
+	if baselinePath == "" {
+		baselinePath = filepath.Join(c.Dir, "corpus.baseline.json")
+	}
+
+	factor := c.Factor
+	if factor == 0 {
+		factor = 3
+	}
+
+	slack := c.Slack
+	if slack == 0 {
+		slack = time.Millisecond
+	}
+
+	runs := c.Runs
+	if runs == 0 {
+		runs = 3
+	}
+
+	paths, err := filepath.Glob(filepath.Join(c.Dir, pattern))
+	if err != nil {
+		t.Fatalf("bad corpus pattern %q: %s", pattern, err)
+	}
+
+	baseline := map[string]time.Duration{}
+
+	if !updating() {
+		baseline, err = readBaseline(baselinePath)
+		if err != nil {
+			t.Fatalf("reading corpus baseline: %s", err)
+		}
+	}
+
+	var results []CorpusResult
+
+	for _, path := range paths {
+		if abs(path) == abs(baselinePath) {
+			continue
+		}
+
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+
+		name := filepath.Base(path)
+
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var best time.Duration
+
+			for i := 0; i < runs; i++ {
+				d, err := c.parse(parser, string(data))
+				if err != nil {
+					t.Fatalf("parsing %s: %s", path, err)
+				}
+
+				if i == 0 || d < best {
+					best = d
+				}
+			}
+
+			results = append(results, CorpusResult{File: name, Time: best, Baseline: baseline[name]})
+
+			if base, ok := baseline[name]; ok {
+				if regressed(best, base, factor, slack) {
+					t.Errorf("parsing %s took %s, over %.1f times its baseline of %s", path, best, factor, base)
+				}
+			}
+		})
+	}
+
+	if updating() {
+		times := make(map[string]time.Duration, len(results))
+		for _, res := range results {
+			times[res.File] = res.Time
+		}
+
+		if err := writeBaseline(baselinePath, times); err != nil {
+			t.Fatalf("writing corpus baseline: %s", err)
+		}
+	}
+
+	return results
+}
+
+// parse parses input once, returning how long it took. A parse that
+// exceeds the budget is canceled, and parse waits for it to stop, so that
+// it does not slow down the parses that follow.
+func (c *Corpus) parse(parser *p.Parser, input string) (time.Duration, error) {
+	type outcome struct {
+		d   time.Duration
+		err error
+	}
+
+	cancel := make(chan struct{})
+
+	cp := *parser
+	p.WithCancel(cancel)(&cp)
+
+	done := make(chan outcome, 1)
+
+	go func() {
+		start := time.Now()
+
+		_, ok, err := cp.Parse(c.Rule, input)
+		if err == nil && !ok {
+			err = p.ErrNoMatch
+		}
+
+		done <- outcome{d: time.Since(start), err: err}
+	}()
+
+	var timeout <-chan time.Time
+
+	if c.Budget > 0 {
+		timer := time.NewTimer(c.Budget)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	select {
+	case o := <-done:
+		if c.Budget > 0 && o.d > c.Budget {
+			return o.d, &budgetError{budget: c.Budget}
+		}
+
+		return o.d, o.err
+	case <-timeout:
+		close(cancel)
+		<-done
+
+		return c.Budget, &budgetError{budget: c.Budget}
+	}
+}
+
+// regressed reports whether d is more than factor times base, plus slack.
+func regressed(d, base time.Duration, factor float64, slack time.Duration) bool {
+	return d > time.Duration(float64(base)*factor)+slack
+}
+
+type budgetError struct {
+	budget time.Duration
+}
+
+func (e *budgetError) Error() string {
+	return "exceeded the time budget of " + e.budget.String()
+}
+
+func abs(path string) string {
+	if a, err := filepath.Abs(path); err == nil {
+		return a
+	}
+
+	return path
+}
+
+// readBaseline reads the baseline file. A missing file is an empty baseline.
+func readBaseline(path string) (map[string]time.Duration, error) {
+	times := map[string]time.Duration{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return times, nil
+		}
+
+		return nil, err
+	}
+
+	var strs map[string]string
+
+	if err := json.Unmarshal(data, &strs); err != nil {
+		return nil, err
+	}
+
+	for name, str := range strs {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+
+		times[name] = d
+	}
+
+	return times, nil
+}
+
+func writeBaseline(path string, times map[string]time.Duration) error {
+	strs := make(map[string]string, len(times))
+	for name, d := range times {
+		strs[name] = d.String()
+	}
+
+	data, err := json.MarshalIndent(strs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
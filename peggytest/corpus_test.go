@@ -0,0 +1,90 @@
+package peggytest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorpus(t *testing.T) {
+	t.Run("parses each file", func(t *testing.T) {
+		c := &Corpus{Rule: pairRule(), Dir: "testdata/corpus", Budget: time.Second}
+
+		results := c.Run(t)
+
+		require.Len(t, results, 2)
+		require.Equal(t, "one.txt", results[0].File)
+		require.Equal(t, "two.txt", results[1].File)
+	})
+
+	t.Run("records and compares with a baseline", func(t *testing.T) {
+		dir := t.TempDir()
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a=b"), 0o644))
+
+		c := &Corpus{Rule: pairRule(), Dir: dir}
+
+		withUpdate(true, func() {
+			c.Run(t)
+		})
+
+		data, err := os.ReadFile(filepath.Join(dir, "corpus.baseline.json"))
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"a.txt"`)
+
+		withUpdate(false, func() {
+			results := c.Run(t)
+			require.Len(t, results, 1)
+			require.NotZero(t, results[0].Baseline)
+		})
+	})
+}
+
+func TestCorpusBudget(t *testing.T) {
+	t.Run("fails parses that exceed it", func(t *testing.T) {
+		slow := p.CheckAction(func(p.Values) bool {
+			time.Sleep(50 * time.Millisecond)
+			return true
+		})
+
+		c := &Corpus{Rule: p.Seq(slow, pairRule()), Budget: time.Millisecond}
+
+		_, err := c.parse(p.New(), "a=b")
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "time budget"))
+	})
+
+	t.Run("stops parses that exceed it", func(t *testing.T) {
+		var calls int64
+
+		count := p.CheckAction(func(p.Values) bool {
+			atomic.AddInt64(&calls, 1)
+			return true
+		})
+
+		// Without memoization, e backtracks exponentially.
+		e := p.R("e")
+		e.Set(p.Or(p.Seq(count, p.S("a"), e, p.S("b")), p.Seq(p.S("a"), e, p.S("c")), p.S("a")))
+
+		c := &Corpus{Rule: e, Budget: 10 * time.Millisecond}
+
+		_, err := c.parse(p.New(p.WithMemo(false)), strings.Repeat("a", 64))
+		require.Error(t, err)
+
+		n := atomic.LoadInt64(&calls)
+		time.Sleep(20 * time.Millisecond)
+		require.Equal(t, n, atomic.LoadInt64(&calls))
+	})
+}
+
+func TestRegressed(t *testing.T) {
+	require.False(t, regressed(3*time.Millisecond, time.Millisecond, 3, 0))
+	require.True(t, regressed(4*time.Millisecond, time.Millisecond, 3, 0))
+	require.False(t, regressed(4*time.Millisecond, time.Millisecond, 3, time.Millisecond))
+}
@@ -0,0 +1,164 @@
+package peggytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+)
+
+// RoundTrip checks that a printer and a grammar agree: that parsing the
+// printed form of an AST gives the same AST back. This catches printers
+// that drop parentheses needed for precedence or forget to escape strings,
+// which unit tests of a few hand picked inputs tend to miss.
+type RoundTrip struct {
+	// Parser is the parser to use. If nil, a parser created with New is used.
+	Parser *p.Parser
+
+	// Rule is the rule that parses the printed ASTs.
+	Rule p.Rule
+
+	// Print returns the source text for an AST produced by the rule.
+	Print func(ast interface{}) string
+
+	// Generate returns a random AST. If nil, ASTs are made by parsing
+	// input generated from the rule by peggysue.Generate.
+	Generate func(rnd *rand.Rand) interface{}
+
+	// Iterations is the number of ASTs to check. It defaults to 100.
+	Iterations int
+
+	// Seed seeds the random number generator, so failures can be
+	// reproduced. It defaults to 1.
+	Seed int64
+
+	// MaxDepth is passed to peggysue.Generate. It defaults to 5.
+	MaxDepth int
+}
+
+// Run checks the round trip for each AST, reporting the first failure with
+// the AST, the printed text, and the AST it parsed back into. ASTs are
+// compared by their encoding with peggysue.EncodeAST, ignoring positions,
+// since printing usually changes them.
+func (rt *RoundTrip) Run(t testing.TB) {
+	t.Helper()
+
+	parser := rt.Parser
+	if parser == nil {
+		parser = p.New()
+	}
+
+	iterations := rt.Iterations
+	if iterations == 0 {
+		iterations = 100
+	}
+
+	seed := rt.Seed
+	if seed == 0 {
+		seed = 1
+	}
+
+	depth := rt.MaxDepth
+	if depth == 0 {
+		depth = 5
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+
+	checked := 0
+
+	for i := 0; i < iterations; i++ {
+		var ast interface{}
+
+		if rt.Generate != nil {
+			ast = rt.Generate(rnd)
+		} else {
+			input := p.Generate(rt.Rule, rnd, depth)
+
+			val, ok, err := parser.Parse(rt.Rule, input)
+			if err != nil || !ok {
+				continue
+			}
+
+			ast = val
+		}
+
+		checked++
+
+		want, err := encodeShape(ast)
+		if err != nil {
+			t.Fatalf("encoding AST: %s", err)
+			return
+		}
+
+		text := rt.Print(ast)
+
+		val, ok, err := parser.Parse(rt.Rule, text)
+		if err != nil || !ok {
+			if err == nil {
+				err = p.ErrNoMatch
+			}
+
+			t.Fatalf("round trip %d (seed %d) failed to parse printed AST:\nast:     %s\nprinted: %q\nerror:   %s", i, seed, want, text, err)
+			return
+		}
+
+		got, err := encodeShape(val)
+		if err != nil {
+			t.Fatalf("encoding AST: %s", err)
+			return
+		}
+
+		if got != want {
+			t.Fatalf("round trip %d (seed %d) changed the AST:\nast:     %s\nprinted: %q\nparsed:  %s", i, seed, want, text, got)
+			return
+		}
+	}
+
+	if checked == 0 {
+		t.Fatalf("none of the %d generated inputs matched the rule", iterations)
+	}
+}
+
+// encodeShape returns v encoded by EncodeAST without the positions.
+func encodeShape(v interface{}) (string, error) {
+	data, err := p.EncodeAST(v)
+	if err != nil {
+		return "", err
+	}
+
+	var tree interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&tree); err != nil {
+		return "", err
+	}
+
+	data, err = json.Marshal(stripSpans(tree))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func stripSpans(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		delete(v, "$span")
+
+		for k, e := range v {
+			v[k] = stripSpans(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stripSpans(e)
+		}
+	}
+
+	return v
+}
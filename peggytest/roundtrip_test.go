@@ -0,0 +1,116 @@
+package peggytest
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+type binary struct {
+	Op          string
+	Left, Right interface{}
+}
+
+func exprRule() p.Rule {
+	num := p.Transform(p.Plus(p.Range('0', '9')), func(s string) interface{} {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+
+	mk := func(lhs, op, rhs interface{}) interface{} {
+		return &binary{Op: op.(string), Left: lhs, Right: rhs}
+	}
+
+	primary := p.R("primary")
+
+	expr := p.Pratt(primary).
+		Infix(p.Capture(p.S("+")), 1, p.AssocLeft, mk).
+		Infix(p.Capture(p.S("*")), 2, p.AssocLeft, mk)
+
+	primary.Set(p.Or(
+		num,
+		p.Action(p.Seq(p.S("("), p.Named("e", expr), p.S(")")), func(v p.Values) interface{} {
+			return v.Get("e")
+		}),
+	))
+
+	return expr
+}
+
+func printExpr(parens bool) func(ast interface{}) string {
+	var print func(ast interface{}, prec int) string
+
+	print = func(ast interface{}, prec int) string {
+		b, ok := ast.(*binary)
+		if !ok {
+			return fmt.Sprint(ast)
+		}
+
+		bp := 1
+		if b.Op == "*" {
+			bp = 2
+		}
+
+		s := print(b.Left, bp) + b.Op + print(b.Right, bp+1)
+		if parens && bp < prec {
+			s = "(" + s + ")"
+		}
+
+		return s
+	}
+
+	return func(ast interface{}) string {
+		return print(ast, 0)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Run("passes when the printer agrees with the grammar", func(t *testing.T) {
+		rt := &RoundTrip{Rule: exprRule(), Print: printExpr(true)}
+		rt.Run(t)
+	})
+
+	t.Run("reports a printer that loses precedence", func(t *testing.T) {
+		rec := &recorder{TB: t}
+
+		rt := &RoundTrip{Rule: exprRule(), Print: printExpr(false)}
+		rt.Run(rec)
+
+		require.Contains(t, rec.failed, "changed the AST")
+		require.Contains(t, rec.failed, "seed 1")
+	})
+
+	t.Run("uses a custom generator", func(t *testing.T) {
+		var gen func(rnd *rand.Rand, depth int) interface{}
+
+		gen = func(rnd *rand.Rand, depth int) interface{} {
+			if depth == 0 || rnd.Intn(3) == 0 {
+				return rnd.Intn(100)
+			}
+
+			return &binary{
+				Op:    []string{"+", "*"}[rnd.Intn(2)],
+				Left:  gen(rnd, depth-1),
+				Right: gen(rnd, depth-1),
+			}
+		}
+
+		rt := &RoundTrip{
+			Rule:     exprRule(),
+			Print:    printExpr(true),
+			Generate: func(rnd *rand.Rand) interface{} { return gen(rnd, 4) },
+		}
+		rt.Run(t)
+
+		rec := &recorder{TB: t}
+
+		rt.Print = printExpr(false)
+		rt.Run(rec)
+
+		require.Contains(t, rec.failed, "changed the AST")
+	})
+}
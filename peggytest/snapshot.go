@@ -0,0 +1,204 @@
+// Package peggytest provides helpers for testing grammars. Snapshot tests
+// record the AST that a grammar produces for test inputs in testdata files,
+// so changes to the grammar that alter the AST show up as test failures.
+package peggytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+)
+
+// update is namespaced so that it does not collide with the -update flag
+// that test packages often define for their own golden files.
+var update = flag.Bool("peggytest.update", false, "update the snapshot files in testdata")
+
+// updating returns true if the test was run with -peggytest.update, or with
+// -update when the test package defines that as a bool flag.
+func updating() bool {
+	if *update {
+		return true
+	}
+
+	if f := flag.Lookup("update"); f != nil {
+		if g, ok := f.Value.(flag.Getter); ok {
+			on, _ := g.Get().(bool)
+			return on
+		}
+	}
+
+	return false
+}
+
+// Snapshot parses input with the rule and compares the result, encoded by
+// peggysue.EncodeAST, with the file testdata/<name>.golden. If the parse
+// fails, the error is recorded instead, so inputs that should be rejected
+// can be snapshotted too.
+//
+// When the test is run with -peggytest.update, the file is written rather
+// than compared. So is it with -update, if the test package defines it.
+func Snapshot(t testing.TB, parser *p.Parser, r p.Rule, name, input string) {
+	t.Helper()
+
+	compare(t, filepath.Join("testdata", name+".golden"), parseSnapshot(parser, r, input))
+}
+
+// SnapshotValue compares v, encoded by peggysue.EncodeAST, with the file
+// testdata/<name>.golden, as Snapshot does.
+func SnapshotValue(t testing.TB, name string, v interface{}) {
+	t.Helper()
+
+	data, err := encode(v)
+	if err != nil {
+		t.Fatalf("encoding snapshot %s: %s", name, err)
+	}
+
+	compare(t, filepath.Join("testdata", name+".golden"), data)
+}
+
+// SnapshotFiles runs Snapshot as a subtest for each file that matches the
+// glob pattern, such as "testdata/*.input", using the file's contents as the
+// input. The result is compared with the file's path with ".golden" added.
+func SnapshotFiles(t *testing.T, parser *p.Parser, r p.Rule, pattern string) {
+	t.Helper()
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("bad snapshot pattern %q: %s", pattern, err)
+	}
+
+	if len(paths) == 0 {
+		t.Fatalf("no files match %q", pattern)
+	}
+
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".golden") {
+			continue
+		}
+
+		path := path
+
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			input, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compare(t, path+".golden", parseSnapshot(parser, r, string(input)))
+		})
+	}
+}
+
+func parseSnapshot(parser *p.Parser, r p.Rule, input string) []byte {
+	val, ok, err := parser.Parse(r, input)
+
+	var v interface{}
+
+	switch {
+	case err != nil:
+		v = map[string]string{"$error": err.Error()}
+	case !ok:
+		v = map[string]string{"$error": "no match"}
+	default:
+		v = val
+	}
+
+	data, err := encode(v)
+	if err != nil {
+		data = []byte(fmt.Sprintf("error encoding value: %s\n", err))
+	}
+
+	return data
+}
+
+// encode returns v encoded with EncodeAST, indented to make diffs readable.
+func encode(v interface{}) ([]byte, error) {
+	data, err := p.EncodeAST(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func compare(t testing.TB, path string, got []byte) {
+	t.Helper()
+
+	if updating() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.Fatalf("snapshot %s does not exist, run with -peggytest.update to create it", path)
+			return
+		}
+
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("snapshot %s differs, run with -peggytest.update to accept the changes:\n%s", path, diff(string(want), string(got)))
+	}
+}
+
+// diff returns the lines of want and got around the first line where they
+// differ.
+func diff(want, got string) string {
+	const context = 3
+
+	wl := strings.Split(want, "\n")
+	gl := strings.Split(got, "\n")
+
+	i := 0
+	for i < len(wl) && i < len(gl) && wl[i] == gl[i] {
+		i++
+	}
+
+	start := i - context
+	if start < 0 {
+		start = 0
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "first difference at line %d\n", i+1)
+
+	for j := start; j < i; j++ {
+		fmt.Fprintf(&sb, "  %s\n", wl[j])
+	}
+
+	for j := i; j < i+context && j < len(wl); j++ {
+		fmt.Fprintf(&sb, "- %s\n", wl[j])
+	}
+
+	for j := i; j < i+context && j < len(gl); j++ {
+		fmt.Fprintf(&sb, "+ %s\n", gl[j])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,145 @@
+package peggytest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+type pos struct {
+	Start, End, Line int
+}
+
+func (ps *pos) SetPosition(start, end, line int, filename string) {
+	ps.Start, ps.End, ps.Line = start, end, line
+}
+
+type pair struct {
+	pos
+	Key   string
+	Value string
+}
+
+func pairRule() p.Rule {
+	word := p.Capture(p.Plus(p.Range('a', 'z')))
+
+	return p.Action(
+		p.Seq(p.Named("key", word), p.S("="), p.Named("value", word), p.Maybe(p.S("\n"))),
+		func(v p.Values) interface{} {
+			return &pair{Key: v.Get("key").(string), Value: v.Get("value").(string)}
+		},
+	)
+}
+
+// recorder is a testing.TB that records failures rather than reporting them.
+type recorder struct {
+	testing.TB
+	failed string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = fmt.Sprintf(format, args...)
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failed = fmt.Sprintf(format, args...)
+}
+
+// withUpdate sets the -peggytest.update flag to on while fn runs.
+func withUpdate(on bool, fn func()) {
+	saved := *update
+	*update = on
+
+	defer func() { *update = saved }()
+
+	fn()
+}
+
+// goldenUpdate is the -update flag that test packages often define for their
+// own golden files, which must not collide with the one in peggytest.
+var goldenUpdate = flag.Bool("update", false, "update the golden files")
+
+func TestSnapshot(t *testing.T) {
+	t.Run("compares with the golden file", func(t *testing.T) {
+		Snapshot(t, p.New(), pairRule(), "pair", "a=b")
+		Snapshot(t, p.New(), pairRule(), "pair-error", "a=")
+	})
+
+	t.Run("runs each matching file", func(t *testing.T) {
+		SnapshotFiles(t, p.New(), pairRule(), "testdata/*.input")
+	})
+
+	t.Run("reports differences", func(t *testing.T) {
+		rec := &recorder{TB: t}
+
+		withUpdate(false, func() {
+			Snapshot(rec, p.New(), pairRule(), "pair", "a=c")
+		})
+
+		require.Contains(t, rec.failed, "snapshot testdata/pair.golden differs")
+		require.Contains(t, rec.failed, `-   "Value": "b"`)
+		require.Contains(t, rec.failed, `+   "Value": "c"`)
+	})
+
+	t.Run("reports missing files", func(t *testing.T) {
+		rec := &recorder{TB: t}
+
+		withUpdate(false, func() {
+			SnapshotValue(rec, "missing", 1)
+		})
+
+		require.Contains(t, rec.failed, "run with -peggytest.update to create it")
+	})
+
+	t.Run("writes files when updating", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "sub", "value.golden")
+
+		withUpdate(true, func() {
+			compare(t, path, []byte("1\n"))
+		})
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "1\n", string(data))
+	})
+
+	t.Run("honors the -update flag of the test package", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "value.golden")
+
+		saved := *goldenUpdate
+		*goldenUpdate = true
+
+		defer func() { *goldenUpdate = saved }()
+
+		compare(t, path, []byte("2\n"))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "2\n", string(data))
+	})
+}
+
+func TestDiff(t *testing.T) {
+	d := diff("a\nb\nc\nd\n", "a\nb\nx\nd\n")
+
+	require.Equal(t, strings.Join([]string{
+		"first difference at line 3",
+		"  a",
+		"  b",
+		"- c",
+		"- d",
+		"- ",
+		"+ x",
+		"+ d",
+		"+ ",
+	}, "\n")+"\n", d)
+}
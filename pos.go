@@ -0,0 +1,225 @@
+package peggysue
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pos describes a position in the input.
+type Pos struct {
+	// Offset is the byte offset in the original input.
+	Offset int
+
+	// Line and Column are 1-based. How columns are counted is controlled
+	// by WithColumnMode.
+	Line   int
+	Column int
+
+	// Filename is the name of the file that the position is within, if known.
+	Filename string
+}
+
+// String returns the position in the conventional "file:line:column" form,
+// omitting the filename if there is none.
+func (p Pos) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// FileRegion describes a region of a virtual input that was assembled from
+// multiple files, such as after expanding includes. Positions within the
+// region are reported relative to the file the region came from.
+type FileRegion struct {
+	// Start is the byte offset in the input where the region begins. The
+	// region extends to the start of the next region or the end of input.
+	Start int
+
+	// Filename is the name of the file the region came from.
+	Filename string
+
+	// Line is the line in Filename that the region begins on. If it is 0,
+	// the region is assumed to begin on line 1.
+	Line int
+
+	// Column is the column in Filename that the region begins at, for a
+	// region that begins in the middle of a line. If it is 0, the region
+	// is assumed to begin at column 1.
+	Column int
+}
+
+// WithFilename sets the filename to report in positions when parsing with
+// Parse. ParseFile always uses the path of the file being parsed.
+func WithFilename(name string) Option {
+	return func(p *Parser) {
+		p.filename = name
+	}
+}
+
+// WithFileRegions sets the regions of the input that came from different
+// files. Positions before the first region use the filename given to
+// WithFilename or ParseFile.
+func WithFileRegions(regions ...FileRegion) Option {
+	return func(p *Parser) {
+		p.regions = append([]FileRegion(nil), regions...)
+
+		sort.SliceStable(p.regions, func(i, j int) bool {
+			return p.regions[i].Start < p.regions[j].Start
+		})
+	}
+}
+
+func (s *state) region(offset int) *FileRegion {
+	regions := s.p.regions
+
+	i := sort.Search(len(regions), func(i int) bool {
+		return regions[i].Start > offset
+	})
+
+	if i == 0 {
+		return nil
+	}
+
+	return &regions[i-1]
+}
+
+// position calculates the Pos for the given byte position in the input.
+func (s *state) position(bp int) Pos {
+	pos := Pos{
+		Offset:   s.srcMap.original(bp),
+		Line:     s.line(bp),
+		Column:   s.column(bp),
+		Filename: s.filename,
+	}
+
+	if r := s.region(pos.Offset); r != nil {
+		s.applyRegion(&pos, r)
+	}
+
+	if s.p.mapper != nil {
+		pos = s.p.mapper.MapPosition(pos)
+	}
+
+	return pos
+}
+
+func (s *state) applyRegion(pos *Pos, r *FileRegion) {
+	start := s.srcMap.decoded(r.Start)
+	startLine := s.line(start)
+
+	line := r.Line
+	if line == 0 {
+		line = 1
+	}
+
+	col := r.Column
+	if col == 0 {
+		col = 1
+	}
+
+	// A region may start in the middle of a line, in which case the columns
+	// on that line are relative to the start of the region.
+	if pos.Line == startLine {
+		pos.Column = pos.Column - s.column(start) + col
+	}
+
+	pos.Line = line + pos.Line - startLine
+	pos.Filename = r.Filename
+}
+
+// endOffset returns the offset to report for the end of a value that ends
+// at the given byte position.
+func (s *state) endOffset(bp int) int {
+	if s.p.mapper != nil {
+		return s.position(bp).Offset
+	}
+
+	return s.srcMap.original(bp)
+}
+
+// OffsetMapper translates positions in the input into positions in the
+// original sources. It is used when the input was produced by preprocessing,
+// such as expanding includes, stripping comments, or evaluating templates.
+type OffsetMapper interface {
+	// MapPosition is passed the position as calculated from the input and
+	// returns the position to report.
+	MapPosition(pos Pos) Pos
+}
+
+// OffsetMapperFunc adapts a function to the OffsetMapper interface.
+type OffsetMapperFunc func(pos Pos) Pos
+
+// MapPosition calls the function.
+func (f OffsetMapperFunc) MapPosition(pos Pos) Pos {
+	return f(pos)
+}
+
+// WithOffsetMapper sets the OffsetMapper used to translate all positions
+// reported by the parser.
+func WithOffsetMapper(m OffsetMapper) Option {
+	return func(p *Parser) {
+		p.mapper = m
+	}
+}
+
+type lineDirective struct {
+	line     int
+	filename string
+	origLine int
+}
+
+// LineMapper is an OffsetMapper that implements #line directive style
+// remapping, where a line in the input declares the file and line number
+// of the lines that follow it.
+type LineMapper struct {
+	directives []lineDirective
+}
+
+// Add declares that starting at the given line of the input, positions are
+// within filename beginning at origLine. If filename is empty, the filename
+// of the position is retained. Directives may be added in any order.
+func (m *LineMapper) Add(line int, filename string, origLine int) {
+	d := lineDirective{line: line, filename: filename, origLine: origLine}
+
+	i := sort.Search(len(m.directives), func(i int) bool {
+		return m.directives[i].line > line
+	})
+
+	m.directives = append(m.directives, lineDirective{})
+	copy(m.directives[i+1:], m.directives[i:])
+	m.directives[i] = d
+}
+
+// MapPosition translates pos according to the directives that have been added.
+func (m *LineMapper) MapPosition(pos Pos) Pos {
+	i := sort.Search(len(m.directives), func(i int) bool {
+		return m.directives[i].line > pos.Line
+	})
+
+	if i == 0 {
+		return pos
+	}
+
+	d := m.directives[i-1]
+
+	pos.Line = d.origLine + pos.Line - d.line
+
+	if d.filename != "" {
+		pos.Filename = d.filename
+	}
+
+	return pos
+}
+
+// Span describes the region of the input between two positions.
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// String returns the span in the form "file:line:column-line:column".
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%d:%d", s.Start, s.End.Line, s.End.Column)
+}
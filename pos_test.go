@@ -0,0 +1,116 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testFileNode struct {
+	line     int
+	filename string
+}
+
+func (t *testFileNode) SetPosition(start, end, line int, filename string) {
+	t.line = line
+	t.filename = filename
+}
+
+func TestPos(t *testing.T) {
+	word := Transform(Plus(Range('a', 'z')), func(string) interface{} {
+		return &testFileNode{}
+	})
+
+	words := PlusCapture(Seq(word, Star(Set(' ', '\n'))))
+
+	t.Run("reports the filename", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New(WithFilename("input.txt"))
+
+		val, ok, err := p.Parse(words, "foo\nbar")
+		r.NoError(err)
+		r.True(ok)
+
+		nodes := val.([]interface{})
+		r.Equal(&testFileNode{line: 1, filename: "input.txt"}, nodes[0])
+		r.Equal(&testFileNode{line: 2, filename: "input.txt"}, nodes[1])
+
+		_, _, err = p.Parse(words, "foo\nbar\n123")
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(err, &nc)
+		r.Equal(Pos{Offset: 8, Line: 3, Column: 1, Filename: "input.txt"}, nc.Pos)
+		r.Equal("input.txt:3:1", nc.Pos.String())
+	})
+
+	t.Run("maps regions of the input to different files", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "foo\nbar baz\nqux\n123"
+
+		p := New(
+			WithFilename("main.txt"),
+			WithFileRegions(
+				FileRegion{Start: 8, Filename: "inc.txt", Line: 10},
+				FileRegion{Start: 12, Filename: "main.txt", Line: 2},
+			),
+		)
+
+		val, _, err := p.Parse(words, input)
+
+		nodes := val.([]interface{})
+		r.Equal(&testFileNode{line: 1, filename: "main.txt"}, nodes[0])
+		r.Equal(&testFileNode{line: 2, filename: "main.txt"}, nodes[1])
+		r.Equal(&testFileNode{line: 10, filename: "inc.txt"}, nodes[2])
+		r.Equal(&testFileNode{line: 2, filename: "main.txt"}, nodes[3])
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(err, &nc)
+		r.Equal(Pos{Offset: 16, Line: 3, Column: 1, Filename: "main.txt"}, nc.Pos)
+
+		var ctx MatchContext
+
+		mid := Seq(S("foo\nbar "), CheckActionCtx(func(c *MatchContext) bool {
+			ctx = *c
+			return true
+		}))
+
+		_, _, err = New(WithPartial(true), WithFileRegions(FileRegion{Start: 8, Filename: "inc.txt"})).Parse(mid, input)
+		r.NoError(err)
+		r.Equal("inc.txt", ctx.Filename)
+		r.Equal(1, ctx.Line)
+		r.Equal(1, ctx.Column)
+	})
+
+	t.Run("translates positions with an offset mapper", func(t *testing.T) {
+		r := require.New(t)
+
+		var lm LineMapper
+		lm.Add(3, "orig.txt", 20)
+		lm.Add(2, "", 7)
+
+		p := New(WithFilename("pp.txt"), WithOffsetMapper(&lm))
+
+		val, _, err := p.Parse(words, "foo\nbar\nbaz\n123")
+
+		nodes := val.([]interface{})
+		r.Equal(&testFileNode{line: 1, filename: "pp.txt"}, nodes[0])
+		r.Equal(&testFileNode{line: 7, filename: "pp.txt"}, nodes[1])
+		r.Equal(&testFileNode{line: 20, filename: "orig.txt"}, nodes[2])
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(err, &nc)
+		r.Equal("orig.txt:21:1", nc.Pos.String())
+
+		shift := OffsetMapperFunc(func(pos Pos) Pos {
+			pos.Offset += 100
+			return pos
+		})
+
+		_, _, err = New(WithOffsetMapper(shift)).Parse(words, "foo 123")
+		r.ErrorAs(err, &nc)
+		r.Equal(104, nc.MaxPos)
+		r.Equal(104, nc.Pos.Offset)
+	})
+}
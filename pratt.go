@@ -0,0 +1,234 @@
+package peggysue
+
+import "strings"
+
+// PrattBuilder is a Rule that parses expressions using Pratt's top down
+// operator precedence algorithm. Operators are registered with a binding
+// power, where larger binding powers bind more tightly. Unlike modeling each
+// precedence level as a left recursive Ref, the operators are all handled by
+// a single rule, which is considerably faster for grammars with many levels.
+type PrattBuilder interface {
+	Rule
+
+	// Prefix registers a prefix operator matched by op. The operand is parsed
+	// with binding power bp, and fn is called with the values of op and the
+	// operand to produce the value.
+	Prefix(op Rule, bp int, fn func(op, v interface{}) interface{}) PrattBuilder
+
+	// Infix registers a binary operator matched by op with binding power bp.
+	// fn is called with the values of the operands and op to produce
+	// the value.
+	Infix(op Rule, bp int, assoc Assoc, fn func(lhs, op, rhs interface{}) interface{}) PrattBuilder
+
+	// Postfix registers a postfix operator matched by op with binding power
+	// bp. fn is called with the values of the operand and op to produce
+	// the value.
+	Postfix(op Rule, bp int, fn func(v, op interface{}) interface{}) PrattBuilder
+}
+
+type prattOp struct {
+	rule  Rule
+	bp    int
+	assoc Assoc
+
+	prefix  func(op, v interface{}) interface{}
+	infix   func(lhs, op, rhs interface{}) interface{}
+	postfix func(v, op interface{}) interface{}
+}
+
+type matchPratt struct {
+	basicRule
+	primary Rule
+
+	prefix  []prattOp
+	infix   []prattOp
+	postfix []prattOp
+}
+
+func (m *matchPratt) Prefix(op Rule, bp int, fn func(op, v interface{}) interface{}) PrattBuilder {
+	m.prefix = append(m.prefix, prattOp{rule: op, bp: bp, prefix: fn})
+	return m
+}
+
+func (m *matchPratt) Infix(op Rule, bp int, assoc Assoc, fn func(lhs, op, rhs interface{}) interface{}) PrattBuilder {
+	m.infix = append(m.infix, prattOp{rule: op, bp: bp, assoc: assoc, infix: fn})
+	return m
+}
+
+func (m *matchPratt) Postfix(op Rule, bp int, fn func(v, op interface{}) interface{}) PrattBuilder {
+	m.postfix = append(m.postfix, prattOp{rule: op, bp: bp, postfix: fn})
+	return m
+}
+
+func (m *matchPratt) match(s *state) result {
+	return s.check(m, m.expr(s, 0))
+}
+
+// expr parses an expression containing only operators with a binding power
+// of at least minBP.
+func (m *matchPratt) expr(s *state, minBP int) result {
+	start := s.mark()
+
+	lhs, ok := m.operand(s)
+	if !ok {
+		s.restore(start)
+		return result{}
+	}
+
+	// The binding power of a non-associative operator that was just
+	// matched, which prevents another operator with the same binding
+	// power from following it.
+	none := -1
+
+loop:
+	for {
+		mark := s.mark()
+
+		for _, op := range m.postfix {
+			if op.bp < minBP || op.bp == none {
+				continue
+			}
+
+			res := s.match(op.rule)
+			if !res.matched {
+				s.restore(mark)
+				continue
+			}
+
+			s.enterAction(m, start.pos)
+			lhs = op.postfix(lhs, res.value)
+			s.leaveAction()
+
+			m.setPosition(s, lhs, start.pos)
+			continue loop
+		}
+
+		for _, op := range m.infix {
+			if op.bp < minBP || op.bp == none {
+				continue
+			}
+
+			res := s.match(op.rule)
+			if !res.matched {
+				s.restore(mark)
+				continue
+			}
+
+			rbp := op.bp + 1
+			if op.assoc == AssocRight {
+				rbp = op.bp
+			}
+
+			rhs := m.expr(s, rbp)
+			if !rhs.matched {
+				s.restore(mark)
+				continue
+			}
+
+			s.enterAction(m, start.pos)
+			lhs = op.infix(lhs, res.value, rhs.value)
+			s.leaveAction()
+
+			m.setPosition(s, lhs, start.pos)
+
+			if op.assoc == AssocNone {
+				none = op.bp
+			} else {
+				none = -1
+			}
+
+			continue loop
+		}
+
+		return result{value: lhs, matched: true}
+	}
+}
+
+// operand parses a primary, possibly preceded by prefix operators.
+func (m *matchPratt) operand(s *state) (interface{}, bool) {
+	start := s.mark()
+
+	for _, op := range m.prefix {
+		res := s.match(op.rule)
+		if !res.matched {
+			s.restore(start)
+			continue
+		}
+
+		v := m.expr(s, op.bp)
+		if !v.matched {
+			s.restore(start)
+			continue
+		}
+
+		s.enterAction(m, start.pos)
+		val := op.prefix(res.value, v.value)
+		s.leaveAction()
+
+		m.setPosition(s, val, start.pos)
+
+		return val, true
+	}
+
+	res := s.match(m.primary)
+	return res.value, res.matched
+}
+
+func (m *matchPratt) setPosition(s *state, val interface{}, bp int) {
+	if sp, ok := val.(SetPositioner); ok {
+		start := s.position(bp)
+		sp.SetPosition(start.Offset, s.endOffset(s.pos), start.Line, start.Filename)
+	}
+}
+
+func (m *matchPratt) detectLeftRec(r Rule, rs ruleSet) bool {
+	left := []Rule{m.primary}
+
+	for _, op := range m.prefix {
+		left = append(left, op.rule)
+	}
+
+	for _, sub := range left {
+		if !rs.Add(sub) {
+			continue
+		}
+
+		if sub == r || sub.detectLeftRec(r, rs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *matchPratt) print() string {
+	var ops []string
+
+	for _, op := range m.prefix {
+		ops = append(ops, addParens(op.rule)+" _")
+	}
+
+	for _, op := range m.infix {
+		ops = append(ops, "_ "+addParens(op.rule)+" _")
+	}
+
+	for _, op := range m.postfix {
+		ops = append(ops, "_ "+addParens(op.rule))
+	}
+
+	return "pratt(" + Print(m.primary) + "; " + strings.Join(ops, ", ") + ")"
+}
+
+// Pratt returns a PrattBuilder that matches expressions made up of the
+// given primary rule combined with the operators registered on the builder.
+// Operands of the operators are the primary or nested expressions, so primary
+// is typically a Ref that also matches parenthesized expressions.
+//
+// When the input could match more than one operator, they are tried in the
+// order they were registered, with postfix operators tried before infix ones.
+//
+// The value of the match is the value of the primary, or the value returned
+// by the function of the outermost operator.
+func Pratt(primary Rule) PrattBuilder {
+	return &matchPratt{primary: primary}
+}
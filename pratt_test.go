@@ -0,0 +1,81 @@
+package peggysue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPratt(t *testing.T) {
+	show := func(lhs, op, rhs interface{}) interface{} {
+		return fmt.Sprintf("(%v %v %v)", lhs, op, rhs)
+	}
+
+	n := Capture(Plus(Range('0', '9')))
+
+	primary := R("primary")
+
+	expr := Pratt(primary).
+		Infix(Capture(S("<")), 1, AssocNone, show).
+		Infix(Capture(Set('+', '-')), 2, AssocLeft, show).
+		Infix(Capture(Set('*', '/')), 3, AssocLeft, show).
+		Infix(Capture(S("^")), 5, AssocRight, show).
+		Prefix(Capture(S("-")), 4, func(op, v interface{}) interface{} {
+			return fmt.Sprintf("(%v%v)", op, v)
+		}).
+		Postfix(Capture(S("!")), 6, func(v, op interface{}) interface{} {
+			return fmt.Sprintf("(%v%v)", v, op)
+		})
+
+	primary.Set(Or(
+		n,
+		Seq(S("("), Named("e", expr), S(")"), Action(S(""), func(v Values) interface{} {
+			return v.Get("e")
+		})),
+	))
+
+	t.Run("parses operators by binding power", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New()
+
+		for input, expected := range map[string]string{
+			"1":       "1",
+			"1+2*3":   "(1 + (2 * 3))",
+			"1-2-3":   "((1 - 2) - 3)",
+			"2^3^4":   "(2 ^ (3 ^ 4))",
+			"-2^2":    "(-(2 ^ 2))",
+			"-2*3":    "((-2) * 3)",
+			"2*3!":    "(2 * (3!))",
+			"(1+2)*3": "((1 + 2) * 3)",
+			"1+2<3*4": "((1 + 2) < (3 * 4))",
+			"--1":     "(-(-1))",
+		} {
+			v, ok, err := p.Parse(expr, input)
+			r.NoError(err, input)
+			r.True(ok, input)
+			r.Equal(expected, v, input)
+		}
+	})
+
+	t.Run("does not chain non-associative operators", func(t *testing.T) {
+		r := require.New(t)
+
+		_, _, err := New().Parse(expr, "1<2<3")
+		r.ErrorIs(err, ErrPartialInput)
+	})
+
+	t.Run("backtracks when an operator has no operand", func(t *testing.T) {
+		r := require.New(t)
+
+		v, ok, err := New(WithPartial(true)).Parse(expr, "1+2*")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("(1 + 2)", v)
+
+		_, ok, err = New().Parse(expr, "-")
+		r.NoError(err)
+		r.False(ok)
+	})
+}
@@ -0,0 +1,254 @@
+package peggysue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Precedence of each kind of rule when printed, used to decide where
+// parentheses are needed.
+const (
+	precChoice = iota
+	precSequence
+	precPrefix
+	precSuffix
+	precPrimary
+)
+
+// PrintGrammar returns every rule reachable from root, one definition per
+// line in the form "name <- rule", starting with root.
+//
+// Unlike Print, which relies on Refs to stop it from following recursive
+// rules, PrintGrammar detects cycles itself. Refs and rules given a name
+// with SetName are printed as their own definition. So is any other rule
+// that is part of a cycle, along with Refs that have no name, under a
+// synthetic name such as _1. Each definition is printed once, and
+// parentheses are added wherever they are needed to preserve grouping.
+func PrintGrammar(root Rule) string {
+	gp := &grammarPrinter{
+		names:   make(map[Rule]string),
+		used:    make(map[string]bool),
+		onStack: make(map[Rule]bool),
+		seen:    make(map[Rule]bool),
+	}
+
+	root = unchain(root)
+
+	gp.define(root)
+	gp.discover(root)
+
+	var sb strings.Builder
+
+	for _, r := range gp.defs {
+		fmt.Fprintf(&sb, "%s <- %s\n", gp.names[r], gp.body(r))
+	}
+
+	return sb.String()
+}
+
+type grammarPrinter struct {
+	names   map[Rule]string
+	used    map[string]bool
+	defs    []Rule
+	onStack map[Rule]bool
+	seen    map[Rule]bool
+	next    int
+}
+
+// define makes r a definition, giving it a name that isn't used by any
+// other definition.
+func (gp *grammarPrinter) define(r Rule) {
+	if _, ok := gp.names[r]; ok {
+		return
+	}
+
+	name := r.Name()
+
+	if name == "" {
+		for name == "" || gp.used[name] {
+			gp.next++
+			name = fmt.Sprintf("_%d", gp.next)
+		}
+	} else if gp.used[name] {
+		base := name
+		for i := 2; gp.used[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+	}
+
+	gp.used[name] = true
+	gp.names[r] = name
+	gp.defs = append(gp.defs, r)
+}
+
+// discover walks the rules reachable from r, finding the definitions.
+func (gp *grammarPrinter) discover(r Rule) {
+	r = unchain(r)
+
+	if r == nil {
+		return
+	}
+
+	if gp.onStack[r] {
+		// A cycle that didn't pass through a definition.
+		gp.define(r)
+		return
+	}
+
+	if gp.seen[r] {
+		return
+	}
+
+	gp.seen[r] = true
+
+	if _, ok := r.(*matchRef); ok || r.Name() != "" {
+		gp.define(r)
+	}
+
+	gp.onStack[r] = true
+
+	for _, sub := range subRules(r) {
+		gp.discover(sub)
+	}
+
+	delete(gp.onStack, r)
+}
+
+// ref returns how r is printed when used within another rule, along with
+// its precedence.
+func (gp *grammarPrinter) ref(r Rule) (string, int) {
+	r = unchain(r)
+
+	if r == nil {
+		return "<nil>", precPrimary
+	}
+
+	if name, ok := gp.names[r]; ok {
+		return name, precPrimary
+	}
+
+	return gp.expr(r)
+}
+
+// operand prints r, adding parentheses if it binds less tightly than min.
+func (gp *grammarPrinter) operand(r Rule, min int) string {
+	str, prec := gp.ref(r)
+	if prec < min {
+		return "(" + str + ")"
+	}
+
+	return str
+}
+
+// body prints the definition of r.
+func (gp *grammarPrinter) body(r Rule) string {
+	if ref, ok := r.(*matchRef); ok {
+		str, _ := gp.ref(ref.rule)
+		return str
+	}
+
+	str, _ := gp.expr(r)
+	return str
+}
+
+func (gp *grammarPrinter) join(rules []Rule, sep string, min int) string {
+	parts := make([]string, len(rules))
+
+	for i, r := range rules {
+		parts[i] = gp.operand(r, min)
+	}
+
+	return strings.Join(parts, sep)
+}
+
+// expr prints r itself, rather than its name, along with its precedence.
+func (gp *grammarPrinter) expr(r Rule) (string, int) {
+	switch m := r.(type) {
+	case *matchRef:
+		return gp.ref(m.rule)
+	case *matchOr, *matchEither, *matchPrefixTable, *matchBranch:
+		subs := subRules(m)
+		if b, ok := m.(*matchBranch); ok {
+			subs = subs[:len(b.rules)]
+		}
+		return gp.join(subs, " | ", precSequence), precChoice
+	case *matchSeq, *matchSeqAll, *matchBoth, *matchThree:
+		return gp.join(subRules(m), " ", precPrefix), precSequence
+	case *matchZeroOrMore, *matchFold:
+		return gp.operand(subRules(m)[0], precPrimary) + "*", precSuffix
+	case *matchOneOrMore:
+		return gp.operand(m.rule, precPrimary) + "+", precSuffix
+	case *matchOptional:
+		return gp.operand(m.rule, precPrimary) + "?", precSuffix
+	case *matchMaybeValue:
+		return gp.operand(m.rule, precPrimary) + "?", precSuffix
+	case *matchCount:
+		return fmt.Sprintf("%s{%d}", gp.operand(m.rule, precPrimary), m.num), precSuffix
+	case *matchMany:
+		switch {
+		case m.min == 0 && m.max == -1:
+			return gp.operand(m.rule, precPrimary) + "*", precSuffix
+		case m.min == 1 && m.max == -1:
+			return gp.operand(m.rule, precPrimary) + "+", precSuffix
+		default:
+			return fmt.Sprintf("%s[%d,%d]", gp.operand(m.rule, precPrimary), m.min, m.max), precSuffix
+		}
+	case *matchCheck:
+		return "&" + gp.operand(m.rule, precSuffix), precPrefix
+	case *matchNot:
+		return "!" + gp.operand(m.rule, precSuffix), precPrefix
+	case *matchSepBy:
+		str := sepByString(gp.operand(m.rule, precPrefix), gp.operand(m.sep, precPrefix), m.min, m.max)
+		if m.min == 0 {
+			return str, precSuffix
+		}
+
+		return str, precSequence
+	case *matchNamed:
+		return gp.operand(m.rule, precPrimary) + ":" + m.name, precSuffix
+	case *matchCapture:
+		str, _ := gp.ref(m.rule)
+		return "< " + str + " >", precPrimary
+	case *matchBind:
+		return gp.operand(m.rule, precPrefix) + " >>= <go-func>", precSequence
+	case *matchAction, *matchApply, *matchScope, *matchTransform, *matchCall:
+		return gp.ref(subRules(m)[0])
+	case *matchPratt:
+		var ops []string
+
+		for _, op := range m.prefix {
+			ops = append(ops, gp.operand(op.rule, precPrimary)+" _")
+		}
+
+		for _, op := range m.infix {
+			ops = append(ops, "_ "+gp.operand(op.rule, precPrimary)+" _")
+		}
+
+		for _, op := range m.postfix {
+			ops = append(ops, "_ "+gp.operand(op.rule, precPrimary))
+		}
+
+		str, _ := gp.ref(m.primary)
+
+		return "pratt(" + str + "; " + strings.Join(ops, ", ") + ")", precPrimary
+	case *matchNotByte:
+		return m.print(), precPrefix
+	case *matchNotClass:
+		return m.print(), precSequence
+	case *matchCustom:
+		if _, ct := customType(m.cr); ct != nil && ct.Print != nil {
+			rules := customRules(m.cr)
+
+			strs := make([]string, len(rules))
+			for i, r := range rules {
+				strs[i] = gp.operand(r, precPrimary)
+			}
+
+			return ct.Print(m.cr, strs), precPrimary
+		}
+
+		return m.print(), precPrimary
+	default:
+		return r.print(), precPrimary
+	}
+}
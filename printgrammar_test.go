@@ -0,0 +1,70 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintGrammar(t *testing.T) {
+	t.Run("prints each definition once", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			expr = R("expr")
+			term = R("term")
+			num  = N("num", Plus(Range('0', '9')))
+		)
+
+		expr.Set(Seq(term, Star(Seq(Or(S("+"), S("-")), term))))
+		term.Set(Or(num, Seq(S("("), Named("inner", expr), S(")"))))
+
+		r.Equal(
+			`expr <- term (("+" | "-") term)*`+"\n"+
+				`term <- num | "(" expr:inner ")"`+"\n"+
+				`num <- [0-9]+`+"\n",
+			PrintGrammar(expr))
+	})
+
+	t.Run("adds parentheses where needed", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := Seq(
+			Or(S("a"), S("b")),
+			Not(Seq(S("c"), S("d"))),
+			Maybe(Or(S("e"), Capture(Seq(S("f"), S("g"))))),
+			Count(S("h"), 2),
+		)
+
+		r.Equal(`_1 <- ("a" | "b") !("c" "d") ("e" | < "f" "g" >)? "h"{2}`+"\n", PrintGrammar(rule))
+	})
+
+	t.Run("names cycles that don't pass through a Ref", func(t *testing.T) {
+		r := require.New(t)
+
+		// Rules can only be made recursive without a Ref from within the
+		// package, but the printer must not loop on them.
+		nested := &matchOr{}
+		nested.rules = []Rule{Seq(S("("), Action(nested, nil), S(")")), S("x")}
+
+		r.Equal(`_1 <- "(" (_1 | "x") ")"`+"\n", PrintGrammar(nested.rules[0]))
+
+		r.Equal(
+			`_1 <- "<" _2 ">"`+"\n"+`_2 <- "(" _2 ")" | "x"`+"\n",
+			PrintGrammar(Seq(S("<"), nested, S(">"))))
+	})
+
+	t.Run("renames anonymous and duplicate rules", func(t *testing.T) {
+		r := require.New(t)
+
+		a1 := R("a")
+		a2 := R("a")
+		anon := R("")
+
+		a1.Set(Seq(a2, anon))
+		a2.Set(S("x"))
+		anon.Set(Or(S("y"), a1))
+
+		r.Equal("a <- a_2 _1\na_2 <- \"x\"\n_1 <- \"y\" | a\n", PrintGrammar(a1))
+	})
+}
@@ -0,0 +1,53 @@
+package peggysue
+
+import "math"
+
+// progressSteps is the number of times, at most, that the progress function
+// is called as the parser advances through the input.
+const progressSteps = 100
+
+// WithProgress registers fn to be called as the parser advances through the
+// input, so that tools parsing large inputs can display a progress bar or log
+// that a slow parse is still running. fn is passed the furthest offset that
+// the parser has reached and the size of the input.
+//
+// To keep the overhead low, fn is only called each time the parser advances
+// by another 1% of the input, and once more when parsing finishes. Because
+// of backtracking, the furthest offset may be beyond the input that has been
+// successfully matched.
+func WithProgress(fn func(pos, total int)) Option {
+	return func(p *Parser) {
+		p.progress = fn
+	}
+}
+
+// startProgress sets up reporting progress. When there is no progress
+// function, nextProgress is never reached.
+func (s *state) startProgress() {
+	if s.p.progress == nil {
+		s.nextProgress = math.MaxInt
+		return
+	}
+
+	s.progressStep = s.inputSize / progressSteps
+	if s.progressStep < 1 {
+		s.progressStep = 1
+	}
+
+	s.nextProgress = s.progressStep
+	s.progressPos = -1
+}
+
+func (s *state) reportProgress() {
+	s.nextProgress = s.maxPos + s.progressStep
+	s.progressPos = s.maxPos
+
+	s.p.progress(s.endOffset(s.maxPos), s.endOffset(s.inputSize))
+}
+
+// finishProgress reports the final position, if it hasn't been already.
+func (s *state) finishProgress() {
+	if s.p.progress != nil && s.progressPos != s.maxPos {
+		s.reportProgress()
+	}
+}
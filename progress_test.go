@@ -0,0 +1,52 @@
+package peggysue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	t.Run("reports the furthest position reached", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls [][2]int
+
+		p := New(WithProgress(func(pos, total int) {
+			calls = append(calls, [2]int{pos, total})
+		}))
+
+		input := strings.Repeat("a", 1000)
+
+		_, ok, err := p.Parse(Star(S("a")), input)
+		r.NoError(err)
+		r.True(ok)
+
+		r.Len(calls, 100)
+		r.Equal([2]int{10, 1000}, calls[0])
+		r.Equal([2]int{1000, 1000}, calls[len(calls)-1])
+
+		for i := 1; i < len(calls); i++ {
+			r.Greater(calls[i][0], calls[i-1][0])
+		}
+	})
+
+	t.Run("reports where a failed parse stopped", func(t *testing.T) {
+		r := require.New(t)
+
+		var last int
+
+		p := New(WithProgress(func(pos, total int) {
+			last = pos
+		}))
+
+		_, ok, _ := p.Parse(Seq(Star(S("a")), S("b")), "aaaac")
+		r.False(ok)
+		r.Equal(4, last)
+
+		_, _, err := p.ParseAll(S("a"), "aaa", nil)
+		r.NoError(err)
+		r.Equal(3, last)
+	})
+}
@@ -0,0 +1,135 @@
+package peggysue
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// RecoveredError describes input that was skipped by a Recover rule because
+// its rule did not match.
+type RecoveredError struct {
+	// Span is the input that was skipped.
+	Span Span
+
+	// Pos is the furthest position in the input that was reached, and
+	// Rule the Ref that was being matched when it was.
+	Pos  Pos
+	Rule Rule
+}
+
+func (e *RecoveredError) Error() string {
+	return fmt.Sprintf("%s: %s, skipped to %s", e.Pos, ErrNoMatch, e.Span.End)
+}
+
+// Is allows errors.Is(err, ErrNoMatch) to detect RecoveredError.
+func (e *RecoveredError) Is(target error) bool {
+	return target == ErrNoMatch
+}
+
+type matchRecover struct {
+	basicRule
+	rule Rule
+	sync Rule
+}
+
+func (m *matchRecover) match(s *state) result {
+	start := s.mark()
+
+	res := s.match(m.rule)
+	if res.matched {
+		return s.check(m, res)
+	}
+
+	s.restore(start)
+
+	// Skipping nothing would let a repetition of the rule loop forever.
+	if s.pos == s.inputSize {
+		return s.check(m, result{})
+	}
+
+	maxPos, maxRule := s.maxPos, s.maxRule
+
+	for s.pos < s.inputSize {
+		mark := s.mark()
+
+		sync := s.match(m.sync)
+		if sync.matched {
+			// A sync rule that matches without consuming anything at
+			// the start means the input is already where it should stop,
+			// so there is nothing to skip.
+			if s.pos == start.pos {
+				s.restore(start)
+				return s.check(m, result{})
+			}
+
+			break
+		}
+
+		s.restore(mark)
+
+		_, sz := utf8.DecodeRuneInString(s.cur())
+		s.pos += sz
+	}
+
+	s.spans = &spanList{
+		start: start.pos,
+		end:   s.pos,
+		err: &RecoveredError{
+			Span: Span{Start: s.position(start.pos), End: s.position(s.pos)},
+			Pos:  s.position(maxPos),
+			Rule: maxRule,
+		},
+		prev: s.spans,
+	}
+
+	return s.check(m, result{matched: true})
+}
+
+func (m *matchRecover) detectLeftRec(r Rule, rs ruleSet) bool {
+	if !rs.Add(m.rule) {
+		return false
+	}
+
+	return m.rule == r || m.rule.detectLeftRec(r, rs)
+}
+
+func (m *matchRecover) print() string {
+	return fmt.Sprintf("recover(%s, %s)", Print(m.rule), Print(m.sync))
+}
+
+// Recover returns a rule that matches r, or if r does not match, recovers
+// from the error by skipping input up to and including the next match of
+// sync, or to the end of the input. For instance, Recover(stmt, S(";"))
+// skips the rest of an invalid statement, and Recover(stmt, Check(S("}")))
+// skips to the end of the block without consuming the "}". Some input is
+// always skipped, so Recover fails at the end of the input, and when sync
+// matches no input where r was tried, such as in front of the "}". This
+// way a repetition of it always ends.
+//
+// This allows a parse to continue past invalid input. The skipped input is
+// reported as a RecoveredError by Run and Parse, and becomes an Error node
+// in the tree returned by ParseTree. As with the values of rules, errors
+// reported within an alternative that is later abandoned are discarded.
+//
+// When r does not match, the value of the match is nil.
+func Recover(r, sync Rule) Rule {
+	return &matchRecover{rule: r, sync: sync}
+}
+
+// recovered returns the errors reported by Recover rules on the path the
+// parse took, in the order they appear in the input.
+func (s *state) recovered() []error {
+	var errs []error
+
+	for sl := s.spans; sl != nil; sl = sl.prev {
+		if sl.err != nil {
+			errs = append(errs, sl.err)
+		}
+	}
+
+	for i, j := 0, len(errs)-1; i < j; i, j = i+1, j-1 {
+		errs[i], errs[j] = errs[j], errs[i]
+	}
+
+	return errs
+}
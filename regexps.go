@@ -0,0 +1,361 @@
+package peggysue
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"unicode"
+)
+
+// RegexpUse describes a rule created with Re. It is returned by
+// AuditRegexps.
+type RegexpUse struct {
+	// Rule is the rule, and Def is the name of the Ref whose definition
+	// contains it, or empty if it is not within one.
+	Rule Rule
+	Def  string
+
+	// Pattern is the regexp, as passed to Re.
+	Pattern string
+
+	// Calls is the number of times the rule was matched, taken from the
+	// counts passed to AuditRegexps.
+	Calls int
+
+	// Native is a rule built without regexps that matches the same input,
+	// or nil if the regexp can't be converted, in which case Reason says
+	// why.
+	Native Rule
+	Reason string
+}
+
+func (ru *RegexpUse) String() string {
+	prefix := ""
+	if ru.Def != "" {
+		prefix = ru.Def + ": "
+	}
+
+	if ru.Native != nil {
+		return fmt.Sprintf("%s/%s/ called %d times, can be written as %s", prefix, ru.Pattern, ru.Calls, Print(ru.Native))
+	}
+
+	return fmt.Sprintf("%s/%s/ called %d times, can not be converted: %s", prefix, ru.Pattern, ru.Calls, ru.Reason)
+}
+
+// AuditRegexps lists the rules reachable from root that were created with
+// Re, which hide the cost of running a regexp engine on every match. counts
+// are the number of times each rule was matched, as recorded by
+// WithCallCounts while parsing typical input, and may be nil. The rules are
+// ordered by decreasing Calls, so that the regexps in hot paths come first.
+//
+// Each regexp is converted to native rules where that can be done without
+// changing what it matches. A regexp can be converted if it only uses
+// literals, character classes, concatenation, and greedy repetition, and
+// its alternations and repetitions never need to backtrack, which is the
+// case when the first character decides which way to go.
+func AuditRegexps(root Rule, counts map[Rule]int) []*RegexpUse {
+	var uses []*RegexpUse
+
+	for r, def := range ruleDefs(root) {
+		m, ok := r.(*matchRegexp)
+		if !ok {
+			continue
+		}
+
+		use := &RegexpUse{
+			Rule:    m,
+			Def:     def,
+			Pattern: m.str,
+			Calls:   counts[m],
+		}
+
+		use.Native, use.Reason = nativeRegexp(m.str)
+
+		uses = append(uses, use)
+	}
+
+	sort.Slice(uses, func(i, j int) bool {
+		a, b := uses[i], uses[j]
+
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+
+		if a.Def != b.Def {
+			return a.Def < b.Def
+		}
+
+		return a.Pattern < b.Pattern
+	})
+
+	return uses
+}
+
+// AuditRegexps validates the grammar and then runs AuditRegexps on its root
+// rule.
+func (g *Grammar) AuditRegexps(counts map[Rule]int) ([]*RegexpUse, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	return AuditRegexps(g.labels.refs[g.root], counts), nil
+}
+
+// nativeRegexp converts the regexp str to native rules, or returns the
+// reason it can't be.
+func nativeRegexp(str string) (Rule, string) {
+	re, err := syntax.Parse(str, syntax.Perl)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	rc := &regexpConverter{}
+
+	rule := rc.convert(re.Simplify(), nil)
+	if rc.reason != "" {
+		return nil, rc.reason
+	}
+
+	return rule, ""
+}
+
+type regexpConverter struct {
+	reason string
+}
+
+func (rc *regexpConverter) fail(format string, args ...interface{}) Rule {
+	if rc.reason == "" {
+		rc.reason = fmt.Sprintf(format, args...)
+	}
+
+	return nil
+}
+
+// follow is the set of characters that may come after a part of a
+// regexp, or nil if the part may be at the end of the regexp.
+type follow []rune
+
+// convert converts re, which is followed by characters in next.
+func (rc *regexpConverter) convert(re *syntax.Regexp, next follow) Rule {
+	if re.Flags&syntax.FoldCase != 0 && (re.Op == syntax.OpLiteral) {
+		return rc.fail("case-insensitive matching")
+	}
+
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return S("")
+	case syntax.OpLiteral:
+		return S(string(re.Rune))
+	case syntax.OpCharClass:
+		return charClass(re.Rune)
+	case syntax.OpAnyCharNotNL:
+		return Seq(Not(S("\n")), Any())
+	case syntax.OpAnyChar:
+		return Any()
+	case syntax.OpCapture:
+		return rc.convert(re.Sub[0], next)
+	case syntax.OpConcat:
+		parts := make([]Rule, len(re.Sub))
+
+		for i, sub := range re.Sub {
+			parts[i] = rc.convert(sub, followOf(re.Sub[i+1:], next))
+		}
+
+		return Seq(parts...)
+	case syntax.OpAlternate:
+		alts := make([]Rule, len(re.Sub))
+
+		for i, sub := range re.Sub {
+			for _, other := range re.Sub[i+1:] {
+				if nullable(sub) || nullable(other) || overlaps(first(sub), first(other)) {
+					return rc.fail("alternatives of %s may begin with the same character", re)
+				}
+			}
+
+			alts[i] = rc.convert(sub, next)
+		}
+
+		return Or(alts...)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if re.Flags&syntax.NonGreedy != 0 {
+			return rc.fail("non-greedy repetition %s", re)
+		}
+
+		sub := re.Sub[0]
+
+		if nullable(sub) {
+			return rc.fail("repetition %s of a regexp that matches the empty string", re)
+		}
+
+		if next != nil && overlaps(first(sub), next) {
+			return rc.fail("repetition %s may need to give back input to what follows it", re)
+		}
+
+		rule := rc.convert(sub, first(sub))
+
+		switch re.Op {
+		case syntax.OpStar:
+			return Star(rule)
+		case syntax.OpPlus:
+			return Plus(rule)
+		case syntax.OpQuest:
+			return Maybe(rule)
+		default:
+			return Many(rule, re.Min, re.Max, nil)
+		}
+	default:
+		return rc.fail("unsupported regexp operator in %s", re)
+	}
+}
+
+// charClass converts the ranges of a character class.
+func charClass(ranges []rune) Rule {
+	var (
+		single []rune
+		alts   []Rule
+	)
+
+	for i := 0; i < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+
+		if lo == hi {
+			single = append(single, lo)
+			continue
+		}
+
+		if lo == 0 && hi == unicode.MaxRune {
+			alts = append(alts, Any())
+			continue
+		}
+
+		alts = append(alts, Range(lo, hi))
+	}
+
+	if len(single) > 0 {
+		alts = append([]Rule{Set(single...)}, alts...)
+	}
+
+	if len(alts) == 1 {
+		return alts[0]
+	}
+
+	return Or(alts...)
+}
+
+// followOf returns the characters that may begin the rest of a
+// concatenation, which is followed by next.
+func followOf(rest []*syntax.Regexp, next follow) follow {
+	var set follow
+
+	for _, re := range rest {
+		set = append(set, first(re)...)
+
+		if !nullable(re) {
+			return set
+		}
+	}
+
+	if next == nil {
+		return nil
+	}
+
+	return append(set, next...)
+}
+
+// first returns the ranges of the characters that re may begin with.
+func first(re *syntax.Regexp) []rune {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return nil
+		}
+
+		r := re.Rune[0]
+
+		if re.Flags&syntax.FoldCase != 0 {
+			var set []rune
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				set = append(set, f, f)
+			}
+
+			return append(set, r, r)
+		}
+
+		return []rune{r, r}
+	case syntax.OpCharClass:
+		return re.Rune
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []rune{0, unicode.MaxRune}
+	case syntax.OpCapture, syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		return first(re.Sub[0])
+	case syntax.OpConcat:
+		var set []rune
+
+		for _, sub := range re.Sub {
+			set = append(set, first(sub)...)
+
+			if !nullable(sub) {
+				break
+			}
+		}
+
+		return set
+	case syntax.OpAlternate:
+		var set []rune
+
+		for _, sub := range re.Sub {
+			set = append(set, first(sub)...)
+		}
+
+		return set
+	default:
+		return nil
+	}
+}
+
+// nullable reports whether re may match the empty string.
+func nullable(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpStar, syntax.OpQuest,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	case syntax.OpLiteral:
+		return len(re.Rune) == 0
+	case syntax.OpCapture, syntax.OpPlus:
+		return nullable(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || nullable(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !nullable(sub) {
+				return false
+			}
+		}
+
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if nullable(sub) {
+				return true
+			}
+		}
+
+		return false
+	default:
+		return false
+	}
+}
+
+// overlaps reports whether two lists of ranges have a character in common.
+func overlaps(a, b []rune) bool {
+	for i := 0; i+1 < len(a); i += 2 {
+		for j := 0; j+1 < len(b); j += 2 {
+			if a[i] <= b[j+1] && b[j] <= a[i+1] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
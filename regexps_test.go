@@ -0,0 +1,87 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRegexps(t *testing.T) {
+	t.Run("lists regexps by calls", func(t *testing.T) {
+		r := require.New(t)
+
+		ident := Re(`[a-z_][a-z0-9_]*`)
+		num := Re(`[0-9]+`)
+
+		item := R("item")
+		item.Set(Or(ident, num))
+
+		list := N("list", SepBy(item, S(",")))
+
+		counts := make(map[Rule]int)
+
+		_, ok, err := New(WithCallCounts(counts)).Parse(list, "a,b,1,c")
+		r.NoError(err)
+		r.True(ok)
+
+		uses := AuditRegexps(list, counts)
+		r.Len(uses, 2)
+
+		r.Equal(`[a-z_][a-z0-9_]*`, uses[0].Pattern)
+		r.Equal("item", uses[0].Def)
+		r.Equal(4, uses[0].Calls)
+		r.Equal(`[0-9]+`, uses[1].Pattern)
+		r.Equal(1, uses[1].Calls)
+
+		r.Equal(`item: /[a-z_][a-z0-9_]*/ called 4 times, can be written as `+Print(uses[0].Native), uses[0].String())
+	})
+
+	t.Run("converts regexps that don't backtrack", func(t *testing.T) {
+		cases := []struct {
+			re     string
+			inputs []string
+		}{
+			{`[a-z_][a-z0-9_]*`, []string{"abc", "_x9", "9a", ""}},
+			{`-?[0-9]+(\.[0-9]+)?`, []string{"12", "-1.5", "1.", ".5", "-"}},
+			{`"[^"\n]*"`, []string{`"hi"`, `""`, `"a`, "\"a\nb\""}},
+			{`(if|else|for)`, []string{"if", "else", "for", "fo", "e"}},
+			{`a{2,3}b`, []string{"ab", "aab", "aaab", "aaaab"}},
+			{`x.y`, []string{"xay", "x\ny"}},
+		}
+
+		for _, c := range cases {
+			native, reason := nativeRegexp(c.re)
+			require.NotNil(t, native, "%s: %s", c.re, reason)
+
+			for _, in := range c.inputs {
+				p := New(WithPartial(true))
+
+				_, reOK, _ := p.Parse(Re(c.re), in)
+				_, nativeOK, _ := p.Parse(native, in)
+				require.Equal(t, reOK, nativeOK, "%s on %q", c.re, in)
+
+				if reOK {
+					_, reFull, _ := New().Parse(Re(c.re), in)
+					_, nativeFull, _ := New().Parse(native, in)
+					require.Equal(t, reFull, nativeFull, "%s on %q", c.re, in)
+				}
+			}
+		}
+	})
+
+	t.Run("explains regexps that can't be converted", func(t *testing.T) {
+		cases := map[string]string{
+			`a*ab`:      "repetition a* may need to give back input to what follows it",
+			`[a-c]x|by`: "may begin with the same character",
+			`a+?`:       "non-greedy repetition",
+			`\bword`:    "unsupported regexp operator",
+			`(?i)abc`:   "case-insensitive matching",
+		}
+
+		for re, reason := range cases {
+			native, got := nativeRegexp(re)
+			require.Nil(t, native, re)
+			require.Contains(t, got, reason, re)
+		}
+	})
+}
@@ -0,0 +1,367 @@
+package peggysue
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// Complexity is an estimate of how the time taken to parse grows with the
+// size of the input.
+type Complexity int
+
+const (
+	// ComplexityLinear means memoization bounds the work done at each
+	// position of the input.
+	ComplexityLinear Complexity = iota
+
+	// ComplexityQuadratic means some rules may scan the rest of the input
+	// from every position.
+	ComplexityQuadratic
+
+	// ComplexityExponential means memoized results may be discarded, so
+	// backtracking is unbounded.
+	ComplexityExponential
+)
+
+func (c Complexity) String() string {
+	switch c {
+	case ComplexityLinear:
+		return "linear"
+	case ComplexityQuadratic:
+		return "quadratic"
+	case ComplexityExponential:
+		return "exponential"
+	default:
+		return fmt.Sprintf("Complexity(%d)", int(c))
+	}
+}
+
+// GrammarReport summarizes the size and shape of a grammar. It is returned
+// by Report.
+type GrammarReport struct {
+	// Rules is the number of distinct rules, including anonymous rules
+	// such as the parts of a Seq.
+	Rules int
+
+	// Types is the number of rules of each type, keyed by the name of the
+	// function that creates them, such as "Seq" or "Or". Rules created by
+	// automatic optimizations are counted as the rule they replace.
+	Types map[string]int
+
+	// MaxDepth is the deepest nesting of rules within a single definition.
+	// A Ref counts as one level; the rules of its definition are measured
+	// separately.
+	MaxDepth int
+
+	// Refs is the number of named Refs, ie. the definitions in the grammar.
+	Refs int
+
+	// Memoized is the number of rules whose results are memoized, which is
+	// the named Refs plus any rules wrapped with Memo.
+	Memoized int
+
+	// Regexps is the number of rules created with Re.
+	Regexps int
+
+	// Worst is the estimated worst case time complexity of parsing with the
+	// grammar, and Hazards describes the rules responsible for it.
+	Worst   Complexity
+	Hazards []string
+}
+
+func (gr *GrammarReport) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "rules: %d\n", gr.Rules)
+	fmt.Fprintf(&sb, "refs: %d\n", gr.Refs)
+	fmt.Fprintf(&sb, "memoized: %d\n", gr.Memoized)
+	fmt.Fprintf(&sb, "regexps: %d\n", gr.Regexps)
+	fmt.Fprintf(&sb, "max depth: %d\n", gr.MaxDepth)
+	fmt.Fprintf(&sb, "worst case: %s\n", gr.Worst)
+
+	types := make([]string, 0, len(gr.Types))
+	for typ := range gr.Types {
+		types = append(types, typ)
+	}
+
+	sort.Strings(types)
+
+	sb.WriteString("types:\n")
+
+	for _, typ := range types {
+		fmt.Fprintf(&sb, "  %s: %d\n", typ, gr.Types[typ])
+	}
+
+	if len(gr.Hazards) > 0 {
+		sb.WriteString("hazards:\n")
+
+		for _, h := range gr.Hazards {
+			fmt.Fprintf(&sb, "  %s\n", h)
+		}
+	}
+
+	return sb.String()
+}
+
+// Report summarizes the rules reachable from root: how many there are of
+// each type, how deeply they nest, how many are memoized or use regexps,
+// and an estimate of the worst case time complexity of parsing with them.
+// The report is deterministic for a given grammar, which makes it suitable
+// for checking in and tracking how a grammar grows over time.
+//
+// The complexity estimate is a heuristic. It flags lookaheads that may scan
+// the rest of the input, as ComplexityQuadratic, and rules that change the
+// state store, which invalidates memoized results, as ComplexityExponential.
+func Report(root Rule) *GrammarReport {
+	gr := &GrammarReport{
+		Types: make(map[string]int),
+	}
+
+	seen := make(map[Rule]bool)
+
+	var visit func(r Rule, def string)
+
+	visit = func(r Rule, def string) {
+		r = unchain(r)
+
+		if r == nil || seen[r] {
+			return
+		}
+
+		seen[r] = true
+
+		gr.Rules++
+		gr.Types[ruleType(r)]++
+
+		if name := r.Name(); name != "" {
+			def = name
+		}
+
+		switch m := r.(type) {
+		case *matchRef:
+			gr.Memoized++
+
+			if m.name != "" {
+				gr.Refs++
+			}
+
+			if d := depth(m.rule); d > gr.MaxDepth {
+				gr.MaxDepth = d
+			}
+		case *matchRegexp:
+			gr.Regexps++
+		case *matchCheck, *matchNot:
+			if unbounded(subRules(m)[0], make(map[Rule]bool)) {
+				gr.hazard(ComplexityQuadratic, def, "lookahead %s may scan the rest of the input at every position", Print(m))
+			}
+		case *matchStateSet, *matchStateUpdate, *matchStatePush, *matchStatePop:
+			gr.hazard(ComplexityExponential, def, "%s changes the state store, which discards memoized results", Print(m))
+		}
+
+		for _, sub := range subRules(r) {
+			visit(sub, def)
+		}
+	}
+
+	if d := depth(root); d > gr.MaxDepth {
+		gr.MaxDepth = d
+	}
+
+	visit(root, "")
+
+	return gr
+}
+
+func (gr *GrammarReport) hazard(c Complexity, def, format string, args ...interface{}) {
+	if c > gr.Worst {
+		gr.Worst = c
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	if def != "" {
+		msg = def + ": " + msg
+	}
+
+	gr.Hazards = append(gr.Hazards, msg)
+}
+
+// depth returns how deeply rules nest within r, stopping at Refs.
+func depth(r Rule) int {
+	r = unchain(r)
+
+	if r == nil {
+		return 0
+	}
+
+	if _, ok := r.(*matchRef); ok {
+		return 1
+	}
+
+	max := 0
+
+	for _, sub := range subRules(r) {
+		if d := depth(sub); d > max {
+			max = d
+		}
+	}
+
+	return max + 1
+}
+
+// unbounded reports whether r may consume an unbounded amount of input
+// by repeating a rule. Scan is included as its function is free to consume
+// any amount of input.
+func unbounded(r Rule, seen map[Rule]bool) bool {
+	r = unchain(r)
+
+	if r == nil || seen[r] {
+		return false
+	}
+
+	seen[r] = true
+
+	switch m := r.(type) {
+	case *matchZeroOrMore, *matchOneOrMore, *matchFold, *matchScan:
+		return true
+	case *matchMany:
+		if m.max < 0 {
+			return true
+		}
+	case *matchSepBy:
+		if m.max < 0 {
+			return true
+		}
+	case *matchRegexp:
+		re, err := syntax.Parse(m.str, syntax.Perl)
+		return err == nil && unboundedRegexp(re)
+	case *matchCheck, *matchNot:
+		// A nested lookahead is reported on its own.
+		return false
+	}
+
+	for _, sub := range subRules(r) {
+		if unbounded(sub, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unboundedRegexp(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		if re.Max == -1 {
+			return true
+		}
+	}
+
+	for _, sub := range re.Sub {
+		if unboundedRegexp(sub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ruleType returns the name of the function that creates rules like r.
+func ruleType(r Rule) string {
+	switch m := r.(type) {
+	case *matchAny:
+		return "Any"
+	case *matchString, *matchString1, *matchString2:
+		return "S"
+	case *matchRegexp:
+		return "Re"
+	case *matchCharRange:
+		return "Range"
+	case *matchCharSet:
+		return "Set"
+	case *matchRunePredicate:
+		return "Rune"
+	case *matchScan:
+		return "Scan"
+	case *matchPrefixTable:
+		return "PrefixTable"
+	case *matchOr, *matchEither:
+		return "Or"
+	case *matchBranch:
+		return "Branches"
+	case *matchSeq, *matchBoth, *matchThree:
+		return "Seq"
+	case *matchSeqAll:
+		return "SeqAll"
+	case *matchCount:
+		return "Count"
+	case *matchZeroOrMore:
+		return "Star"
+	case *matchOneOrMore:
+		return "Plus"
+	case *matchMany:
+		return "Many"
+	case *matchSepBy:
+		if m.min == 0 && m.max == -1 && m.fn == nil {
+			return "SepBy"
+		}
+		return "ManySep"
+	case *matchFold:
+		return "Fold"
+	case *matchOptional:
+		return "Maybe"
+	case *matchMaybeValue:
+		return "MaybeValue"
+	case *matchCheck:
+		return "Check"
+	case *matchNot, *matchNotByte, *matchNotClass:
+		return "Not"
+	case *matchRef:
+		return "R"
+	case *matchCall:
+		return "Call"
+	case *matchBind:
+		return "Bind"
+	case *matchAction:
+		return "Action"
+	case *matchApply:
+		return "Apply"
+	case *matchScope:
+		return "Scope"
+	case *matchNamed:
+		return "Named"
+	case *matchTransform:
+		return "Transform"
+	case *matchCapture:
+		return "Capture"
+	case *matchRecover:
+		return "Recover"
+	case *matchCheckAction:
+		return "CheckAction"
+	case *matchCheckActionCtx:
+		return "CheckActionCtx"
+	case *matchEOS:
+		return "EOS"
+	case *matchDebug:
+		return "Debug"
+	case *matchPratt:
+		return "Pratt"
+	case *matchStateSet:
+		return "StateSet"
+	case *matchStateUpdate:
+		return "StateUpdate"
+	case *matchStateGet:
+		return "StateGet"
+	case *matchStatePush:
+		return "StatePush"
+	case *matchStatePop:
+		return "StatePop"
+	case *matchDispatch:
+		return "Dispatch"
+	default:
+		return fmt.Sprintf("%T", r)
+	}
+}
@@ -0,0 +1,76 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	t.Run("summarizes the rules", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			expr = R("expr")
+			num  = R("num")
+		)
+
+		num.Set(Re(`[0-9]+`))
+		expr.Set(Or(
+			Seq(expr, S("+"), num),
+			Seq(S("("), Memo(expr), S(")")),
+			num,
+		))
+
+		gr := Report(expr)
+
+		r.Equal(2, gr.Refs)
+		r.Equal(3, gr.Memoized)
+		r.Equal(1, gr.Regexps)
+		r.Equal(3, gr.MaxDepth)
+		r.Equal(ComplexityLinear, gr.Worst)
+		r.Empty(gr.Hazards)
+
+		r.Equal(map[string]int{"R": 3, "Or": 1, "Seq": 2, "S": 3, "Re": 1}, gr.Types)
+		r.Equal(10, gr.Rules)
+
+		r.Equal(`rules: 10
+refs: 2
+memoized: 3
+regexps: 1
+max depth: 3
+worst case: linear
+types:
+  Or: 1
+  R: 3
+  Re: 1
+  S: 3
+  Seq: 2
+`, gr.String())
+	})
+
+	t.Run("flags lookaheads that scan the rest of the input", func(t *testing.T) {
+		r := require.New(t)
+
+		line := N("line", Seq(Not(Seq(Star(S(" ")), S("#"))), Plus(Range('a', 'z'))))
+
+		gr := Report(Star(line))
+
+		r.Equal(ComplexityQuadratic, gr.Worst)
+		r.Equal([]string{`line: lookahead !" "* "#" may scan the rest of the input at every position`}, gr.Hazards)
+
+		gr = Report(Star(Seq(Not(S("#")), Plus(Range('a', 'z')))))
+		r.Equal(ComplexityLinear, gr.Worst)
+	})
+
+	t.Run("flags state updates", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := Seq(StatePush("indent", func(v Values) interface{} { return 1 }), S("x"))
+
+		gr := Report(rule)
+
+		r.Equal(ComplexityExponential, gr.Worst)
+		r.Len(gr.Hazards, 1)
+	})
+}
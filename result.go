@@ -0,0 +1,110 @@
+package peggysue
+
+// ParseResult is the outcome of Parser.Run. It provides more detail than
+// the values returned by Parse.
+type ParseResult struct {
+	// Value is the value of the rule, if it matched.
+	Value interface{}
+
+	// Matched indicates if the rule matched. When the parser requires the
+	// full input to be consumed, Matched is false if it was not.
+	Matched bool
+
+	// Span is the region of the input that the rule matched.
+	Span Span
+
+	// Consumed indicates if the rule matched the entire input.
+	Consumed bool
+
+	// Errors contains any errors detected while parsing.
+	Errors []error
+
+	// Stats contains information about the work performed while parsing.
+	Stats Stats
+
+	// Bindings are the values bound by Named and captured by Capture, in
+	// the order they appear in the input, when the parser was created
+	// with WithBindings.
+	Bindings []Binding
+}
+
+// Stats contains information about the work performed while parsing.
+type Stats struct {
+	// InputSize is the size of the input in bytes.
+	InputSize int
+
+	// MaxPos is the furthest byte offset in the input that any rule reached.
+	MaxPos int
+
+	// MemoEntries is the number of memoized Ref results that were stored.
+	MemoEntries int
+
+	// MemoHits is the number of times a memoized Ref result was reused.
+	MemoHits int
+}
+
+// Err returns the first error in Errors, or nil if there are none.
+func (r *ParseResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	return r.Errors[0]
+}
+
+// Run attempts to match the given rule against the input string, just like
+// Parse, but returns the details of the parse as a ParseResult.
+func (p *Parser) Run(r Rule, input string) *ParseResult {
+	s, res := p.parse(r, input, p.filename)
+
+	pr := &ParseResult{
+		Value:    res.value,
+		Matched:  res.matched,
+		Consumed: res.matched && s.pos == s.inputSize,
+		Stats:    s.stats(),
+	}
+
+	if s.err != nil {
+		pr.Value = nil
+		pr.Matched = false
+		pr.Errors = append(pr.Errors, s.err)
+		return pr
+	}
+
+	if !res.matched {
+		pr.Value = nil
+		pr.Errors = append(pr.Errors, s.noMatch())
+		return pr
+	}
+
+	pr.Span = Span{Start: s.position(s.matchStart), End: s.position(s.pos)}
+
+	if p.bindings {
+		pr.Bindings = s.sortedBindings()
+	}
+	pr.Errors = append(pr.Errors, s.recovered()...)
+
+	if !pr.Consumed && !p.partial {
+		pr.Matched = false
+		pr.Errors = append(pr.Errors, s.notConsumed())
+	}
+
+	return pr
+}
+
+func (s *state) stats() Stats {
+	st := Stats{
+		InputSize: s.inputSize,
+		MaxPos:    s.endOffset(s.maxPos),
+	}
+
+	for _, memo := range s.memos {
+		st.MemoEntries += len(memo)
+
+		for _, mr := range memo {
+			st.MemoHits += mr.used
+		}
+	}
+
+	return st
+}
@@ -0,0 +1,54 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	num := R("num")
+	num.Set(Capture(Plus(Range('0', '9'))))
+
+	sum := Capture(Seq(num, Star(Seq(S("+"), num))))
+
+	t.Run("returns the details of a successful parse", func(t *testing.T) {
+		r := require.New(t)
+
+		res := New().Run(sum, "1+22")
+		r.NoError(res.Err())
+		r.True(res.Matched)
+		r.True(res.Consumed)
+		r.Equal("1+22", res.Value)
+		r.Equal(0, res.Span.Start.Offset)
+		r.Equal(4, res.Span.End.Offset)
+		r.Equal(4, res.Stats.InputSize)
+		r.Equal(2, res.Stats.MemoEntries)
+	})
+
+	t.Run("reports input that was not consumed", func(t *testing.T) {
+		r := require.New(t)
+
+		res := New().Run(sum, "1+22-3")
+		r.False(res.Matched)
+		r.False(res.Consumed)
+		r.Equal(4, res.Span.End.Offset)
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(res.Err(), &nc)
+
+		res = New(WithPartial(true)).Run(sum, "1+22-3")
+		r.NoError(res.Err())
+		r.True(res.Matched)
+		r.False(res.Consumed)
+	})
+
+	t.Run("reports a failed match", func(t *testing.T) {
+		r := require.New(t)
+
+		res := New().Run(sum, "x")
+		r.False(res.Matched)
+		r.Nil(res.Value)
+		r.ErrorIs(res.Err(), ErrNoMatch)
+	})
+}
@@ -0,0 +1,214 @@
+package peggysue
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// WithCallCounts counts the number of times each rule is matched while
+// parsing, adding them to counts. Dividing the counts by the size of the
+// input shows where the parser does the most work. Counting slows down
+// parsing, so it is intended for profiling grammars.
+func WithCallCounts(counts map[Rule]int) Option {
+	return func(p *Parser) {
+		p.callCounts = counts
+	}
+}
+
+// countCalls wraps s.match to count the rules matched.
+func (s *state) countCalls() {
+	counts := s.p.callCounts
+	match := s.match
+
+	s.match = func(r Rule) result {
+		counts[r]++
+		return match(r)
+	}
+}
+
+// ScalingRule is a rule whose work grows faster than the size of the input.
+// It is returned by DetectSuperLinear.
+type ScalingRule struct {
+	// Rule is the rule, and Def is the name of the Ref whose definition
+	// contains it, or empty if it is not within one.
+	Rule Rule
+	Def  string
+
+	// Calls is the number of times the rule was matched for each input.
+	Calls []int
+
+	// Exponent estimates how the number of calls grows with the size of
+	// the input, n. It is about 1 for work that grows as n, 2 for n², and
+	// keeps growing with the input for exponential work.
+	Exponent float64
+}
+
+func (sr *ScalingRule) String() string {
+	var sb strings.Builder
+
+	if sr.Def != "" {
+		sb.WriteString(sr.Def)
+		sb.WriteString(": ")
+	}
+
+	fmt.Fprintf(&sb, "%s grows as n^%.1f, calls:", Print(sr.Rule), sr.Exponent)
+
+	for _, c := range sr.Calls {
+		fmt.Fprintf(&sb, " %d", c)
+	}
+
+	return sb.String()
+}
+
+// ScalingReport is the result of DetectSuperLinear.
+type ScalingReport struct {
+	// Sizes is the size, in bytes, of each input parsed.
+	Sizes []int
+
+	// Rules are the rules whose work grew faster than the input, ordered
+	// by decreasing Exponent.
+	Rules []*ScalingRule
+}
+
+func (sr *ScalingReport) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("sizes:")
+
+	for _, n := range sr.Sizes {
+		fmt.Fprintf(&sb, " %d", n)
+	}
+
+	sb.WriteByte('\n')
+
+	for _, r := range sr.Rules {
+		sb.WriteString(r.String())
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// superLinear is the smallest exponent that DetectSuperLinear reports. It
+// leaves room for the noise of inputs that don't grow exactly in
+// proportion.
+const superLinear = 1.3
+
+// DetectSuperLinear parses inputs of doubling size, counting how many times
+// each rule is matched, to find the rules responsible for backtracking that
+// makes parsing slower than linear. gen returns an input of about n bytes;
+// it is called with n, then 2n, 4n, and so on, for the given number of
+// doublings. The inputs don't have to match the rule, since inputs that
+// fail are often the ones that backtrack the most.
+//
+// A rule is reported if the number of times it is matched grew faster than
+// the input over the last doubling, and it was matched at least once per
+// byte of the largest input, which rules out rules that do a small, fixed
+// amount of work.
+func (p *Parser) DetectSuperLinear(r Rule, gen func(n int) string, n, doublings int) (*ScalingReport, error) {
+	if doublings < 1 {
+		return nil, fmt.Errorf("can not detect super-linear rules: need at least 1 doubling, not %d", doublings)
+	}
+
+	report := &ScalingReport{}
+
+	var runs []map[Rule]int
+
+	for i := 0; i <= doublings; i++ {
+		input := gen(n << i)
+
+		counts := make(map[Rule]int)
+
+		cp := *p
+		cp.callCounts = counts
+
+		if _, _, err := cp.Parse(r, input); err != nil && !errors.Is(err, ErrPartialInput) {
+			return nil, err
+		}
+
+		report.Sizes = append(report.Sizes, len(input))
+		runs = append(runs, counts)
+	}
+
+	defs := ruleDefs(r)
+
+	last := len(runs) - 1
+	growth := float64(report.Sizes[last]) / float64(report.Sizes[last-1])
+
+	for rule, calls := range runs[last] {
+		if calls < report.Sizes[last] || growth <= 1 {
+			continue
+		}
+
+		prev := runs[last-1][rule]
+		if prev == 0 {
+			prev = 1
+		}
+
+		exp := math.Log(float64(calls)/float64(prev)) / math.Log(growth)
+		if exp < superLinear {
+			continue
+		}
+
+		sr := &ScalingRule{Rule: rule, Def: defs[unchain(rule)], Exponent: exp}
+
+		for _, run := range runs {
+			sr.Calls = append(sr.Calls, run[rule])
+		}
+
+		report.Rules = append(report.Rules, sr)
+	}
+
+	sort.Slice(report.Rules, func(i, j int) bool {
+		a, b := report.Rules[i], report.Rules[j]
+
+		if a.Exponent != b.Exponent {
+			return a.Exponent > b.Exponent
+		}
+
+		if a.Calls[last] != b.Calls[last] {
+			return a.Calls[last] > b.Calls[last]
+		}
+
+		return Print(a.Rule) < Print(b.Rule)
+	})
+
+	return report, nil
+}
+
+// ruleDefs returns the name of the definition that contains each rule
+// reachable from root.
+func ruleDefs(root Rule) map[Rule]string {
+	defs := make(map[Rule]string)
+
+	var visit func(r Rule, def string)
+
+	visit = func(r Rule, def string) {
+		r = unchain(r)
+
+		if r == nil {
+			return
+		}
+
+		if _, ok := defs[r]; ok {
+			return
+		}
+
+		if name := r.Name(); name != "" {
+			def = name
+		}
+
+		defs[r] = def
+
+		for _, sub := range subRules(r) {
+			visit(sub, def)
+		}
+	}
+
+	visit(root, "")
+
+	return defs
+}
@@ -0,0 +1,63 @@
+package peggysue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallCounts(t *testing.T) {
+	a := S("a")
+	r := Star(a)
+
+	counts := make(map[Rule]int)
+
+	_, ok, err := New(WithCallCounts(counts)).Parse(r, "aaa")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// The last call fails at the end of the input.
+	require.Equal(t, 4, counts[a])
+}
+
+func TestDetectSuperLinear(t *testing.T) {
+	gen := func(n int) string {
+		return strings.Repeat("a", n) + "b"
+	}
+
+	t.Run("reports rules that rescan the input", func(t *testing.T) {
+		rest := S("a")
+		scan := R("scan")
+		scan.Set(Seq(Check(Seq(Star(rest), S("b"))), S("a")))
+
+		r := Seq(Star(scan), S("b"))
+
+		report, err := New().DetectSuperLinear(r, gen, 32, 3)
+		require.NoError(t, err)
+
+		require.Equal(t, []int{33, 65, 129, 257}, report.Sizes)
+		require.NotEmpty(t, report.Rules)
+
+		top := report.Rules[0]
+		require.Equal(t, rest, top.Rule)
+		require.Equal(t, "scan", top.Def)
+		require.InDelta(t, 2, top.Exponent, 0.1)
+		require.Len(t, top.Calls, 4)
+
+		require.Contains(t, report.String(), "scan: \"a\" grows as n^2.0")
+	})
+
+	t.Run("reports nothing for linear rules", func(t *testing.T) {
+		r := Seq(Star(S("a")), S("b"))
+
+		report, err := New().DetectSuperLinear(r, gen, 32, 3)
+		require.NoError(t, err)
+		require.Empty(t, report.Rules)
+	})
+
+	t.Run("requires a doubling", func(t *testing.T) {
+		_, err := New().DetectSuperLinear(S("a"), gen, 32, 0)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,682 @@
+package peggysue
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Handlers names the functions used by rules, so that rules using them can be
+// serialized by Marshal and restored by Unmarshal. Functions are identified by
+// their code, so every function must be distinct; closures created by the same
+// function literal can not be told apart.
+type Handlers struct {
+	Actions    map[string]func(Values) interface{}
+	ErrActions map[string]func(Values) (interface{}, error)
+	Transforms map[string]func(string) interface{}
+	Checks     map[string]func(Values) bool
+}
+
+// serialVersion is the version of the serialized format.
+const serialVersion = 1
+
+type serialGraph struct {
+	Version int           `json:"version"`
+	Rule    *serialRule   `json:"rule"`
+	Refs    []*serialRule `json:"refs,omitempty"`
+}
+
+type serialBranch struct {
+	Name      string      `json:"name"`
+	Rule      *serialRule `json:"rule"`
+	LeftAssoc bool        `json:"left_assoc,omitempty"`
+}
+
+type serialRule struct {
+	Type string `json:"type"`
+
+	// Name is the name of the rule as set by SetName, or of a Ref.
+	Name string `json:"name,omitempty"`
+
+	Value    string                 `json:"value,omitempty"`
+	Lo       string                 `json:"lo,omitempty"`
+	Hi       string                 `json:"hi,omitempty"`
+	Fold     bool                   `json:"fold,omitempty"`
+	Min      int                    `json:"min,omitempty"`
+	Max      int                    `json:"max,omitempty"`
+	Collect  bool                   `json:"collect,omitempty"`
+	Handler  string                 `json:"handler,omitempty"`
+	Ref      *int                   `json:"ref,omitempty"`
+	Rule     *serialRule            `json:"rule,omitempty"`
+	Rules    []*serialRule          `json:"rules,omitempty"`
+	Branches []serialBranch         `json:"branches,omitempty"`
+	Prefix   map[string]*serialRule `json:"prefix,omitempty"`
+	Custom   json.RawMessage        `json:"custom,omitempty"`
+	Opts     int                    `json:"opts,omitempty"`
+}
+
+// Marshal serializes the graph of rules reachable from r to JSON. The
+// serialized form describes the terminals, combinators, and Refs of the
+// grammar. Rules that call functions are only supported when the function is
+// named in h; others, such as Fold, Bind, and Dispatch, return an error.
+func Marshal(r Rule, h *Handlers) ([]byte, error) {
+	if h == nil {
+		h = &Handlers{}
+	}
+
+	m := &marshaler{
+		h:    h,
+		refs: map[*matchRef]int{},
+	}
+
+	root, err := m.rule(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(serialGraph{Version: serialVersion, Rule: root, Refs: m.graph})
+}
+
+type marshaler struct {
+	h     *Handlers
+	refs  map[*matchRef]int
+	graph []*serialRule
+}
+
+func funcPtr(fn interface{}) uintptr {
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// handler returns the name in handlers, which is a map of names to
+// functions, of fn.
+func (m *marshaler) handler(r Rule, handlers interface{}, fn interface{}) (string, error) {
+	var found []string
+
+	ptr := funcPtr(fn)
+
+	iter := reflect.ValueOf(handlers).MapRange()
+	for iter.Next() {
+		if iter.Value().Pointer() == ptr {
+			found = append(found, iter.Key().String())
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("can not marshal %s: function is not a registered handler", Print(r))
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("can not marshal %s: function is registered as multiple handlers", Print(r))
+	}
+}
+
+func (m *marshaler) rules(rules ...Rule) ([]*serialRule, error) {
+	out := make([]*serialRule, len(rules))
+
+	for i, r := range rules {
+		sr, err := m.rule(r)
+		if err != nil {
+			return nil, err
+		}
+
+		out[i] = sr
+	}
+
+	return out, nil
+}
+
+func (m *marshaler) sub(typ string, r Rule) (*serialRule, error) {
+	sr, err := m.rule(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serialRule{Type: typ, Rule: sr}, nil
+}
+
+func (m *marshaler) rule(r Rule) (*serialRule, error) {
+	r = unchain(r)
+
+	sr, err := m.ruleBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := r.(*matchRef); !ok {
+		sr.Name = r.Name()
+	}
+
+	return sr, nil
+}
+
+func (m *marshaler) ruleBody(r Rule) (*serialRule, error) {
+	switch r := r.(type) {
+	case *matchRef:
+		if idx, ok := m.refs[r]; ok {
+			return &serialRule{Type: "ref", Ref: &idx}, nil
+		}
+
+		idx := len(m.graph)
+		m.refs[r] = idx
+
+		sr := &serialRule{Type: "ref", Name: r.Name()}
+		m.graph = append(m.graph, sr)
+
+		if r.rule != nil {
+			body, err := m.rule(r.rule)
+			if err != nil {
+				return nil, err
+			}
+
+			sr.Rule = body
+		}
+
+		return &serialRule{Type: "ref", Ref: &idx}, nil
+	case *matchAny:
+		return &serialRule{Type: "any"}, nil
+	case *matchEOS:
+		return &serialRule{Type: "eos"}, nil
+	case *matchDebug:
+		return &serialRule{Type: "debug"}, nil
+	case *matchString:
+		return &serialRule{Type: "string", Value: r.str}, nil
+	case *matchString1:
+		return &serialRule{Type: "string", Value: string([]byte{r.b})}, nil
+	case *matchString2:
+		return &serialRule{Type: "string", Value: string([]byte{r.a, r.b})}, nil
+	case *matchRegexp:
+		return &serialRule{Type: "regexp", Value: r.str}, nil
+	case *matchCharRange:
+		return &serialRule{Type: "range", Lo: string(r.start), Hi: string(r.end), Fold: r.fold}, nil
+	case *matchCharSet:
+		return &serialRule{Type: "set", Value: string(r.set), Fold: r.fold}, nil
+	case *matchNotByte:
+		return &serialRule{Type: "not", Rule: &serialRule{Type: "string", Value: string([]byte{r.b})}}, nil
+	case *matchNotClass:
+		rules, err := m.rules(&matchNot{rule: r.class}, &matchAny{})
+		return &serialRule{Type: "seq", Rules: rules}, err
+	case *matchOr:
+		rules, err := m.rules(r.rules...)
+		return &serialRule{Type: "or", Rules: rules}, err
+	case *matchEither:
+		rules, err := m.rules(r.a, r.b)
+		return &serialRule{Type: "or", Rules: rules}, err
+	case *matchSeq:
+		rules, err := m.rules(r.rules...)
+		return &serialRule{Type: "seq", Rules: rules}, err
+	case *matchBoth:
+		rules, err := m.rules(r.a, r.b)
+		return &serialRule{Type: "seq", Rules: rules}, err
+	case *matchThree:
+		rules, err := m.rules(r.a, r.b, r.c)
+		return &serialRule{Type: "seq", Rules: rules}, err
+	case *matchSeqAll:
+		rules, err := m.rules(r.rules...)
+		return &serialRule{Type: "seqall", Rules: rules}, err
+	case *matchBranch:
+		sr := &serialRule{Type: "branches"}
+
+		for _, b := range r.rules {
+			br, err := m.rule(b.r)
+			if err != nil {
+				return nil, err
+			}
+
+			sr.Branches = append(sr.Branches, serialBranch{Name: b.name, Rule: br, LeftAssoc: b.leftAssoc})
+		}
+
+		return sr, nil
+	case *matchPrefixTable:
+		sr := &serialRule{Type: "prefix", Prefix: map[string]*serialRule{}}
+
+		for b, sub := range r.rules {
+			br, err := m.rule(sub)
+			if err != nil {
+				return nil, err
+			}
+
+			sr.Prefix[string([]byte{b})] = br
+		}
+
+		return sr, nil
+	case *matchCount:
+		sr, err := m.sub("count", r.rule)
+		if err == nil {
+			sr.Min = r.num
+		}
+
+		return sr, err
+	case *matchZeroOrMore:
+		return m.sub("star", r.rule)
+	case *matchOneOrMore:
+		return m.sub("plus", r.rule)
+	case *matchMany:
+		var collect bool
+
+		switch {
+		case r.fn == nil:
+		case funcPtr(r.fn) == funcPtr(copyGroup):
+			collect = true
+		default:
+			return nil, fmt.Errorf("can not marshal %s: Many with a function", Print(r))
+		}
+
+		sr, err := m.sub("many", r.rule)
+		if err == nil {
+			sr.Min = r.min
+			sr.Max = r.max
+			sr.Collect = collect
+		}
+
+		return sr, err
+	case *matchSepBy:
+		if r.fn != nil {
+			return nil, fmt.Errorf("can not marshal %s: ManySep with a function", Print(r))
+		}
+
+		rules, err := m.rules(r.rule, r.sep)
+		sr := &serialRule{Type: "sepby", Rules: rules, Min: r.min}
+
+		// An unbounded SepBy is written without a max, as before bounds
+		// were supported.
+		if r.max != -1 {
+			sr.Max = r.max
+		}
+
+		return sr, err
+	case *matchOptional:
+		return m.sub("maybe", r.rule)
+	case *matchMaybeValue:
+		return m.sub("maybevalue", r.rule)
+	case *matchCheck:
+		return m.sub("check", r.rule)
+	case *matchNot:
+		return m.sub("not", r.rule)
+	case *matchCapture:
+		sr, err := m.sub("capture", r.rule)
+		if err != nil {
+			return nil, err
+		}
+
+		sr.Opts = int(r.opts)
+
+		return sr, nil
+	case *matchScope:
+		// Action adds a scope, as does Ref.Set when given a scope, so
+		// those are recreated when unmarshaling.
+		switch r.rule.(type) {
+		case *matchScope, *matchAction:
+			return m.ruleBody(r.rule)
+		}
+
+		return m.sub("scope", r.rule)
+	case *matchNamed:
+		sr, err := m.sub("named", r.rule)
+		if err == nil {
+			sr.Value = r.name
+		}
+
+		return sr, err
+	case *matchAction:
+		var (
+			name string
+			err  error
+			typ  = "action"
+		)
+
+		if r.efn != nil {
+			typ = "erraction"
+			name, err = m.handler(r, m.h.ErrActions, r.efn)
+		} else {
+			name, err = m.handler(r, m.h.Actions, r.fn)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		sr, err := m.sub(typ, r.rule)
+		if err == nil {
+			sr.Handler = name
+		}
+
+		return sr, err
+	case *matchTransform:
+		name, err := m.handler(r, m.h.Transforms, r.fn)
+		if err != nil {
+			return nil, err
+		}
+
+		sr, err := m.sub("transform", r.rule)
+		if err == nil {
+			sr.Handler = name
+		}
+
+		return sr, err
+	case *matchCheckAction:
+		name, err := m.handler(r, m.h.Checks, r.fn)
+		if err != nil {
+			return nil, err
+		}
+
+		return &serialRule{Type: "checkaction", Handler: name}, nil
+	case *matchStateGet:
+		return &serialRule{Type: "stateget", Value: r.key}, nil
+	case *matchStatePop:
+		return &serialRule{Type: "statepop", Value: r.key}, nil
+	case *matchCustom:
+		kind, ct := customType(r.cr)
+		if ct == nil {
+			return nil, fmt.Errorf("can not marshal %s: custom rule type %T is not registered", Print(r), r.cr)
+		}
+
+		rules, err := m.rules(customRules(r.cr)...)
+		if err != nil {
+			return nil, err
+		}
+
+		sr := &serialRule{Type: "custom", Value: kind, Rules: rules}
+
+		if ct.Marshal != nil {
+			sr.Custom, err = ct.Marshal(r.cr)
+			if err != nil {
+				return nil, fmt.Errorf("can not marshal %s: %w", Print(r), err)
+			}
+		}
+
+		return sr, nil
+	default:
+		return nil, fmt.Errorf("can not marshal %s: unsupported rule type %T", Print(r), r)
+	}
+}
+
+// Unmarshal restores a rule graph serialized by Marshal, using h to find
+// the functions named by rules.
+func Unmarshal(data []byte, h *Handlers) (Rule, error) {
+	var g serialGraph
+
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+
+	if g.Version != serialVersion {
+		return nil, fmt.Errorf("unsupported rule graph version %d", g.Version)
+	}
+
+	if h == nil {
+		h = &Handlers{}
+	}
+
+	u := &unmarshaler{h: h, graph: g.Refs}
+
+	for _, sr := range g.Refs {
+		u.refs = append(u.refs, R(sr.Name))
+	}
+
+	for i, sr := range g.Refs {
+		if sr.Rule == nil {
+			continue
+		}
+
+		rule, err := u.rule(sr.Rule)
+		if err != nil {
+			return nil, err
+		}
+
+		if mb, ok := rule.(*matchBranch); ok {
+			mb.ref = u.refs[i]
+		}
+
+		u.refs[i].Set(rule)
+	}
+
+	if g.Rule == nil {
+		return nil, fmt.Errorf("rule graph has no rule")
+	}
+
+	return u.rule(g.Rule)
+}
+
+type unmarshaler struct {
+	h     *Handlers
+	graph []*serialRule
+	refs  []Ref
+}
+
+func (u *unmarshaler) rules(srs []*serialRule) ([]Rule, error) {
+	out := make([]Rule, len(srs))
+
+	for i, sr := range srs {
+		r, err := u.rule(sr)
+		if err != nil {
+			return nil, err
+		}
+
+		out[i] = r
+	}
+
+	return out, nil
+}
+
+func singleRune(s string) (rune, error) {
+	r, sz := utf8.DecodeRuneInString(s)
+	if sz == 0 || sz != len(s) {
+		return 0, fmt.Errorf("invalid rune %q", s)
+	}
+
+	return r, nil
+}
+
+func (u *unmarshaler) rule(sr *serialRule) (Rule, error) {
+	r, err := u.ruleBody(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	if sr.Name != "" && sr.Type != "ref" {
+		r.SetName(sr.Name)
+	}
+
+	return r, nil
+}
+
+func (u *unmarshaler) sub(sr *serialRule, fn func(Rule) Rule) (Rule, error) {
+	if sr.Rule == nil {
+		return nil, fmt.Errorf("%s rule has no sub-rule", sr.Type)
+	}
+
+	r, err := u.rule(sr.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return fn(r), nil
+}
+
+func (u *unmarshaler) ruleBody(sr *serialRule) (Rule, error) {
+	switch sr.Type {
+	case "ref":
+		if sr.Ref == nil || *sr.Ref < 0 || *sr.Ref >= len(u.refs) {
+			return nil, fmt.Errorf("invalid ref")
+		}
+
+		return u.refs[*sr.Ref], nil
+	case "any":
+		return Any(), nil
+	case "eos":
+		return EOS(), nil
+	case "debug":
+		return Debug(), nil
+	case "string":
+		return S(sr.Value), nil
+	case "regexp":
+		re, err := regexp.Compile(`\A` + sr.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &matchRegexp{str: sr.Value, re: re}, nil
+	case "range":
+		lo, err := singleRune(sr.Lo)
+		if err != nil {
+			return nil, err
+		}
+
+		hi, err := singleRune(sr.Hi)
+		if err != nil {
+			return nil, err
+		}
+
+		if sr.Fold {
+			return RangeFold(lo, hi), nil
+		}
+
+		return Range(lo, hi), nil
+	case "set":
+		if sr.Fold {
+			return SetFold([]rune(sr.Value)...), nil
+		}
+
+		return Set([]rune(sr.Value)...), nil
+	case "or", "seq", "seqall":
+		rules, err := u.rules(sr.Rules)
+		if err != nil {
+			return nil, err
+		}
+
+		switch sr.Type {
+		case "or":
+			return Or(rules...), nil
+		case "seq":
+			return Seq(rules...), nil
+		default:
+			return SeqAll(rules...), nil
+		}
+	case "sepby":
+		rules, err := u.rules(sr.Rules)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rules) != 2 {
+			return nil, fmt.Errorf("sepby rule requires 2 rules, got %d", len(rules))
+		}
+
+		if sr.Max == 0 {
+			return ManySep(rules[0], rules[1], sr.Min, -1, nil), nil
+		}
+
+		return ManySep(rules[0], rules[1], sr.Min, sr.Max, nil), nil
+	case "branches":
+		mb := &matchBranch{}
+
+		for _, b := range sr.Branches {
+			r, err := u.rule(b.Rule)
+			if err != nil {
+				return nil, err
+			}
+
+			mb.rules = append(mb.rules, branch{name: b.Name, r: r, leftAssoc: b.LeftAssoc})
+		}
+
+		return mb, nil
+	case "prefix":
+		mpt := &matchPrefixTable{rules: map[byte]Rule{}}
+
+		for k, v := range sr.Prefix {
+			if len(k) != 1 {
+				return nil, fmt.Errorf("invalid prefix %q", k)
+			}
+
+			r, err := u.rule(v)
+			if err != nil {
+				return nil, err
+			}
+
+			mpt.rules[k[0]] = r
+		}
+
+		return mpt, nil
+	case "count":
+		return u.sub(sr, func(r Rule) Rule { return Count(r, sr.Min) })
+	case "star":
+		return u.sub(sr, Star)
+	case "plus":
+		return u.sub(sr, Plus)
+	case "many":
+		var fn func([]interface{}) interface{}
+		if sr.Collect {
+			fn = copyGroup
+		}
+
+		return u.sub(sr, func(r Rule) Rule { return Many(r, sr.Min, sr.Max, fn) })
+	case "maybe":
+		return u.sub(sr, Maybe)
+	case "maybevalue":
+		return u.sub(sr, MaybeValue)
+	case "check":
+		return u.sub(sr, Check)
+	case "not":
+		return u.sub(sr, Not)
+	case "capture":
+		return u.sub(sr, func(r Rule) Rule { return CaptureWith(r, CaptureOption(sr.Opts)) })
+	case "scope":
+		return u.sub(sr, Scope)
+	case "named":
+		return u.sub(sr, func(r Rule) Rule { return Named(sr.Value, r) })
+	case "action":
+		fn, ok := u.h.Actions[sr.Handler]
+		if !ok {
+			return nil, fmt.Errorf("unknown action handler %q", sr.Handler)
+		}
+
+		return u.sub(sr, func(r Rule) Rule { return Action(r, fn) })
+	case "erraction":
+		fn, ok := u.h.ErrActions[sr.Handler]
+		if !ok {
+			return nil, fmt.Errorf("unknown error action handler %q", sr.Handler)
+		}
+
+		return u.sub(sr, func(r Rule) Rule { return ActionErr(r, fn) })
+	case "transform":
+		fn, ok := u.h.Transforms[sr.Handler]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform handler %q", sr.Handler)
+		}
+
+		return u.sub(sr, func(r Rule) Rule { return Transform(r, fn) })
+	case "checkaction":
+		fn, ok := u.h.Checks[sr.Handler]
+		if !ok {
+			return nil, fmt.Errorf("unknown check handler %q", sr.Handler)
+		}
+
+		return CheckAction(fn), nil
+	case "stateget":
+		return StateGet(sr.Value), nil
+	case "statepop":
+		return StatePop(sr.Value), nil
+	case "custom":
+		ct := customKind(sr.Value)
+		if ct == nil || ct.Unmarshal == nil {
+			return nil, fmt.Errorf("custom rule kind %q is not registered", sr.Value)
+		}
+
+		rules, err := u.rules(sr.Rules)
+		if err != nil {
+			return nil, err
+		}
+
+		cr, err := ct.Unmarshal(sr.Custom, rules)
+		if err != nil {
+			return nil, err
+		}
+
+		return Custom(sr.Name, cr), nil
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", sr.Type)
+	}
+}
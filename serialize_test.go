@@ -0,0 +1,127 @@
+package peggysue
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerialize(t *testing.T) {
+	toInt := func(s string) interface{} {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	add := func(v Values) interface{} {
+		return v.Get("lhs").(int) + v.Get("rhs").(int)
+	}
+
+	h := &Handlers{
+		Actions:    map[string]func(Values) interface{}{"add": add},
+		Transforms: map[string]func(string) interface{}{"int": toInt},
+	}
+
+	num := R("num")
+	num.Set(Transform(Plus(Range('0', '9')), toInt))
+
+	sum := R("sum")
+	sum.Set(Or(
+		Action(Seq(Named("lhs", sum), S("+"), Named("rhs", num)), add),
+		num,
+	))
+
+	t.Run("round trips a rule graph", func(t *testing.T) {
+		r := require.New(t)
+
+		data, err := Marshal(sum, h)
+		r.NoError(err)
+
+		rule, err := Unmarshal(data, h)
+		r.NoError(err)
+
+		r.Equal("sum", rule.Name())
+		r.True(rule.(Ref).LeftRecursive())
+
+		val, ok, err := New().Parse(rule, "1+2+30")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(33, val)
+
+		again, err := Marshal(rule, h)
+		r.NoError(err)
+		r.JSONEq(string(data), string(again))
+	})
+
+	t.Run("round trips terminals and combinators", func(t *testing.T) {
+		r := require.New(t)
+
+		word := N("word", CaptureWith(Plus(Or(Range('a', 'z'), SetFold('_', 'x'))), CaptureFold))
+
+		rule := Seq(
+			Not(S("x")),
+			Collect(Star(Seq(word, Maybe(S(" "))))),
+			Check(EOS()),
+		)
+
+		data, err := Marshal(rule, nil)
+		r.NoError(err)
+
+		rule2, err := Unmarshal(data, nil)
+		r.NoError(err)
+		r.Equal(Print(rule), Print(rule2))
+
+		val, ok, err := New().Parse(rule2, "ab X_")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"ab", "x_"}, val)
+
+		body := Seq(S(`"`), Capture(Star(Seq(Not(Set('"', '\\')), Any()))), S(`"`))
+
+		data, err = Marshal(body, nil)
+		r.NoError(err)
+
+		body2, err := Unmarshal(data, nil)
+		r.NoError(err)
+		r.Equal(Print(body), Print(body2))
+
+		val, ok, err = New().Parse(body2, `"a b"`)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("a b", val)
+	})
+
+	t.Run("round trips separated lists", func(t *testing.T) {
+		r := require.New(t)
+
+		item := Capture(Range('a', 'z'))
+
+		for _, rule := range []Rule{SepBy(item, S(",")), ManySep(item, S(","), 1, 2, nil)} {
+			data, err := Marshal(rule, nil)
+			r.NoError(err)
+
+			rule2, err := Unmarshal(data, nil)
+			r.NoError(err)
+			r.Equal(Print(rule), Print(rule2))
+		}
+
+		_, err := Marshal(ManySep(item, S(","), 0, -1, func([]interface{}) interface{} { return nil }), nil)
+		r.ErrorContains(err, "ManySep with a function")
+	})
+
+	t.Run("reports functions that can not be serialized", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := Marshal(Action(S("a"), func(Values) interface{} { return nil }), h)
+		r.ErrorContains(err, "not a registered handler")
+
+		_, err = Marshal(Rune(func(rune) bool { return true }), h)
+		r.ErrorContains(err, "unsupported rule type")
+
+		data, err := Marshal(sum, h)
+		r.NoError(err)
+
+		_, err = Unmarshal(data, nil)
+		r.ErrorContains(err, "unknown action handler \"add\"")
+	})
+}
@@ -0,0 +1,391 @@
+package peggysue
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// State provides access to the per-parse state store. The store is manipulated
+// by the StateSet, StateUpdate, StatePush, and StatePop rules and allows for
+// context sensitive grammars, such as C's typedef names or indentation based
+// blocks.
+//
+// Changes to the store are undone when the parser backtracks past the rule that
+// made them, so the store always reflects the rules that have actually matched.
+type State interface {
+	// Get returns the value assigned to key with StateSet or StateUpdate, or
+	// nil if the key has not been assigned.
+	Get(key string) interface{}
+
+	// Top returns the value at the top of the stack named key. The boolean
+	// is false if the stack is empty.
+	Top(key string) (interface{}, bool)
+
+	// Depth returns the number of values on the stack named key.
+	Depth(key string) int
+}
+
+// stateStore is an immutable map of assignments, held as a balanced binary
+// tree ordered by key. Every change copies the path to the key it changes,
+// creating a new store that shares the rest of the tree with the previous
+// one. This makes it cheap to snapshot the store when marking a position and
+// to restore it when backtracking, while lookups take time logarithmic in the
+// number of keys rather than linear in the number of changes.
+type stateStore struct {
+	key         string
+	val         interface{}
+	left, right *stateStore
+	height      int
+}
+
+// stateStack is an immutable stack of values, used as the value of a key
+// manipulated by StatePush and StatePop.
+type stateStack struct {
+	val   interface{}
+	next  *stateStack
+	depth int
+}
+
+func (st *stateStore) with(key string, val interface{}) *stateStore {
+	if st == nil {
+		return &stateStore{key: key, val: val, height: 1}
+	}
+
+	n := *st
+
+	switch {
+	case key < st.key:
+		n.left = st.left.with(key, val)
+	case key > st.key:
+		n.right = st.right.with(key, val)
+	default:
+		n.val = val
+		return &n
+	}
+
+	return n.balance()
+}
+
+func (st *stateStore) lookup(key string) (interface{}, bool) {
+	for n := st; n != nil; {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n.val, true
+		}
+	}
+
+	return nil, false
+}
+
+func (st *stateStore) depth() int {
+	if st == nil {
+		return 0
+	}
+
+	return st.height
+}
+
+func (st *stateStore) fixHeight() {
+	st.height = 1 + st.left.depth()
+	if h := 1 + st.right.depth(); h > st.height {
+		st.height = h
+	}
+}
+
+// balance returns n, a new node, rotated so that the heights of its subtrees
+// differ by at most one.
+func (n *stateStore) balance() *stateStore {
+	switch bf := n.left.depth() - n.right.depth(); {
+	case bf > 1:
+		if n.left.left.depth() < n.left.right.depth() {
+			n.left = n.left.rotateLeft()
+		}
+
+		return n.rotateRight()
+	case bf < -1:
+		if n.right.right.depth() < n.right.left.depth() {
+			n.right = n.right.rotateRight()
+		}
+
+		return n.rotateLeft()
+	}
+
+	n.fixHeight()
+	return n
+}
+
+// rotateRight returns a copy of st with its left child as the root. The
+// nodes are copied, since they may be shared with other stores.
+func (st *stateStore) rotateRight() *stateStore {
+	top, n := *st.left, *st
+
+	n.left = top.right
+	n.fixHeight()
+
+	top.right = &n
+	top.fixHeight()
+
+	return &top
+}
+
+// rotateLeft returns a copy of st with its right child as the root.
+func (st *stateStore) rotateLeft() *stateStore {
+	top, n := *st.right, *st
+
+	n.right = top.left
+	n.fixHeight()
+
+	top.left = &n
+	top.fixHeight()
+
+	return &top
+}
+
+func (st *stateStore) stack(key string) *stateStack {
+	val, _ := st.lookup(key)
+	stk, _ := val.(*stateStack)
+	return stk
+}
+
+func (st *stateStore) Get(key string) interface{} {
+	val, _ := st.lookup(key)
+	return val
+}
+
+func (st *stateStore) Top(key string) (interface{}, bool) {
+	stk := st.stack(key)
+	if stk == nil {
+		return nil, false
+	}
+
+	return stk.val, true
+}
+
+func (st *stateStore) Depth(key string) int {
+	stk := st.stack(key)
+	if stk == nil {
+		return 0
+	}
+
+	return stk.depth
+}
+
+type matchStateSet struct {
+	basicRule
+	key string
+	fn  func(Values) interface{}
+}
+
+func (m *matchStateSet) match(s *state) result {
+	s.store = s.store.with(m.key, m.fn(s.values))
+	s.good(m)
+	return result{matched: true}
+}
+
+func (m *matchStateSet) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchStateSet) print() string {
+	return fmt.Sprintf("&{ set %s }", strconv.Quote(m.key))
+}
+
+// StateSet returns a rule that assigns the return value of the given function
+// to key in the state store. The Values argument provides access to the current
+// scope. The rule always matches and does not consume any input.
+//
+// The value of the match is nil.
+func StateSet(key string, fn func(Values) interface{}) Rule {
+	return &matchStateSet{key: key, fn: fn}
+}
+
+type matchStateUpdate struct {
+	basicRule
+	key string
+	fn  func(old interface{}, v Values) interface{}
+}
+
+func (m *matchStateUpdate) match(s *state) result {
+	s.store = s.store.with(m.key, m.fn(s.store.Get(m.key), s.values))
+	s.good(m)
+	return result{matched: true}
+}
+
+func (m *matchStateUpdate) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchStateUpdate) print() string {
+	return fmt.Sprintf("&{ update %s }", strconv.Quote(m.key))
+}
+
+// StateUpdate returns a rule that calls the given function with the value
+// currently assigned to key in the state store (or nil) and the current scope,
+// and assigns the return value to key. The rule always matches and does not
+// consume any input.
+//
+// Because the store is restored when backtracking, the old value must not be
+// modified in place. Instead, return an updated copy.
+//
+// The value of the match is nil.
+func StateUpdate(key string, fn func(old interface{}, v Values) interface{}) Rule {
+	return &matchStateUpdate{key: key, fn: fn}
+}
+
+type matchStateGet struct {
+	basicRule
+	key string
+}
+
+func (m *matchStateGet) match(s *state) result {
+	val, ok := s.store.lookup(m.key)
+	if !ok {
+		s.bad(m)
+		return result{}
+	}
+
+	s.good(m)
+	return result{value: val, matched: true}
+}
+
+func (m *matchStateGet) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchStateGet) print() string {
+	return fmt.Sprintf("&{ get %s }", strconv.Quote(m.key))
+}
+
+// StateGet returns a rule that matches if key has been assigned in the state
+// store. It does not consume any input.
+//
+// The value of the match is the value assigned to key.
+func StateGet(key string) Rule {
+	return &matchStateGet{key: key}
+}
+
+type matchStatePush struct {
+	basicRule
+	key string
+	fn  func(Values) interface{}
+}
+
+func (m *matchStatePush) match(s *state) result {
+	stk := s.store.stack(m.key)
+
+	depth := 1
+	if stk != nil {
+		depth = stk.depth + 1
+	}
+
+	s.store = s.store.with(m.key, &stateStack{
+		val:   m.fn(s.values),
+		next:  stk,
+		depth: depth,
+	})
+
+	s.good(m)
+	return result{matched: true}
+}
+
+func (m *matchStatePush) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchStatePush) print() string {
+	return fmt.Sprintf("&{ push %s }", strconv.Quote(m.key))
+}
+
+// StatePush returns a rule that pushes the return value of the given function
+// onto the stack named key in the state store. The rule always matches and does
+// not consume any input.
+//
+// The value of the match is nil.
+func StatePush(key string, fn func(Values) interface{}) Rule {
+	return &matchStatePush{key: key, fn: fn}
+}
+
+type matchStatePop struct {
+	basicRule
+	key string
+}
+
+func (m *matchStatePop) match(s *state) result {
+	stk := s.store.stack(m.key)
+	if stk == nil {
+		s.bad(m)
+		return result{}
+	}
+
+	s.store = s.store.with(m.key, stk.next)
+
+	s.good(m)
+	return result{value: stk.val, matched: true}
+}
+
+func (m *matchStatePop) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchStatePop) print() string {
+	return fmt.Sprintf("&{ pop %s }", strconv.Quote(m.key))
+}
+
+// StatePop returns a rule that removes the top value from the stack named key
+// in the state store. The rule fails if the stack is empty. It does not consume
+// any input.
+//
+// The value of the match is the value that was removed.
+func StatePop(key string) Rule {
+	return &matchStatePop{key: key}
+}
+
+type matchDispatch struct {
+	basicRule
+	fn func(st State, input string) Rule
+}
+
+func (m *matchDispatch) match(s *state) result {
+	r := m.fn(s.store, s.cur())
+	if r == nil {
+		s.bad(m)
+		return result{}
+	}
+
+	mark := s.mark()
+
+	res := s.match(r)
+	if !res.matched {
+		s.restore(mark)
+	}
+
+	return s.check(m, res)
+}
+
+func (m *matchDispatch) detectLeftRec(r Rule, rs ruleSet) bool {
+	return false
+}
+
+func (m *matchDispatch) print() string {
+	return "&{ dispatch }"
+}
+
+// Dispatch returns a rule that calls the given function at match time, passing
+// the state store and the remaining input, and then matches the rule that it
+// returns. If the function returns nil, the match fails. This allows for mode
+// switching grammars, where the rules to use depend on what has been parsed so
+// far, without duplicating entire rule trees.
+//
+// The function should return rules that were created ahead of time rather than
+// creating new ones on each call, so that memoization of Refs remains effective.
+// Because the rule is only known at match time, Dispatch is not considered when
+// detecting left recursion.
+//
+// The value of the match is the value of the selected rule.
+func Dispatch(fn func(st State, input string) Rule) Rule {
+	return &matchDispatch{fn: fn}
+}
@@ -0,0 +1,264 @@
+package peggysue
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	t.Run("can set and get state", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		r1 := Seq(
+			StateSet("k", func(Values) interface{} { return 42 }),
+			S("a"),
+			StateGet("k"),
+		)
+
+		val, ok, err := p.Parse(r1, "a")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(42, val)
+
+		_, ok, err = p.Parse(Seq(StateGet("k"), S("a")), "a")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("undoes state changes when backtracking", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		unset := CheckActionCtx(func(ctx *MatchContext) bool {
+			return ctx.State.Get("k") == nil
+		})
+
+		r1 := Or(
+			Seq(StateSet("k", func(Values) interface{} { return true }), S("a")),
+			Seq(S("b"), unset),
+		)
+
+		_, ok, err := p.Parse(r1, "b")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("pushes and pops values", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		var depth int
+
+		r1 := Seq(
+			StatePush("s", func(Values) interface{} { return "x" }),
+			StatePush("s", func(Values) interface{} { return "y" }),
+			CheckActionCtx(func(ctx *MatchContext) bool {
+				depth = ctx.State.Depth("s")
+				return true
+			}),
+			S("a"),
+			StatePop("s"),
+		)
+
+		val, ok, err := p.Parse(r1, "a")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("y", val)
+		r.Equal(2, depth)
+
+		r2 := Seq(
+			StatePush("s", func(Values) interface{} { return "x" }),
+			StatePop("s"),
+			StatePop("s"),
+		)
+
+		_, ok, err = p.Parse(r2, "")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("does not reuse memoized results computed with different state", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		ref := R("r")
+		ref.Set(Seq(
+			CheckActionCtx(func(ctx *MatchContext) bool {
+				return ctx.State.Get("k") == nil
+			}),
+			S("a"),
+		))
+
+		r1 := Or(
+			Seq(StateSet("k", func(Values) interface{} { return true }), ref),
+			Seq(ref, S("b")),
+		)
+
+		_, ok, err := p.Parse(r1, "ab")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("resolves typedef style ambiguity", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		ident := Capture(Plus(Range('a', 'z')))
+
+		typedef := Action(
+			Seq(
+				S("typedef "),
+				Named("name", ident),
+				StateUpdate("types", func(old interface{}, v Values) interface{} {
+					types := map[string]bool{}
+					if m, ok := old.(map[string]bool); ok {
+						for k := range m {
+							types[k] = true
+						}
+					}
+
+					types[v.Get("name").(string)] = true
+					return types
+				}),
+				S(";"),
+			),
+			func(Values) interface{} { return "typedef" },
+		)
+
+		typeName := R("type-name")
+		typeName.Set(Seq(
+			Named("t", ident),
+			CheckActionCtx(func(ctx *MatchContext) bool {
+				types, _ := ctx.State.Get("types").(map[string]bool)
+				return types[ctx.Values.Get("t").(string)]
+			}),
+		))
+
+		decl := Action(Seq(typeName, S("*"), ident, S(";")), func(Values) interface{} {
+			return "decl"
+		})
+
+		expr := Action(Seq(ident, S("*"), ident, S(";")), func(Values) interface{} {
+			return "expr"
+		})
+
+		prog := StarCapture(Or(typedef, decl, expr))
+
+		val, ok, err := p.Parse(prog, "a*b;typedef a;a*b;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"expr", "typedef", "decl"}, val)
+	})
+
+	t.Run("dispatches to a rule based on state", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		word := Capture(Plus(Range('a', 'z')))
+		upper := Capture(Plus(Range('A', 'Z')))
+
+		mode := Dispatch(func(st State, input string) Rule {
+			switch st.Get("mode") {
+			case "upper":
+				return upper
+			case "lower":
+				return word
+			default:
+				return nil
+			}
+		})
+
+		setMode := func(m string) Rule {
+			return StateSet("mode", func(Values) interface{} { return m })
+		}
+
+		r1 := Or(
+			Seq(S("U:"), setMode("upper"), mode),
+			Seq(S("L:"), setMode("lower"), mode),
+			mode,
+		)
+
+		val, ok, err := p.Parse(r1, "U:ABC")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("ABC", val)
+
+		val, ok, err = p.Parse(r1, "L:abc")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("abc", val)
+
+		_, ok, err = p.Parse(r1, "U:abc")
+		r.NoError(err)
+		r.False(ok)
+
+		_, ok, err = p.Parse(r1, "abc")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("dispatches to a rule based on lookahead", func(t *testing.T) {
+		p := New()
+
+		r := require.New(t)
+
+		num := Capture(Plus(Range('0', '9')))
+		word := Capture(Plus(Range('a', 'z')))
+
+		r1 := Dispatch(func(st State, input string) Rule {
+			if input != "" && input[0] >= '0' && input[0] <= '9' {
+				return num
+			}
+			return word
+		})
+
+		val, ok, err := p.Parse(r1, "123")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("123", val)
+
+		val, ok, err = p.Parse(r1, "abc")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("abc", val)
+	})
+}
+
+func TestStateStore(t *testing.T) {
+	t.Run("keeps earlier stores unchanged", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			st     *stateStore
+			stores []*stateStore
+		)
+
+		for i := 0; i < 1000; i++ {
+			st = st.with(strconv.Itoa(i%100), i)
+			stores = append(stores, st)
+		}
+
+		// A balanced tree of 100 keys is no more than about 1.44*log2(100)
+		// high.
+		r.LessOrEqual(st.depth(), 10)
+
+		for i, st := range stores {
+			r.Equal(i, st.Get(strconv.Itoa(i%100)))
+
+			if i >= 100 {
+				r.Equal(i-1, st.Get(strconv.Itoa((i-1)%100)))
+			} else {
+				r.Nil(st.Get(strconv.Itoa(i + 1)))
+			}
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package peggysue
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// streamReadSize is how much input ParseReader reads at a time.
+	streamReadSize = 64 * 1024
+
+	// defaultStreamLookahead is the lookahead used by ParseReader when
+	// WithStreamLookahead is not given.
+	defaultStreamLookahead = 4 * 1024
+)
+
+// WithStreamLookahead sets how close to the end of the input read so far
+// ParseReader lets the parser get before it reads more input and retries
+// the current item. It must be at least as long as the longest input that
+// a rule looks at to decide to fail, such as the longest literal string.
+// The default is 4KiB.
+func WithStreamLookahead(n int) Option {
+	return func(p *Parser) {
+		p.streamLookahead = n
+	}
+}
+
+// ParseReader is like ParseAll, but reads the input from rd rather than
+// requiring all of it to be in memory. Only a window of the input is kept:
+// once an item has been matched, it is passed to fn and the input before it,
+// along with any memoized results, is discarded. Memory use is bounded by
+// the size of the largest item plus the lookahead, rather than the size of
+// the input.
+//
+// Because the parser does not see the whole input, ParseReader reads more
+// input and matches the current item again whenever the parser gets within
+// the lookahead of the end of the input read so far, or the item fails to
+// match before the end of the input. Rules that are given the rest of the
+// input, such as Scan and Re, must not fail because of input beyond the
+// lookahead.
+//
+// If fn returns an error, parsing stops and the error is returned. Positions
+// in the spans and values are relative to the whole input. ParseReader does
+// not support WithEncoding, other than UTF-8, or WithFileRegions, and does
+// not report progress to WithProgress, as the size of the input is unknown.
+func (p *Parser) ParseReader(r Rule, rd io.Reader, skip Rule, fn func(val interface{}, span Span) error) error {
+	if p.encoding != EncodingUTF8 {
+		return fmt.Errorf("ParseReader does not support encodings other than UTF-8")
+	}
+
+	if len(p.regions) > 0 {
+		return fmt.Errorf("ParseReader does not support file regions")
+	}
+
+	lookahead := p.streamLookahead
+	if lookahead <= 0 {
+		lookahead = defaultStreamLookahead
+	}
+
+	w := &streamWindow{rd: rd}
+
+	if err := p.fillWindow(w, streamReadSize); err != nil {
+		return err
+	}
+
+	if p.skipBOM && len(w.buf) >= len(utf8BOM) && string(w.buf[:len(utf8BOM)]) == utf8BOM {
+		w.drop(len(utf8BOM), 0, 0)
+	}
+
+	for {
+		s := p.initState(string(w.buf), &sourceMap{shift: w.base}, p.filename)
+		s.lineBase = w.lineBase
+		s.colBase = w.colBase
+		s.nextProgress = math.MaxInt
+
+		commit, err := s.streamItems(r, skip, w.eof, lookahead, fn)
+
+		returnValues(s.values)
+
+		if err != nil || w.eof {
+			return err
+		}
+
+		// Before the window is moved, the position of the commit point is
+		// calculated so that positions in the next window continue on.
+		w.drop(commit, s.line(commit)-1, s.column(commit)-1)
+
+		if err := p.fillWindow(w, len(w.buf)+streamReadSize); err != nil {
+			return err
+		}
+	}
+}
+
+// fillWindow reads until the window holds at least size bytes, checking
+// that the input read so far is within the limit set by WithMaxInputSize.
+func (p *Parser) fillWindow(w *streamWindow, size int) error {
+	if err := w.fill(size); err != nil {
+		return err
+	}
+
+	return p.checkInputSize(w.base + len(w.buf))
+}
+
+// streamItems matches items in the window until one can not be trusted
+// because the parser got within lookahead of the end of the window, and
+// returns the position that item started at. If eof is true, the window
+// contains the rest of the input and all items are matched.
+func (s *state) streamItems(r, skip Rule, eof bool, lookahead int, fn func(val interface{}, span Span) error) (int, error) {
+	limit := s.inputSize
+	if !eof {
+		limit -= lookahead
+	}
+
+	for {
+		commit := s.pos
+
+		if skip != nil {
+			mark := s.mark()
+			if !s.run(skip).matched {
+				s.restore(mark)
+			}
+		}
+
+		if s.err != nil {
+			return commit, s.err
+		}
+
+		if s.maxPos > limit {
+			return commit, nil
+		}
+
+		if s.pos >= s.inputSize {
+			return commit, nil
+		}
+
+		start := s.pos
+
+		res := s.run(r)
+		if s.err != nil {
+			return commit, s.err
+		}
+
+		if !res.matched || s.pos == start {
+			if !eof {
+				return commit, nil
+			}
+
+			return commit, s.notConsumed()
+		}
+
+		if s.maxPos > limit {
+			return commit, nil
+		}
+
+		if err := fn(res.value, Span{Start: s.position(start), End: s.position(s.pos)}); err != nil {
+			return commit, err
+		}
+	}
+}
+
+// streamWindow is the portion of the input that ParseReader holds in
+// memory.
+type streamWindow struct {
+	rd  io.Reader
+	buf []byte
+	eof bool
+
+	// base is the offset of the start of buf in the input, and lineBase
+	// and colBase are the line and column before it.
+	base     int
+	lineBase int
+	colBase  int
+}
+
+// fill reads until the window holds at least size bytes or the input ends.
+func (w *streamWindow) fill(size int) error {
+	for !w.eof && len(w.buf) < size {
+		if cap(w.buf) < size {
+			buf := make([]byte, len(w.buf), size)
+			copy(buf, w.buf)
+			w.buf = buf
+		}
+
+		n, err := w.rd.Read(w.buf[len(w.buf):cap(w.buf)])
+		w.buf = w.buf[:len(w.buf)+n]
+
+		if err == io.EOF {
+			w.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// drop discards the first n bytes of the window. line and col are the line
+// and column, counting from 0, of the new start of the window.
+func (w *streamWindow) drop(n, line, col int) {
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	w.base += n
+	w.lineBase = line
+	w.colBase = col
+}
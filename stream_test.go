@@ -0,0 +1,99 @@
+package peggysue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReader(t *testing.T) {
+	word := Capture(Plus(Range('a', 'z')))
+	skip := Plus(Set(' ', '\t', '\n'))
+
+	var sb strings.Builder
+
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&sb, "%s ", strings.Repeat(string(rune('a'+i%26)), i%13+1))
+
+		if i%7 == 0 {
+			sb.WriteString("\n\t")
+		}
+	}
+
+	input := sb.String()
+
+	t.Run("matches the same items as ParseAll", func(t *testing.T) {
+		r := require.New(t)
+
+		p := New()
+
+		values, spans, err := p.ParseAll(word, input, skip)
+		r.NoError(err)
+
+		var (
+			streamed []interface{}
+			sspans   []Span
+		)
+
+		err = p.ParseReader(word, iotest.HalfReader(strings.NewReader(input)), skip, func(val interface{}, span Span) error {
+			streamed = append(streamed, val)
+			sspans = append(sspans, span)
+			return nil
+		})
+		r.NoError(err)
+
+		r.Equal(values, streamed)
+		r.Equal(spans, sspans)
+	})
+
+	t.Run("retries items at the end of the window", func(t *testing.T) {
+		r := require.New(t)
+
+		long := strings.Repeat("x", 3*streamReadSize)
+
+		var got []int
+
+		err := New().ParseReader(word, strings.NewReader("ab "+long+" cd"), skip, func(val interface{}, span Span) error {
+			got = append(got, len(val.(string)))
+			return nil
+		})
+		r.NoError(err)
+		r.Equal([]int{2, len(long), 2}, got)
+	})
+
+	t.Run("reports errors with positions in the whole input", func(t *testing.T) {
+		r := require.New(t)
+
+		err := New().ParseReader(word, strings.NewReader(input+"\n123"), skip, func(val interface{}, span Span) error {
+			return nil
+		})
+
+		var nc *ErrInputNotConsumed
+		r.ErrorAs(err, &nc)
+		r.Equal(len(input)+1, nc.Pos.Offset)
+		r.Equal(strings.Count(input, "\n")+2, nc.Pos.Line)
+		r.Equal(1, nc.Pos.Column)
+	})
+
+	t.Run("stops when fn returns an error", func(t *testing.T) {
+		r := require.New(t)
+
+		stop := errors.New("stop")
+
+		var n int
+
+		err := New().ParseReader(word, strings.NewReader(input), skip, func(val interface{}, span Span) error {
+			n++
+			if n == 3 {
+				return stop
+			}
+			return nil
+		})
+		r.ErrorIs(err, stop)
+		r.Equal(3, n)
+	})
+}
@@ -0,0 +1,60 @@
+package toolkit
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	p "github.com/lab47/peggysue"
+)
+
+var (
+	charEscape = p.Or(em(`\'`, "'"), escaped)
+
+	charPlain = p.Transform(p.Rune(func(r rune) bool {
+		return r != '\'' && r != '\\' && r != '\n'
+	}), func(s string) interface{} {
+		r, _ := utf8.DecodeRuneInString(s)
+		return r
+	})
+
+	// CharLiteral parses a C or Go style character literal, such as 'a',
+	// '\n', '\x7f', '\101', or 'é', using the same escapes as
+	// DoubleQuotedString plus \'. An escape that produces an invalid code
+	// point or an octal escape above 255 aborts the parse with a
+	// *peggysue.SemanticError.
+	//
+	// The value of the match is a rune.
+	CharLiteral = p.ActionErr(
+		p.Seq(
+			p.S(`'`),
+			p.Named("raw", p.Capture(p.Named("char", p.Or(charEscape, charPlain)))),
+			p.S(`'`),
+		),
+		func(v p.Values) (interface{}, error) {
+			raw := v.Get("raw").(string)
+
+			var r rune
+
+			switch cv := v.Get("char").(type) {
+			case rune:
+				r = cv
+			case byte:
+				r = rune(cv)
+			case string:
+				// Hex escapes produce a single byte string.
+				r = rune(cv[0])
+			default:
+				panic(fmt.Sprintf("unexpected value: %T", cv))
+			}
+
+			if len(raw) == 4 && raw[0] == '\\' && '0' <= raw[1] && raw[1] <= '7' && r > 255 {
+				return nil, fmt.Errorf("octal escape value %d > 255", r)
+			}
+
+			if !utf8.ValidRune(r) {
+				return nil, fmt.Errorf("escape sequence %s is an invalid unicode code point", raw)
+			}
+
+			return r, nil
+		})
+)
@@ -0,0 +1,57 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharLiteral(t *testing.T) {
+	t.Run("parses characters and escapes", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for in, out := range map[string]rune{
+			`'a'`:          'a',
+			`'é'`:          'é',
+			`'\n'`:         '\n',
+			`'\''`:         '\'',
+			`'\\'`:         '\\',
+			`'\x7f'`:       0x7f,
+			`'\101'`:       'A',
+			`'\u00e9'`:     'é',
+			`'\U0001F600'`: '😀',
+		} {
+			val, ok, err := pr.Parse(CharLiteral, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+			r.Equal(out, val, in)
+		}
+	})
+
+	t.Run("rejects malformed literals", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{`''`, `'ab'`, `'a`, "'\n'", `'\q'`} {
+			_, ok, _ := pr.Parse(CharLiteral, in)
+			r.False(ok, in)
+		}
+	})
+
+	t.Run("validates the range of escapes", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{`'\400'`, `'\uD800'`, `'\U00110000'`} {
+			_, _, err := pr.Parse(CharLiteral, in)
+
+			var se *p.SemanticError
+			r.ErrorAs(err, &se, in)
+		}
+	})
+}
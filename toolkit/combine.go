@@ -1,6 +1,10 @@
 package toolkit
 
-import "github.com/lab47/peggysue"
+import (
+	"unicode"
+
+	"github.com/lab47/peggysue"
+)
 
 // After returns a function that when called, returns a new rule
 // that will match the rule passed to the function, then the
@@ -22,3 +26,69 @@ func After(after Rule) func(r Rule) Rule {
 		return peggysue.Seq(r, after)
 	}
 }
+
+// Before returns a function that when called, returns a new rule that
+// will match the rule passed to Before, then the rule passed to the
+// function. It's the counterpart to After, for grammars that skip
+// whitespace ahead of each token rather than after it.
+func Before(before Rule) func(r Rule) Rule {
+	return func(r Rule) Rule {
+		return peggysue.Seq(before, r)
+	}
+}
+
+// Around returns a function that when called, returns a new rule that
+// will match pre, the rule passed to the function, then post.
+//
+// For example:
+// parens := Around(S("("), S(")"))
+// call := Seq(ident, parens(args))
+func Around(pre, post Rule) func(r Rule) Rule {
+	return func(r Rule) Rule {
+		return peggysue.Seq(pre, r, post)
+	}
+}
+
+// Tokenizer creates token rules that skip trailing input, such as
+// whitespace and comments. Create one with Tokens.
+type Tokenizer struct {
+	skip Rule
+}
+
+// Tokens returns a Tokenizer whose rules match a token followed by
+// skip.
+//
+// For example:
+// tk := Tokens(WS)
+// ifStmt := Seq(tk.Kw("if"), cond, tk.Tok("{"), body, tk.Tok("}"))
+func Tokens(skip Rule) *Tokenizer {
+	return &Tokenizer{skip: skip}
+}
+
+// Tok returns a rule that matches the literal str, then the skip rule.
+//
+// The value of the match is nil.
+func (t *Tokenizer) Tok(str string) Rule {
+	return peggysue.Seq(peggysue.S(str), t.skip)
+}
+
+// Kw returns a rule that matches the keyword str, then the skip rule.
+// Unlike Tok, the keyword must not be followed by a letter, digit, or
+// underscore, so Kw("if") does not match the start of "iffy".
+//
+// The value of the match is nil.
+func (t *Tokenizer) Kw(str string) Rule {
+	return peggysue.Seq(peggysue.S(str), peggysue.Not(identChar), t.skip)
+}
+
+// T returns a rule that matches r, then the skip rule, for tokens that
+// aren't literals, such as numbers and identifiers.
+//
+// The value of the match is the value of r.
+func (t *Tokenizer) T(r Rule) Rule {
+	return peggysue.Seq(r, t.skip)
+}
+
+var identChar = peggysue.Rune(func(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+})
@@ -0,0 +1,57 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombine(t *testing.T) {
+	t.Run("matches before and around a rule", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		word := p.Capture(p.Plus(p.Range('a', 'z')))
+
+		val, ok, err := pr.Parse(Before(WS)(word), "  abc")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("abc", val)
+
+		parens := Around(p.S("("), p.S(")"))
+
+		val, ok, err = pr.Parse(parens(word), "(abc)")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("abc", val)
+	})
+
+	t.Run("creates tokens that skip whitespace", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		tk := Tokens(WS)
+
+		ident := tk.T(p.Capture(p.Plus(p.Range('a', 'z'))))
+
+		stmt := p.Seq(tk.Kw("if"), p.Named("cond", ident), tk.Tok("{"), tk.Tok("}"), p.Action(p.S(""), func(v p.Values) interface{} {
+			return v.Get("cond")
+		}))
+
+		val, ok, err := pr.Parse(stmt, "if  ready {\n}\n")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("ready", val)
+
+		_, ok, _ = pr.Parse(stmt, "iffy {}")
+		r.False(ok)
+
+		val, ok, err = pr.Parse(p.Or(tk.Kw("if"), ident), "iffy")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("iffy", val)
+	})
+}
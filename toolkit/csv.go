@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+var (
+	csvEOL = p.Or(p.S("\r\n"), p.S("\n"))
+
+	csvQuoted = p.Transform(
+		p.Seq(p.S(`"`), p.Star(p.Or(p.S(`""`), p.Rune(func(r rune) bool { return r != '"' }))), p.S(`"`)),
+		func(s string) interface{} {
+			return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+		})
+
+	csvUnquoted = p.Capture(p.Star(p.Rune(func(r rune) bool {
+		return r != ',' && r != '"' && r != '\r' && r != '\n'
+	})))
+
+	// CSVField parses a single CSV field, as defined by RFC 4180. A field is
+	// either unquoted, in which case it can't contain commas, quotes, or line
+	// breaks, or it is surrounded by double quotes and can contain anything,
+	// with quotes written twice.
+	//
+	// The value of the match is a string with the surrounding quotes removed
+	// and doubled quotes collapsed.
+	CSVField = p.Or(csvQuoted, csvUnquoted)
+
+	// CSVRecord parses one line of comma separated fields.
+	//
+	// The value of the match is a []string.
+	CSVRecord = p.Action(
+		p.Seq(
+			p.Named("first", CSVField),
+			p.Named("rest", p.Collect(p.Star(p.Seq(p.S(","), CSVField)))),
+		),
+		func(v p.Values) interface{} {
+			rest := v.Get("rest").([]interface{})
+
+			rec := make([]string, 0, len(rest)+1)
+			rec = append(rec, v.Get("first").(string))
+
+			for _, f := range rest {
+				rec = append(rec, f.(string))
+			}
+
+			return rec
+		})
+
+	// CSV parses a whole CSV document: records separated by CRLF (or a bare
+	// LF), with an optional line break after the last record.
+	//
+	// The value of the match is a [][]string.
+	CSV = p.Action(
+		p.Seq(
+			p.Named("first", CSVRecord),
+			p.Named("rest", p.Collect(p.Star(csvNextRecord(CSVRecord)))),
+			p.Maybe(csvEOL),
+		),
+		func(v p.Values) interface{} {
+			rest := v.Get("rest").([]interface{})
+
+			recs := make([][]string, 0, len(rest)+1)
+			recs = append(recs, v.Get("first").([]string))
+
+			for _, r := range rest {
+				recs = append(recs, r.([]string))
+			}
+
+			return recs
+		})
+)
+
+// csvNextRecord matches a line break followed by rec. A line break at the
+// end of the input is not the start of another (empty) record.
+func csvNextRecord(rec Rule) Rule {
+	return p.Seq(csvEOL, p.Not(p.EOS()), rec)
+}
+
+// CSVEach returns a rule that parses a CSV document like CSV, but rather
+// than building up all the records, it calls fn with each record as it is
+// matched. This allows large documents to be processed without keeping
+// every record in memory. If fn returns an error, the parse is aborted and
+// the error is returned wrapped in a *peggysue.SemanticError.
+//
+// The value of the match is nil.
+func CSVEach(fn func(rec []string) error) Rule {
+	rec := p.ActionErr(p.Named("rec", CSVRecord), func(v p.Values) (interface{}, error) {
+		return nil, fn(v.Get("rec").([]string))
+	})
+
+	return p.Seq(rec, p.Star(csvNextRecord(rec)), p.Maybe(csvEOL))
+}
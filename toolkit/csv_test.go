@@ -0,0 +1,88 @@
+package toolkit
+
+import (
+	"errors"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSV(t *testing.T) {
+	t.Run("parses fields", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for in, out := range map[string]string{
+			`abc`:              "abc",
+			``:                 "",
+			`"a,b"`:            "a,b",
+			`"say ""hi"""`:     `say "hi"`,
+			"\"two\r\nlines\"": "two\r\nlines",
+		} {
+			val, ok, err := pr.Parse(CSVField, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+			r.Equal(out, val, in)
+		}
+	})
+
+	t.Run("parses a document", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(CSV, "name,note\r\nbob,\"likes, commas\"\r\n,\r\n")
+		r.NoError(err)
+		r.True(ok)
+
+		r.Equal([][]string{
+			{"name", "note"},
+			{"bob", "likes, commas"},
+			{"", ""},
+		}, val)
+
+		val, ok, err = pr.Parse(CSV, "a\nb")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([][]string{{"a"}, {"b"}}, val)
+
+		_, _, err = pr.Parse(CSV, "a,b\"c\"\n")
+		r.Error(err)
+	})
+
+	t.Run("streams records to a callback", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		var recs [][]string
+
+		each := CSVEach(func(rec []string) error {
+			recs = append(recs, rec)
+			return nil
+		})
+
+		_, ok, err := pr.Parse(each, "1,2\r\n3,\"4\"\r\n")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([][]string{{"1", "2"}, {"3", "4"}}, recs)
+
+		stop := errors.New("stop")
+
+		_, _, err = pr.Parse(CSVEach(func(rec []string) error {
+			if rec[0] == "3" {
+				return stop
+			}
+
+			return nil
+		}), "1,2\r\n3,4\r\n")
+
+		r.ErrorIs(err, stop)
+
+		var se *p.SemanticError
+		r.ErrorAs(err, &se)
+		r.Equal(2, se.Pos.Line)
+	})
+}
@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	p "github.com/lab47/peggysue"
+)
+
+// scanIdent returns the length of the identifier at the start of str, or 0
+// if there isn't one.
+func scanIdent(str string) int {
+	for i, r := range str {
+		if r == utf8.RuneError {
+			return i
+		}
+
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+
+		return i
+	}
+
+	return len(str)
+}
+
+func identity(s string) interface{} {
+	return s
+}
+
+// Identifier parses an identifier: a letter or underscore followed by any
+// number of letters, digits, and underscores, such as foo_2. Letters and
+// digits are those defined by unicode.
+//
+// The value of the match is the identifier as a string.
+var Identifier = p.Transform(p.Scan(func(str string) int {
+	n := scanIdent(str)
+	if n == 0 {
+		return -1
+	}
+
+	return n
+}), identity)
+
+// IdentifierExcluding returns a rule that matches an Identifier, but only
+// if it is not one of keywords. This keeps reserved words from being parsed
+// as names, so "if" is not a variable while "iffy" still is.
+//
+// The value of the match is the identifier as a string.
+func IdentifierExcluding(keywords ...string) Rule {
+	reserved := make(map[string]struct{}, len(keywords))
+	for _, kw := range keywords {
+		reserved[kw] = struct{}{}
+	}
+
+	return p.Transform(p.Scan(func(str string) int {
+		n := scanIdent(str)
+		if n == 0 {
+			return -1
+		}
+
+		if _, ok := reserved[str[:n]]; ok {
+			return -1
+		}
+
+		return n
+	}), identity)
+}
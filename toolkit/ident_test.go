@@ -0,0 +1,55 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifier(t *testing.T) {
+	t.Run("parses identifiers", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{"foo", "_x1", "héllo", "a_b_c"} {
+			val, ok, err := pr.Parse(Identifier, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+			r.Equal(in, val)
+		}
+
+		for _, in := range []string{"1abc", "", "-x"} {
+			_, ok, _ := pr.Parse(Identifier, in)
+			r.False(ok, in)
+		}
+	})
+
+	t.Run("excludes keywords", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		name := IdentifierExcluding("if", "else", "return")
+
+		for _, in := range []string{"if", "else", "return"} {
+			_, ok, _ := pr.Parse(name, in)
+			r.False(ok, in)
+		}
+
+		for _, in := range []string{"iffy", "elsewhere", "x", "If"} {
+			val, ok, err := pr.Parse(name, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+			r.Equal(in, val)
+		}
+
+		expr := p.Or(p.Seq(p.S("if"), p.Or(p.EOS(), p.Not(Identifier)), p.Action(p.S(""), func(p.Values) interface{} { return "keyword" })), name)
+
+		val, ok, err := pr.Parse(expr, "if")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("keyword", val)
+	})
+}
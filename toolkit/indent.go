@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	p "github.com/lab47/peggysue"
+)
+
+// Indenter tracks the indentation of nested blocks, for grammars where
+// indentation is significant, such as Python or YAML. The widths of the
+// enclosing blocks are kept on a stack in the parser's state store, so they
+// are undone when the parser backtracks.
+type Indenter struct {
+	key      string
+	tabWidth int
+}
+
+// NewIndenter returns a new Indenter. The name is used to keep its stack
+// separate from other values in the state store, so each Indenter in a
+// grammar must use a unique name. Tabs advance to the next multiple of
+// peggysue.DefaultTabWidth.
+func NewIndenter(name string) *Indenter {
+	return &Indenter{key: "indent:" + name, tabWidth: p.DefaultTabWidth}
+}
+
+// TabWidth sets the distance between tab stops used to compute the width
+// of indentation that contains tabs. If n is not positive,
+// peggysue.DefaultTabWidth is used.
+func (ind *Indenter) TabWidth(n int) *Indenter {
+	if n <= 0 {
+		n = p.DefaultTabWidth
+	}
+
+	ind.tabWidth = n
+	return ind
+}
+
+// Current returns the width of the innermost enclosing block, or 0 if there
+// is none.
+func (ind *Indenter) Current(st p.State) int {
+	w, ok := st.Top(ind.key)
+	if !ok {
+		return 0
+	}
+
+	return w.(int)
+}
+
+// Indent returns a rule that matches the spaces and tabs at the current
+// position, which should be the start of a line. It always matches.
+//
+// The value of the match is the width of the indentation, an int.
+func (ind *Indenter) Indent() Rule {
+	return p.Transform(p.Star(p.Set(' ', '\t')), func(s string) interface{} {
+		w := 0
+
+		for _, b := range []byte(s) {
+			if b == '\t' {
+				w += ind.tabWidth - (w % ind.tabWidth)
+			} else {
+				w++
+			}
+		}
+
+		return w
+	})
+}
+
+// compare matches indentation and checks its width against the current
+// block with cmp.
+func (ind *Indenter) compare(cmp func(w, cur int) bool, then ...Rule) Rule {
+	rules := append([]Rule{
+		p.Named("indent", ind.Indent()),
+		p.CheckActionCtx(func(ctx *p.MatchContext) bool {
+			return cmp(ctx.Values.Get("indent").(int), ind.Current(ctx.State))
+		}),
+	}, then...)
+
+	return p.Scope(p.Seq(rules...))
+}
+
+// SameIndent returns a rule that matches indentation as wide as the current
+// block, ie. the start of another line in the same block.
+//
+// The value of the match is the width of the indentation.
+func (ind *Indenter) SameIndent() Rule {
+	return ind.compare(func(w, cur int) bool { return w == cur })
+}
+
+// DeeperIndent returns a rule that matches indentation wider than the
+// current block and begins a new block at that width. Use Dedent to end
+// the block.
+//
+// The value of the match is the width of the indentation.
+func (ind *Indenter) DeeperIndent() Rule {
+	return ind.compare(
+		func(w, cur int) bool { return w > cur },
+		p.StatePush(ind.key, func(v p.Values) interface{} {
+			return v.Get("indent")
+		}),
+	)
+}
+
+// Dedent returns a rule that ends the current block. It does not consume
+// any input, and fails if there is no block to end.
+//
+// The value of the match is the width of the block that ended.
+func (ind *Indenter) Dedent() Rule {
+	return p.StatePop(ind.key)
+}
+
+// Block returns a rule that matches an indented block of lines, each
+// matched by line, which must consume its own line break. The first line
+// sets the indentation of the block and the rest must be indented the
+// same. Blank lines between them are skipped.
+//
+// The value of the match is a []interface{} of the values of each line.
+func (ind *Indenter) Block(line Rule) Rule {
+	return p.Action(
+		p.Seq(
+			p.Star(BlankLine),
+			ind.DeeperIndent(),
+			p.Named("first", line),
+			p.Named("rest", p.Collect(p.Star(p.Action(
+				p.Seq(p.Star(BlankLine), ind.SameIndent(), p.Named("line", line)),
+				func(v p.Values) interface{} {
+					return v.Get("line")
+				})))),
+			ind.Dedent(),
+		),
+		func(v p.Values) interface{} {
+			rest := v.Get("rest").([]interface{})
+			return append([]interface{}{v.Get("first")}, rest...)
+		})
+}
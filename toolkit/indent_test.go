@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndenter(t *testing.T) {
+	type ifStmt struct {
+		body []interface{}
+	}
+
+	ind := NewIndenter("test")
+
+	stmt := p.R("stmt")
+
+	simple := p.Seq(p.Capture(p.Plus(p.Range('a', 'z'))), Newline)
+
+	cond := p.Action(
+		p.Seq(p.S("if:"), Newline, p.Named("body", ind.Block(stmt))),
+		func(v p.Values) interface{} {
+			return ifStmt{body: v.Get("body").([]interface{})}
+		})
+
+	stmt.Set(p.Or(cond, simple))
+
+	program := p.Collect(p.Star(p.Seq(ind.SameIndent(), stmt)))
+
+	t.Run("parses nested blocks", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(program, "a\nif:\n  b\n\n  if:\n\tc\n  d\ne\n")
+		r.NoError(err)
+		r.True(ok)
+
+		r.Equal([]interface{}{
+			"a",
+			ifStmt{body: []interface{}{
+				"b",
+				ifStmt{body: []interface{}{"c"}},
+				"d",
+			}},
+			"e",
+		}, val)
+	})
+
+	t.Run("rejects inconsistent indentation", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		_, _, err := pr.Parse(program, "if:\n    a\n  b\n")
+		r.Error(err)
+
+		_, _, err = pr.Parse(program, "if:\nb\n")
+		r.Error(err)
+	})
+
+	t.Run("measures indentation", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New(p.WithPartial(true))
+
+		val, ok, err := pr.Parse(NewIndenter("w").TabWidth(4).Indent(), "  \t x")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(5, val)
+
+		val, ok, err = pr.Parse(NewIndenter("w").TabWidth(0).Indent(), " \tx")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(p.DefaultTabWidth, val)
+	})
+}
@@ -0,0 +1,215 @@
+package toolkit
+
+import (
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+// INIFile is the value of the INI rule. It retains the order that sections
+// and entries appear in the input.
+type INIFile struct {
+	// Sections are the sections of the file in order. The first section
+	// is always the unnamed one, holding the entries that appear before
+	// any section header. It's empty if there are none.
+	Sections []*INISection
+}
+
+// Section returns the first section with the given name, or nil if there
+// is none. The unnamed section can be retrieved with the empty string.
+func (f *INIFile) Section(name string) *INISection {
+	for _, s := range f.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// INISection is a section header and the entries that follow it.
+type INISection struct {
+	// Name is the name in the header, with surrounding whitespace removed.
+	Name string
+
+	// Entries are the key/value pairs in the section, in order.
+	Entries []*INIEntry
+
+	// Start and End are the byte offsets of the section, from the header
+	// to the last line before the next header.
+	Start, End int
+
+	// Line is the line of the header.
+	Line int
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (s *INISection) SetPosition(start, end, line int, filename string) {
+	s.Start = start
+	s.End = end
+	s.Line = line
+}
+
+// Get returns the value of the last entry in the section with the given
+// key, matching the usual INI behavior of later entries overriding
+// earlier ones.
+func (s *INISection) Get(key string) (string, bool) {
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		if s.Entries[i].Key == key {
+			return s.Entries[i].Value, true
+		}
+	}
+
+	return "", false
+}
+
+// INIEntry is a single key/value pair.
+type INIEntry struct {
+	// Key is the text before the separator, with surrounding whitespace
+	// removed.
+	Key string
+
+	// Value is the text after the separator, with surrounding whitespace
+	// removed and any line continuations joined.
+	Value string
+
+	// Start and End are the byte offsets of the entry in the input.
+	Start, End int
+
+	// Line is the line the entry begins on.
+	Line int
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (e *INIEntry) SetPosition(start, end, line int, filename string) {
+	e.Start = start
+	e.End = end
+	e.Line = line
+}
+
+// joinContinuations removes each backslash-newline pair, along with the
+// indentation of the line that follows it.
+func joinContinuations(s string) string {
+	if !strings.Contains(s, "\\\n") && !strings.Contains(s, "\\\r\n") {
+		return s
+	}
+
+	var sb strings.Builder
+
+	for {
+		i := strings.IndexByte(s, '\\')
+		if i == -1 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+
+		rest := s[i+1:]
+
+		switch {
+		case strings.HasPrefix(rest, "\n"):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "\r\n"):
+			rest = rest[2:]
+		default:
+			sb.WriteString(s[:i+1])
+			s = rest
+			continue
+		}
+
+		sb.WriteString(s[:i])
+		s = strings.TrimLeft(rest, " \t")
+	}
+}
+
+var (
+	iniSpace = p.Star(p.Set(' ', '\t'))
+
+	iniEOL = p.Or(p.S("\r\n"), p.S("\n"), p.EOS())
+
+	iniComment = p.Seq(p.Set(';', '#'), p.Star(p.Rune(func(r rune) bool {
+		return r != '\n' && r != '\r'
+	})))
+
+	iniBlank = p.Seq(p.Not(p.EOS()), iniSpace, p.Maybe(iniComment), iniEOL)
+
+	iniEntry = p.Action(
+		p.Seq(
+			iniSpace,
+			p.Named("key", p.Capture(p.Plus(p.Rune(func(r rune) bool {
+				return !strings.ContainsRune("=:;#[\r\n", r)
+			})))),
+			p.Set('=', ':'),
+			p.Named("value", p.Capture(p.Star(p.Or(
+				p.Seq(p.S(`\`), p.Or(p.S("\r\n"), p.S("\n"))),
+				p.Rune(func(r rune) bool { return r != '\n' && r != '\r' }),
+			)))),
+			iniEOL,
+		),
+		func(v p.Values) interface{} {
+			return &INIEntry{
+				Key:   strings.TrimSpace(v.Get("key").(string)),
+				Value: strings.TrimSpace(joinContinuations(v.Get("value").(string))),
+			}
+		})
+
+	iniEntries = p.Collect(p.Star(p.Or(iniEntry, iniBlank)))
+
+	iniSection = p.Action(
+		p.Seq(
+			iniSpace,
+			p.S("["),
+			p.Named("name", p.Capture(p.Plus(p.Rune(func(r rune) bool {
+				return r != ']' && r != '\n' && r != '\r'
+			})))),
+			p.S("]"),
+			iniSpace,
+			p.Maybe(iniComment),
+			iniEOL,
+			p.Named("entries", iniEntries),
+		),
+		func(v p.Values) interface{} {
+			return &INISection{
+				Name:    strings.TrimSpace(v.Get("name").(string)),
+				Entries: iniEntryValues(v.Get("entries")),
+			}
+		})
+
+	// INI parses an INI style configuration file: [section] headers,
+	// key = value (or key: value) entries, full line comments starting
+	// with ; or #, and values continued onto the next line by ending the
+	// line with a backslash.
+	//
+	// The value of the match is an *INIFile.
+	INI = p.Action(
+		p.Seq(
+			p.Named("global", p.Action(p.Named("entries", iniEntries), func(v p.Values) interface{} {
+				return &INISection{Entries: iniEntryValues(v.Get("entries"))}
+			})),
+			p.Named("sections", p.Collect(p.Star(iniSection))),
+		),
+		func(v p.Values) interface{} {
+			f := &INIFile{
+				Sections: []*INISection{v.Get("global").(*INISection)},
+			}
+
+			for _, s := range v.Get("sections").([]interface{}) {
+				f.Sections = append(f.Sections, s.(*INISection))
+			}
+
+			return f
+		})
+)
+
+// iniEntryValues pulls the entries out of the values collected for a
+// section, dropping the nils produced by blank and comment lines.
+func iniEntryValues(v interface{}) []*INIEntry {
+	var entries []*INIEntry
+
+	for _, e := range v.([]interface{}) {
+		if ent, ok := e.(*INIEntry); ok {
+			entries = append(entries, ent)
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestINI(t *testing.T) {
+	t.Run("parses sections and entries in order", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		input := `; global settings
+name = demo
+
+[server]
+host = example.com
+# the port
+port: 8080
+
+[ paths ]
+search = /usr/bin:\
+         /usr/local/bin
+`
+
+		val, ok, err := pr.Parse(INI, input)
+		r.NoError(err)
+		r.True(ok)
+
+		f := val.(*INIFile)
+
+		r.Len(f.Sections, 3)
+
+		global := f.Section("")
+		r.Len(global.Entries, 1)
+
+		name, ok := global.Get("name")
+		r.True(ok)
+		r.Equal("demo", name)
+
+		server := f.Section("server")
+		r.NotNil(server)
+		r.Equal(4, server.Line)
+
+		r.Equal([]string{"host", "port"}, []string{server.Entries[0].Key, server.Entries[1].Key})
+
+		port, ok := server.Get("port")
+		r.True(ok)
+		r.Equal("8080", port)
+		r.Equal(7, server.Entries[1].Line)
+		r.Equal("port: 8080\n", input[server.Entries[1].Start:server.Entries[1].End])
+
+		_, ok = server.Get("missing")
+		r.False(ok)
+
+		paths := f.Sections[2]
+		r.Equal("paths", paths.Name)
+
+		search, ok := paths.Get("search")
+		r.True(ok)
+		r.Equal("/usr/bin:/usr/local/bin", search)
+	})
+
+	t.Run("lets later entries override earlier ones", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(INI, "[a]\nx=1\nx=2")
+		r.NoError(err)
+		r.True(ok)
+
+		f := val.(*INIFile)
+
+		r.Len(f.Section("").Entries, 0)
+
+		x, _ := f.Section("a").Get("x")
+		r.Equal("2", x)
+	})
+
+	t.Run("rejects lines that are not entries", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		_, _, err := pr.Parse(INI, "[a]\njust some words\n")
+		r.Error(err)
+	})
+}
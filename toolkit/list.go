@@ -0,0 +1,54 @@
+package toolkit
+
+import (
+	p "github.com/lab47/peggysue"
+)
+
+// ListOpts controls the shape of the lists matched by List.
+type ListOpts struct {
+	// AllowTrailing permits a separator after the last item, such as
+	// [1, 2, 3,].
+	AllowTrailing bool
+
+	// AllowEmpty permits a list with no items at all.
+	AllowEmpty bool
+
+	// MinItems is the least number of items a non-empty list must have.
+	MinItems int
+}
+
+// List returns a rule that matches items separated by sep, as found in
+// argument lists, array literals, and import lists. Whitespace handling is
+// left to item and sep.
+//
+// The value of the match is a []interface{} of the values of each item.
+func List(item, sep Rule, opts ListOpts) Rule {
+	min := opts.MinItems
+	if min < 1 {
+		min = 1
+	}
+
+	count := func(v p.Values) int {
+		items, _ := v.Get("items").([]interface{})
+		return len(items)
+	}
+
+	rules := []Rule{
+		p.Named("items", p.SepBy(item, sep)),
+		p.CheckAction(func(v p.Values) bool {
+			n := count(v)
+			return n >= min || (n == 0 && opts.AllowEmpty)
+		}),
+	}
+
+	if opts.AllowTrailing {
+		rules = append(rules, p.Maybe(p.Seq(
+			p.CheckAction(func(v p.Values) bool { return count(v) > 0 }),
+			sep,
+		)))
+	}
+
+	return p.Action(p.Seq(rules...), func(v p.Values) interface{} {
+		return v.Get("items")
+	})
+}
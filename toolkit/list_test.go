@@ -0,0 +1,66 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	item := p.Capture(p.Plus(p.Range('a', 'z')))
+
+	parse := func(r *require.Assertions, rule Rule, in string) ([]interface{}, bool) {
+		val, ok, err := p.New().Parse(p.Seq(p.S("["), rule, p.S("]")), in)
+		if err != nil || !ok {
+			return nil, false
+		}
+
+		return val.([]interface{}), true
+	}
+
+	t.Run("matches separated items", func(t *testing.T) {
+		r := require.New(t)
+
+		list := List(item, p.S(","), ListOpts{})
+
+		items, ok := parse(r, list, "[a,bc,d]")
+		r.True(ok)
+		r.Equal([]interface{}{"a", "bc", "d"}, items)
+
+		_, ok = parse(r, list, "[]")
+		r.False(ok)
+
+		_, ok = parse(r, list, "[a,]")
+		r.False(ok)
+	})
+
+	t.Run("allows a trailing separator", func(t *testing.T) {
+		r := require.New(t)
+
+		list := List(item, p.S(","), ListOpts{AllowTrailing: true})
+
+		items, ok := parse(r, list, "[a,b,]")
+		r.True(ok)
+		r.Equal([]interface{}{"a", "b"}, items)
+
+		_, ok = parse(r, list, "[,]")
+		r.False(ok)
+	})
+
+	t.Run("allows an empty list", func(t *testing.T) {
+		r := require.New(t)
+
+		list := List(item, p.S(","), ListOpts{AllowEmpty: true, AllowTrailing: true, MinItems: 2})
+
+		items, ok := parse(r, list, "[]")
+		r.True(ok)
+		r.Len(items, 0)
+
+		_, ok = parse(r, list, "[a]")
+		r.False(ok)
+
+		_, ok = parse(r, list, "[a,b]")
+		r.True(ok)
+	})
+}
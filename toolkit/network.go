@@ -0,0 +1,178 @@
+package toolkit
+
+import (
+	"net"
+	"net/netip"
+
+	p "github.com/lab47/peggysue"
+)
+
+var (
+	// IPv4 parses a dotted quad IPv4 address, such as 192.168.0.1.
+	//
+	// The value of the match is a netip.Addr.
+	IPv4 = p.Transform(p.Scan(scanIPv4), parseAddr)
+
+	// IPv6 parses an IPv6 address, such as fe80::1, including forms with
+	// an embedded IPv4 address and a zone, such as ::ffff:10.0.0.1 and
+	// fe80::1%eth0.
+	//
+	// The value of the match is a netip.Addr.
+	IPv6 = p.Transform(p.Scan(scanIPv6), parseAddr)
+
+	// IP parses either an IPv4 or an IPv6 address.
+	//
+	// The value of the match is a netip.Addr.
+	IP = p.Or(IPv4, IPv6)
+
+	// CIDR parses an IPv4 or IPv6 address followed by a prefix length,
+	// such as 10.0.0.0/8 or 2001:db8::/32.
+	//
+	// The value of the match is a netip.Prefix.
+	CIDR = p.Transform(p.Scan(scanCIDR), func(s string) interface{} {
+		return netip.MustParsePrefix(s)
+	})
+
+	// MAC parses a MAC address written as 6 or 8 pairs of hex digits
+	// separated by colons or hyphens, such as 00:00:5e:00:53:01.
+	//
+	// The value of the match is a net.HardwareAddr.
+	MAC = p.Transform(p.Scan(scanMAC), func(s string) interface{} {
+		hw, err := net.ParseMAC(s)
+		if err != nil {
+			panic(err)
+		}
+
+		return hw
+	})
+)
+
+func parseAddr(s string) interface{} {
+	return netip.MustParseAddr(s)
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+func isHexDigit(b byte) bool {
+	return isDigit(b) || ('a' <= lower(b) && lower(b) <= 'f')
+}
+
+// longestAddr returns the length of the longest prefix of str, made up of
+// bytes accepted by inSet, that parses as an address accepted by ok. The
+// byte following the prefix must not be one rejected by boundary, so that
+// an address is not matched out of the middle of a longer token.
+func longestAddr(str string, inSet, boundary func(byte) bool, ok func(netip.Addr) bool) int {
+	end := 0
+	for end < len(str) && inSet(str[end]) {
+		end++
+	}
+
+	for i := end; i > 0; i-- {
+		if i < len(str) && boundary(str[i]) {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(str[:i])
+		if err == nil && ok(addr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func scanIPv4(str string) int {
+	return longestAddr(str,
+		func(b byte) bool { return isDigit(b) || b == '.' },
+		isDigit,
+		netip.Addr.Is4,
+	)
+}
+
+func scanIPv6(str string) int {
+	// A zone is not restricted by the address syntax, so it runs until the
+	// first byte that can't be part of an interface name.
+	zone := false
+
+	return longestAddr(str,
+		func(b byte) bool {
+			switch {
+			case b == '%':
+				zone = true
+				return true
+			case zone:
+				return b == '_' || b == '-' || b == '.' || isDigit(b) || ('a' <= lower(b) && lower(b) <= 'z')
+			default:
+				return isHexDigit(b) || b == ':' || b == '.'
+			}
+		},
+		isHexDigit,
+		netip.Addr.Is6,
+	)
+}
+
+func scanCIDR(str string) int {
+	n := scanIPv4(str)
+	if n == -1 {
+		n = scanIPv6(str)
+	}
+
+	if n == -1 || n >= len(str) || str[n] != '/' {
+		return -1
+	}
+
+	end := n + 1
+	for end < len(str) && isDigit(str[end]) {
+		end++
+	}
+
+	if _, err := netip.ParsePrefix(str[:end]); err != nil {
+		return -1
+	}
+
+	return end
+}
+
+func scanMAC(str string) int {
+	if len(str) < 3 {
+		return -1
+	}
+
+	sep := str[2]
+	if sep != ':' && sep != '-' {
+		return -1
+	}
+
+	var groups, i int
+
+	for {
+		if i+2 > len(str) || !isHexDigit(str[i]) || !isHexDigit(str[i+1]) {
+			return -1
+		}
+
+		groups++
+		i += 2
+
+		if groups == 8 || i+2 >= len(str) || str[i] != sep || !isHexDigit(str[i+1]) || !isHexDigit(str[i+2]) {
+			break
+		}
+
+		i++
+	}
+
+	if groups != 6 && groups != 8 {
+		return -1
+	}
+
+	if i < len(str) && isHexDigit(str[i]) {
+		return -1
+	}
+
+	if _, err := net.ParseMAC(str[:i]); err != nil {
+		return -1
+	}
+
+	return i
+}
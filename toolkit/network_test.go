@@ -0,0 +1,118 @@
+package toolkit
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork(t *testing.T) {
+	t.Run("parses IPv4 addresses", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(IPv4, "192.168.0.1")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(netip.MustParseAddr("192.168.0.1"), val)
+
+		for _, in := range []string{"256.0.0.1", "1.2.3", "01.2.3.4", "1.2.3.456", "::1"} {
+			_, ok, _ := pr.Parse(IPv4, in)
+			r.False(ok, in)
+		}
+
+		pr = p.New(p.WithPartial(true))
+
+		val, ok, err = pr.Parse(IPv4, "10.0.0.1:80")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(netip.MustParseAddr("10.0.0.1"), val)
+	})
+
+	t.Run("parses IPv6 addresses", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{"::1", "2001:db8::8a2e:370:7334", "::ffff:10.0.0.1", "fe80::1%eth0"} {
+			val, ok, err := pr.Parse(IPv6, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+			r.Equal(netip.MustParseAddr(in), val, in)
+		}
+
+		for _, in := range []string{"1.2.3.4", "dead:beef", "1:2:3:4:5:6:7:8:9"} {
+			_, ok, _ := pr.Parse(IPv6, in)
+			r.False(ok, in)
+		}
+
+		val, ok, err := pr.Parse(p.Seq(p.S("["), IPv6, p.S("]:443")), "[::1]:443")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(netip.MustParseAddr("::1"), val)
+	})
+
+	t.Run("parses either kind of address", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(IP, "1.2.3.4")
+		r.NoError(err)
+		r.True(ok)
+		r.True(val.(netip.Addr).Is4())
+
+		val, ok, err = pr.Parse(IP, "1::")
+		r.NoError(err)
+		r.True(ok)
+		r.True(val.(netip.Addr).Is6())
+	})
+
+	t.Run("parses CIDR prefixes", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.7/24"} {
+			val, ok, err := pr.Parse(CIDR, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+			r.Equal(netip.MustParsePrefix(in), val, in)
+		}
+
+		for _, in := range []string{"10.0.0.0/33", "10.0.0.0", "10.0.0.0/"} {
+			_, ok, _ := pr.Parse(CIDR, in)
+			r.False(ok, in)
+		}
+	})
+
+	t.Run("parses MAC addresses", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{"00:00:5e:00:53:01", "00-00-5E-00-53-01", "02:00:5e:10:00:00:00:01"} {
+			val, ok, err := pr.Parse(MAC, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+
+			hw, _ := net.ParseMAC(in)
+			r.Equal(hw, val, in)
+		}
+
+		for _, in := range []string{"00:00:5e:00:53", "00:00-5e:00:53:01", "00:00:5e:00:53:0g"} {
+			_, ok, _ := pr.Parse(MAC, in)
+			r.False(ok, in)
+		}
+
+		pr = p.New(p.WithPartial(true))
+
+		_, ok, err := pr.Parse(MAC, "00:00:5e:00:53:01:")
+		r.NoError(err)
+		r.True(ok)
+	})
+}
@@ -3,6 +3,8 @@ package toolkit
 import (
 	"errors"
 	"math/big"
+	"strconv"
+	"strings"
 
 	p "github.com/lab47/peggysue"
 )
@@ -41,27 +43,22 @@ func (n *NumberValue) AsBig() (interface{}, error) {
 // point numbers by maintaining a seperate numerator and
 // denominator.
 func (n *NumberValue) AsBigRat() (*big.Rat, error) {
-	numb, err := n.AsBigInt()
+	numb, err := asBigInt(n.Str, int64(n.Base))
 	if err != nil {
 		return nil, err
 	}
 
-	rhs, err := asBigInt(n.PostDecimal, int64(n.Base))
+	digits := stripUnderscores(n.PostDecimal)
+
+	rhs, err := asBigInt(digits, int64(n.Base))
 	if err != nil {
 		return nil, err
 	}
 
+	// The width of the fraction is the number of digits written, not the
+	// magnitude of rhs, so that leading zeros (the 0 in 1.05) are kept.
 	base := big.NewInt(int64(n.Base))
-
-	acc := new(big.Int).Div(rhs, base)
-
-	width := 1
-	for acc.Int64() != 0 {
-		acc.Div(acc, base)
-		width++
-	}
-
-	offset := base.Exp(base, big.NewInt(int64(width)), nil)
+	offset := base.Exp(base, big.NewInt(int64(len(digits))), nil)
 
 	numb.Mul(numb, offset)
 	numb.Add(numb, rhs)
@@ -91,12 +88,33 @@ func (n *NumberValue) AsBigRat() (*big.Rat, error) {
 	return new(big.Rat).SetFrac(numb, denom), nil
 }
 
-var ErrRangeError = errors.New("range error")
+var (
+	ErrRangeError = errors.New("range error")
+
+	// ErrNotIntegral is returned when a number with a fraction, such as
+	// 3.14 or 1e-3, is converted to an integer.
+	ErrNotIntegral = errors.New("number is not an integer")
+)
 
-// AsBigInt returns a big.Int representation of the number.
-// big.Int can integers of infinite bit length.
+// AsBigInt returns a big.Int representation of the magnitude of the
+// number, with any fraction and exponent applied. big.Int can integers
+// of infinite bit length. If the number has a non-zero fraction,
+// ErrNotIntegral is returned.
 func (n *NumberValue) AsBigInt() (*big.Int, error) {
-	return asBigInt(n.Str, int64(n.Base))
+	if n.PostDecimal == "" && n.Power == nil {
+		return asBigInt(n.Str, int64(n.Base))
+	}
+
+	r, err := n.AsBigRat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.IsInt() {
+		return nil, ErrNotIntegral
+	}
+
+	return new(big.Int).Abs(r.Num()), nil
 }
 
 func digToByte(c byte) byte {
@@ -142,22 +160,143 @@ func asBigInt(str string, base int64) (*big.Int, error) {
 	return &x, nil
 }
 
-// AsInt returns the number value as a Go int.
+// AsInt returns the number value as a Go int. If the value does not fit
+// in an int, ErrRangeError is returned.
 func (n *NumberValue) AsInt() (int, error) {
-	bi, err := n.AsBigInt()
+	bi, err := n.checkedInt(strconv.IntSize, true)
 	if err != nil {
 		return 0, err
 	}
 
+	return int(bi.Int64()), nil
+}
+
+// AsInt64 returns the number value as a Go int64. If the value does not fit
+// in an int64, ErrRangeError is returned.
+func (n *NumberValue) AsInt64() (int64, error) {
+	bi, err := n.checkedInt(64, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return bi.Int64(), nil
+}
+
+// AsInt32 returns the number value as a Go int32. If the value does not fit
+// in an int32, ErrRangeError is returned.
+func (n *NumberValue) AsInt32() (int32, error) {
+	bi, err := n.checkedInt(32, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(bi.Int64()), nil
+}
+
+// AsUint64 returns the number value as a Go uint64. If the value is negative
+// or does not fit in a uint64, ErrRangeError is returned.
+func (n *NumberValue) AsUint64() (uint64, error) {
+	bi, err := n.checkedInt(64, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return bi.Uint64(), nil
+}
+
+// Fits reports whether the integer value of the number can be represented
+// in an integer of the given number of bits, using two's complement when
+// signed is true. It's intended for frontends that need to report constants
+// that overflow their type.
+func (n *NumberValue) Fits(bits int, signed bool) bool {
+	_, err := n.checkedInt(bits, signed)
+	return err == nil
+}
+
+// signedBigInt returns the integer value of the number with the sign applied.
+func (n *NumberValue) signedBigInt() (*big.Int, error) {
+	bi, err := n.AsBigInt()
+	if err != nil {
+		return nil, err
+	}
+
 	if n.Negative {
 		bi.Neg(bi)
 	}
 
-	return int(bi.Int64()), nil
+	return bi, nil
 }
 
-// AsInt returns the number value as a Go float64.
+func (n *NumberValue) checkedInt(bits int, signed bool) (*big.Int, error) {
+	// Every base is at least 2, so a positive exponent larger than bits
+	// overflows unless the number is zero. Checking it first avoids
+	// computing the value of numbers such as 1e999999999.
+	if n.Power != nil && !n.Power.Negative {
+		pi, err := asBigInt(n.Power.Str, 10)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pi.IsInt64() || pi.Int64() > int64(bits) {
+			if !n.isZero() {
+				return nil, ErrRangeError
+			}
+
+			return new(big.Int), nil
+		}
+	}
+
+	bi, err := n.signedBigInt()
+	if err != nil {
+		return nil, err
+	}
+
+	if !fits(bi, bits, signed) {
+		return nil, ErrRangeError
+	}
+
+	return bi, nil
+}
+
+// isZero reports whether all the digits of the number are zero.
+func (n *NumberValue) isZero() bool {
+	return strings.Trim(n.Str+n.PostDecimal, "0_") == ""
+}
+
+func fits(bi *big.Int, bits int, signed bool) bool {
+	if !signed {
+		return bi.Sign() >= 0 && bi.BitLen() <= bits
+	}
+
+	if bi.Sign() >= 0 {
+		return bi.BitLen() < bits
+	}
+
+	// A negative x fits when -x-1 does, which is what allows the minimum
+	// value, -1<<(bits-1), to be represented.
+	var mag big.Int
+	mag.Neg(bi).Sub(&mag, big.NewInt(1))
+
+	return mag.BitLen() < bits
+}
+
+// AsFloat64 returns the number value as a Go float64, rounded to the
+// nearest representable value. If the number is too large to be
+// represented, it returns an infinity and ErrRangeError.
 func (n *NumberValue) AsFloat64() (float64, error) {
+	if text, ok := n.floatText(); ok {
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return v, ErrRangeError
+			}
+
+			return 0, err
+		}
+
+		return v, nil
+	}
+
 	r, err := n.AsBigRat()
 	if err != nil {
 		return 0, err
@@ -167,6 +306,85 @@ func (n *NumberValue) AsFloat64() (float64, error) {
 	return v, nil
 }
 
+// AsBigFloat returns the number value as a big.Float with prec bits of
+// mantissa, rounded to the nearest even value. If prec is 0, 64 is used.
+func (n *NumberValue) AsBigFloat(prec uint) (*big.Float, error) {
+	if prec == 0 {
+		prec = 64
+	}
+
+	if text, ok := n.floatText(); ok {
+		f, _, err := big.ParseFloat(text, 0, prec, big.ToNearestEven)
+		return f, err
+	}
+
+	r, err := n.AsBigRat()
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Float).SetPrec(prec).SetRat(r), nil
+}
+
+// floatText renders the number in the syntax accepted by strconv.ParseFloat
+// and big.ParseFloat. Only decimal numbers with a decimal exponent and
+// hexadecimal numbers with a binary exponent have such a form; ok is false
+// for the others.
+func (n *NumberValue) floatText() (text string, ok bool) {
+	var sb strings.Builder
+
+	if n.Negative {
+		sb.WriteByte('-')
+	}
+
+	var exp byte
+
+	switch n.Base {
+	case 10:
+		exp = 'e'
+		if n.Power != nil && n.Power.Base != 10 {
+			return "", false
+		}
+	case 16:
+		exp = 'p'
+		if n.Power != nil && n.Power.Base != 2 {
+			return "", false
+		}
+		sb.WriteString("0x")
+	default:
+		return "", false
+	}
+
+	sb.WriteString(stripUnderscores(n.Str))
+
+	if n.PostDecimal != "" {
+		sb.WriteByte('.')
+		sb.WriteString(stripUnderscores(n.PostDecimal))
+	}
+
+	switch {
+	case n.Power != nil:
+		sb.WriteByte(exp)
+		if n.Power.Negative {
+			sb.WriteByte('-')
+		}
+		sb.WriteString(stripUnderscores(n.Power.Str))
+	case exp == 'p':
+		// Hexadecimal floats require an exponent.
+		sb.WriteString("p0")
+	}
+
+	return sb.String(), true
+}
+
+func stripUnderscores(s string) string {
+	if strings.IndexByte(s, '_') == -1 {
+		return s
+	}
+
+	return strings.ReplaceAll(s, "_", "")
+}
+
 func xset(r Rule) Rule {
 	return p.Seq(r, p.Star(p.Or(p.S("_"), r)))
 }
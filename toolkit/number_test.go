@@ -2,6 +2,7 @@ package toolkit
 
 import (
 	"math"
+	"math/big"
 	"testing"
 
 	"github.com/lab47/peggysue"
@@ -210,6 +211,8 @@ func TestNumbers(t *testing.T) {
 			{"3.14", 3.14},
 			{"100.1", 100.1},
 			{"-100.1", -100.1},
+			{"1.05", 1.05},
+			{"0.001", 0.001},
 		}
 
 		for _, rt := range tests {
@@ -239,6 +242,8 @@ func TestNumbers(t *testing.T) {
 			{"1e1", 1e1},
 			{"3.14e19", 3.14e19},
 			{"1e-9", 1e-9},
+			{"1.005e-3", 1.005e-3},
+			{"1_000.000_1e2", 1000.0001e2},
 		}
 
 		for _, rt := range tests {
@@ -266,7 +271,7 @@ func TestNumbers(t *testing.T) {
 			val float64
 		}{
 			{"0x1.921fb54442d18p1", math.Pi},
-			// {"0x123.fffp5", 0x123.fffp5},
+			{"0x123.fffp5", 0x123.fffp5},
 			{"0x12.p7", 0x12.p7},
 		}
 
@@ -285,4 +290,168 @@ func TestNumbers(t *testing.T) {
 		}
 	})
 
+	t.Run("keeps leading zeros after the decimal point", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		val, ok, err := p.Parse(Number, "1.05")
+		r.NoError(err)
+		r.True(ok)
+
+		rat, err := val.(*NumberValue).AsBigRat()
+		r.NoError(err)
+
+		r.Equal("21/20", rat.String())
+	})
+
+	t.Run("converts to an arbitrary precision float", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		for _, in := range []string{"0.1", "-3.14e19", "0x1.8p-3", "2.5e-400"} {
+			val, ok, err := p.Parse(Number, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+
+			f, err := val.(*NumberValue).AsBigFloat(200)
+			r.NoError(err, in)
+			r.Equal(uint(200), f.Prec())
+
+			expected, _, err := big.ParseFloat(in, 0, 200, big.ToNearestEven)
+			r.NoError(err)
+
+			r.Equal(0, expected.Cmp(f), in)
+		}
+
+		val, _, err := p.Parse(Number, "017")
+		r.NoError(err)
+
+		f, err := val.(*NumberValue).AsBigFloat(0)
+		r.NoError(err)
+
+		r.Equal(uint(64), f.Prec())
+		r.Equal("15", f.Text('f', -1))
+	})
+
+	t.Run("reports floats out of range", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		val, _, err := p.Parse(Number, "1e400")
+		r.NoError(err)
+
+		f, err := val.(*NumberValue).AsFloat64()
+		r.ErrorIs(err, ErrRangeError)
+		r.True(math.IsInf(f, 1))
+	})
+
+	t.Run("checks integers for overflow", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		parse := func(in string) *NumberValue {
+			val, ok, err := p.Parse(Number, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+
+			return val.(*NumberValue)
+		}
+
+		i64, err := parse("9223372036854775807").AsInt64()
+		r.NoError(err)
+		r.Equal(int64(math.MaxInt64), i64)
+
+		i64, err = parse("-9223372036854775808").AsInt64()
+		r.NoError(err)
+		r.Equal(int64(math.MinInt64), i64)
+
+		_, err = parse("9223372036854775808").AsInt64()
+		r.ErrorIs(err, ErrRangeError)
+
+		_, err = parse("-9223372036854775809").AsInt64()
+		r.ErrorIs(err, ErrRangeError)
+
+		u64, err := parse("0xffffffffffffffff").AsUint64()
+		r.NoError(err)
+		r.Equal(uint64(math.MaxUint64), u64)
+
+		_, err = parse("0x1_0000_0000_0000_0000").AsUint64()
+		r.ErrorIs(err, ErrRangeError)
+
+		_, err = parse("-1").AsUint64()
+		r.ErrorIs(err, ErrRangeError)
+
+		i32, err := parse("-2147483648").AsInt32()
+		r.NoError(err)
+		r.Equal(int32(math.MinInt32), i32)
+
+		_, err = parse("2147483648").AsInt32()
+		r.ErrorIs(err, ErrRangeError)
+
+		_, err = parse("99999999999999999999").AsInt()
+		r.ErrorIs(err, ErrRangeError)
+
+		r.True(parse("127").Fits(8, true))
+		r.False(parse("128").Fits(8, true))
+		r.True(parse("-128").Fits(8, true))
+		r.False(parse("-129").Fits(8, true))
+		r.True(parse("255").Fits(8, false))
+		r.False(parse("256").Fits(8, false))
+		r.False(parse("-1").Fits(8, false))
+	})
+
+	t.Run("applies the fraction and exponent to integers", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		parse := func(in string) *NumberValue {
+			val, ok, err := p.Parse(Number, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+
+			return val.(*NumberValue)
+		}
+
+		i64, err := parse("3.14e2").AsInt64()
+		r.NoError(err)
+		r.Equal(int64(314), i64)
+
+		i64, err = parse("-1.5e1").AsInt64()
+		r.NoError(err)
+		r.Equal(int64(-15), i64)
+
+		i64, err = parse("1200e-2").AsInt64()
+		r.NoError(err)
+		r.Equal(int64(12), i64)
+
+		_, err = parse("1e400").AsInt64()
+		r.ErrorIs(err, ErrRangeError)
+
+		_, err = parse("3.14e19").AsInt64()
+		r.ErrorIs(err, ErrRangeError)
+
+		_, err = parse("1e999999999").AsInt64()
+		r.ErrorIs(err, ErrRangeError)
+
+		i64, err = parse("0e999999999").AsInt64()
+		r.NoError(err)
+		r.Equal(int64(0), i64)
+
+		_, err = parse("3.14").AsInt64()
+		r.ErrorIs(err, ErrNotIntegral)
+
+		_, err = parse("1e-3").AsInt64()
+		r.ErrorIs(err, ErrNotIntegral)
+
+		bi, err := parse("1e20").AsBigInt()
+		r.NoError(err)
+		r.Equal("100000000000000000000", bi.String())
+
+		r.False(parse("3.14e19").Fits(64, true))
+	})
 }
@@ -0,0 +1,229 @@
+package toolkit
+
+import (
+	"fmt"
+
+	p "github.com/lab47/peggysue"
+)
+
+// UnderscoreRule controls where underscores may appear as digit separators
+// in numbers built by a NumberSpec.
+type UnderscoreRule int
+
+const (
+	// UnderscoresAfterFirstDigit allows any number of underscores anywhere
+	// after the first digit, including at the end, such as 1__000_. This is
+	// what the Numbers rules accept.
+	UnderscoresAfterFirstDigit UnderscoreRule = iota
+
+	// UnderscoresBetweenDigits allows single underscores only between two
+	// digits, such as 1_000 but not 1__000 or 1000_.
+	UnderscoresBetweenDigits
+
+	// UnderscoresNone does not allow underscores in numbers.
+	UnderscoresNone
+)
+
+// NumberSpec describes the numeric literal syntax of a language. Create one
+// with NewNumberSpec, adjust it with its methods, and call Rule to get a rule
+// that parses numbers in that syntax. The value of the rule is a *NumberValue,
+// the same as the Numbers rules.
+type NumberSpec struct {
+	bases            map[int]bool
+	leadingZeroOctal bool
+	underscores      UnderscoreRule
+	sign             bool
+	floats           bool
+}
+
+// NewNumberSpec returns a NumberSpec that accepts the same syntax as Number:
+// bases 2, 8, 10, and 16, leading zero octal, underscores after the first
+// digit, a leading sign, and floating point numbers.
+func NewNumberSpec() *NumberSpec {
+	return &NumberSpec{
+		bases:            map[int]bool{2: true, 8: true, 10: true, 16: true},
+		leadingZeroOctal: true,
+		underscores:      UnderscoresAfterFirstDigit,
+		sign:             true,
+		floats:           true,
+	}
+}
+
+// Bases sets which integer bases are accepted. Base 10 is written without a
+// prefix, the others with 0b, 0o, and 0x. Only 2, 8, 10, and 16 are supported.
+func (ns *NumberSpec) Bases(bases ...int) *NumberSpec {
+	ns.bases = make(map[int]bool)
+
+	for _, b := range bases {
+		switch b {
+		case 2, 8, 10, 16:
+			ns.bases[b] = true
+		default:
+			panic(fmt.Sprintf("unsupported number base: %d", b))
+		}
+	}
+
+	return ns
+}
+
+// LeadingZeroOctal sets whether a leading 0 introduces an octal number, such
+// as 0644. When off, such numbers are read as decimal. It has no effect if
+// base 8 is not accepted.
+func (ns *NumberSpec) LeadingZeroOctal(on bool) *NumberSpec {
+	ns.leadingZeroOctal = on
+	return ns
+}
+
+// Underscores sets where underscores may be used to separate digits.
+func (ns *NumberSpec) Underscores(u UnderscoreRule) *NumberSpec {
+	ns.underscores = u
+	return ns
+}
+
+// Sign sets whether a leading + or - is consumed as part of the number. When
+// off, the sign is left for the grammar to handle, typically as a unary
+// operator.
+func (ns *NumberSpec) Sign(on bool) *NumberSpec {
+	ns.sign = on
+	return ns
+}
+
+// Floats sets whether numbers with a fraction or an exponent are accepted.
+// Decimal floats, such as 1.5e3, require base 10 and hexadecimal floats,
+// such as 0x1.8p3, require base 16.
+func (ns *NumberSpec) Floats(on bool) *NumberSpec {
+	ns.floats = on
+	return ns
+}
+
+// digits returns a rule matching a run of digits from set, with
+// underscores allowed according to the spec.
+func (ns *NumberSpec) digits(set Rule) Rule {
+	switch ns.underscores {
+	case UnderscoresNone:
+		return p.Plus(set)
+	case UnderscoresBetweenDigits:
+		return p.Seq(set, p.Star(p.Or(set, p.Seq(p.S("_"), set))))
+	default:
+		return xset(set)
+	}
+}
+
+func (ns *NumberSpec) integer(base int, set Rule) Rule {
+	return p.Transform(ns.digits(set), func(s string) interface{} {
+		return &NumberValue{Base: base, Str: s}
+	})
+}
+
+// Rule returns a rule that parses numbers as described by the spec. It
+// panics if the spec accepts no bases.
+func (ns *NumberSpec) Rule() Rule {
+	if len(ns.bases) == 0 {
+		panic("number spec accepts no bases")
+	}
+
+	var (
+		ints   []Rule
+		floats []Rule
+	)
+
+	decimal := ns.integer(10, p.Range('0', '9'))
+
+	if ns.bases[16] {
+		hex := ns.integer(16, hexSet)
+		ints = append(ints, p.Seq(p.S("0x"), hex))
+
+		if ns.floats {
+			floats = append(floats, p.Action(
+				p.Seq(
+					p.S("0x"),
+					p.Named("lhs", hex),
+					p.S("."),
+					p.Named("rhs", p.Capture(p.Maybe(ns.digits(hexSet)))),
+					p.Set('p', 'P'),
+					p.Named("sign", p.Maybe(sign)),
+					p.Named("power", decimal),
+				),
+				func(v p.Values) interface{} {
+					lhs := v.Get("lhs").(*NumberValue).Dup()
+					power := v.Get("power").(*NumberValue).Dup()
+
+					if sv, ok := v.Get("sign").(bool); ok {
+						power.Negative = sv
+					}
+
+					power.Base = 2
+					lhs.PostDecimal = v.Get("rhs").(string)
+					lhs.Power = power
+
+					return lhs
+				}))
+		}
+	}
+
+	if ns.bases[2] {
+		ints = append(ints, p.Seq(p.S("0b"), ns.integer(2, p.Range('0', '1'))))
+	}
+
+	if ns.bases[8] {
+		octal := ns.integer(8, p.Range('0', '7'))
+		ints = append(ints, p.Seq(p.S("0o"), octal))
+
+		if ns.leadingZeroOctal {
+			ints = append(ints, p.Seq(p.S("0"), octal))
+		}
+	}
+
+	if ns.bases[10] {
+		ints = append(ints, decimal)
+
+		if ns.floats {
+			fraction := p.Action(
+				p.Seq(
+					p.Named("lhs", decimal),
+					p.S("."),
+					p.Named("rhs", decimal),
+				),
+				func(v p.Values) interface{} {
+					lhs := v.Get("lhs").(*NumberValue).Dup()
+					lhs.PostDecimal = v.Get("rhs").(*NumberValue).Str
+
+					return lhs
+				})
+
+			sci := p.Action(
+				p.Seq(
+					p.Named("num", p.Or(fraction, decimal)),
+					p.Set('e', 'E'),
+					p.Maybe(p.Named("sign", sign)),
+					p.Named("power", decimal),
+				),
+				func(v p.Values) interface{} {
+					num := v.Get("num").(*NumberValue).Dup()
+					power := v.Get("power").(*NumberValue)
+
+					if sign, ok := v.Get("sign").(bool); ok {
+						power = power.Dup()
+						power.Negative = sign
+					}
+
+					num.Power = power
+
+					return num
+				})
+
+			floats = append(floats, sci, fraction)
+		}
+	}
+
+	unsigned := p.Or(append(floats, ints...)...)
+
+	if !ns.sign {
+		return unsigned
+	}
+
+	return p.Action(p.Seq(
+		p.Maybe(p.Named("sign", sign)),
+		p.Named("num", unsigned)),
+		setSign)
+}
@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"testing"
+
+	"github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberSpec(t *testing.T) {
+	parse := func(r *require.Assertions, rule Rule, in string) (*NumberValue, bool) {
+		p := peggysue.New()
+
+		val, ok, err := p.Parse(rule, in)
+		if err != nil || !ok {
+			return nil, false
+		}
+
+		nv, ok := val.(*NumberValue)
+		r.True(ok)
+
+		return nv, true
+	}
+
+	t.Run("defaults to the Numbers syntax", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := NewNumberSpec().Rule()
+
+		for _, tc := range []struct {
+			in   string
+			base int
+			val  float64
+		}{
+			{"42", 10, 42},
+			{"-0x1f", 16, -31},
+			{"0b101", 2, 5},
+			{"0o17", 8, 15},
+			{"017", 8, 15},
+			{"1_000_", 10, 1000},
+			{"3.5e2", 10, 350},
+			{"0x1.8p1", 16, 3},
+		} {
+			nv, ok := parse(r, rule, tc.in)
+			r.True(ok, tc.in)
+			r.Equal(tc.base, nv.Base, tc.in)
+
+			f, err := nv.AsFloat64()
+			r.NoError(err, tc.in)
+			r.Equal(tc.val, f, tc.in)
+		}
+	})
+
+	t.Run("restricts the bases", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := NewNumberSpec().Bases(10, 16).Rule()
+
+		_, ok := parse(r, rule, "0x10")
+		r.True(ok)
+
+		_, ok = parse(r, rule, "0b10")
+		r.False(ok)
+
+		nv, ok := parse(r, rule, "017")
+		r.True(ok)
+		r.Equal(10, nv.Base)
+
+		r.Panics(func() {
+			NewNumberSpec().Bases(3)
+		})
+
+		r.Panics(func() {
+			NewNumberSpec().Bases().Rule()
+		})
+	})
+
+	t.Run("reads leading zeros as decimal when octal is off", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := NewNumberSpec().LeadingZeroOctal(false).Rule()
+
+		nv, ok := parse(r, rule, "0644")
+		r.True(ok)
+
+		i, err := nv.AsInt()
+		r.NoError(err)
+		r.Equal(644, i)
+
+		nv, ok = parse(r, rule, "0o644")
+		r.True(ok)
+
+		i, err = nv.AsInt()
+		r.NoError(err)
+		r.Equal(0644, i)
+	})
+
+	t.Run("controls underscores", func(t *testing.T) {
+		r := require.New(t)
+
+		between := NewNumberSpec().Underscores(UnderscoresBetweenDigits).Rule()
+
+		for in, ok := range map[string]bool{
+			"1_000":     true,
+			"0x_ff":     false,
+			"0xf_f":     true,
+			"1__000":    false,
+			"1000_":     false,
+			"1_0.0_1":   true,
+			"1.0_1e1_0": true,
+		} {
+			_, matched := parse(r, between, in)
+			r.Equal(ok, matched, in)
+		}
+
+		none := NewNumberSpec().Underscores(UnderscoresNone).Rule()
+
+		_, ok := parse(r, none, "1_000")
+		r.False(ok)
+
+		_, ok = parse(r, none, "1000")
+		r.True(ok)
+	})
+
+	t.Run("leaves the sign when told to", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := NewNumberSpec().Sign(false).Rule()
+
+		_, ok := parse(r, rule, "-1")
+		r.False(ok)
+
+		nv, ok := parse(r, NewNumberSpec().Rule(), "-1")
+		r.True(ok)
+		r.True(nv.Negative)
+	})
+
+	t.Run("can exclude floats", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := NewNumberSpec().Floats(false).Rule()
+
+		_, ok := parse(r, rule, "1.5")
+		r.False(ok)
+
+		_, ok = parse(r, rule, "1e3")
+		r.False(ok)
+
+		_, ok = parse(r, rule, "15")
+		r.True(ok)
+	})
+}
@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+func joinStrings(vals []interface{}) interface{} {
+	var sb strings.Builder
+
+	for _, v := range vals {
+		sb.WriteString(v.(string))
+	}
+
+	return sb.String()
+}
+
+func isShellBlank(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+var (
+	// shellBlanks separates words. A backslash-newline between words is a
+	// line continuation, so it is skipped along with them rather than
+	// starting an empty word.
+	shellBlanks = p.Star(p.Or(p.Rune(isShellBlank), p.S("\\\n")))
+
+	shellUnquoted = p.Capture(p.Plus(p.Rune(func(r rune) bool {
+		return !isShellBlank(r) && r != '\'' && r != '"' && r != '\\'
+	})))
+
+	// shellEscape is a backslash outside of quotes, which makes the
+	// following character literal. A backslash-newline is removed entirely.
+	shellEscape = p.Transform(p.Seq(p.S(`\`), p.Any()), func(s string) interface{} {
+		if s[1:] == "\n" {
+			return ""
+		}
+
+		return s[1:]
+	})
+
+	shellSingle = p.Transform(
+		p.Seq(p.S(`'`), p.Star(p.Rune(func(r rune) bool { return r != '\'' })), p.S(`'`)),
+		func(s string) interface{} {
+			return s[1 : len(s)-1]
+		})
+
+	// shellDoubleEscape follows POSIX: within double quotes, a backslash
+	// only escapes $, `, ", \, and newline. Otherwise it is kept.
+	shellDoubleEscape = p.Transform(p.Seq(p.S(`\`), p.Any()), func(s string) interface{} {
+		switch s[1:] {
+		case "\n":
+			return ""
+		case "$", "`", `"`, `\`:
+			return s[1:]
+		default:
+			return s
+		}
+	})
+
+	shellDouble = p.Seq(
+		p.S(`"`),
+		p.Many(p.Or(
+			shellDoubleEscape,
+			p.Capture(p.Plus(p.Rune(func(r rune) bool { return r != '"' && r != '\\' }))),
+		), 0, -1, joinStrings),
+		p.S(`"`),
+	)
+
+	// ShellWord parses a single word of a shell command line. A word is made
+	// up of unquoted text, 'single quoted' text in which every character is
+	// literal, "double quoted" text in which a backslash escapes $, `, ", \,
+	// and newline, and backslash escaped characters, all run together. No
+	// expansion of variables, globs, or commands is done.
+	//
+	// The value of the match is a string with the quoting removed.
+	ShellWord = p.Many(p.Or(shellSingle, shellDouble, shellEscape, shellUnquoted), 1, -1, joinStrings)
+
+	// ShellWords splits a command line into words, as a POSIX shell would,
+	// honoring quotes and backslash escapes. Words are separated by spaces,
+	// tabs, and newlines. An empty pair of quotes produces an empty word.
+	//
+	// The value of the match is a []string.
+	ShellWords = p.Action(
+		p.Seq(
+			p.Named("words", p.Collect(p.Star(p.Seq(shellBlanks, ShellWord)))),
+			shellBlanks,
+		),
+		func(v p.Values) interface{} {
+			vals := v.Get("words").([]interface{})
+
+			words := make([]string, len(vals))
+			for i, w := range vals {
+				words[i] = w.(string)
+			}
+
+			return words
+		})
+)
@@ -0,0 +1,60 @@
+package toolkit
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellWords(t *testing.T) {
+	t.Run("splits a command line", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, tc := range []struct {
+			in    string
+			words []string
+		}{
+			{"", []string{}},
+			{"  ls  -la\t/tmp \n", []string{"ls", "-la", "/tmp"}},
+			{`echo 'a  b' "c  d"`, []string{"echo", "a  b", "c  d"}},
+			{`a"b c"'d'`, []string{"ab cd"}},
+			{`x "" ''`, []string{"x", "", ""}},
+			{`a\ b \'c`, []string{"a b", "'c"}},
+			{`'\n' "\n \" \\ \$"`, []string{`\n`, `\n " \ $`}},
+			{"one \\\ntwo", []string{"one", "two"}},
+			{"a \\\n b", []string{"a", "b"}},
+			{"a\\\nb \\\n", []string{"ab"}},
+			{"\"multi\\\nline\"", []string{"multiline"}},
+		} {
+			val, ok, err := pr.Parse(ShellWords, tc.in)
+			r.NoError(err, tc.in)
+			r.True(ok, tc.in)
+			r.Equal(tc.words, val, tc.in)
+		}
+	})
+
+	t.Run("rejects unterminated quotes", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{`echo "hi`, `echo 'hi`, `echo \`} {
+			_, _, err := pr.Parse(ShellWords, in)
+			r.Error(err, in)
+		}
+	})
+
+	t.Run("parses a single word", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(p.Seq(ShellWord, p.S(" rest")), `'a b'c rest`)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("a bc", val)
+	})
+}
@@ -7,8 +7,41 @@ import (
 	p "github.com/lab47/peggysue"
 )
 
+// StringValue is the value of the string rules. Along with the processed
+// value, it retains how the literal was written so later passes and error
+// messages can refer back to it.
 type StringValue struct {
+	// Value is the string with any escape sequences interpreted.
 	Value string
+
+	// Quote is the delimiter the literal used, such as `"`, `'''`, or "`".
+	Quote string
+
+	// Raw is the literal exactly as it appeared in the input, including
+	// the delimiters.
+	Raw string
+
+	// Escaped is true when interpreting escape sequences changed the body
+	// of the literal, ie. when Value differs from the text between the
+	// delimiters.
+	Escaped bool
+
+	// Start and End are the byte offsets of the literal in the input.
+	Start, End int
+
+	// Line is the line the literal begins on.
+	Line int
+
+	// Filename is the name of the input, if the parse was given one.
+	Filename string
+}
+
+// SetPosition implements peggysue.SetPositioner.
+func (sv *StringValue) SetPosition(start, end, line int, filename string) {
+	sv.Start = start
+	sv.End = end
+	sv.Line = line
+	sv.Filename = filename
 }
 
 var (
@@ -34,30 +67,10 @@ var (
 			d := (digToByte(s[0]) << 4) | digToByte(s[1])
 			return string([]byte{d})
 		})),
-		`u`, p.Seq(p.S(`u`), p.Transform(p.Many(hexSet, 4, 4, nil), func(s string) interface{} {
-			d :=
-				(rune(digToByte(s[0])) << 12) |
-					(rune(digToByte(s[1])) << 8) |
-					(rune(digToByte(s[2])) << 4) |
-					rune(digToByte(s[3]))
-
-			return rune(d)
-		})),
-		`U`, p.Seq(p.S(`U`), p.Transform(p.Many(hexSet, 8, 8, nil), func(s string) interface{} {
-			d :=
-				(rune(digToByte(s[0])) << 28) |
-					(rune(digToByte(s[1])) << 24) |
-					(rune(digToByte(s[2])) << 20) |
-					(rune(digToByte(s[3])) << 16) |
-					(rune(digToByte(s[4])) << 12) |
-					(rune(digToByte(s[5])) << 8) |
-					(rune(digToByte(s[6])) << 4) |
-					rune(digToByte(s[7]))
-
-			return rune(d)
-		}))),
+		`u`, p.Seq(p.S(`u`), hexRune(4)),
+		`U`, p.Seq(p.S(`U`), hexRune(8))),
 		p.Seq(p.Transform(p.Seq(octalSet, octalSet, octalSet), func(s string) interface{} {
-			d := (digToByte(s[0]) << 6) | (digToByte(s[1]) << 3) | digToByte(s[2])
+			d := (rune(digToByte(s[0])) << 6) | (rune(digToByte(s[1])) << 3) | rune(digToByte(s[2]))
 			return rune(d)
 		})),
 	))
@@ -73,8 +86,65 @@ var (
 	TripleSingleQuotedString = makeString(`'''`, singleEscape)
 
 	String = p.Or(TripleSingleQuotedString, SingleQuotedString, TripleDoubleQuotedString, DoubleQuotedString)
+
+	// RawString matches a backtick delimited string, Go style. No escapes
+	// are processed, so the value is exactly the text between the backticks.
+	RawString = MakeRawString("`", false)
 )
 
+// MakeRawString returns a rule that matches a string delimited by delim in
+// which no escape sequences are processed. If doubled is true, two delimiters
+// in a row within the body stand for one literal delimiter, the way SQL
+// string literals escape single quotes.
+//
+// The value of the match is a *StringValue.
+func MakeRawString(delim string, doubled bool) Rule {
+	if delim == "" {
+		panic("raw string delimiter must not be empty")
+	}
+
+	body := p.Scan(func(str string) int {
+		i := 0
+		for {
+			idx := strings.Index(str[i:], delim)
+			if idx == -1 {
+				return -1
+			}
+
+			i += idx
+
+			if doubled && strings.HasPrefix(str[i+len(delim):], delim) {
+				i += 2 * len(delim)
+				continue
+			}
+
+			return i
+		}
+	})
+
+	value := p.Transform(body, func(s string) interface{} {
+		if doubled {
+			s = strings.ReplaceAll(s, delim+delim, delim)
+		}
+
+		return &StringValue{Value: s}
+	})
+
+	return literal(delim, value)
+}
+
+// hexRune matches n hex digits. The value is the rune they encode.
+func hexRune(n int) Rule {
+	return p.Transform(p.Times(hexSet, n), func(s string) interface{} {
+		var d rune
+		for i := 0; i < len(s); i++ {
+			d = d<<4 | rune(digToByte(s[i]))
+		}
+
+		return d
+	})
+}
+
 func makeString(quote string, escaped Rule) Rule {
 	normal := p.Capture(p.Scan(func(str string) int {
 		for i, b := range []byte(str) {
@@ -117,5 +187,20 @@ func makeString(quote string, escaped Rule) Rule {
 		return &StringValue{Value: sb.String()}
 	})
 
-	return p.Seq(p.S(quote), strBody, p.S(quote))
+	return literal(quote, strBody)
+}
+
+// literal matches body between two quotes and fills in the details of the
+// *StringValue that body produces.
+func literal(quote string, body Rule) Rule {
+	return p.Action(
+		p.Named("raw", p.Capture(p.Seq(p.S(quote), p.Named("body", body), p.S(quote)))),
+		func(v p.Values) interface{} {
+			sv := v.Get("body").(*StringValue)
+			sv.Quote = quote
+			sv.Raw = v.Get("raw").(string)
+			sv.Escaped = sv.Value != sv.Raw[len(quote):len(sv.Raw)-len(quote)]
+			return sv
+		},
+	)
 }
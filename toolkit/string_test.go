@@ -133,6 +133,84 @@ func TestString(t *testing.T) {
 
 		r.Equal("\nhello\n", sv.Value)
 	})
+
+	t.Run("parses a raw string", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(RawString, "`h\\t\"ello\n`")
+		r.NoError(err)
+		r.True(ok)
+
+		sv := val.(*StringValue)
+
+		r.Equal("h\\t\"ello\n", sv.Value)
+
+		val, ok, err = pr.Parse(RawString, "``")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("", val.(*StringValue).Value)
+
+		_, ok, err = pr.Parse(RawString, "`hello")
+		r.NoError(err)
+		r.False(ok)
+	})
+
+	t.Run("parses a raw string with doubled delimiters", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		sql := MakeRawString(`'`, true)
+
+		val, ok, err := pr.Parse(sql, `'it''s ''here'''`)
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("it's 'here'", val.(*StringValue).Value)
+
+		_, _, err = pr.Parse(MakeRawString(`'`, false), `'it''s'`)
+		r.Error(err)
+	})
+
+	t.Run("records how the literal was written", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(p.Seq(p.S("x = "), String), `x = "h\tello"`)
+		r.NoError(err)
+		r.True(ok)
+
+		sv := val.(*StringValue)
+
+		r.Equal("h\tello", sv.Value)
+		r.Equal(`"`, sv.Quote)
+		r.Equal(`"h\tello"`, sv.Raw)
+		r.True(sv.Escaped)
+		r.Equal(4, sv.Start)
+		r.Equal(13, sv.End)
+		r.Equal(1, sv.Line)
+
+		val, ok, err = pr.Parse(String, "'''\nhello'''")
+		r.NoError(err)
+		r.True(ok)
+
+		sv = val.(*StringValue)
+
+		r.Equal(`'''`, sv.Quote)
+		r.False(sv.Escaped)
+
+		val, ok, err = pr.Parse(RawString, "`a\\nb`")
+		r.NoError(err)
+		r.True(ok)
+
+		sv = val.(*StringValue)
+
+		r.Equal("`", sv.Quote)
+		r.Equal("`a\\nb`", sv.Raw)
+		r.False(sv.Escaped)
+	})
 }
 
 func BenchmarkString(b *testing.B) {
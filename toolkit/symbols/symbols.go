@@ -0,0 +1,102 @@
+// Package symbols provides scoped symbol tables that are maintained while
+// parsing. They allow grammars to resolve ambiguities that depend on earlier
+// declarations, such as C's "identifier vs type name" problem.
+package symbols
+
+import (
+	"fmt"
+
+	p "github.com/lab47/peggysue"
+)
+
+// Table is a symbol table stored in the parser's state store. Because it lives
+// in the state store, declarations are undone when the parser backtracks past
+// the rule that declared them.
+type Table struct {
+	key string
+}
+
+// New returns a new Table. The name is used to keep the table separate from
+// other values in the state store, so each table in a grammar must use a unique
+// name.
+func New(name string) *Table {
+	return &Table{key: "symbols:" + name}
+}
+
+// Lookup returns the value associated with name in the innermost scope that
+// declares it. The boolean is false if the name has not been declared.
+func (t *Table) Lookup(st p.State, name string) (interface{}, bool) {
+	if d := tableOf(st.Get(t.key)).names.get(name); d != nil {
+		return d.value, true
+	}
+
+	return nil, false
+}
+
+// Declare returns a rule that declares the name returned by the given function
+// in the current scope. The rule always matches and does not consume any input.
+//
+// The value of the match is nil.
+func (t *Table) Declare(name func(p.Values) string) p.Rule {
+	return t.DeclareValue(func(v p.Values) (string, interface{}) {
+		return name(v), true
+	})
+}
+
+// DeclareValue is like Declare, but associates a value with the name which
+// can later be retrieved with Lookup.
+//
+// The value of the match is nil.
+func (t *Table) DeclareValue(fn func(p.Values) (string, interface{})) p.Rule {
+	return p.StateUpdate(t.key, func(old interface{}, v p.Values) interface{} {
+		name, val := fn(v)
+		return tableOf(old).declare(name, val)
+	})
+}
+
+// IsDeclared returns a rule that matches the given rule and then checks that
+// it's value, which must be a string, has been declared.
+//
+// The value of the match is the value of the given rule.
+func (t *Table) IsDeclared(rule p.Rule) p.Rule {
+	return t.check(rule, true)
+}
+
+// IsNotDeclared is the inverse of IsDeclared, matching the given rule only
+// if it's value has not been declared.
+//
+// The value of the match is the value of the given rule.
+func (t *Table) IsNotDeclared(rule p.Rule) p.Rule {
+	return t.check(rule, false)
+}
+
+func (t *Table) check(rule p.Rule, declared bool) p.Rule {
+	return p.Scope(p.Seq(
+		p.Named("symbol", rule),
+		p.CheckActionCtx(func(ctx *p.MatchContext) bool {
+			name, ok := ctx.Values.Get("symbol").(string)
+			if !ok {
+				panic(fmt.Sprintf("symbol must be a string, got %T", ctx.Values.Get("symbol")))
+			}
+
+			_, ok = t.Lookup(ctx.State, name)
+			return ok == declared
+		}),
+	))
+}
+
+// Scope returns a rule that matches the given rule inside a new scope. Names
+// declared while matching the rule are discarded once it completes.
+//
+// The value of the match is the value of the given rule.
+func (t *Table) Scope(rule p.Rule) p.Rule {
+	push := p.StateUpdate(t.key, func(old interface{}, v p.Values) interface{} {
+		return tableOf(old).push()
+	})
+
+	pop := p.StateUpdate(t.key, func(old interface{}, v p.Values) interface{} {
+		return tableOf(old).pop()
+	})
+
+	return p.Seq(push, rule, pop)
+}
@@ -0,0 +1,131 @@
+package symbols
+
+import (
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbols(t *testing.T) {
+	ident := p.Capture(p.Plus(p.Range('a', 'z')))
+
+	t.Run("resolves declared names", func(t *testing.T) {
+		r := require.New(t)
+
+		types := New("types")
+
+		typedef := p.Action(
+			p.Seq(
+				p.S("typedef "),
+				p.Named("name", ident),
+				types.Declare(func(v p.Values) string {
+					return v.Get("name").(string)
+				}),
+				p.S(";"),
+			),
+			func(p.Values) interface{} { return "typedef" },
+		)
+
+		decl := p.Action(p.Seq(types.IsDeclared(ident), p.S("*"), ident, p.S(";")), func(p.Values) interface{} {
+			return "decl"
+		})
+
+		expr := p.Action(p.Seq(types.IsNotDeclared(ident), p.S("*"), ident, p.S(";")), func(p.Values) interface{} {
+			return "expr"
+		})
+
+		prog := p.StarCapture(p.Or(typedef, decl, expr))
+
+		val, ok, err := p.New().Parse(prog, "a*b;typedef a;a*b;c*d;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{"expr", "typedef", "decl", "expr"}, val)
+	})
+
+	t.Run("discards names when a scope ends", func(t *testing.T) {
+		r := require.New(t)
+
+		vars := New("vars")
+
+		decl := p.Seq(p.S("let "), p.Named("name", ident), vars.Declare(func(v p.Values) string {
+			return v.Get("name").(string)
+		}), p.S(";"))
+
+		known := p.Action(vars.IsDeclared(ident), func(p.Values) interface{} { return "known" })
+		unknown := p.Action(ident, func(p.Values) interface{} { return "unknown" })
+
+		use := p.Seq(p.S("use "), p.Or(known, unknown), p.S(";"))
+
+		stmt := p.R("stmt")
+
+		block := vars.Scope(p.Seq(p.S("{"), p.StarCapture(stmt), p.S("}")))
+
+		stmt.Set(p.Or(decl, use, block))
+
+		val, ok, err := p.New().Parse(p.StarCapture(stmt), "let a;{let b;use a;use b;}use b;")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal([]interface{}{
+			"a",
+			[]interface{}{"b", "known", "known"},
+			"unknown",
+		}, val)
+	})
+
+	t.Run("associates values with names", func(t *testing.T) {
+		r := require.New(t)
+
+		consts := New("consts")
+
+		var val interface{}
+
+		prog := p.Seq(
+			p.Named("name", ident),
+			consts.DeclareValue(func(v p.Values) (string, interface{}) {
+				return v.Get("name").(string), 42
+			}),
+			p.CheckActionCtx(func(ctx *p.MatchContext) bool {
+				val, _ = consts.Lookup(ctx.State, "abc")
+				return true
+			}),
+		)
+
+		_, ok, err := p.New().Parse(prog, "abc")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal(42, val)
+	})
+
+	t.Run("shadows declarations in outer scopes", func(t *testing.T) {
+		r := require.New(t)
+
+		consts := New("consts")
+
+		digit := p.Capture(p.Range('0', '9'))
+
+		def := p.Seq(p.Named("name", ident), p.S("="), p.Named("val", digit),
+			consts.DeclareValue(func(v p.Values) (string, interface{}) {
+				return v.Get("name").(string), v.Get("val")
+			}), p.S(";"))
+
+		// $a=1; checks that a is 1.
+		check := p.Scope(p.Seq(p.S("$"), p.Named("name", ident), p.S("="), p.Named("val", digit), p.S(";"),
+			p.CheckActionCtx(func(ctx *p.MatchContext) bool {
+				val, _ := consts.Lookup(ctx.State, ctx.Values.Get("name").(string))
+				return val == ctx.Values.Get("val")
+			})))
+
+		stmt := p.R("stmt")
+		stmt.Set(p.Or(def, check, consts.Scope(p.Seq(p.S("{"), p.Star(stmt), p.S("}")))))
+
+		prog := p.Star(stmt)
+
+		_, ok, err := p.New().Parse(prog, "a=1;b=2;{a=3;$a=3;$b=2;{a=4;$a=4;}$a=3;}$a=1;")
+		r.NoError(err)
+		r.True(ok)
+
+		_, _, err = p.New().Parse(prog, "a=1;{a=3;}$a=3;")
+		r.Error(err)
+	})
+}
@@ -0,0 +1,186 @@
+package symbols
+
+// table is the value of a Table in the state store. It is immutable, so each
+// change creates a new table that shares most of its structure with the old
+// one, allowing the state store to undo the change when backtracking.
+type table struct {
+	// names maps each declared name to its innermost declaration, so that
+	// looking up a name takes time logarithmic in the number of names,
+	// however many scopes are open.
+	names *names
+
+	// scope is the innermost open scope.
+	scope *scope
+}
+
+// decl is a declaration of a name. It shadows the declaration in an outer
+// scope, if any, which becomes visible again when its scope ends.
+type decl struct {
+	value    interface{}
+	shadowed *decl
+}
+
+// scope is a scope opened by Table.Scope, and the names declared in it.
+type scope struct {
+	declared []string
+	outer    *scope
+}
+
+// tableOf returns the table that is the value v from the state store, or an
+// empty one if nothing has been declared.
+func tableOf(v interface{}) *table {
+	if tbl, ok := v.(*table); ok {
+		return tbl
+	}
+
+	return &table{}
+}
+
+// declare returns t with name declared in the innermost scope.
+func (t *table) declare(name string, val interface{}) *table {
+	nt := &table{
+		names: t.names.with(name, &decl{value: val, shadowed: t.names.get(name)}),
+		scope: t.scope,
+	}
+
+	if t.scope != nil {
+		// Limit the capacity so that append copies rather than writing
+		// into an array shared with other tables.
+		declared := t.scope.declared[:len(t.scope.declared):len(t.scope.declared)]
+		nt.scope = &scope{declared: append(declared, name), outer: t.scope.outer}
+	}
+
+	return nt
+}
+
+// push returns t with a new innermost scope.
+func (t *table) push() *table {
+	return &table{names: t.names, scope: &scope{outer: t.scope}}
+}
+
+// pop returns t without its innermost scope, restoring the declarations that
+// the names declared in it shadowed.
+func (t *table) pop() *table {
+	if t.scope == nil {
+		return &table{}
+	}
+
+	nt := &table{names: t.names, scope: t.scope.outer}
+
+	for i := len(t.scope.declared) - 1; i >= 0; i-- {
+		name := t.scope.declared[i]
+		nt.names = nt.names.with(name, nt.names.get(name).shadowed)
+	}
+
+	return nt
+}
+
+// names is an immutable map from names to declarations, held as a balanced
+// binary tree ordered by name. Every change copies the path to the name it
+// changes. A name whose declarations have all gone out of scope is kept with
+// a nil declaration, since scopes tend to declare the same names again.
+type names struct {
+	name        string
+	decl        *decl
+	left, right *names
+	height      int
+}
+
+func (n *names) get(name string) *decl {
+	for n != nil {
+		switch {
+		case name < n.name:
+			n = n.left
+		case name > n.name:
+			n = n.right
+		default:
+			return n.decl
+		}
+	}
+
+	return nil
+}
+
+func (n *names) with(name string, d *decl) *names {
+	if n == nil {
+		return &names{name: name, decl: d, height: 1}
+	}
+
+	c := *n
+
+	switch {
+	case name < n.name:
+		c.left = n.left.with(name, d)
+	case name > n.name:
+		c.right = n.right.with(name, d)
+	default:
+		c.decl = d
+		return &c
+	}
+
+	return c.balance()
+}
+
+func (n *names) depth() int {
+	if n == nil {
+		return 0
+	}
+
+	return n.height
+}
+
+func (n *names) fixHeight() {
+	n.height = 1 + n.left.depth()
+	if h := 1 + n.right.depth(); h > n.height {
+		n.height = h
+	}
+}
+
+// balance returns n, a new node, rotated so that the heights of its subtrees
+// differ by at most one.
+func (n *names) balance() *names {
+	switch bf := n.left.depth() - n.right.depth(); {
+	case bf > 1:
+		if n.left.left.depth() < n.left.right.depth() {
+			n.left = n.left.rotateLeft()
+		}
+
+		return n.rotateRight()
+	case bf < -1:
+		if n.right.right.depth() < n.right.left.depth() {
+			n.right = n.right.rotateRight()
+		}
+
+		return n.rotateLeft()
+	}
+
+	n.fixHeight()
+	return n
+}
+
+// rotateRight returns a copy of n with its left child as the root. The nodes
+// are copied, since they may be shared with other tables.
+func (n *names) rotateRight() *names {
+	top, c := *n.left, *n
+
+	c.left = top.right
+	c.fixHeight()
+
+	top.right = &c
+	top.fixHeight()
+
+	return &top
+}
+
+// rotateLeft returns a copy of n with its right child as the root.
+func (n *names) rotateLeft() *names {
+	top, c := *n.right, *n
+
+	c.right = top.left
+	c.fixHeight()
+
+	top.left = &c
+	top.fixHeight()
+
+	return &top
+}
@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"net/url"
+	"strings"
+
+	p "github.com/lab47/peggysue"
+)
+
+const (
+	uriUnreserved = "-._~"
+	uriSubDelims  = "!$&'()*+,;="
+)
+
+func isAlpha(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+// uriChars returns a rule that matches one unreserved character, one of
+// extra, or a percent encoded byte.
+func uriChars(extra string) Rule {
+	return p.Or(
+		p.Rune(func(r rune) bool {
+			return isAlpha(r) || ('0' <= r && r <= '9') || strings.ContainsRune(uriUnreserved, r) || strings.ContainsRune(extra, r)
+		}),
+		p.Seq(p.S("%"), hexSet, hexSet),
+	)
+}
+
+// The rules below follow the ABNF in RFC 3986, appendix A.
+var (
+	uriScheme = p.Seq(p.Rune(isAlpha), p.Star(p.Rune(func(r rune) bool {
+		return isAlpha(r) || ('0' <= r && r <= '9') || r == '+' || r == '-' || r == '.'
+	})))
+
+	uriPchar = uriChars(uriSubDelims + ":@")
+
+	uriPathAbEmpty  = p.Star(p.Seq(p.S("/"), p.Star(uriPchar)))
+	uriPathAbsolute = p.Seq(p.S("/"), p.Maybe(p.Seq(p.Plus(uriPchar), uriPathAbEmpty)))
+	uriPathRootless = p.Seq(p.Plus(uriPchar), uriPathAbEmpty)
+	uriPathNoScheme = p.Seq(p.Plus(uriChars(uriSubDelims+"@")), uriPathAbEmpty)
+
+	uriIPvFuture = p.Seq(p.S("v"), p.Plus(hexSet), p.S("."), p.Plus(uriChars(uriSubDelims+":")))
+
+	uriHost = p.Or(
+		p.Seq(p.S("["), p.Or(IPv6, uriIPvFuture), p.S("]")),
+		p.Star(uriChars(uriSubDelims)),
+	)
+
+	uriAuthority = p.Seq(
+		p.Maybe(p.Seq(p.Star(uriChars(uriSubDelims+":")), p.S("@"))),
+		uriHost,
+		p.Maybe(p.Seq(p.S(":"), p.Star(p.Range('0', '9')))),
+	)
+
+	uriQuery = p.Seq(p.S("?"), p.Star(uriChars(uriSubDelims+":@/?")))
+
+	uriFragment = p.Seq(p.S("#"), p.Star(uriChars(uriSubDelims+":@/?")))
+
+	uriAbsolute = p.Seq(
+		uriScheme, p.S(":"),
+		p.Or(
+			p.Seq(p.S("//"), uriAuthority, uriPathAbEmpty),
+			uriPathAbsolute,
+			uriPathRootless,
+			p.S(""),
+		),
+		p.Maybe(uriQuery),
+		p.Maybe(uriFragment),
+	)
+
+	uriRelative = p.Seq(
+		p.Or(
+			p.Seq(p.S("//"), uriAuthority, uriPathAbEmpty),
+			uriPathAbsolute,
+			uriPathNoScheme,
+			p.S(""),
+		),
+		p.Maybe(uriQuery),
+		p.Maybe(uriFragment),
+	)
+
+	// URI parses an absolute URI as defined by RFC 3986, such as
+	// https://user@example.com:8080/a/b?q=1#top or mailto:me@example.com.
+	// The match stops at the first character that can't be part of a URI,
+	// so the rule can be embedded in larger grammars. A URI that is valid
+	// syntax but can't be represented by url.URL aborts the parse with a
+	// *peggysue.SemanticError.
+	//
+	// The value of the match is a *url.URL.
+	URI = makeURI(uriAbsolute)
+
+	// URIReference parses either an absolute URI or a relative reference,
+	// such as ../a/b?q=1, as defined by RFC 3986.
+	//
+	// The value of the match is a *url.URL.
+	URIReference = makeURI(p.Or(uriAbsolute, uriRelative))
+)
+
+func makeURI(r Rule) Rule {
+	return p.ActionErr(p.Named("uri", p.Capture(r)), func(v p.Values) (interface{}, error) {
+		return url.Parse(v.Get("uri").(string))
+	})
+}
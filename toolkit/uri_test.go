@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"net/url"
+	"testing"
+
+	p "github.com/lab47/peggysue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURI(t *testing.T) {
+	t.Run("parses absolute URIs", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		val, ok, err := pr.Parse(URI, "https://user:pw@example.com:8080/a/b%20c?q=1&r=2#top")
+		r.NoError(err)
+		r.True(ok)
+
+		u := val.(*url.URL)
+
+		r.Equal("https", u.Scheme)
+		r.Equal("user", u.User.Username())
+		r.Equal("example.com:8080", u.Host)
+		r.Equal("8080", u.Port())
+		r.Equal("/a/b c", u.Path)
+		r.Equal("q=1&r=2", u.RawQuery)
+		r.Equal("top", u.Fragment)
+
+		for _, in := range []string{
+			"mailto:me@example.com",
+			"urn:isbn:0451450523",
+			"file:///etc/hosts",
+			"http://[::1]:80/",
+			"http://192.168.0.1/",
+			"x:",
+		} {
+			val, ok, err := pr.Parse(URI, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+
+			expected, err := url.Parse(in)
+			r.NoError(err)
+
+			r.Equal(expected, val, in)
+		}
+
+		for _, in := range []string{"/a/b", "1http://x", "http://x/%zz", "http://x:8a/"} {
+			_, ok, _ := pr.Parse(URI, in)
+			r.False(ok, in)
+		}
+	})
+
+	t.Run("parses relative references", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		for _, in := range []string{"../a/b?q=1", "//example.com/x", "/abs", "#frag", "http://example.com"} {
+			val, ok, err := pr.Parse(URIReference, in)
+			r.NoError(err, in)
+			r.True(ok, in)
+
+			expected, err := url.Parse(in)
+			r.NoError(err)
+
+			r.Equal(expected, val, in)
+		}
+
+		_, ok, _ := pr.Parse(URI, "../a")
+		r.False(ok)
+	})
+
+	t.Run("stops at the end of an embedded URI", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := p.New()
+
+		link := p.Seq(p.S("<"), URI, p.S(">"))
+
+		val, ok, err := pr.Parse(link, "<http://example.com/x>")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("/x", val.(*url.URL).Path)
+
+		words := p.Seq(p.S("see "), p.Named("u", URI), p.S(" now"), p.Action(p.S(""), func(v p.Values) interface{} {
+			return v.Get("u")
+		}))
+
+		val, ok, err = pr.Parse(words, "see http://example.com now")
+		r.NoError(err)
+		r.True(ok)
+		r.Equal("example.com", val.(*url.URL).Host)
+	})
+}
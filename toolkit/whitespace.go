@@ -12,3 +12,93 @@ var (
 	IsWhiteSpace = p.Rune(unicode.IsSpace)
 	WS           = p.Star(IsWhiteSpace)
 )
+
+func isLineBreak(r rune) bool {
+	switch r {
+	case '\n', '\r', '\u0085', '\u2028', '\u2029':
+		return true
+	default:
+		return false
+	}
+}
+
+var (
+	// IsHorizontalSpace matches a single whitespace character that does
+	// not break a line, such as a space or a tab.
+	IsHorizontalSpace = p.Rune(func(r rune) bool {
+		return unicode.IsSpace(r) && !isLineBreak(r)
+	})
+
+	// HorizontalWS matches any amount of whitespace that does not include
+	// a line break. Statement oriented grammars use it where a newline is
+	// significant.
+	HorizontalWS = p.Star(IsHorizontalSpace)
+
+	// Newline matches a single line break, written as \n, \r\n, or \r.
+	Newline = p.Or(p.S("\r\n"), p.S("\n"), p.S("\r"))
+
+	// BlankLine matches a line that has nothing but whitespace on it,
+	// including the line break.
+	BlankLine = p.Seq(HorizontalWS, Newline)
+)
+
+// WSSpec describes what a grammar considers skippable between tokens.
+// Create one with NewWSSpec, adjust it with its methods, and call Rule to
+// get a rule that skips it.
+type WSSpec struct {
+	newlines      bool
+	lineComments  []string
+	blockComments [][2]string
+}
+
+// NewWSSpec returns a WSSpec that skips horizontal whitespace only.
+func NewWSSpec() *WSSpec {
+	return &WSSpec{}
+}
+
+// Newlines sets whether line breaks are skipped along with horizontal
+// whitespace.
+func (ws *WSSpec) Newlines(on bool) *WSSpec {
+	ws.newlines = on
+	return ws
+}
+
+// LineComment adds a comment that starts with prefix and runs to the end
+// of the line, such as // or #. The line break that ends the comment is
+// only skipped if Newlines is on.
+func (ws *WSSpec) LineComment(prefix string) *WSSpec {
+	ws.lineComments = append(ws.lineComments, prefix)
+	return ws
+}
+
+// BlockComment adds a comment that starts with open and ends with close,
+// such as /* and */. Block comments do not nest.
+func (ws *WSSpec) BlockComment(open, close string) *WSSpec {
+	ws.blockComments = append(ws.blockComments, [2]string{open, close})
+	return ws
+}
+
+// Rule returns a rule that matches any amount of what the spec skips,
+// including nothing.
+//
+// The value of the match is nil.
+func (ws *WSSpec) Rule() Rule {
+	alts := []Rule{p.Plus(IsHorizontalSpace)}
+
+	if ws.newlines {
+		alts = append(alts, Newline)
+	}
+
+	for _, prefix := range ws.lineComments {
+		alts = append(alts, p.Seq(p.S(prefix), p.Star(p.Rune(func(r rune) bool {
+			return !isLineBreak(r)
+		}))))
+	}
+
+	for _, bc := range ws.blockComments {
+		close := p.S(bc[1])
+		alts = append(alts, p.Seq(p.S(bc[0]), p.Star(p.Seq(p.Not(close), p.Any())), close))
+	}
+
+	return p.Star(p.Or(alts...))
+}
@@ -16,4 +16,55 @@ func TestWhitespace(t *testing.T) {
 		r.NoError(err)
 		r.True(ok)
 	})
+
+	t.Run("matches horizontal whitespace only", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		_, ok, err := p.Parse(HorizontalWS, " \t\u00a0")
+		r.NoError(err)
+		r.True(ok)
+
+		_, _, err = p.Parse(HorizontalWS, " \n")
+		r.Error(err)
+	})
+
+	t.Run("matches each style of newline", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New()
+
+		for _, in := range []string{"\n", "\r\n", "\r"} {
+			_, ok, err := p.Parse(Newline, in)
+			r.NoError(err)
+			r.True(ok)
+		}
+
+		_, ok, err := p.Parse(peggysue.Plus(BlankLine), "  \n\t\r\n\n")
+		r.NoError(err)
+		r.True(ok)
+	})
+
+	t.Run("composes whitespace and comments", func(t *testing.T) {
+		r := require.New(t)
+
+		p := peggysue.New(peggysue.WithPartial(true))
+
+		stmt := NewWSSpec().LineComment("//").BlockComment("/*", "*/").Rule()
+
+		_, ok, err := p.Parse(peggysue.Seq(stmt, Newline, peggysue.EOS()), " /* a\nb */ // done\n")
+		r.NoError(err)
+		r.True(ok)
+
+		all := NewWSSpec().Newlines(true).LineComment("#").Rule()
+
+		_, ok, err = p.Parse(peggysue.Seq(all, peggysue.S("x")), "# one\n  # two\r\n\tx")
+		r.NoError(err)
+		r.True(ok)
+
+		_, ok, err = p.Parse(peggysue.Seq(NewWSSpec().Rule(), peggysue.S("x")), " \nx")
+		r.NoError(err)
+		r.False(ok)
+	})
 }
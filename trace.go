@@ -0,0 +1,50 @@
+package peggysue
+
+// Tracer is called as Refs are matched, to observe how the parser
+// processes the input.
+type Tracer interface {
+	// Enter is called when the parser begins matching the named Ref at pos.
+	Enter(rule string, pos Pos)
+
+	// Exit is called when the Ref entered most recently has finished
+	// matching. If the Ref matched, end is the position after the input
+	// it matched. memoized indicates if the result was reused from an
+	// earlier attempt at the same position.
+	Exit(rule string, start, end Pos, matched, memoized bool)
+}
+
+// WithTracer sets a Tracer to be called as Refs are matched. Tracing slows
+// down parsing considerably, so it is intended for debugging grammars.
+func WithTracer(t Tracer) Option {
+	return func(p *Parser) {
+		p.tracer = t
+	}
+}
+
+func (m *matchRef) matchTraced(s *state) result {
+	t := s.p.tracer
+
+	pos := s.mark()
+	start := s.position(pos.pos)
+
+	var memoized bool
+
+	if memo, ok := s.memos[pos.pos][m]; ok && memo.store == pos.store {
+		memoized = true
+	}
+
+	name := m.Name()
+
+	t.Enter(name, start)
+
+	res := m.matchMemo(s)
+
+	end := start
+	if res.matched {
+		end = s.position(s.pos)
+	}
+
+	t.Exit(name, start, end, res.matched, memoized)
+
+	return res
+}
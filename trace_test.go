@@ -0,0 +1,47 @@
+package peggysue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testTracer struct {
+	events []string
+}
+
+func (t *testTracer) Enter(rule string, pos Pos) {
+	t.events = append(t.events, fmt.Sprintf("enter %s %d", rule, pos.Offset))
+}
+
+func (t *testTracer) Exit(rule string, start, end Pos, matched, memoized bool) {
+	t.events = append(t.events, fmt.Sprintf("exit %s %d-%d %v %v", rule, start.Offset, end.Offset, matched, memoized))
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("reports refs as they are matched", func(t *testing.T) {
+		r := require.New(t)
+
+		num := R("num")
+		num.Set(Plus(Range('0', '9')))
+
+		sum := R("sum")
+		sum.Set(Or(Seq(num, S("+"), num), num))
+
+		var tr testTracer
+
+		_, ok, err := New(WithTracer(&tr)).Parse(sum, "12")
+		r.NoError(err)
+		r.True(ok)
+
+		r.Equal([]string{
+			"enter sum 0",
+			"enter num 0",
+			"exit num 0-2 true false",
+			"enter num 0",
+			"exit num 0-2 true true",
+			"exit sum 0-2 true false",
+		}, tr.events)
+	})
+}
@@ -0,0 +1,214 @@
+package peggysue
+
+// Node is a node of the tree returned by ParseTree.
+type Node struct {
+	// Rule is the name of the Ref that matched the node. It is empty for
+	// Error nodes, and for the root if the rule it was parsed with has no
+	// name.
+	Rule string
+
+	// Span is the input covered by the node.
+	Span Span
+
+	// Err is set if the node is an Error node, describing why the input
+	// it covers could not be parsed.
+	Err error
+
+	Parent   *Node
+	Children []*Node
+}
+
+// IsError reports whether n is an Error node.
+func (n *Node) IsError() bool {
+	return n.Err != nil
+}
+
+// At returns the innermost node within n that covers offset, a byte offset
+// in the input. A node covers the offsets from the start of its span up to,
+// but not including, the end, except that the root also covers the end of
+// the input. It returns nil if n does not cover offset.
+//
+// The chain of Parents of the node gives the context at offset, such as the
+// declaration that contains an identifier that's being hovered over.
+func (n *Node) At(offset int) *Node {
+	if !n.covers(offset) && !(n.Parent == nil && offset == n.Span.End.Offset) {
+		return nil
+	}
+
+	for {
+		var next *Node
+
+		for _, c := range n.Children {
+			if c.covers(offset) {
+				next = c
+				break
+			}
+		}
+
+		if next == nil {
+			return n
+		}
+
+		n = next
+	}
+}
+
+func (n *Node) covers(offset int) bool {
+	return offset >= n.Span.Start.Offset && offset < n.Span.End.Offset
+}
+
+// Errors returns the Error nodes within n, in the order they appear in the
+// input.
+func (n *Node) Errors() []*Node {
+	var errs []*Node
+
+	n.Walk(func(n *Node) bool {
+		if n.IsError() {
+			errs = append(errs, n)
+		}
+
+		return true
+	})
+
+	return errs
+}
+
+// ParseTree parses the input with the rule and returns a tree of the named
+// Refs that matched, with the spans of input that they matched. Unlike
+// Parse, it always returns a tree covering the entire input, even when the
+// input is invalid, which is what editor features such as hover, outlines,
+// and completion need.
+//
+// Input that could not be parsed becomes an Error node. These are created
+// for the input skipped by Recover rules, so a grammar that uses Recover to
+// resynchronize keeps the structure of the input around the error. Any input
+// after where the rule stopped matching, or all of the input if it did not
+// match at all, becomes an Error node at the end of the root. If parsing is
+// aborted, such as by exceeding a limit, the root contains a single Error
+// node describing why.
+//
+// The root node is the rule that was parsed with, and covers all of the
+// input. Actions are run as usual, but their values are not part of the
+// tree.
+func (p *Parser) ParseTree(r Rule, input string) *Node {
+	if err := p.checkInputSize(len(input)); err != nil {
+		root := &Node{
+			Rule: r.Name(),
+			Span: Span{
+				Start: Pos{Line: 1, Column: 1, Filename: p.filename},
+				End:   Pos{Offset: len(input), Filename: p.filename},
+			},
+		}
+
+		root.Children = []*Node{{Span: root.Span, Err: err, Parent: root}}
+
+		return root
+	}
+
+	s := p.newState(input, p.filename)
+
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	s.recordRef = func(name string) bool {
+		return name != ""
+	}
+
+	res := s.run(r)
+
+	root := &Node{
+		Rule: r.Name(),
+		Span: Span{Start: s.position(0), End: s.position(s.inputSize)},
+	}
+
+	var end int
+
+	switch {
+	case s.err != nil:
+		root.Children = []*Node{{Span: root.Span, Err: s.err, Parent: root}}
+		return root
+	case !res.matched:
+		end = 0
+	default:
+		end = s.pos
+	}
+
+	spans := s.sortedSpans()
+
+	// The rule itself, if it's a named Ref, is the root.
+	if len(spans) > 0 && spans[0].start == 0 && spans[0].end == end &&
+		spans[0].err == nil && spans[0].rule == root.Rule {
+		spans = spans[1:]
+	}
+
+	if !res.matched {
+		spans = nil
+	}
+
+	tb := &treeBuilder{s: s, spans: spans}
+	tb.children(root, 0, end)
+
+	if end < s.inputSize {
+		var err error
+		if res.matched {
+			err = s.notConsumed()
+		} else {
+			err = s.noMatch()
+		}
+
+		root.Children = append(root.Children, &Node{
+			Span:   Span{Start: s.position(end), End: root.Span.End},
+			Err:    err,
+			Parent: root,
+		})
+	}
+
+	return root
+}
+
+type treeBuilder struct {
+	s     *state
+	spans []*spanList
+	next  int
+}
+
+// children adds the nodes for the spans within start and end to parent.
+func (tb *treeBuilder) children(parent *Node, start, end int) {
+	pos := start
+
+	for tb.next < len(tb.spans) && tb.spans[tb.next].start < end {
+		sl := tb.spans[tb.next]
+		tb.next++
+
+		// Spans never partially overlap, but be defensive about it.
+		if sl.start < pos || sl.end > end {
+			continue
+		}
+
+		n := &Node{
+			Rule:   sl.rule,
+			Span:   Span{Start: tb.s.position(sl.start), End: tb.s.position(sl.end)},
+			Err:    sl.err,
+			Parent: parent,
+		}
+
+		parent.Children = append(parent.Children, n)
+
+		tb.children(n, sl.start, sl.end)
+
+		pos = sl.end
+	}
+}
+
+// Walk calls fn for n and the nodes within it, in the order they appear in
+// the input, with parents before their children. If fn returns false, the
+// children of the node are skipped.
+func (n *Node) Walk(fn func(n *Node) bool) {
+	if !fn(n) {
+		return
+	}
+
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
@@ -0,0 +1,175 @@
+package peggysue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// treeString formats a tree as an s-expression of rule names and the text
+// of leaves, with Error nodes shown as !.
+func treeString(n *Node, input string) string {
+	name := n.Rule
+	if n.IsError() {
+		name = "!"
+	}
+
+	if len(n.Children) == 0 {
+		return fmt.Sprintf("%s%q", name, input[n.Span.Start.Offset:n.Span.End.Offset])
+	}
+
+	var parts []string
+	for _, c := range n.Children {
+		parts = append(parts, treeString(c, input))
+	}
+
+	return "(" + name + " " + strings.Join(parts, " ") + ")"
+}
+
+func TestRecover(t *testing.T) {
+	ws := Star(S(" "))
+
+	stmt := R("stmt")
+	stmt.Set(Seq(Plus(Range('a', 'z')), ws, S(";"), ws))
+
+	program := Star(Recover(stmt, Seq(S(";"), ws)))
+
+	t.Run("skips input that does not match", func(t *testing.T) {
+		r := require.New(t)
+
+		pr := New().Run(Seq(program, EOS()), "a; 12; b;")
+		r.True(pr.Matched)
+		r.Len(pr.Errors, 1)
+
+		var re *RecoveredError
+		r.ErrorAs(pr.Errors[0], &re)
+		r.Equal(3, re.Span.Start.Offset)
+		r.Equal(7, re.Span.End.Offset)
+		r.True(errors.Is(re, ErrNoMatch))
+
+		_, ok, err := New().Parse(program, "a; 12; b;")
+		r.True(ok)
+		r.ErrorAs(err, &re)
+
+		_, ok, err = New().Parse(program, "a; b;")
+		r.True(ok)
+		r.NoError(err)
+	})
+
+	t.Run("discards errors in abandoned alternatives", func(t *testing.T) {
+		r := require.New(t)
+
+		rule := Or(Seq(Recover(S("x"), S(";")), S("!")), Seq(Plus(Range('0', '9')), S(";")))
+
+		_, ok, err := New().Parse(rule, "12;")
+		r.True(ok)
+		r.NoError(err)
+	})
+
+	t.Run("stops at the sync rule", func(t *testing.T) {
+		r := require.New(t)
+
+		_, ok, err := New().Parse(Recover(stmt, S(";")), "")
+		r.False(ok)
+		r.NoError(err)
+
+		// A sync rule that matches no input stops before it.
+		rule := Seq(Recover(stmt, Check(S("}"))), S("}"))
+
+		pr := New().Run(rule, "1 2}")
+		r.True(pr.Matched)
+		r.Len(pr.Errors, 1)
+
+		// Nor does it skip past the input it stops at.
+		block := Seq(S("{"), Star(Recover(Seq(S("a"), S(";")), Check(S("}")))), S("}"))
+
+		pr = New().Run(block, "{a;}")
+		r.True(pr.Matched)
+		r.Empty(pr.Errors)
+
+		pr = New().Run(block, "{a;b}")
+		r.True(pr.Matched)
+		r.Len(pr.Errors, 1)
+	})
+}
+
+func TestParseTree(t *testing.T) {
+	ws := Star(S(" "))
+
+	ident := R("ident")
+	ident.Set(Seq(Plus(Range('a', 'z')), ws))
+
+	number := R("number")
+	number.Set(Seq(Plus(Range('0', '9')), ws))
+
+	assign := R("assign")
+	assign.Set(Seq(ident, S("="), ws, Or(number, ident), S(";"), ws))
+
+	program := R("program")
+	program.Set(Seq(ws, Star(Recover(assign, Seq(S(";"), ws))), EOS()))
+
+	t.Run("builds a tree of named rules", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "a = 1; b = a;"
+
+		root := New().ParseTree(program, input)
+		r.Equal(`(program (assign ident"a " number"1") (assign ident"b " ident"a"))`, treeString(root, input))
+		r.Empty(root.Errors())
+		r.Equal(len(input), root.Span.End.Offset)
+	})
+
+	t.Run("includes errors in the tree", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "a = 1; b = = 2; c = 3;"
+
+		root := New().ParseTree(program, input)
+		r.Equal(`(program (assign ident"a " number"1") !"b = = 2; " (assign ident"c " number"3"))`, treeString(root, input))
+
+		errs := root.Errors()
+		r.Len(errs, 1)
+		r.Equal(7, errs[0].Span.Start.Offset)
+
+		var re *RecoveredError
+		r.ErrorAs(errs[0].Err, &re)
+	})
+
+	t.Run("covers input that was not parsed", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "a = 1; 2"
+
+		root := New().ParseTree(Seq(ws, Star(assign)), input)
+		r.Equal(`( (assign ident"a " number"1") !"2")`, treeString(root, input))
+		r.ErrorIs(root.Errors()[0].Err, ErrPartialInput)
+
+		root = New().ParseTree(assign, "=")
+		r.Equal(`(assign !"=")`, treeString(root, "="))
+		r.ErrorIs(root.Errors()[0].Err, ErrNoMatch)
+
+		root = New(WithMaxInputSize(1)).ParseTree(assign, "a=1;")
+		r.Len(root.Errors(), 1)
+	})
+
+	t.Run("finds the node at an offset", func(t *testing.T) {
+		r := require.New(t)
+
+		input := "a = 1; bc = a;"
+
+		root := New().ParseTree(program, input)
+
+		n := root.At(8)
+		r.Equal("ident", n.Rule)
+		r.Equal("assign", n.Parent.Rule)
+		r.Equal(root, n.Parent.Parent)
+
+		r.Equal("assign", root.At(5).Rule)
+		r.Equal(root, root.At(len(input)))
+		r.Nil(root.At(len(input) + 1))
+		r.Nil(n.At(0))
+	})
+}
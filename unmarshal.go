@@ -0,0 +1,364 @@
+package peggysue
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Unmarshal parses the input with the rule, as Parse does, and stores the
+// result in the value pointed to by dest, much as encoding/json does for
+// JSON. This lets a grammar be used to fill in an existing Go type without
+// writing an action for every rule.
+//
+// The value of the rule is stored in dest, unless dest is a struct and the
+// value is not something a struct can be filled in from, such as the value
+// of the last rule in a Seq. Then the struct is filled in from the named
+// values of the rule, such as those created with Named, in the same way as
+// Apply: each exported field gets the value of the same name, or the name
+// given by its `ast:` tag.
+//
+// Values are stored in dest using these conversions, applied recursively:
+//
+//   - A value that's assignable to the destination is assigned.
+//   - Pointers are allocated as needed.
+//   - A []interface{}, such as the value of Collect, fills in a slice.
+//   - Values, a map[string]interface{}, or another struct fills in a
+//     struct, by field name or `ast:` tag.
+//   - A string, such as the value of Capture, is parsed into a number or
+//     bool, and numbers are converted between numeric types.
+//
+// A value that can't be stored in its destination is reported as an error
+// naming the field.
+func (p *Parser) Unmarshal(r Rule, input string, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("can not unmarshal into %T: not a non-nil pointer", dest)
+	}
+
+	if err := p.checkInputSize(len(input)); err != nil {
+		return err
+	}
+
+	s := p.newState(input, p.filename)
+
+	defer returnValues(s.values)
+	defer s.finishProgress()
+
+	res := s.run(r)
+	if s.err != nil {
+		return s.err
+	}
+
+	if !res.matched {
+		return s.noMatch()
+	}
+
+	if s.pos != s.inputSize && !p.partial {
+		return s.notConsumed()
+	}
+
+	if errs := s.recovered(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	s.runNodeHooks()
+
+	var src interface{} = s.values
+	if res.value != nil && !(isStruct(rv.Type()) && !isStructSource(res.value)) {
+		src = res.value
+	}
+
+	return unmarshalValue(rv.Elem(), src, "")
+}
+
+// isStruct reports whether typ is a struct or a pointer to one.
+func isStruct(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Struct
+}
+
+// isStructSource reports whether v can fill in a struct.
+func isStructSource(v interface{}) bool {
+	switch v.(type) {
+	case Values, map[string]interface{}:
+		return true
+	default:
+		return isStruct(reflect.TypeOf(v))
+	}
+}
+
+// Unmarshal stores the tree rooted at n, which was returned by ParseTree for
+// input, in the struct pointed to by dest. Each exported field is filled in
+// from the children of n matched by the rule of the same name, or the name
+// given by its `ast:` tag. A string field gets the text of the first such
+// child, a struct field is filled in from the first child's own children,
+// and a slice field gets an element for each child. Strings are converted
+// to numbers and bools as they are by Parser.Unmarshal.
+//
+// Error nodes are skipped, so a tree with errors fills in what it can.
+func (n *Node) Unmarshal(input string, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("can not unmarshal into %T: not a non-nil pointer", dest)
+	}
+
+	return unmarshalValue(rv.Elem(), &nodeText{n: n, input: input}, "")
+}
+
+// nodeText is the source of values when unmarshaling a tree.
+type nodeText struct {
+	n     *Node
+	input string
+}
+
+func (nt *nodeText) text() string {
+	return nt.input[nt.n.Span.Start.Offset:nt.n.Span.End.Offset]
+}
+
+func (nt *nodeText) children(rule string) []*nodeText {
+	var out []*nodeText
+
+	for _, c := range nt.n.Children {
+		if c.Rule == rule && !c.IsError() {
+			out = append(out, &nodeText{n: c, input: nt.input})
+		}
+	}
+
+	return out
+}
+
+// fieldName returns the name of the value that fills in the field.
+func fieldName(ft reflect.StructField) string {
+	if name := ft.Tag.Get("ast"); name != "" {
+		return name
+	}
+
+	return ft.Name
+}
+
+func unmarshalValue(dst reflect.Value, src interface{}, field string) error {
+	if src == nil {
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+
+		return unmarshalValue(dst.Elem(), src, field)
+	}
+
+	switch src := src.(type) {
+	case *nodeText:
+		return unmarshalNode(dst, src, field)
+	case string:
+		if ok, err := unmarshalString(dst, src); ok {
+			if err != nil {
+				return fmt.Errorf("can not unmarshal %q into %s: %w", src, fieldDesc(dst, field), err)
+			}
+
+			return nil
+		}
+	case []interface{}:
+		if dst.Kind() == reflect.Slice {
+			out := reflect.MakeSlice(dst.Type(), len(src), len(src))
+
+			for i, v := range src {
+				if err := unmarshalValue(out.Index(i), v, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+					return err
+				}
+			}
+
+			dst.Set(out)
+			return nil
+		}
+	case Values:
+		if dst.Kind() == reflect.Struct {
+			return unmarshalStruct(dst, src.Get, field)
+		}
+	case map[string]interface{}:
+		if dst.Kind() == reflect.Struct {
+			return unmarshalStruct(dst, func(name string) interface{} { return src[name] }, field)
+		}
+	}
+
+	switch {
+	case sv.Kind() == reflect.Pointer && !sv.IsNil():
+		return unmarshalValue(dst, sv.Elem().Interface(), field)
+	case sv.Kind() == reflect.Struct && dst.Kind() == reflect.Struct:
+		return unmarshalStruct(dst, structGetter(sv), field)
+	case isNumber(sv.Kind()) && isNumber(dst.Kind()):
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("can not unmarshal %T into %s", src, fieldDesc(dst, field))
+}
+
+func fieldDesc(dst reflect.Value, field string) string {
+	if field == "" {
+		return dst.Type().String()
+	}
+
+	return fmt.Sprintf("field %s of type %s", field, dst.Type())
+}
+
+func unmarshalStruct(dst reflect.Value, get func(name string) interface{}, field string) error {
+	typ := dst.Type()
+
+	for i := 0; i < dst.NumField(); i++ {
+		ft := typ.Field(i)
+
+		if !ft.IsExported() {
+			continue
+		}
+
+		path := ft.Name
+		if field != "" {
+			path = field + "." + ft.Name
+		}
+
+		if err := unmarshalValue(dst.Field(i), get(fieldName(ft)), path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// structGetter returns a function that gets the fields of the struct sv by
+// name or `ast:` tag.
+func structGetter(sv reflect.Value) func(name string) interface{} {
+	typ := sv.Type()
+
+	return func(name string) interface{} {
+		for i := 0; i < sv.NumField(); i++ {
+			ft := typ.Field(i)
+
+			if ft.IsExported() && fieldName(ft) == name {
+				return sv.Field(i).Interface()
+			}
+		}
+
+		return nil
+	}
+}
+
+func unmarshalNode(dst reflect.Value, src *nodeText, field string) error {
+	switch dst.Kind() {
+	case reflect.Struct:
+		typ := dst.Type()
+
+		for i := 0; i < dst.NumField(); i++ {
+			ft := typ.Field(i)
+
+			if !ft.IsExported() {
+				continue
+			}
+
+			path := ft.Name
+			if field != "" {
+				path = field + "." + ft.Name
+			}
+
+			children := src.children(fieldName(ft))
+			if len(children) == 0 {
+				continue
+			}
+
+			fv := dst.Field(i)
+
+			if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+				out := reflect.MakeSlice(fv.Type(), len(children), len(children))
+
+				for j, c := range children {
+					if err := unmarshalValue(out.Index(j), c, fmt.Sprintf("%s[%d]", path, j)); err != nil {
+						return err
+					}
+				}
+
+				fv.Set(out)
+				continue
+			}
+
+			if err := unmarshalValue(fv, children[0], path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return unmarshalValue(dst, src.text(), field)
+	}
+}
+
+// unmarshalString stores str in dst, parsing it if dst is a number or a
+// bool. It returns false if dst is not a kind that a string can be stored
+// in.
+func unmarshalString(dst reflect.Value, str string) (bool, error) {
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(str)
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() != reflect.Uint8 {
+			return false, nil
+		}
+
+		dst.SetBytes([]byte(str))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return true, err
+		}
+
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 0, dst.Type().Bits())
+		if err != nil {
+			return true, err
+		}
+
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(str, 0, dst.Type().Bits())
+		if err != nil {
+			return true, err
+		}
+
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, dst.Type().Bits())
+		if err != nil {
+			return true, err
+		}
+
+		dst.SetFloat(f)
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,133 @@
+package peggysue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshal(t *testing.T) {
+	ws := Star(S(" "))
+	word := Capture(Plus(Range('a', 'z')))
+	num := Capture(Plus(Range('0', '9')))
+
+	type Server struct {
+		Host string `ast:"host"`
+		Port uint16 `ast:"port"`
+		TLS  bool   `ast:"tls"`
+	}
+
+	server := Seq(
+		Named("host", word), S(":"), Named("port", num),
+		Maybe(Seq(S(" tls="), Named("tls", word))),
+	)
+
+	t.Run("fills in a struct from named values", func(t *testing.T) {
+		r := require.New(t)
+
+		var srv Server
+		r.NoError(New().Unmarshal(server, "example:8080 tls=true", &srv))
+		r.Equal(Server{Host: "example", Port: 8080, TLS: true}, srv)
+
+		var ptr *Server
+		r.NoError(New().Unmarshal(server, "local:1", &ptr))
+		r.Equal(&Server{Host: "local", Port: 1}, ptr)
+	})
+
+	t.Run("fills in nested structs and slices", func(t *testing.T) {
+		r := require.New(t)
+
+		type Config struct {
+			Name    string    `ast:"name"`
+			Servers []*Server `ast:"servers"`
+			Weights []float64 `ast:"weights"`
+		}
+
+		// Apply requires the values to match the types of the fields, so
+		// the port is a string until it's stored in a Server.
+		type serverNode struct {
+			Host string `ast:"host"`
+			Port string `ast:"port"`
+		}
+
+		config := Seq(
+			Named("name", word), ws, S("{"), ws,
+			Named("servers", Collect(Star(Seq(Apply(server, serverNode{}), ws)))),
+			S("}"), ws,
+			Named("weights", Collect(Star(Seq(num, ws)))),
+		)
+
+		var cfg Config
+		r.NoError(New().Unmarshal(config, "prod { a:1 b:2 } 3 4", &cfg))
+		r.Equal("prod", cfg.Name)
+		r.Equal([]*Server{{Host: "a", Port: 1}, {Host: "b", Port: 2}}, cfg.Servers)
+		r.Equal([]float64{3, 4}, cfg.Weights)
+	})
+
+	t.Run("stores the value of the rule", func(t *testing.T) {
+		r := require.New(t)
+
+		var ports []int
+		r.NoError(New().Unmarshal(Collect(Star(Seq(num, ws))), "1 22 333", &ports))
+		r.Equal([]int{1, 22, 333}, ports)
+
+		var str string
+		r.NoError(New().Unmarshal(word, "abc", &str))
+		r.Equal("abc", str)
+	})
+
+	t.Run("reports values that can not be stored", func(t *testing.T) {
+		r := require.New(t)
+
+		var srv Server
+		err := New().Unmarshal(server, "example:99999", &srv)
+		r.ErrorContains(err, `can not unmarshal "99999" into field Port of type uint16`)
+
+		err = New().Unmarshal(server, "example:1 tls=maybe", &srv)
+		r.ErrorContains(err, "field TLS")
+
+		var n int
+		err = New().Unmarshal(Collect(Star(num)), "1", &n)
+		r.ErrorContains(err, "can not unmarshal []interface {} into int")
+
+		r.ErrorContains(New().Unmarshal(word, "abc", srv), "not a non-nil pointer")
+
+		r.ErrorIs(New().Unmarshal(word, "12", &srv), ErrNoMatch)
+		r.ErrorIs(New().Unmarshal(word, "ab 12", &srv), ErrPartialInput)
+	})
+
+	t.Run("fills in a struct from a tree", func(t *testing.T) {
+		r := require.New(t)
+
+		key := R("key")
+		key.Set(Plus(Range('a', 'z')))
+
+		value := R("value")
+		value.Set(Plus(Range('0', '9')))
+
+		entry := R("entry")
+		entry.Set(Seq(key, S("="), value, ws))
+
+		section := R("section")
+		section.Set(Seq(S("["), key, S("]"), ws, Star(Recover(entry, S(" ")))))
+
+		type Entry struct {
+			Key   string `ast:"key"`
+			Value int    `ast:"value"`
+		}
+
+		type Section struct {
+			Name    string  `ast:"key"`
+			Entries []Entry `ast:"entry"`
+		}
+
+		input := "[main] a=1 b=x c=3"
+
+		root := New().ParseTree(section, input)
+		r.Len(root.Errors(), 1)
+
+		var sec Section
+		r.NoError(root.Unmarshal(input, &sec))
+		r.Equal(Section{Name: "main", Entries: []Entry{{Key: "a", Value: 1}, {Key: "c", Value: 3}}}, sec)
+	})
+}
@@ -0,0 +1,94 @@
+package peggysue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NoProgressError is returned when the progress watchdog enabled with
+// WithProgressCheck detects a rule that would loop without consuming input.
+type NoProgressError struct {
+	// Pos is the position where no progress was made.
+	Pos Pos
+
+	// Rule is the name of the rule that failed to make progress, or the
+	// name of the Ref that contains it if the rule is unnamed.
+	Rule string
+
+	// Expr is the printed form of the rule.
+	Expr string
+}
+
+func (e *NoProgressError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s: no progress matching %s", e.Pos, e.Expr)
+	}
+
+	return fmt.Sprintf("%s: %s: no progress matching %s", e.Pos, e.Rule, e.Expr)
+}
+
+// WithProgressCheck enables a watchdog that detects grammar bugs which would
+// otherwise cause the parser to hang or silently fail. When a repetition
+// (Star, Plus, Many, and their variants) matches its sub-rule without
+// consuming any input, or a left recursive Ref grows without consuming any
+// input, parsing stops and a NoProgressError is returned.
+func WithProgressCheck(on bool) Option {
+	return func(p *Parser) {
+		p.progressCheck = on
+	}
+}
+
+// noProgress aborts parsing because m matched at bp without consuming input.
+func (s *state) noProgress(m Rule, bp int) {
+	name := m.Name()
+	if name == "" && s.curRef != nil {
+		name = s.curRef.Name()
+	}
+
+	s.abort(&NoProgressError{
+		Pos:  s.position(bp),
+		Rule: name,
+		Expr: m.print(),
+	})
+}
+
+// ErrCanceled is returned when parsing is stopped because the channel passed
+// to WithCancel was closed.
+var ErrCanceled = errors.New("parse canceled")
+
+// cancelInterval is the number of rules matched between checks of the
+// channel passed to WithCancel.
+const cancelInterval = 1024
+
+// WithCancel stops parsing with ErrCanceled once done is closed, such as the
+// Done channel of a context.Context. This allows a parse that takes too long,
+// such as one that backtracks exponentially, to be stopped rather than left
+// running. To keep the overhead low, done is only checked every few
+// thousand rules matched.
+func WithCancel(done <-chan struct{}) Option {
+	return func(p *Parser) {
+		p.cancel = done
+	}
+}
+
+// checkCancel wraps s.match to abort parsing once the channel passed to
+// WithCancel is closed.
+func (s *state) checkCancel() {
+	done := s.p.cancel
+	match := s.match
+	n := 0
+
+	s.match = func(r Rule) result {
+		if n++; n == cancelInterval {
+			n = 0
+
+			select {
+			case <-done:
+				s.abort(ErrCanceled)
+			default:
+			}
+		}
+
+		return match(r)
+	}
+}
@@ -0,0 +1,90 @@
+package peggysue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressCheck(t *testing.T) {
+	p := New(WithProgressCheck(true))
+
+	t.Run("detects repetitions that do not consume input", func(t *testing.T) {
+		r := require.New(t)
+
+		items := R("items")
+		items.Set(Star(Seq(S("a"), Maybe(S(",")))))
+
+		_, ok, err := p.Parse(items, "a,a")
+		r.NoError(err)
+		r.True(ok)
+
+		for _, rule := range []Rule{
+			Star(Maybe(S("a"))),
+			Plus(Maybe(S("a"))),
+			StarCapture(Maybe(S("a"))),
+			Fold(func() interface{} { return nil }, Maybe(S("a")), func(acc, v interface{}) interface{} { return acc }),
+		} {
+			items := R("items")
+			items.Set(Seq(S("x"), rule))
+
+			_, ok, err := p.Parse(items, "xaab")
+			r.False(ok)
+
+			var np *NoProgressError
+			r.ErrorAs(err, &np)
+			r.Equal("items", np.Rule)
+			r.Equal(3, np.Pos.Offset)
+			r.Equal(Print(rule), np.Expr)
+		}
+
+		named := Star(Maybe(S("a")))
+		named.SetName("as")
+
+		_, _, err = p.Parse(named, "b")
+
+		var np *NoProgressError
+		r.ErrorAs(err, &np)
+		r.Equal("1:1: as: no progress matching \"a\"?*", err.Error())
+	})
+
+	t.Run("detects left recursion that does not consume input", func(t *testing.T) {
+		r := require.New(t)
+
+		list := R("list")
+		list.Set(Or(Seq(list, S(","), S("a")), Maybe(S("a"))))
+
+		_, ok, err := p.Parse(Seq(S("x"), list), "x,a")
+		r.False(ok)
+
+		var np *NoProgressError
+		r.ErrorAs(err, &np)
+		r.Equal("list", np.Rule)
+		r.Equal(1, np.Pos.Offset)
+
+		_, ok, err = New().Parse(Seq(S("x"), list), "x,a")
+		r.NoError(err)
+		r.False(ok)
+	})
+}
+
+func TestCancel(t *testing.T) {
+	t.Run("stops parsing when canceled", func(t *testing.T) {
+		r := require.New(t)
+
+		input := strings.Repeat("a", 10000)
+
+		done := make(chan struct{})
+
+		_, ok, err := New(WithCancel(done)).Parse(Star(S("a")), input)
+		r.NoError(err)
+		r.True(ok)
+
+		close(done)
+
+		_, ok, err = New(WithCancel(done)).Parse(Star(S("a")), input)
+		r.False(ok)
+		r.ErrorIs(err, ErrCanceled)
+	})
+}